@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestUsers(t *testing.T) {
+	s := newTestServer(t)
+
+	var users []User
+	s.expect("GET", "/users", s.viewer, nil, http.StatusOK, &users)
+	if len(users) != 2 {
+		t.Fatalf("%d Benutzer, erwartet admin und viewer", len(users))
+	}
+
+	var created User
+	s.expect("POST", "/users", s.admin, map[string]string{"username": " erika ", "password": "geheim", "role": "viewer"}, http.StatusCreated, &created)
+	if created.Username != "erika" || created.Role != "viewer" {
+		t.Errorf("angelegt: %+v", created)
+	}
+	s.login("erika", "geheim")
+
+	for name, body := range map[string]map[string]string{
+		"doppelt":          {"username": "erika", "password": "x", "role": "viewer"},
+		"ohne Namen":       {"username": " ", "password": "x", "role": "viewer"},
+		"ohne Passwort":    {"username": "max", "role": "viewer"},
+		"unbekannte Rolle": {"username": "max", "password": "x", "role": "root"},
+	} {
+		want := http.StatusBadRequest
+		if name == "doppelt" {
+			want = http.StatusConflict
+		}
+		resp := s.do("POST", "/users", s.admin, body)
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("%s: Status %d statt %d", name, resp.StatusCode, want)
+		}
+	}
+
+	// Ohne Passwort bleibt das bisherige erhalten
+	path := fmt.Sprintf("/users/%d", created.ID)
+	var updated User
+	s.expect("PUT", path, s.admin, map[string]string{"username": "erika.m", "role": "admin"}, http.StatusOK, &updated)
+	if updated.Username != "erika.m" || updated.Role != "admin" {
+		t.Errorf("geändert: %+v", updated)
+	}
+	s.login("erika.m", "geheim")
+	s.expect("PUT", path, s.admin, map[string]string{"username": "erika.m", "password": "neu", "role": "admin"}, http.StatusOK, nil)
+	s.login("erika.m", "neu")
+
+	s.expect("PUT", path, s.admin, map[string]string{"username": "viewer", "role": "admin"}, http.StatusConflict, nil)
+	s.expect("PUT", "/users/999", s.admin, map[string]string{"username": "x", "role": "viewer"}, http.StatusNotFound, nil)
+	s.expect("PUT", path, s.admin, strings.NewReader("{"), http.StatusBadRequest, nil)
+
+	s.expect("DELETE", path, s.admin, nil, http.StatusNoContent, nil)
+	s.expect("DELETE", path, s.admin, nil, http.StatusNotFound, nil)
+	resp := s.do("POST", "/login", "", map[string]string{"username": "erika.m", "password": "neu"})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Anmeldung eines gelöschten Benutzers: Status %d", resp.StatusCode)
+	}
+}
+
+func TestLastAdminProtection(t *testing.T) {
+	s := newTestServer(t)
+	second := s.createUser("zweiter", "admin")
+	secondToken := s.login("zweiter", "zweiter")
+
+	// Der einzige Admin kann sich nicht selbst herabstufen oder löschen
+	s.expect("PUT", fmt.Sprintf("/users/%d", second.ID), s.admin, map[string]string{"username": "zweiter", "role": "viewer"}, http.StatusOK, nil)
+	s.expect("PUT", "/users/1", s.admin, map[string]string{"username": "admin", "role": "viewer"}, http.StatusBadRequest, nil)
+	s.expect("DELETE", "/users/1", s.admin, nil, http.StatusBadRequest, nil)
+
+	// Ein Token aus der Zeit als Admin gilt weiter, darf aber den letzten Admin nicht löschen
+	body := s.expect("DELETE", "/users/1", secondToken, nil, http.StatusBadRequest, nil)
+	if !strings.Contains(body, "letzte Admin") {
+		t.Errorf("Meldung: %s", body)
+	}
+	s.expect("PUT", "/users/1", secondToken, map[string]string{"username": "admin", "role": "viewer"}, http.StatusBadRequest, nil)
+
+	// Mit einem zweiten Admin ist beides möglich
+	s.expect("PUT", fmt.Sprintf("/users/%d", second.ID), s.admin, map[string]string{"username": "zweiter", "role": "admin"}, http.StatusOK, nil)
+	s.expect("PUT", "/users/1", secondToken, map[string]string{"username": "admin", "role": "viewer"}, http.StatusOK, nil)
+	s.expect("PUT", "/users/1", secondToken, map[string]string{"username": "admin", "role": "admin"}, http.StatusOK, nil)
+	s.expect("DELETE", "/users/1", secondToken, nil, http.StatusNoContent, nil)
+
+	var users []User
+	s.expect("GET", "/users", secondToken, nil, http.StatusOK, &users)
+	admins := 0
+	for _, u := range users {
+		if u.Role == "admin" {
+			admins++
+		}
+	}
+	if admins != 1 {
+		t.Errorf("%d Admins übrig", admins)
+	}
+}
+
+func TestUserRepositoryDelete(t *testing.T) {
+	repos := setupTestDB(t)
+	ctx := context.Background()
+
+	admin, err := repos.Users.FirstAdmin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Users.Delete(ctx, admin.ID, admin.ID); !errors.Is(err, errValidation) {
+		t.Errorf("eigenen Account gelöscht: %v", err)
+	}
+	if err := repos.Users.Delete(ctx, admin.ID, 0); !errors.Is(err, errValidation) {
+		t.Errorf("letzten Admin gelöscht: %v", err)
+	}
+	if err := repos.Users.Delete(ctx, 999, admin.ID); !errors.Is(err, errNotFound) {
+		t.Errorf("unbekannten Benutzer gelöscht: %v", err)
+	}
+}
+
+// TestDeleteUserKeepsReferences löscht einen Benutzer, der Verträge verantwortet,
+// Dokumente hochgeladen und Protokolleinträge erzeugt hat.
+func TestDeleteUserKeepsReferences(t *testing.T) {
+	s := newTestServer(t)
+	user := s.createUser("erika", "admin")
+	token := s.login("erika", "erika")
+
+	var c Contract
+	s.expect("POST", "/contracts", token, map[string]interface{}{"title": "Wartung", "contract_type": "individual",
+		"category": "IT", "partner": "ACME"}, http.StatusCreated, &c)
+	s.expect("POST", fmt.Sprintf("/contracts/%d/documents", c.ID), token, uploadForm(t, "vertrag.pdf", testPDF("erika"), nil), http.StatusCreated, nil)
+	trashed := s.createContract(nil)
+	s.expect("DELETE", fmt.Sprintf("/contracts/%d", trashed.ID), token, nil, http.StatusNoContent, nil)
+
+	s.expect("DELETE", fmt.Sprintf("/users/%d", user.ID), s.admin, nil, http.StatusNoContent, nil)
+
+	var got Contract
+	s.expect("GET", fmt.Sprintf("/contracts/%d", c.ID), s.admin, nil, http.StatusOK, &got)
+	if got.OwnerID != nil {
+		t.Errorf("Verantwortlicher %d nach dem Löschen", *got.OwnerID)
+	}
+	var entries []AuditEntry
+	s.expect("GET", fmt.Sprintf("/audit-log?event=%s&entity_id=%d", auditContractDeleted, trashed.ID), s.admin, nil, http.StatusOK, &entries)
+	if len(entries) != 1 || entries[0].UserID != nil || entries[0].UserName == nil || *entries[0].UserName != "erika" {
+		t.Errorf("Prüfprotokoll: %+v", entries)
+	}
+	s.expect("POST", fmt.Sprintf("/contracts/%d/restore", trashed.ID), s.admin, nil, http.StatusOK, nil)
+}
+
+func TestContracts(t *testing.T) {
+	s := newTestServer(t)
+
+	framework := s.createContract(map[string]interface{}{"title": "Rahmenvertrag", "contract_type": "framework",
+		"valid_from": "2024-01-01T00:00:00Z", "notice_period": 3, "term_months": 12, "minimum_term": "2025-01-01T00:00:00Z"})
+	if framework.ContractNumber != "V000001" {
+		t.Errorf("Vertragsnummer %s", framework.ContractNumber)
+	}
+	single := s.createContract(map[string]interface{}{"title": "Einzelvertrag", "framework_contract_id": framework.ID,
+		"valid_from": "2024-03-01T00:00:00Z", "annual_cost": 1200.5})
+	if single.ContractNumber != "V000002" || single.FrameworkContractID == nil || *single.FrameworkContractID != framework.ID {
+		t.Errorf("Einzelvertrag: %+v", single)
+	}
+	if single.OwnerID == nil || *single.OwnerID != 1 {
+		t.Errorf("Verantwortlicher %v, erwartet den anlegenden Admin", single.OwnerID)
+	}
+
+	var got Contract
+	s.expect("GET", fmt.Sprintf("/contracts/%d", single.ID), s.viewer, nil, http.StatusOK, &got)
+	if got.Title != "Einzelvertrag" || got.AnnualCost == nil || *got.AnnualCost != 1200.5 {
+		t.Errorf("gelesen: %+v", got)
+	}
+	s.expect("GET", "/contracts/999", s.viewer, nil, http.StatusNotFound, nil)
+	s.expect("GET", "/contracts/abc", s.viewer, nil, http.StatusNotFound, nil)
+
+	for name, body := range map[string]map[string]interface{}{
+		"Vertragstyp":         {"title": "x", "contract_type": "sonstiges"},
+		"negative Frist":      {"title": "x", "contract_type": "individual", "notice_period": -1},
+		"negative Laufzeit":   {"title": "x", "contract_type": "individual", "term_months": -1},
+		"Datum":               {"title": "x", "contract_type": "individual", "valid_from": "morgen"},
+		"Kündigungsfrist Typ": {"title": "x", "contract_type": "individual", "notice_period": "3 Monate"},
+		"Rahmenvertrag fehlt": {"title": "x", "contract_type": "individual", "framework_contract_id": 999},
+		"Benutzer fehlt":      {"title": "x", "contract_type": "individual", "owner_id": 999},
+	} {
+		resp := s.do("POST", "/contracts", s.admin, body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: Status %d statt 400", name, resp.StatusCode)
+		}
+	}
+
+	var updated Contract
+	s.expect("PUT", fmt.Sprintf("/contracts/%d", single.ID), s.admin, map[string]interface{}{"title": "Einzelvertrag 2",
+		"contract_type": "individual", "category": "IT", "partner": "ACME", "valid_from": "2024-03-01T00:00:00Z"}, http.StatusOK, &updated)
+	if updated.Title != "Einzelvertrag 2" || updated.ContractNumber != single.ContractNumber {
+		t.Errorf("geändert: %+v", updated)
+	}
+	s.expect("PUT", "/contracts/999", s.admin, map[string]interface{}{"title": "x", "contract_type": "individual"}, http.StatusNotFound, nil)
+
+	var list []Contract
+	s.expect("GET", "/contracts?contract_type=framework", s.viewer, nil, http.StatusOK, &list)
+	if len(list) != 1 || list[0].ID != framework.ID {
+		t.Errorf("Filter contract_type: %+v", list)
+	}
+	s.expect("GET", "/contracts?search=Einzelvertrag", s.viewer, nil, http.StatusOK, &list)
+	if len(list) != 1 || list[0].ID != single.ID {
+		t.Errorf("Filter search: %+v", list)
+	}
+
+	var calc struct {
+		Updated int `json:"updated"`
+	}
+	s.expect("POST", "/contracts/calculate-dates", s.admin, nil, http.StatusOK, &calc)
+	if calc.Updated != 1 {
+		t.Errorf("%d Kündigungstermine berechnet, erwartet 1", calc.Updated)
+	}
+	s.expect("GET", fmt.Sprintf("/contracts/%d", framework.ID), s.viewer, nil, http.StatusOK, &got)
+	if got.CancellationDate == nil || got.CancellationActionDate == nil ||
+		got.CancellationActionDate.AddDate(0, 3, 0).Format("2006-01-02") != got.CancellationDate.Format("2006-01-02") {
+		t.Errorf("Kündigungstermine %v / %v", got.CancellationDate, got.CancellationActionDate)
+	}
+
+	s.expect("POST", fmt.Sprintf("/contracts/%d/terminate", single.ID), s.admin, nil, http.StatusOK, nil)
+	s.expect("GET", fmt.Sprintf("/contracts/%d", single.ID), s.viewer, nil, http.StatusOK, &got)
+	if !got.IsTerminated || got.TerminatedAt == nil {
+		t.Errorf("nicht beendet: %+v", got)
+	}
+	s.expect("POST", "/contracts/999/terminate", s.admin, nil, http.StatusNotFound, nil)
+
+	var expiring []Contract
+	s.expect("GET", "/reports/expiring?days=36500", s.viewer, nil, http.StatusOK, &expiring)
+}
+
+func TestCategories(t *testing.T) {
+	s := newTestServer(t)
+
+	var categories []Category
+	s.expect("GET", "/categories", s.viewer, nil, http.StatusOK, &categories)
+	if len(categories) != 3 {
+		t.Errorf("Standardkategorien: %+v", categories)
+	}
+
+	var cat Category
+	s.expect("POST", "/categories", s.admin, map[string]string{"name": " Leasing "}, http.StatusCreated, &cat)
+	if cat.Name != "Leasing" {
+		t.Errorf("angelegt: %+v", cat)
+	}
+	s.expect("POST", "/categories", s.admin, map[string]string{"name": "Leasing"}, http.StatusConflict, nil)
+	s.expect("POST", "/categories", s.admin, map[string]string{"name": ""}, http.StatusBadRequest, nil)
+
+	c := s.createContract(map[string]interface{}{"category": "Leasing"})
+	path := fmt.Sprintf("/categories/%d", cat.ID)
+	s.expect("PUT", path, s.admin, map[string]string{"name": "Fahrzeugleasing"}, http.StatusOK, nil)
+	var got Contract
+	s.expect("GET", fmt.Sprintf("/contracts/%d", c.ID), s.viewer, nil, http.StatusOK, &got)
+	if got.Category != "Fahrzeugleasing" {
+		t.Errorf("Kategorie des Vertrags: %s", got.Category)
+	}
+	s.expect("PUT", path, s.admin, map[string]string{"name": "IT"}, http.StatusConflict, nil)
+	s.expect("PUT", "/categories/999", s.admin, map[string]string{"name": "x"}, http.StatusNotFound, nil)
+
+	// In Verwendung: erst nach dem Vertrag löschbar, endgültig erst ohne Vertrag im Papierkorb
+	s.expect("DELETE", path, s.admin, nil, http.StatusConflict, nil)
+	s.expect("DELETE", fmt.Sprintf("/contracts/%d", c.ID), s.admin, nil, http.StatusNoContent, nil)
+	s.expect("DELETE", path, s.admin, nil, http.StatusNoContent, nil)
+	s.expect("POST", "/categories", s.admin, map[string]string{"name": "Fahrzeugleasing"}, http.StatusConflict, nil)
+	s.expect("DELETE", fmt.Sprintf("/trash/categories/%d", cat.ID), s.admin, nil, http.StatusConflict, nil)
+
+	s.expect("POST", path+"/restore", s.admin, nil, http.StatusOK, nil)
+	s.expect("POST", path+"/restore", s.admin, nil, http.StatusNotFound, nil)
+	s.expect("DELETE", fmt.Sprintf("/trash/contracts/%d", c.ID), s.admin, nil, http.StatusNoContent, nil)
+	s.expect("DELETE", path, s.admin, nil, http.StatusNoContent, nil)
+	s.expect("DELETE", fmt.Sprintf("/trash/categories/%d", cat.ID), s.admin, nil, http.StatusNoContent, nil)
+	s.expect("POST", "/categories", s.admin, map[string]string{"name": "Fahrzeugleasing"}, http.StatusCreated, nil)
+}
+
+func TestTrash(t *testing.T) {
+	s := newTestServer(t)
+	framework := s.createContract(map[string]interface{}{"contract_type": "framework"})
+	single := s.createContract(map[string]interface{}{"framework_contract_id": framework.ID})
+
+	s.expect("DELETE", fmt.Sprintf("/contracts/%d", framework.ID), s.admin, nil, http.StatusConflict, nil)
+	s.expect("DELETE", fmt.Sprintf("/contracts/%d", single.ID), s.admin, nil, http.StatusNoContent, nil)
+	s.expect("DELETE", fmt.Sprintf("/contracts/%d", single.ID), s.admin, nil, http.StatusNotFound, nil)
+	s.expect("GET", fmt.Sprintf("/contracts/%d", single.ID), s.viewer, nil, http.StatusNotFound, nil)
+	s.expect("DELETE", fmt.Sprintf("/contracts/%d", framework.ID), s.admin, nil, http.StatusNoContent, nil)
+
+	var trash []struct {
+		Type string `json:"type"`
+		ID   int    `json:"id"`
+	}
+	s.expect("GET", "/trash", s.admin, nil, http.StatusOK, &trash)
+	if len(trash) != 2 {
+		t.Errorf("Papierkorb: %+v", trash)
+	}
+
+	// Der Einzelvertrag kommt erst nach seinem Rahmenvertrag zurück
+	s.expect("POST", fmt.Sprintf("/contracts/%d/restore", single.ID), s.admin, nil, http.StatusConflict, nil)
+	s.expect("POST", fmt.Sprintf("/contracts/%d/restore", framework.ID), s.admin, nil, http.StatusOK, nil)
+	s.expect("POST", fmt.Sprintf("/contracts/%d/restore", single.ID), s.admin, nil, http.StatusOK, nil)
+	s.expect("POST", fmt.Sprintf("/contracts/%d/restore", single.ID), s.admin, nil, http.StatusNotFound, nil)
+
+	s.expect("DELETE", fmt.Sprintf("/trash/contracts/%d", single.ID), s.admin, nil, http.StatusNotFound, nil)
+	s.expect("DELETE", fmt.Sprintf("/contracts/%d", single.ID), s.admin, nil, http.StatusNoContent, nil)
+	s.expect("DELETE", fmt.Sprintf("/trash/contracts/%d", single.ID), s.admin, nil, http.StatusNoContent, nil)
+	s.expect("POST", fmt.Sprintf("/contracts/%d/restore", single.ID), s.admin, nil, http.StatusNotFound, nil)
+
+	// Legal Hold sperrt das Löschen
+	s.expect("PUT", fmt.Sprintf("/contracts/%d/legal-hold", framework.ID), s.admin, map[string]interface{}{"legal_hold": true, "reason": "Rechtsstreit"}, http.StatusOK, nil)
+	s.expect("DELETE", fmt.Sprintf("/contracts/%d", framework.ID), s.admin, nil, http.StatusConflict, nil)
+	s.expect("PUT", fmt.Sprintf("/contracts/%d/legal-hold", framework.ID), s.admin, map[string]interface{}{"legal_hold": false}, http.StatusOK, nil)
+	s.expect("DELETE", fmt.Sprintf("/contracts/%d", framework.ID), s.admin, nil, http.StatusNoContent, nil)
+}
+
+func TestDocuments(t *testing.T) {
+	s := newTestServer(t)
+	c := s.createContract(nil)
+	contractPath := fmt.Sprintf("/contracts/%d/documents", c.ID)
+
+	var doc Document
+	s.expect("POST", contractPath, s.admin, uploadForm(t, "vertrag.pdf", testPDF("v1"),
+		map[string]string{"document_type": "contract", "description": "Original"}), http.StatusCreated, &doc)
+	if doc.Version != 1 || doc.Filename != "vertrag.pdf" || doc.Description != "Original" || doc.SHA256 == nil {
+		t.Errorf("hochgeladen: %+v", doc)
+	}
+	s.expect("POST", "/contracts/999/documents", s.admin, uploadForm(t, "vertrag.pdf", testPDF("x"), nil), http.StatusNotFound, nil)
+	s.expect("POST", contractPath, s.admin, uploadForm(t, "vertrag.pdf", testPDF("x"),
+		map[string]string{"document_type": "unbekannt"}), http.StatusBadRequest, nil)
+
+	var docs []Document
+	s.expect("GET", contractPath, s.viewer, nil, http.StatusOK, &docs)
+	if len(docs) != 1 || docs[0].ID != doc.ID {
+		t.Fatalf("Dokumente: %+v", docs)
+	}
+
+	docPath := fmt.Sprintf("/documents/%d", doc.ID)
+	if body := s.expect("GET", docPath+"/download", s.viewer, nil, http.StatusOK, nil); body != string(testPDF("v1")) {
+		t.Errorf("heruntergeladen: %q", body)
+	}
+
+	// Neue Version; dieselbe Datei noch einmal ist ein Konflikt
+	s.expect("POST", docPath+"/versions", s.admin, uploadForm(t, "vertrag-2.pdf", testPDF("v2"), nil), http.StatusCreated, &doc)
+	if doc.Version != 2 || doc.Filename != "vertrag-2.pdf" || doc.Description != "Original" {
+		t.Errorf("Version 2: %+v", doc)
+	}
+	s.expect("POST", docPath+"/versions", s.admin, uploadForm(t, "vertrag-2.pdf", testPDF("v2"), nil), http.StatusConflict, nil)
+
+	var versions []DocumentVersion
+	s.expect("GET", docPath+"/versions", s.viewer, nil, http.StatusOK, &versions)
+	if len(versions) != 2 || versions[0].Version != 2 || versions[1].Version != 1 {
+		t.Errorf("Versionen: %+v", versions)
+	}
+	if body := s.expect("GET", docPath+"/versions/1/download", s.viewer, nil, http.StatusOK, nil); body != string(testPDF("v1")) {
+		t.Errorf("Version 1: %q", body)
+	}
+	if body := s.expect("GET", docPath+"/download", s.viewer, nil, http.StatusOK, nil); body != string(testPDF("v2")) {
+		t.Errorf("aktuelle Version: %q", body)
+	}
+	s.expect("GET", docPath+"/versions/3/download", s.viewer, nil, http.StatusNotFound, nil)
+
+	s.expect("PUT", docPath, s.admin, map[string]string{"document_type": "amendment", "description": " Nachtrag "}, http.StatusOK, &doc)
+	if doc.DocumentType != "amendment" || doc.Description != "Nachtrag" {
+		t.Errorf("geändert: %+v", doc)
+	}
+	s.expect("PUT", docPath, s.admin, map[string]string{"document_type": "unbekannt"}, http.StatusBadRequest, nil)
+	s.expect("PUT", "/documents/999", s.admin, map[string]string{"description": "x"}, http.StatusNotFound, nil)
+
+	// Solange das Dokument existiert, kann der Vertrag nicht gelöscht werden
+	s.expect("DELETE", fmt.Sprintf("/contracts/%d", c.ID), s.admin, nil, http.StatusConflict, nil)
+
+	s.expect("DELETE", docPath, s.admin, nil, http.StatusNoContent, nil)
+	s.expect("DELETE", docPath, s.admin, nil, http.StatusNotFound, nil)
+	s.expect("GET", docPath, s.viewer, nil, http.StatusNotFound, nil)
+	s.expect("GET", docPath+"/download", s.viewer, nil, http.StatusNotFound, nil)
+	if body := s.expect("GET", docPath+"/download", s.admin, nil, http.StatusOK, nil); body != string(testPDF("v2")) {
+		t.Errorf("gelöschtes Dokument für Admins: %q", body)
+	}
+	s.expect("GET", docPath+"/versions/1/download", s.admin, nil, http.StatusOK, nil)
+	s.expect("GET", contractPath+"?deleted=true", s.viewer, nil, http.StatusForbidden, nil)
+	s.expect("GET", contractPath+"?deleted=true", s.admin, nil, http.StatusOK, &docs)
+	if len(docs) != 1 {
+		t.Errorf("gelöschte Dokumente: %+v", docs)
+	}
+	s.expect("POST", docPath+"/restore", s.admin, nil, http.StatusOK, nil)
+	s.expect("POST", docPath+"/restore", s.admin, nil, http.StatusNotFound, nil)
+	s.expect("GET", docPath, s.viewer, nil, http.StatusOK, nil)
+
+	s.expect("PUT", fmt.Sprintf("/contracts/%d/legal-hold", c.ID), s.admin, map[string]interface{}{"legal_hold": true, "reason": "Prüfung"}, http.StatusOK, nil)
+	s.expect("DELETE", docPath, s.admin, nil, http.StatusConflict, nil)
+}
+
+func TestUploadLimits(t *testing.T) {
+	s := newTestServer(t)
+	c := s.createContract(nil)
+	path := fmt.Sprintf("/contracts/%d/documents", c.ID)
+
+	s.expect("POST", path, s.admin, uploadForm(t, "programm.exe", []byte("MZ\x90\x00"), nil), http.StatusUnsupportedMediaType, nil)
+	s.expect("POST", path, s.admin, uploadForm(t, "falsch.pdf", []byte("kein PDF"), nil), http.StatusUnsupportedMediaType, nil)
+
+	big := bytes.Repeat([]byte("a"), int(maxUploadSize)+1)
+	resp := s.do("POST", path, s.admin, uploadForm(t, "gross.pdf", append(testPDF("gross"), big...), nil))
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("zu große Datei: Status %d statt 413", resp.StatusCode)
+	}
+}
+
+// stubScanner liest nur die ersten limit Byte und meldet dann signature.
+type stubScanner struct {
+	limit     int64
+	signature string
+}
+
+func (s stubScanner) Scan(ctx context.Context, r io.Reader) (string, error) {
+	_, err := io.Copy(io.Discard, io.LimitReader(r, s.limit))
+	return s.signature, err
+}
+
+func (s stubScanner) String() string { return "stub" }
+
+// TestUploadScannerStopsEarly stellt sicher, dass ein Scanner, der vor dem Ende der
+// Datei aufhört zu lesen, den Upload nicht mit einem Serverfehler abbricht.
+func TestUploadScannerStopsEarly(t *testing.T) {
+	s := newTestServer(t)
+	t.Cleanup(func() { scanner = nil })
+	c := s.createContract(nil)
+	path := fmt.Sprintf("/contracts/%d/documents", c.ID)
+	content := append(testPDF("scan"), bytes.Repeat([]byte("a"), 256<<10)...)
+
+	scanner = stubScanner{limit: 16}
+	s.expect("POST", path, s.admin, uploadForm(t, "vertrag.pdf", content, nil), http.StatusServiceUnavailable, nil)
+
+	scanner = stubScanner{limit: 16, signature: "Eicar-Test-Signature"}
+	s.expect("POST", path, s.admin, uploadForm(t, "vertrag.pdf", content, nil), http.StatusUnprocessableEntity, nil)
+	var quarantined []QuarantinedUpload
+	s.expect("GET", "/quarantine", s.admin, nil, http.StatusOK, &quarantined)
+	if len(quarantined) != 1 || quarantined[0].Signature != "Eicar-Test-Signature" || quarantined[0].FileSize != int64(len(content)) {
+		t.Errorf("Quarantäne: %+v", quarantined)
+	}
+
+	scanner = stubScanner{limit: int64(len(content))}
+	s.expect("POST", path, s.admin, uploadForm(t, "vertrag.pdf", content, nil), http.StatusCreated, nil)
+}
+
+// TestContractListScanError stellt sicher, dass eine nicht lesbare Zeile die Liste
+// mit einem Fehler abbricht, statt sie stillschweigend zu verkürzen.
+func TestContractListScanError(t *testing.T) {
+	s := newTestServer(t)
+	skipUnlessSQLite(t, s.repos.db)
+	s.createContract(nil)
+	broken := s.createContract(nil)
+	if _, err := s.repos.db.Exec("UPDATE contracts SET valid_from = 'kein Datum' WHERE id = ?", broken.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := s.repos.Contracts.List(context.Background(), "1 = 1", nil, listOptions{Sort: []string{"id"}}); err == nil {
+		t.Error("List ohne Fehler")
+	}
+	s.expect("GET", "/contracts", s.admin, nil, http.StatusInternalServerError, nil)
+}
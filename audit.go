@@ -0,0 +1,122 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Ereignisse im Prüfprotokoll
+const (
+	auditContractDeleted      = "contract.deleted" // in den Papierkorb verschoben
+	auditContractRestored     = "contract.restored"
+	auditContractPurged       = "contract.purged" // Grabstein eines endgültig gelöschten Vertrags
+	auditCategoryDeleted      = "category.deleted"
+	auditCategoryRestored     = "category.restored"
+	auditCategoryPurged       = "category.purged"
+	auditDocumentPurged       = "document.purged" // Grabstein eines endgültig gelöschten Dokuments
+	auditLegalHoldSet         = "legal_hold.set"
+	auditLegalHoldReleased    = "legal_hold.released"
+	auditRetentionRejected    = "retention.rejected" // Löschvorschlag abgelehnt
+	auditRetentionRuleCreated = "retention_rule.created"
+	auditRetentionRuleUpdated = "retention_rule.updated"
+	auditRetentionRuleDeleted = "retention_rule.deleted"
+)
+
+const maxAuditEntries = 500
+
+// AuditEntry ist ein Eintrag im Prüfprotokoll. Einträge werden nie geändert oder
+// gelöscht; details enthält keine personenbezogenen Vertragsdaten.
+type AuditEntry struct {
+	ID        int             `json:"id"`
+	Event     string          `json:"event"`
+	Entity    string          `json:"entity"` // contract, document, category, retention_rule
+	EntityID  *int            `json:"entity_id"`
+	UserID    *int            `json:"user_id"`
+	UserName  *string         `json:"user_name"`
+	Details   json.RawMessage `json:"details"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// execer ist *DB oder *Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// writeAudit schreibt einen Eintrag ins Prüfprotokoll, innerhalb der Transaktion
+// der protokollierten Änderung, wenn eine übergeben wird.
+func writeAudit(ex execer, event, entity string, entityID, userID int, details interface{}) error {
+	data, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	// Der Name bleibt erhalten, wenn der Benutzer später gelöscht wird
+	_, err = ex.Exec(`INSERT INTO audit_log (event, entity, entity_id, user_id, user_name, details, created_at)
+		VALUES (?, ?, ?, ?, (SELECT username FROM users WHERE id = ?), ?, ?)`,
+		event, entity, nullableID(entityID), nullableID(userID), nullableID(userID), string(data), time.Now())
+	return err
+}
+
+// auditHandlers bedient das Prüfprotokoll.
+type auditHandlers struct {
+	db *DB
+}
+
+// list liefert das Prüfprotokoll, neueste Einträge zuerst. Gefiltert wird mit
+// entity, entity_id und event.
+func (h *auditHandlers) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	where := "1 = 1"
+	var args []interface{}
+	if entity := q.Get("entity"); entity != "" {
+		where += " AND a.entity = ?"
+		args = append(args, entity)
+	}
+	if id := q.Get("entity_id"); id != "" {
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			http.Error(w, "ungültiger Wert für entity_id: "+id, http.StatusBadRequest)
+			return
+		}
+		where += " AND a.entity_id = ?"
+		args = append(args, n)
+	}
+	if event := q.Get("event"); event != "" {
+		where += " AND a.event = ?"
+		args = append(args, event)
+	}
+	limit := 100
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			http.Error(w, "ungültiger Wert für limit: "+l, http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxAuditEntries)
+	}
+
+	rows, err := h.db.Query(`SELECT a.id, a.event, a.entity, a.entity_id, a.user_id, a.user_name, a.details, a.created_at
+		FROM audit_log a
+		WHERE `+where+` ORDER BY a.id DESC LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var details string
+		if err := rows.Scan(&e.ID, &e.Event, &e.Entity, &e.EntityID, &e.UserID, &e.UserName, &details, &e.CreatedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		e.Details = json.RawMessage(details)
+		entries = append(entries, e)
+	}
+
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,694 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Aufbau eines Sicherungsarchivs (tar.gz): zuerst das Manifest, dann die Datenbank,
+// dann alle Dateien des Dokumentenspeichers unter files/<Schlüssel>.
+const (
+	backupFormat       = 1
+	backupManifestName = "manifest.json"
+	backupDatabaseName = "contracts.db"
+	backupFilesPrefix  = "files/"
+)
+
+const defaultBackupKeep = 7
+
+var backupNamePattern = regexp.MustCompile(`^vertragsdb-\d{8}-\d{6}\.tar\.gz$`)
+
+var (
+	backupDir      string
+	backupInterval time.Duration // 0 = keine geplanten Sicherungen
+	backupKeep     int           // 0 = alle Sicherungen behalten
+)
+
+// backupMu verhindert parallele Sicherungen.
+var backupMu sync.Mutex
+
+// Sicherungen enthalten eine Kopie der SQLite-Datei. Eine PostgreSQL-Datenbank wird mit
+// ihren eigenen Werkzeugen gesichert, die Dokumente mit denen des Speichers.
+var errBackupUnsupported = errors.New("Sicherungen sind nur mit SQLite möglich; PostgreSQL z. B. mit pg_dump sichern")
+
+// loadBackupConfig liest VERTRAGSDB_BACKUP_DIR, VERTRAGSDB_BACKUP_INTERVAL_HOURS und
+// VERTRAGSDB_BACKUP_KEEP.
+func loadBackupConfig() error {
+	backupDir = os.Getenv("VERTRAGSDB_BACKUP_DIR")
+	if backupDir == "" {
+		backupDir = "./backups"
+	}
+
+	backupInterval = 0
+	if v := os.Getenv("VERTRAGSDB_BACKUP_INTERVAL_HOURS"); v != "" {
+		hours, err := strconv.Atoi(v)
+		if err != nil || hours < 0 {
+			return fmt.Errorf("VERTRAGSDB_BACKUP_INTERVAL_HOURS: ungültiger Wert %q", v)
+		}
+		backupInterval = time.Duration(hours) * time.Hour
+	}
+
+	backupKeep = defaultBackupKeep
+	if v := os.Getenv("VERTRAGSDB_BACKUP_KEEP"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("VERTRAGSDB_BACKUP_KEEP: ungültiger Wert %q", v)
+		}
+		backupKeep = n
+	}
+	return nil
+}
+
+// backupManifest beschreibt den Inhalt eines Sicherungsarchivs.
+type backupManifest struct {
+	Format         int          `json:"format"`
+	CreatedAt      time.Time    `json:"created_at"`
+	SchemaVersion  int          `json:"schema_version"`
+	DatabaseSHA256 string       `json:"database_sha256"`
+	DatabaseSize   int64        `json:"database_size"`
+	Storage        string       `json:"storage"` // Backend, aus dem die Dateien stammen
+	Files          []backupFile `json:"files"`
+	Missing        []string     `json:"missing,omitempty"` // in der Datenbank verzeichnet, aber nicht im Speicher
+}
+
+type backupFile struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+}
+
+// BackupInfo ist eine Sicherung im Sicherungsverzeichnis.
+type BackupInfo struct {
+	Name          string    `json:"name"`
+	Size          int64     `json:"size"` // Größe des Archivs in Byte
+	CreatedAt     time.Time `json:"created_at"`
+	SchemaVersion int       `json:"schema_version"`
+	Files         int       `json:"files"`
+	MissingFiles  int       `json:"missing_files"`
+}
+
+func (m *backupManifest) info(name string, size int64) BackupInfo {
+	return BackupInfo{
+		Name: name, Size: size, CreatedAt: m.CreatedAt, SchemaVersion: m.SchemaVersion,
+		Files: len(m.Files), MissingFiles: len(m.Missing),
+	}
+}
+
+// rawStorage liefert das Backend ohne Verschlüsselung. Gesichert werden die Dateien
+// so, wie sie im Speicher liegen; die Datenschlüssel stehen in der Datenbank.
+func rawStorage(s Storage) Storage {
+	if es, ok := s.(*encryptedStorage); ok {
+		return es.inner
+	}
+	return s
+}
+
+// createBackup sichert die Datenbank mit VACUUM INTO als konsistenten Stand und
+// danach alle Dateien, auf die dieser Stand verweist. Der Server kann dabei weiter
+// schreiben; neue Dateien gehören erst zur nächsten Sicherung.
+func createBackup(ctx context.Context, db *DB, files Storage) (*BackupInfo, error) {
+	if db.Dialect.Name() != "sqlite" {
+		return nil, errBackupUnsupported
+	}
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
+	if err := os.MkdirAll(backupDir, 0o700); err != nil {
+		return nil, err
+	}
+	tmpDir, err := os.MkdirTemp("", "vertragsdb-backup-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	snapshot := filepath.Join(tmpDir, backupDatabaseName)
+	if _, err := db.Exec("VACUUM INTO ?", snapshot); err != nil {
+		return nil, fmt.Errorf("Datenbank nicht gesichert: %w", err)
+	}
+
+	now := time.Now()
+	m := backupManifest{Format: backupFormat, CreatedAt: now, Storage: files.String()}
+	if m.DatabaseSHA256, m.DatabaseSize, err = hashFile(snapshot); err != nil {
+		return nil, err
+	}
+	keys, err := snapshotContents(snapshot, &m.SchemaVersion)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		info, err := files.Stat(ctx, key)
+		if errors.Is(err, errStorageNotFound) {
+			log.Printf("Sicherung: %s fehlt im Speicher", key)
+			m.Missing = append(m.Missing, key)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		m.Files = append(m.Files, backupFile{Key: key, Size: info.Size})
+	}
+
+	name := "vertragsdb-" + now.Format("20060102-150405") + ".tar.gz"
+	target := filepath.Join(backupDir, name)
+	if _, err := os.Stat(target); err == nil {
+		return nil, fmt.Errorf("Sicherung %s existiert bereits", name)
+	}
+	tmp, err := os.CreateTemp(backupDir, ".backup-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = writeBackupArchive(ctx, tmp, &m, snapshot, files)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return nil, err
+	}
+
+	st, err := os.Stat(target)
+	if err != nil {
+		return nil, err
+	}
+	info := m.info(name, st.Size())
+	return &info, nil
+}
+
+// snapshotContents liest Schema-Version und alle Speicherschlüssel aus der
+// gesicherten Datenbank, auch die gelöschter Dokumente und der Quarantäne.
+func snapshotContents(path string, version *int) ([]string, error) {
+	sdb, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	defer sdb.Close()
+
+	if err := sdb.QueryRow("PRAGMA user_version").Scan(version); err != nil {
+		return nil, err
+	}
+	rows, err := sdb.Query(`SELECT storage_key FROM document_versions
+		UNION SELECT thumbnail_key FROM document_versions WHERE thumbnail_key != ''
+		UNION SELECT storage_key FROM documents
+		UNION SELECT storage_key FROM quarantined_uploads
+		ORDER BY 1`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+func writeBackupArchive(ctx context.Context, w io.Writer, m *backupManifest, snapshot string, files Storage) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeTarEntry(tw, backupManifestName, int64(len(data)), m.CreatedAt, bytes.NewReader(data)); err != nil {
+		return err
+	}
+
+	f, err := os.Open(snapshot)
+	if err != nil {
+		return err
+	}
+	err = writeTarEntry(tw, backupDatabaseName, m.DatabaseSize, m.CreatedAt, f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range m.Files {
+		r, _, err := files.Get(ctx, file.Key)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.Key, err)
+		}
+		err = writeTarEntry(tw, backupFilesPrefix+file.Key, file.Size, m.CreatedAt, r)
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.Key, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func writeTarEntry(tw *tar.Writer, name string, size int64, modTime time.Time, r io.Reader) error {
+	err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Size: size, Mode: 0o600, ModTime: modTime})
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(tw, r)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("Größe hat sich während der Sicherung geändert (%d statt %d Byte)", n, size)
+	}
+	return nil
+}
+
+// readBackupManifest liest das Manifest am Anfang eines Archivs. Der zurückgegebene
+// tar.Reader steht danach auf dem nächsten Eintrag.
+func readBackupManifest(r io.Reader) (*backupManifest, *tar.Reader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("kein Sicherungsarchiv: %w", err)
+	}
+	tr := tar.NewReader(gz)
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != backupManifestName {
+		return nil, nil, errors.New("kein Sicherungsarchiv: Manifest fehlt")
+	}
+	var m backupManifest
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return nil, nil, fmt.Errorf("Manifest nicht lesbar: %w", err)
+	}
+	if m.Format != backupFormat {
+		return nil, nil, fmt.Errorf("unbekanntes Sicherungsformat %d", m.Format)
+	}
+	return &m, tr, nil
+}
+
+// listBackups liefert die Sicherungen im Sicherungsverzeichnis, neueste zuerst.
+func listBackups() ([]BackupInfo, error) {
+	entries, err := os.ReadDir(backupDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []BackupInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []BackupInfo{}
+	for _, e := range entries {
+		if !backupNamePattern.MatchString(e.Name()) {
+			continue
+		}
+		info, err := readBackupInfo(e.Name())
+		if err != nil {
+			log.Printf("Sicherung %s: %v", e.Name(), err)
+			continue
+		}
+		backups = append(backups, info)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Name > backups[j].Name })
+	return backups, nil
+}
+
+func readBackupInfo(name string) (BackupInfo, error) {
+	f, err := os.Open(filepath.Join(backupDir, name))
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	m, _, err := readBackupManifest(f)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	return m.info(name, st.Size()), nil
+}
+
+// pruneBackups löscht die ältesten Sicherungen, sodass höchstens backupKeep bleiben.
+func pruneBackups() {
+	if backupKeep == 0 {
+		return
+	}
+	backups, err := listBackups()
+	if err != nil {
+		log.Printf("Alte Sicherungen nicht gelöscht: %v", err)
+		return
+	}
+	for i := backupKeep; i < len(backups); i++ {
+		if err := os.Remove(filepath.Join(backupDir, backups[i].Name)); err != nil {
+			log.Printf("Sicherung %s nicht gelöscht: %v", backups[i].Name, err)
+		}
+	}
+}
+
+func runBackupScheduler(db *DB) {
+	if backupInterval == 0 {
+		return
+	}
+	if db.Dialect.Name() != "sqlite" {
+		log.Printf("Geplante Sicherungen abgeschaltet: %v", errBackupUnsupported)
+		return
+	}
+	ticker := time.NewTicker(backupInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		info, err := createBackup(context.Background(), db, rawStorage(store))
+		if err != nil {
+			log.Printf("Geplante Sicherung fehlgeschlagen: %v", err)
+			continue
+		}
+		log.Printf("Sicherung %s angelegt (%d Dateien)", info.Name, info.Files)
+		pruneBackups()
+	}
+}
+
+// Handler für Sicherungen
+
+// backupHandlers bedient die Sicherungen im Sicherungsverzeichnis.
+type backupHandlers struct {
+	db *DB
+}
+
+func (h *backupHandlers) list(w http.ResponseWriter, r *http.Request) {
+	backups, err := listBackups()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(backups)
+}
+
+func (h *backupHandlers) create(w http.ResponseWriter, r *http.Request) {
+	info, err := createBackup(r.Context(), h.db, rawStorage(store))
+	if errors.Is(err, errBackupUnsupported) {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pruneBackups()
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(info)
+}
+
+func (h *backupHandlers) download(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !backupNamePattern.MatchString(name) {
+		http.Error(w, "Sicherung nicht gefunden", http.StatusNotFound)
+		return
+	}
+	f, err := os.Open(filepath.Join(backupDir, name))
+	if err != nil {
+		http.Error(w, "Sicherung nicht gefunden", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	http.ServeContent(w, r, name, st.ModTime(), f)
+}
+
+// backupCommand legt eine Sicherung an oder listet die vorhandenen; der Server darf
+// dabei laufen.
+//
+//	vertragsdb backup [-dir <Verzeichnis>] [-list]
+func backupCommand(args []string) error {
+	fset := flag.NewFlagSet("backup", flag.ContinueOnError)
+	dir := fset.String("dir", "", "Sicherungsverzeichnis (Standard: VERTRAGSDB_BACKUP_DIR bzw. ./backups)")
+	list := fset.Bool("list", false, "vorhandene Sicherungen anzeigen")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	if *dir != "" {
+		backupDir = *dir
+	}
+
+	if *list {
+		backups, err := listBackups()
+		if err != nil {
+			return err
+		}
+		for _, b := range backups {
+			fmt.Printf("%s  %s  Schema %d  %d Dateien  %d Byte\n",
+				b.Name, b.CreatedAt.Format("02.01.2006 15:04"), b.SchemaVersion, b.Files, b.Size)
+		}
+		return nil
+	}
+
+	db, err := initDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	info, err := createBackup(context.Background(), db, store)
+	if err != nil {
+		return err
+	}
+	pruneBackups()
+	log.Printf("Sicherung %s angelegt: %d Dateien, %d Byte", filepath.Join(backupDir, info.Name), info.Files, info.Size)
+	if info.MissingFiles > 0 {
+		log.Printf("%d Dateien fehlten im Speicher und sind nicht enthalten", info.MissingFiles)
+	}
+	return nil
+}
+
+// restoreCommand spielt eine Sicherung zurück. Das Archiv wird vollständig geprüft,
+// bevor Dateien in den Speicher geschrieben und die Datenbank ersetzt wird; die
+// bisherige Datenbank bleibt daneben erhalten.
+// Der Server muss dabei angehalten sein.
+//
+//	vertragsdb restore [-dry-run] <Archiv>
+func restoreCommand(args []string) error {
+	fset := flag.NewFlagSet("restore", flag.ContinueOnError)
+	dryRun := fset.Bool("dry-run", false, "Archiv nur prüfen, nichts zurückspielen")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() != 1 {
+		return errors.New("Aufruf: vertragsdb restore [-dry-run] <Archiv>")
+	}
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	if driver := os.Getenv("VERTRAGSDB_DATABASE"); driver != "" && driver != "sqlite" {
+		return errBackupUnsupported
+	}
+	files := store
+	f, err := os.Open(fset.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	m, tr, err := readBackupManifest(f)
+	if err != nil {
+		return err
+	}
+	if m.SchemaVersion > schemaVersion {
+		return fmt.Errorf("die Sicherung hat Schema-Version %d, diese Programmversion unterstützt höchstens %d", m.SchemaVersion, schemaVersion)
+	}
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != backupDatabaseName {
+		return errors.New("Archiv enthält keine Datenbank")
+	}
+	restored := databaseFile + ".restore"
+	if err := extractDatabase(tr, restored, m); err != nil {
+		os.Remove(restored)
+		return err
+	}
+	defer os.Remove(restored)
+
+	// Dateien erst in ein eigenes Verzeichnis entpacken; in den Speicher kommen sie
+	// erst, wenn das ganze Archiv gelesen und geprüft ist
+	staging, err := os.MkdirTemp(".", databaseFile+".restore-files-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	expected := make(map[string]int64, len(m.Files))
+	for _, file := range m.Files {
+		expected[file.Key] = file.Size
+	}
+	var staged []backupFile
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Archiv beschädigt: %w", err)
+		}
+		key := strings.TrimPrefix(hdr.Name, backupFilesPrefix)
+		size, ok := expected[key]
+		if !strings.HasPrefix(hdr.Name, backupFilesPrefix) || !ok || hdr.Size != size || validStorageKey(key) != nil {
+			return fmt.Errorf("unerwarteter Eintrag im Archiv: %s", hdr.Name)
+		}
+		if *dryRun {
+			_, err = io.Copy(io.Discard, tr)
+		} else {
+			err = stageBackupFile(filepath.Join(staging, strconv.Itoa(len(staged))), tr)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		staged = append(staged, backupFile{key, hdr.Size})
+		delete(expected, key)
+	}
+	if len(expected) > 0 {
+		return fmt.Errorf("Archiv unvollständig: %d Dateien fehlen", len(expected))
+	}
+
+	if *dryRun {
+		log.Printf("Sicherung vom %s ist gültig: Schema-Version %d, %d Dateien",
+			m.CreatedAt.Format("02.01.2006 15:04"), m.SchemaVersion, len(m.Files))
+		return nil
+	}
+
+	ctx := context.Background()
+	for i, file := range staged {
+		if err := putStagedFile(ctx, files, file, filepath.Join(staging, strconv.Itoa(i))); err != nil {
+			return fmt.Errorf("%s: %w; die Datenbank ist unverändert", file.Key, err)
+		}
+	}
+
+	// Bisherige Datenbank samt Journal beiseitelegen, dann die geprüfte einsetzen
+	previous := databaseFile + ".before-restore-" + time.Now().Format("20060102-150405")
+	for _, suffix := range []string{"", "-journal", "-wal", "-shm"} {
+		if err := os.Rename(databaseFile+suffix, previous+suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(restored, databaseFile); err != nil {
+		return err
+	}
+
+	log.Printf("Sicherung vom %s zurückgespielt: Schema-Version %d, %d Dateien in %s; bisherige Datenbank unter %s",
+		m.CreatedAt.Format("02.01.2006 15:04"), m.SchemaVersion, len(m.Files), files, previous)
+	if len(m.Missing) > 0 {
+		log.Printf("%d Dateien fehlten bereits bei der Sicherung", len(m.Missing))
+	}
+	return nil
+}
+
+// stageBackupFile schreibt eine Datei aus dem Archiv nach path.
+func stageBackupFile(path string, r io.Reader) error {
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, r)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// putStagedFile legt eine entpackte Datei unter ihrem Schlüssel in den Speicher.
+func putStagedFile(ctx context.Context, files Storage, file backupFile, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return files.Put(ctx, file.Key, f, file.Size)
+}
+
+// extractDatabase schreibt die Datenbank aus dem Archiv nach path und prüft Hash,
+// Integrität und Schema-Version.
+func extractDatabase(r io.Reader, path string, m *backupManifest) error {
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, h), r)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("Datenbank nicht lesbar: %w", err)
+	}
+	if hex.EncodeToString(h.Sum(nil)) != m.DatabaseSHA256 {
+		return errors.New("Prüfsumme der Datenbank stimmt nicht mit dem Manifest überein")
+	}
+
+	rdb, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer rdb.Close()
+	var result string
+	if err := rdb.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return fmt.Errorf("Datenbank nicht lesbar: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("Datenbank beschädigt: %s", result)
+	}
+	var version int
+	if err := rdb.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version != m.SchemaVersion {
+		return fmt.Errorf("Schema-Version der Datenbank (%d) weicht vom Manifest ab (%d)", version, m.SchemaVersion)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	s := newTestServer(t)
+	if s.repos.db.Dialect.Name() != "sqlite" {
+		s.expect("POST", "/backups", s.admin, nil, http.StatusNotImplemented, nil)
+		return
+	}
+
+	c := s.createContract(map[string]interface{}{"title": "Gesichert"})
+	var doc Document
+	s.expect("POST", fmt.Sprintf("/contracts/%d/documents", c.ID), s.admin, uploadForm(t, "vertrag.pdf", testPDF("gesichert"), nil), http.StatusCreated, &doc)
+
+	var info BackupInfo
+	s.expect("POST", "/backups", s.admin, nil, http.StatusCreated, &info)
+	if !backupNamePattern.MatchString(info.Name) || info.Files == 0 || info.MissingFiles != 0 || info.SchemaVersion != schemaVersion {
+		t.Fatalf("Sicherung: %+v", info)
+	}
+	var backups []BackupInfo
+	s.expect("GET", "/backups", s.admin, nil, http.StatusOK, &backups)
+	if len(backups) != 1 || backups[0].Name != info.Name {
+		t.Errorf("Sicherungen: %+v", backups)
+	}
+	resp := s.do("GET", "/backups/"+info.Name, s.admin, nil)
+	archive, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/gzip" || int64(len(archive)) != info.Size {
+		t.Errorf("Download: Status %d, %s, %d Byte", resp.StatusCode, resp.Header.Get("Content-Type"), len(archive))
+	}
+	s.expect("GET", "/backups/contracts.db", s.admin, nil, http.StatusNotFound, nil)
+
+	// Änderungen nach der Sicherung gehen beim Zurückspielen verloren
+	ctx := context.Background()
+	s.createContract(map[string]interface{}{"title": "Nicht gesichert"})
+	stored, err := s.repos.Documents.Get(ctx, doc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, stored.StorageKey); err != nil {
+		t.Fatal(err)
+	}
+	s.repos.db.Close()
+
+	path := filepath.Join(backupDir, info.Name)
+	truncated := filepath.Join(t.TempDir(), info.Name)
+	if err := os.WriteFile(truncated, archive[:len(archive)/2], 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := restoreCommand([]string{truncated}); err == nil {
+		t.Error("beschädigte Sicherung zurückgespielt")
+	}
+	// Fehlt eine Datei am Ende des Archivs, darf auch keine der vorherigen im Speicher landen
+	incomplete := filepath.Join(t.TempDir(), info.Name)
+	if err := os.WriteFile(incomplete, addManifestFile(t, archive, backupFile{"fehlt.pdf", 1}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := restoreCommand([]string{incomplete}); err == nil || !strings.Contains(err.Error(), "unvollständig") {
+		t.Errorf("unvollständige Sicherung: %v", err)
+	}
+	if _, err := store.Stat(ctx, stored.StorageKey); !errors.Is(err, errStorageNotFound) {
+		t.Errorf("Datei aus unvollständiger Sicherung im Speicher: %v", err)
+	}
+	if err := restoreCommand([]string{"-dry-run", path}); err != nil {
+		t.Fatal(err)
+	}
+	if err := restoreCommand([]string{path}); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	contracts, total, err := newRepositories(db).Contracts.List(ctx, "1 = 1", nil, listOptions{Sort: []string{"id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || contracts[0].Title != "Gesichert" {
+		t.Errorf("zurückgespielt: %+v", contracts)
+	}
+	if _, err := store.Stat(ctx, stored.StorageKey); err != nil {
+		t.Errorf("Dokument nicht zurückgespielt: %v", err)
+	}
+}
+
+// addManifestFile packt ein Sicherungsarchiv neu und verzeichnet im Manifest eine
+// zusätzliche Datei, die im Archiv fehlt.
+func addManifestFile(t *testing.T, archive []byte, file backupFile) []byte {
+	t.Helper()
+	m, tr, err := readBackupManifest(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Files = append(m.Files, file)
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	if err := writeTarEntry(tw, backupManifestName, int64(len(data)), m.CreatedAt, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writeTarEntry(tw, hdr.Name, hdr.Size, hdr.ModTime, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// CategoryRepository verwaltet die Vertragskategorien. Verträge verweisen über den
+// Namen auf ihre Kategorie.
+type CategoryRepository struct {
+	s *Repositories
+}
+
+// List liefert alle Kategorien außerhalb des Papierkorbs, nach Namen sortiert.
+func (r *CategoryRepository) List(ctx context.Context) ([]Category, error) {
+	rows, err := r.s.q.QueryContext(ctx, "SELECT id, name FROM categories WHERE deleted_at IS NULL ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []Category
+	for rows.Next() {
+		var cat Category
+		if err := rows.Scan(&cat.ID, &cat.Name); err != nil {
+			return nil, err
+		}
+		categories = append(categories, cat)
+	}
+	return categories, rows.Err()
+}
+
+// Get liest eine Kategorie außerhalb des Papierkorbs.
+func (r *CategoryRepository) Get(ctx context.Context, id int) (*Category, error) {
+	return r.getOne(ctx, "id = ? AND deleted_at IS NULL", id, "Kategorie nicht gefunden")
+}
+
+// GetTrashed liest eine Kategorie aus dem Papierkorb.
+func (r *CategoryRepository) GetTrashed(ctx context.Context, id int) (*Category, error) {
+	return r.getOne(ctx, "id = ? AND deleted_at IS NOT NULL", id, "Kategorie nicht im Papierkorb")
+}
+
+func (r *CategoryRepository) getOne(ctx context.Context, where string, id int, notFound string) (*Category, error) {
+	var cat Category
+	err := r.s.q.QueryRowContext(ctx, "SELECT id, name FROM categories WHERE "+where, id).Scan(&cat.ID, &cat.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFoundError("%s", notFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cat, nil
+}
+
+// checkName prüft einen Kategorienamen und meldet einen Konflikt, wenn eine andere
+// Kategorie als exceptID ihn bereits trägt, auch im Papierkorb.
+func (r *CategoryRepository) checkName(ctx context.Context, name string, exceptID int) error {
+	if name == "" {
+		return validationError("Kategoriename darf nicht leer sein")
+	}
+	var trashed bool
+	err := r.s.q.QueryRowContext(ctx, "SELECT deleted_at IS NOT NULL FROM categories WHERE name = ? AND id != ?", name, exceptID).Scan(&trashed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if trashed {
+		return conflictError("Kategorie liegt im Papierkorb und kann dort wiederhergestellt werden")
+	}
+	return conflictError("Kategorie existiert bereits")
+}
+
+// Create legt eine Kategorie an.
+func (r *CategoryRepository) Create(ctx context.Context, name string) (*Category, error) {
+	name = strings.TrimSpace(name)
+	var cat *Category
+	err := r.s.Transaction(ctx, func(tx *Repositories) error {
+		if err := tx.Categories.checkName(ctx, name, 0); err != nil {
+			return err
+		}
+		id, err := tx.q.InsertContext(ctx, "INSERT INTO categories (name) VALUES (?)", name)
+		if err != nil {
+			return err
+		}
+		cat = &Category{ID: int(id), Name: name}
+		return nil
+	})
+	return cat, err
+}
+
+// Rename benennt eine Kategorie um und übernimmt den neuen Namen in alle Verträge,
+// auch die im Papierkorb. Geliefert wird der bisherige Name.
+func (r *CategoryRepository) Rename(ctx context.Context, id int, name string) (oldName string, err error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", validationError("Kategoriename darf nicht leer sein")
+	}
+	err = r.s.Transaction(ctx, func(tx *Repositories) error {
+		cat, err := tx.Categories.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		oldName = cat.Name
+		if name == oldName {
+			return nil
+		}
+		if err := tx.Categories.checkName(ctx, name, id); err != nil {
+			return err
+		}
+		if _, err := tx.q.ExecContext(ctx, "UPDATE categories SET name = ? WHERE id = ?", name, id); err != nil {
+			return err
+		}
+		_, err = tx.q.ExecContext(ctx, "UPDATE contracts SET category = ? WHERE category = ?", name, oldName)
+		return err
+	})
+	return oldName, err
+}
+
+// Trash verschiebt eine Kategorie in den Papierkorb, sofern kein Vertrag außerhalb
+// des Papierkorbs sie verwendet. Verträge im Papierkorb dürfen sie weiter verwenden.
+func (r *CategoryRepository) Trash(ctx context.Context, id, userID int) (*Category, error) {
+	var cat *Category
+	err := r.s.Transaction(ctx, func(tx *Repositories) error {
+		var err error
+		if cat, err = tx.Categories.Get(ctx, id); err != nil {
+			return err
+		}
+		count, err := tx.count(ctx, "SELECT COUNT(*) FROM contracts WHERE category = ? AND deleted_at IS NULL", cat.Name)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return conflictError("Kategorie wird von %d Vertrag/Verträgen verwendet", count)
+		}
+		if _, err := tx.q.ExecContext(ctx, "UPDATE categories SET deleted_at = ?, deleted_by = ? WHERE id = ?", time.Now(), userID, id); err != nil {
+			return err
+		}
+		return writeAudit(tx.q, auditCategoryDeleted, "category", cat.ID, userID, map[string]string{"name": cat.Name})
+	})
+	return cat, err
+}
+
+// Restore holt eine Kategorie aus dem Papierkorb zurück.
+func (r *CategoryRepository) Restore(ctx context.Context, id, userID int) (*Category, error) {
+	var cat *Category
+	err := r.s.Transaction(ctx, func(tx *Repositories) error {
+		var err error
+		if cat, err = tx.Categories.GetTrashed(ctx, id); err != nil {
+			return err
+		}
+		if _, err := tx.q.ExecContext(ctx, "UPDATE categories SET deleted_at = NULL, deleted_by = NULL WHERE id = ?", id); err != nil {
+			return err
+		}
+		return writeAudit(tx.q, auditCategoryRestored, "category", cat.ID, userID, map[string]string{"name": cat.Name})
+	})
+	return cat, err
+}
+
+// Purge löscht eine Kategorie aus dem Papierkorb endgültig, mit ihren
+// Aufbewahrungsregeln, sobald kein Vertrag im Papierkorb sie mehr verwendet.
+func (r *CategoryRepository) Purge(ctx context.Context, id, userID int) (*Category, error) {
+	var cat *Category
+	err := r.s.Transaction(ctx, func(tx *Repositories) error {
+		var err error
+		if cat, err = tx.Categories.GetTrashed(ctx, id); err != nil {
+			return err
+		}
+		count, err := tx.count(ctx, "SELECT COUNT(*) FROM contracts WHERE category = ?", cat.Name)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return conflictError("Kategorie wird noch von %d Vertrag/Verträgen im Papierkorb verwendet", count)
+		}
+		for _, query := range []string{
+			"DELETE FROM retention_rules WHERE category_id = ?",
+			"DELETE FROM categories WHERE id = ?",
+		} {
+			if _, err := tx.q.ExecContext(ctx, query, cat.ID); err != nil {
+				return err
+			}
+		}
+		return writeAudit(tx.q, auditCategoryPurged, "category", cat.ID, userID, map[string]string{"name": cat.Name})
+	})
+	return cat, err
+}
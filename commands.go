@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// command ist ein Befehl der Kommandozeile (vertragsdb <Befehl> [Optionen]).
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
+
+var commands = []command{
+	{"serve", "Server starten (Voreinstellung)", serveCommand},
+	{"migrate", "Datenbankschema migrieren", migrateCommand},
+	{"create-user", "Benutzer anlegen", createUserCommand},
+	{"reset-password", "Passwort eines Benutzers zurücksetzen", resetPasswordCommand},
+	{"recalc-dates", "Kündigungstermine aller Verträge neu berechnen", recalcDatesCommand},
+	{"import", "Verträge aus CSV- oder Excel-Datei importieren", importCommand},
+	{"export", "Vertragsliste oder Bericht als Datei exportieren", exportCommand},
+	{"backup", "Sicherung anlegen oder auflisten", backupCommand},
+	{"restore", "Sicherung zurückspielen", restoreCommand},
+	{"migrate-storage", "Dokumente in ein anderes Speicher-Backend kopieren", migrateStorageCommand},
+	{"encrypt-storage", "Unverschlüsselte Dokumente verschlüsseln", encryptStorageCommand},
+	{"rotate-keys", "Datenschlüssel mit dem aktiven Hauptschlüssel neu verschlüsseln", rotateKeysCommand},
+	{"generate-key", "Neuen Hauptschlüssel erzeugen", generateKeyCommand},
+}
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Aufruf: vertragsdb [Befehl] [Optionen]")
+	fmt.Fprintln(os.Stderr, "\nBefehle:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", c.name, c.description)
+	}
+	fmt.Fprintln(os.Stderr, "\nOptionen eines Befehls: vertragsdb <Befehl> -h")
+}
+
+// loadConfig liest die Konfiguration aus den Umgebungsvariablen. Server und Befehle
+// verwenden dieselbe Konfiguration; ungültige Werte brechen jeden Befehl ab.
+func loadConfig() error {
+	var err error
+	if store, err = openStorage(os.Getenv("VERTRAGSDB_STORAGE")); err != nil {
+		return err
+	}
+	if err := loadUploadConfig(); err != nil {
+		return err
+	}
+	if err := loadTrashConfig(); err != nil {
+		return err
+	}
+	if err := loadBackupConfig(); err != nil {
+		return err
+	}
+	loadPreviewConfig()
+	return nil
+}
+
+// migrateCommand migriert die Datenbank auf die aktuelle oder die angegebene
+// Schema-Version, bei einer niedrigeren Version rückwärts. Mit -dry-run werden nur
+// die auszuführenden Migrationen angezeigt.
+//
+//	vertragsdb migrate [-dry-run] [-to <Version>]
+func migrateCommand(args []string) error {
+	fset := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := fset.Bool("dry-run", false, "nur anzeigen, welche Migrationen ausgeführt würden")
+	to := fset.Int("to", schemaVersion, "Ziel-Schema-Version, 0 entfernt das ganze Schema")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if *to < 0 || *to > schemaVersion {
+		return fmt.Errorf("ungültige Ziel-Version %d (0 bis %d)", *to, schemaVersion)
+	}
+	if err := loadConfig(); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(databaseFile); errors.Is(err, os.ErrNotExist) {
+		if *dryRun {
+			log.Printf("%s existiert nicht und wird mit Schema-Version %d angelegt", databaseFile, *to)
+			return nil
+		}
+	} else if err != nil {
+		return err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	state, err := readMigrationState(db, db.Dialect)
+	db.Close()
+	if err != nil {
+		return err
+	}
+
+	steps := migrationPlan(db.Dialect, state.Version, *to)
+	if len(steps) == 0 {
+		log.Printf("Schema-Version %d, keine Migration nötig", state.Version)
+		if *dryRun || !state.Baseline {
+			return nil
+		}
+	}
+	if *dryRun {
+		log.Printf("Schema-Version %d, auszuführende Migrationen:", state.Version)
+		for _, step := range steps {
+			fmt.Printf("  %s\n", step)
+		}
+		return nil
+	}
+
+	db, err = initDBVersion(*to)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if len(steps) > 0 {
+		log.Printf("Datenbank von Schema-Version %d auf %d migriert", state.Version, *to)
+	}
+	return nil
+}
+
+// createUserCommand legt einen Benutzer an. Ohne -password-stdin wird ein zufälliges
+// Passwort erzeugt und ausgegeben.
+//
+//	vertragsdb create-user -username <Name> [-role admin|viewer] [-password-stdin]
+func createUserCommand(args []string) error {
+	fset := flag.NewFlagSet("create-user", flag.ContinueOnError)
+	username := fset.String("username", "", "Benutzername")
+	role := fset.String("role", "viewer", "Rolle: admin oder viewer")
+	passwordStdin := fset.Bool("password-stdin", false, "Passwort aus der ersten Zeile der Standardeingabe lesen")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	*username = strings.TrimSpace(*username)
+	if *username == "" {
+		return errors.New("Benutzername fehlt (-username)")
+	}
+	password, generated, err := commandPassword(*passwordStdin)
+	if err != nil {
+		return err
+	}
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	db, err := initDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	in := UserInput{Username: *username, Password: password, Role: *role}
+	if _, err := newRepositories(db).Users.Create(context.Background(), in); err != nil {
+		return err
+	}
+
+	log.Printf("Benutzer %s (%s) angelegt", *username, *role)
+	if generated {
+		fmt.Printf("Passwort: %s\n", password)
+	}
+	return nil
+}
+
+// resetPasswordCommand setzt das Passwort eines Benutzers neu, etwa wenn sich kein
+// Admin mehr anmelden kann. Ohne -password-stdin wird ein zufälliges Passwort
+// erzeugt und ausgegeben.
+//
+//	vertragsdb reset-password -username <Name> [-password-stdin]
+func resetPasswordCommand(args []string) error {
+	fset := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	username := fset.String("username", "", "Benutzername")
+	passwordStdin := fset.Bool("password-stdin", false, "Passwort aus der ersten Zeile der Standardeingabe lesen")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" {
+		return errors.New("Benutzername fehlt (-username)")
+	}
+	password, generated, err := commandPassword(*passwordStdin)
+	if err != nil {
+		return err
+	}
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	db, err := initDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := newRepositories(db).Users.SetPassword(context.Background(), *username, password); err != nil {
+		return err
+	}
+
+	log.Printf("Passwort von %s zurückgesetzt", *username)
+	if generated {
+		fmt.Printf("Passwort: %s\n", password)
+	}
+	return nil
+}
+
+// commandPassword liest das Passwort aus der Standardeingabe oder erzeugt ein
+// zufälliges. Ein Passwort als Option stünde in der Prozessliste.
+func commandPassword(fromStdin bool) (password string, generated bool, err error) {
+	if fromStdin {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", false, errors.New("kein Passwort auf der Standardeingabe")
+		}
+		password = strings.TrimRight(line, "\r\n")
+		if password == "" {
+			return "", false, errors.New("das Passwort darf nicht leer sein")
+		}
+		return password, false, nil
+	}
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", false, err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), true, nil
+}
+
+// commandUser liefert die ID des Benutzers, in dessen Namen ein Befehl handelt;
+// ohne Angabe ist es der erste Admin.
+func commandUser(db *DB, username string) (int, error) {
+	users := newRepositories(db).Users
+	var user *User
+	var err error
+	if username == "" {
+		user, err = users.FirstAdmin(context.Background())
+	} else {
+		user, err = users.GetByUsername(context.Background(), username)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return user.ID, nil
+}
+
+// recalcDatesCommand berechnet die Kündigungstermine aller laufenden Verträge neu,
+// wie POST /contracts/calculate-dates.
+//
+//	vertragsdb recalc-dates
+func recalcDatesCommand(args []string) error {
+	fset := flag.NewFlagSet("recalc-dates", flag.ContinueOnError)
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	db, err := initDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	updated, err := newRepositories(db).Contracts.RecalculateDates(context.Background())
+	if err != nil {
+		return err
+	}
+	log.Printf("Kündigungstermine für %d Verträge berechnet", updated)
+	return nil
+}
+
+// importCommand importiert Verträge aus einer CSV- oder XLSX-Datei wie
+// POST /contracts/import. Fehlerhafte Zeilen werden ausgegeben und übersprungen; der
+// Befehl endet dann mit Fehlercode.
+//
+//	vertragsdb import [-dry-run] [-mapping <JSON>] [-delimiter <Zeichen>] [-create-categories] [-create-partners] [-user <Name>] <Datei>
+func importCommand(args []string) error {
+	fset := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := fset.Bool("dry-run", false, "Datei nur prüfen, nichts importieren")
+	mapping := fset.String("mapping", "", `Spaltenzuordnung als JSON, z. B. {"Bezeichnung":"title"}`)
+	delimiter := fset.String("delimiter", "", "Trennzeichen der CSV-Datei (Standard: automatisch)")
+	createCategories := fset.Bool("create-categories", false, "unbekannte Kategorien anlegen")
+	createPartners := fset.Bool("create-partners", false, "unbekannte Partner zulassen")
+	username := fset.String("user", "", "Benutzer, der als Verantwortlicher eingetragen wird (Standard: erster Admin)")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() != 1 {
+		return errors.New("Aufruf: vertragsdb import [Optionen] <Datei>")
+	}
+
+	opts := ImportOptions{DryRun: *dryRun, CreateCategories: *createCategories, CreatePartners: *createPartners}
+	if *mapping != "" {
+		if err := json.Unmarshal([]byte(*mapping), &opts.Mapping); err != nil {
+			return fmt.Errorf("ungültige Zuordnung: %w", err)
+		}
+	}
+	var err error
+	if opts.Delimiter, err = parseImportDelimiter(*delimiter); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(fset.Arg(0))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxImportSize {
+		return fmt.Errorf("Datei zu groß (höchstens %d MB)", maxImportSize>>20)
+	}
+	records, err := readImportFile(data, fset.Arg(0), opts.Delimiter)
+	if err != nil {
+		return fmt.Errorf("Datei kann nicht gelesen werden: %w", err)
+	}
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	db, err := initDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if opts.UserID, err = commandUser(db, *username); err != nil {
+		return err
+	}
+
+	report, err := importContracts(db, records, opts)
+	if err != nil {
+		return err
+	}
+	if report.Error != "" {
+		return errors.New(report.Error)
+	}
+	for _, row := range report.Rows {
+		if len(row.Errors) > 0 {
+			fmt.Printf("Zeile %d: %s\n", row.Row, strings.Join(row.Errors, "; "))
+		}
+	}
+	if len(report.NewCategories) > 0 {
+		log.Printf("Neue Kategorien: %s", strings.Join(report.NewCategories, ", "))
+	}
+	if *dryRun {
+		log.Printf("Probelauf: %d Zeilen, %d gültig, %d fehlerhaft", report.TotalRows, report.ValidRows, report.InvalidRows)
+	} else {
+		log.Printf("%d von %d Verträgen importiert", report.Imported, report.TotalRows)
+	}
+	if report.InvalidRows > 0 {
+		return fmt.Errorf("%d Zeilen fehlerhaft", report.InvalidRows)
+	}
+	return nil
+}
+
+// exportCommand schreibt eine Vertragsliste oder einen Bericht als Datei, mit
+// denselben Parametern wie die API bzw. ein Berichtsabonnement. Ohne -o wird der
+// Dateiname des Exports im aktuellen Verzeichnis verwendet, -o - schreibt auf die
+// Standardausgabe.
+//
+//	vertragsdb export [-report contracts|expiring|portfolio|saved_search] [-format csv|xlsx|pdf|html|json] [-query <Parameter>] [-user <Name>] [-o <Datei>]
+func exportCommand(args []string) error {
+	fset := flag.NewFlagSet("export", flag.ContinueOnError)
+	report := fset.String("report", reportContracts, "Bericht: contracts, expiring, portfolio oder saved_search")
+	format := fset.String("format", exportCSV, "Format: csv, xlsx, pdf, html oder json")
+	query := fset.String("query", "", `Filter und Parameter als URL-Query, z. B. "category=IT&sort=partner"`)
+	username := fset.String("user", "", "Benutzer, mit dessen Rechten exportiert wird (Standard: erster Admin)")
+	output := fset.String("o", "", "Zieldatei, - für die Standardausgabe")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if !validReport(*report) {
+		return fmt.Errorf("unbekannter Bericht: %s", *report)
+	}
+	q, err := url.ParseQuery(*query)
+	if err != nil {
+		return fmt.Errorf("ungültige Parameter: %w", err)
+	}
+	params := map[string]string{}
+	allowed := subscriptionParams(*report)
+	for k := range q {
+		if !allowed[k] {
+			return fmt.Errorf("unbekannter Parameter für Bericht %s: %s", *report, k)
+		}
+		params[k] = q.Get(k)
+	}
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	db, err := initDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	userID, err := commandUser(db, *username)
+	if err != nil {
+		return err
+	}
+
+	resp, err := renderSubscription(newRepositories(db), ReportSubscription{UserID: userID, Report: *report, Params: params, Format: *format})
+	if err != nil {
+		return err
+	}
+
+	if *output == "-" {
+		_, err = os.Stdout.Write(resp.body.Bytes())
+		return err
+	}
+	path := *output
+	if path == "" {
+		path = exportFilename(*report, time.Now(), *format)
+		if _, p, err := mime.ParseMediaType(resp.header.Get("Content-Disposition")); err == nil && p["filename"] != "" {
+			path = filepath.Base(p["filename"])
+		}
+	}
+	if err := os.WriteFile(path, resp.body.Bytes(), 0o644); err != nil {
+		return err
+	}
+	log.Printf("%s geschrieben (%d Byte)", path, resp.body.Len())
+	return nil
+}
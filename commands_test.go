@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestCommandsLoadConfig stellt sicher, dass Befehle mit Datenbankzugriff dieselbe
+// Konfiguration lesen und prüfen wie der Server.
+func TestCommandsLoadConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"rotate-keys", nil},
+		{"encrypt-storage", []string{"-dry-run"}},
+		{"migrate-storage", []string{"-from", "local", "-to", "s3", "-dry-run"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDB(t)
+			t.Setenv("VERTRAGSDB_BACKUP_KEEP", "-1")
+			err := findCommand(tt.name).run(tt.args)
+			if err == nil || !strings.Contains(err.Error(), "VERTRAGSDB_BACKUP_KEEP") {
+				t.Errorf("Fehler %v, erwartet ungültige Konfiguration", err)
+			}
+		})
+	}
+}
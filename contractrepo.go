@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ContractRepository liest und ändert Verträge. Verträge im Papierkorb liefern nur
+// GetTrashed und List mit WithDeleted.
+type ContractRepository struct {
+	s *Repositories
+}
+
+// Get liest einen Vertrag mit allen Feldern.
+func (r *ContractRepository) Get(ctx context.Context, id int) (*Contract, error) {
+	return r.getOne(ctx, "id = ?", id, false, "Contract not found")
+}
+
+// GetTrashed liest einen Vertrag aus dem Papierkorb.
+func (r *ContractRepository) GetTrashed(ctx context.Context, id int) (*Contract, error) {
+	return r.getOne(ctx, "id = ? AND deleted_at IS NOT NULL", id, true, "Vertrag nicht im Papierkorb")
+}
+
+func (r *ContractRepository) getOne(ctx context.Context, where string, id int, withDeleted bool, notFound string) (*Contract, error) {
+	contracts, _, err := r.List(ctx, where, []interface{}{id},
+		listOptions{Limit: -1, Sort: []string{"id ASC"}, WithDeleted: withDeleted})
+	if err != nil {
+		return nil, err
+	}
+	if len(contracts) == 0 {
+		return nil, notFoundError("%s", notFound)
+	}
+	return &contracts[0], nil
+}
+
+// List liefert eine Seite der Verträge zur Bedingung where sowie die Gesamtanzahl der Treffer.
+func (r *ContractRepository) List(ctx context.Context, where string, args []interface{}, opts listOptions) ([]Contract, int, error) {
+	if !opts.WithDeleted {
+		where = "deleted_at IS NULL AND (" + where + ")"
+	}
+	total, err := r.s.count(ctx, "SELECT COUNT(*) FROM contracts WHERE "+where, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT " + opts.selectList() + " FROM contracts WHERE " + where +
+		" ORDER BY " + strings.Join(opts.Sort, ", ")
+	queryArgs := append([]interface{}{}, args...)
+	if opts.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		queryArgs = append(queryArgs, opts.Limit, opts.Offset)
+	}
+
+	rows, err := r.s.q.QueryContext(ctx, query, queryArgs...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	contracts, err := scanContracts(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return contracts, total, nil
+}
+
+// NextNumber liefert die nächste freie Vertragsnummer im Format V000001.
+func (r *ContractRepository) NextNumber(ctx context.Context) (string, error) {
+	var maxNumber int
+	err := r.s.q.QueryRowContext(ctx, "SELECT COALESCE(MAX("+r.s.dialect.LeadingInteger("SUBSTR(contract_number, 2)")+
+		"), 0) FROM contracts WHERE contract_number LIKE 'V%'").Scan(&maxNumber)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("V%06d", maxNumber+1), nil
+}
+
+func validateContract(c *Contract) error {
+	if c.ContractType != "framework" && c.ContractType != "individual" {
+		return validationError("ungültiger Vertragstyp: %s", c.ContractType)
+	}
+	if c.NoticePeriod != nil && *c.NoticePeriod < 0 {
+		return validationError("Kündigungsfrist darf nicht negativ sein")
+	}
+	if c.TermMonths != nil && *c.TermMonths < 0 {
+		return validationError("Laufzeit darf nicht negativ sein")
+	}
+	return nil
+}
+
+// checkContractReferences prüft, dass Rahmenvertrag und Verantwortlicher existieren.
+func checkContractReferences(ctx context.Context, tx *Repositories, c *Contract) error {
+	if c.FrameworkContractID != nil {
+		if _, err := tx.Contracts.Get(ctx, *c.FrameworkContractID); errors.Is(err, errNotFound) {
+			return validationError("Rahmenvertrag %d existiert nicht", *c.FrameworkContractID)
+		} else if err != nil {
+			return err
+		}
+	}
+	if c.OwnerID != nil {
+		if _, err := tx.Users.Get(ctx, *c.OwnerID); errors.Is(err, errNotFound) {
+			return validationError("Benutzer %d existiert nicht", *c.OwnerID)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Create legt einen Vertrag an und liefert ihn, wie er gespeichert wurde. Ohne
+// Vertragsnummer wird die nächste freie vergeben.
+func (r *ContractRepository) Create(ctx context.Context, c *Contract) (*Contract, error) {
+	if err := validateContract(c); err != nil {
+		return nil, err
+	}
+	var created *Contract
+	err := r.s.Transaction(ctx, func(tx *Repositories) error {
+		if err := checkContractReferences(ctx, tx, c); err != nil {
+			return err
+		}
+		if c.ContractNumber == "" {
+			number, err := tx.Contracts.NextNumber(ctx)
+			if err != nil {
+				return err
+			}
+			c.ContractNumber = number
+		}
+
+		id, err := tx.q.InsertContext(ctx, `INSERT INTO contracts
+			(contract_number, title, content, conditions, notice_period, minimum_term,
+			term_months, valid_from, valid_until, partner, category, contract_type, framework_contract_id, owner_id, annual_cost)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			c.ContractNumber, c.Title, c.Content, c.Conditions,
+			c.NoticePeriod, c.MinimumTerm, c.TermMonths, c.ValidFrom, c.ValidUntil,
+			c.Partner, c.Category, c.ContractType, c.FrameworkContractID, c.OwnerID, c.AnnualCost)
+		if err != nil {
+			return err
+		}
+		created, err = tx.Contracts.Get(ctx, int(id))
+		return err
+	})
+	return created, err
+}
+
+// Update ändert einen Vertrag und liefert den Stand davor und danach. Ohne OwnerID
+// bleibt der bisherige Verantwortliche erhalten; Vertragsnummer, Termine und Status
+// ändern sich nicht.
+func (r *ContractRepository) Update(ctx context.Context, id int, c *Contract) (previous, updated *Contract, err error) {
+	if err := validateContract(c); err != nil {
+		return nil, nil, err
+	}
+	err = r.s.Transaction(ctx, func(tx *Repositories) error {
+		if previous, err = tx.Contracts.Get(ctx, id); err != nil {
+			return err
+		}
+		if err := checkContractReferences(ctx, tx, c); err != nil {
+			return err
+		}
+		_, err := tx.q.ExecContext(ctx, `UPDATE contracts SET
+			title = ?, content = ?, conditions = ?, notice_period = ?,
+			minimum_term = ?, term_months = ?, valid_from = ?, valid_until = ?, partner = ?,
+			category = ?, contract_type = ?, framework_contract_id = ?, owner_id = COALESCE(?, owner_id),
+			annual_cost = ?
+			WHERE id = ?`,
+			c.Title, c.Content, c.Conditions, c.NoticePeriod,
+			c.MinimumTerm, c.TermMonths, c.ValidFrom, c.ValidUntil, c.Partner,
+			c.Category, c.ContractType, c.FrameworkContractID, c.OwnerID, c.AnnualCost, id)
+		if err != nil {
+			return err
+		}
+		updated, err = tx.Contracts.Get(ctx, id)
+		return err
+	})
+	return previous, updated, err
+}
+
+// Terminate kündigt einen Vertrag und liefert den Stand davor und danach. Bei einem
+// bereits gekündigten Vertrag wird nur der Kündigungszeitpunkt neu gesetzt.
+func (r *ContractRepository) Terminate(ctx context.Context, id int) (previous, terminated *Contract, err error) {
+	err = r.s.Transaction(ctx, func(tx *Repositories) error {
+		if previous, err = tx.Contracts.Get(ctx, id); err != nil {
+			return err
+		}
+		if _, err := tx.q.ExecContext(ctx, "UPDATE contracts SET is_terminated = TRUE, terminated_at = ? WHERE id = ?",
+			time.Now(), id); err != nil {
+			return err
+		}
+		terminated, err = tx.Contracts.Get(ctx, id)
+		return err
+	})
+	return previous, terminated, err
+}
+
+// Trash verschiebt einen Vertrag in den Papierkorb. Verträge mit Legal Hold,
+// Rahmenverträge mit Einzelverträgen und Verträge mit Dokumenten bleiben erhalten;
+// Dokumente müssen zuerst gelöscht werden.
+func (r *ContractRepository) Trash(ctx context.Context, id, userID int) (*Contract, error) {
+	var c *Contract
+	err := r.s.Transaction(ctx, func(tx *Repositories) error {
+		var err error
+		if c, err = tx.Contracts.Get(ctx, id); err != nil {
+			return err
+		}
+		if c.LegalHold {
+			return conflictError("%s, er kann nicht gelöscht werden", errLegalHold)
+		}
+		children, err := tx.count(ctx, "SELECT COUNT(*) FROM contracts WHERE framework_contract_id = ? AND deleted_at IS NULL", c.ID)
+		if err != nil {
+			return err
+		}
+		if children > 0 {
+			return conflictError("Dem Rahmenvertrag sind noch %d Einzelvertrag/Einzelverträge zugeordnet", children)
+		}
+		documents, err := tx.count(ctx, "SELECT COUNT(*) FROM documents WHERE contract_id = ? AND deleted_at IS NULL", c.ID)
+		if err != nil {
+			return err
+		}
+		if documents > 0 {
+			return conflictError("Der Vertrag hat noch %d Dokument(e), bitte zuerst löschen", documents)
+		}
+
+		if _, err := tx.q.ExecContext(ctx, "UPDATE contracts SET deleted_at = ?, deleted_by = ? WHERE id = ?", time.Now(), userID, c.ID); err != nil {
+			return err
+		}
+		if _, err := tx.q.ExecContext(ctx, "DELETE FROM retention_candidates WHERE contract_id = ? AND status = ?", c.ID, retentionPending); err != nil {
+			return err
+		}
+		return writeAudit(tx.q, auditContractDeleted, "contract", c.ID, userID, map[string]string{"contract_number": c.ContractNumber})
+	})
+	return c, err
+}
+
+// Restore holt einen Vertrag aus dem Papierkorb zurück. Kategorie und Rahmenvertrag
+// dürfen nicht im Papierkorb liegen.
+func (r *ContractRepository) Restore(ctx context.Context, id, userID int) (*Contract, error) {
+	var restored *Contract
+	err := r.s.Transaction(ctx, func(tx *Repositories) error {
+		c, err := tx.Contracts.GetTrashed(ctx, id)
+		if err != nil {
+			return err
+		}
+		categories, err := tx.count(ctx, "SELECT COUNT(*) FROM categories WHERE name = ? AND deleted_at IS NULL", c.Category)
+		if err != nil {
+			return err
+		}
+		if categories == 0 {
+			return conflictError("Kategorie %q liegt im Papierkorb, bitte zuerst wiederherstellen", c.Category)
+		}
+		if c.FrameworkContractID != nil {
+			if _, err := tx.Contracts.Get(ctx, *c.FrameworkContractID); errors.Is(err, errNotFound) {
+				return conflictError("Der Rahmenvertrag liegt im Papierkorb, bitte zuerst wiederherstellen")
+			} else if err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.q.ExecContext(ctx, "UPDATE contracts SET deleted_at = NULL, deleted_by = NULL WHERE id = ?", c.ID); err != nil {
+			return err
+		}
+		if err := writeAudit(tx.q, auditContractRestored, "contract", c.ID, userID, map[string]string{"contract_number": c.ContractNumber}); err != nil {
+			return err
+		}
+		restored, err = tx.Contracts.Get(ctx, c.ID)
+		return err
+	})
+	return restored, err
+}
+
+// RecalculateDates berechnet Kündigungstermin und Kündigungsvornahme aller laufenden
+// Verträge neu und liefert die Anzahl der berechneten Verträge. Verträge mit
+// unvollständigen Angaben verlieren ihre Termine.
+func (r *ContractRepository) RecalculateDates(ctx context.Context) (int, error) {
+	type calcContract struct {
+		id           int
+		validFrom    time.Time
+		noticePeriod sql.NullInt64
+		termMonths   sql.NullInt64
+		minimumTerm  sql.NullTime
+	}
+
+	today := time.Now().Truncate(24 * time.Hour)
+	updated := 0
+	err := r.s.Transaction(ctx, func(tx *Repositories) error {
+		rows, err := tx.q.QueryContext(ctx, `SELECT id, valid_from, notice_period, minimum_term, term_months
+			FROM contracts WHERE is_terminated = FALSE AND deleted_at IS NULL`)
+		if err != nil {
+			return err
+		}
+		var contracts []calcContract
+		for rows.Next() {
+			var c calcContract
+			if err := rows.Scan(&c.id, &c.validFrom, &c.noticePeriod, &c.minimumTerm, &c.termMonths); err != nil {
+				rows.Close()
+				return err
+			}
+			contracts = append(contracts, c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, c := range contracts {
+			// Alle Felder müssen gesetzt sein
+			if !c.noticePeriod.Valid || !c.minimumTerm.Valid || !c.termMonths.Valid || c.termMonths.Int64 <= 0 {
+				if _, err := tx.q.ExecContext(ctx, "UPDATE contracts SET cancellation_date = NULL, cancellation_action_date = NULL WHERE id = ?", c.id); err != nil {
+					return err
+				}
+				continue
+			}
+
+			cancDate, cancActionDate := cancellationDates(c.validFrom, c.minimumTerm.Time,
+				int(c.noticePeriod.Int64), int(c.termMonths.Int64), today)
+			if _, err := tx.q.ExecContext(ctx, "UPDATE contracts SET cancellation_date = ?, cancellation_action_date = ? WHERE id = ?",
+				cancDate, cancActionDate, c.id); err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+// scanContracts liest alle Zeilen aus einem Contracts-Query und gibt sie als Slice zurück.
+// Ist eine Zeile nicht lesbar, gibt es statt einer unvollständigen Liste einen Fehler.
+func scanContracts(rows *sql.Rows) ([]Contract, error) {
+	var contracts []Contract
+	for rows.Next() {
+		contract, err := scanContract(rows)
+		if err != nil {
+			return nil, err
+		}
+		contracts = append(contracts, contract)
+	}
+	return contracts, rows.Err()
+}
+
+// scanContract liest die aktuelle Zeile eines Contracts-Query (Spalten wie contractColumns).
+func scanContract(rows *sql.Rows) (Contract, error) {
+	var contract Contract
+	var validUntil, minimumTerm, cancDate, cancActionDate, terminatedAt sql.NullTime
+	var frameworkID, noticePeriod, termMonths, ownerID sql.NullInt64
+	var annualCost sql.NullFloat64
+
+	if err := rows.Scan(&contract.ID, &contract.ContractNumber, &contract.Title,
+		&contract.Content, &contract.Conditions, &noticePeriod,
+		&minimumTerm, &termMonths, &cancDate, &cancActionDate,
+		&contract.ValidFrom, &validUntil, &contract.Partner,
+		&contract.Category, &contract.ContractType, &frameworkID,
+		&contract.IsTerminated, &terminatedAt, &contract.CreatedAt, &ownerID, &annualCost,
+		&contract.LegalHold, &contract.LegalHoldReason); err != nil {
+		return contract, err
+	}
+
+	if validUntil.Valid {
+		contract.ValidUntil = &validUntil.Time
+	}
+	if minimumTerm.Valid {
+		contract.MinimumTerm = &minimumTerm.Time
+	}
+	if termMonths.Valid {
+		n := int(termMonths.Int64)
+		contract.TermMonths = &n
+	}
+	if cancDate.Valid {
+		contract.CancellationDate = &cancDate.Time
+	}
+	if cancActionDate.Valid {
+		contract.CancellationActionDate = &cancActionDate.Time
+	}
+	if noticePeriod.Valid {
+		n := int(noticePeriod.Int64)
+		contract.NoticePeriod = &n
+	}
+	if frameworkID.Valid {
+		id := int(frameworkID.Int64)
+		contract.FrameworkContractID = &id
+	}
+	if terminatedAt.Valid {
+		contract.TerminatedAt = &terminatedAt.Time
+	}
+	if ownerID.Valid {
+		id := int(ownerID.Int64)
+		contract.OwnerID = &id
+	}
+	if annualCost.Valid {
+		contract.AnnualCost = &annualCost.Float64
+	}
+	return contract, nil
+}
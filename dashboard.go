@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Widget-Typen des persönlichen Dashboards
+const (
+	widgetUpcomingDeadlines = "upcoming_deadlines" // eigene Verträge mit anstehender Kündigungsvornahme
+	widgetWithoutDocuments  = "without_documents"  // laufende Verträge ohne Dokumente
+	widgetCostByCategory    = "cost_by_category"   // jährliche Kosten gültiger Verträge je Kategorie
+	widgetSavedSearch       = "saved_search"       // Ergebnis einer gespeicherten Suche
+)
+
+const defaultWidgetLimit = 10
+
+// DashboardWidget ist ein Baustein des persönlichen Dashboards.
+type DashboardWidget struct {
+	ID       int          `json:"id"`
+	UserID   int          `json:"user_id"`
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Config   WidgetConfig `json:"config"`
+	Position int          `json:"position"`
+}
+
+// WidgetConfig enthält die typabhängigen Einstellungen eines Widgets.
+type WidgetConfig struct {
+	Days          int  `json:"days,omitempty"`            // upcoming_deadlines, Standard 90
+	OnlyMine      bool `json:"only_mine,omitempty"`       // upcoming_deadlines, without_documents
+	Limit         int  `json:"limit,omitempty"`           // Anzahl Verträge, Standard 10
+	SavedSearchID int  `json:"saved_search_id,omitempty"` // saved_search
+}
+
+// CategoryCost ist eine Zeile des Widgets cost_by_category.
+type CategoryCost struct {
+	Category   string  `json:"category"`
+	Contracts  int     `json:"contracts"`
+	AnnualCost float64 `json:"annual_cost"`
+}
+
+func (wd *DashboardWidget) validate(db *DB, userID int, role string) error {
+	switch wd.Type {
+	case widgetUpcomingDeadlines, widgetWithoutDocuments, widgetCostByCategory:
+	case widgetSavedSearch:
+		if _, err := findSavedSearch(db, strconv.Itoa(wd.Config.SavedSearchID), userID, role); err != nil {
+			return fmt.Errorf("gespeicherte Suche %d nicht gefunden", wd.Config.SavedSearchID)
+		}
+	default:
+		return fmt.Errorf("unbekannter Widget-Typ: %s", wd.Type)
+	}
+	if wd.Config.Days < 0 || wd.Config.Limit < 0 || wd.Config.Limit > maxListLimit {
+		return fmt.Errorf("ungültige Widget-Konfiguration")
+	}
+	return nil
+}
+
+// data berechnet den Inhalt eines Widgets für den angemeldeten Benutzer.
+func (wd DashboardWidget) data(ctx context.Context, repos *Repositories, userID int, role string) (interface{}, error) {
+	limit := wd.Config.Limit
+	if limit == 0 {
+		limit = defaultWidgetLimit
+	}
+	opts := listOptions{Limit: limit, Fields: map[string]bool{}}
+
+	switch wd.Type {
+	case widgetUpcomingDeadlines:
+		days := wd.Config.Days
+		if days == 0 {
+			days = 90
+		}
+		where := `is_terminated = FALSE
+			AND cancellation_action_date IS NOT NULL
+			AND cancellation_action_date BETWEEN CURRENT_DATE AND ` + repos.dialect.DateInDays()
+		args := []interface{}{days}
+		if wd.Config.OnlyMine {
+			where += " AND owner_id = ?"
+			args = append(args, userID)
+		}
+		opts.Sort = []string{"cancellation_action_date ASC", "id ASC"}
+		return contractWidgetData(ctx, repos, where, args, opts)
+
+	case widgetWithoutDocuments:
+		where := "is_terminated = FALSE AND NOT EXISTS (SELECT 1 FROM documents WHERE documents.contract_id = contracts.id AND documents.deleted_at IS NULL)"
+		var args []interface{}
+		if wd.Config.OnlyMine {
+			where += " AND owner_id = ?"
+			args = append(args, userID)
+		}
+		opts.Sort = []string{"created_at DESC", "id ASC"}
+		return contractWidgetData(ctx, repos, where, args, opts)
+
+	case widgetCostByCategory:
+		rows, err := repos.db.QueryContext(ctx, `SELECT category, COUNT(*), COALESCE(SUM(annual_cost), 0) FROM contracts
+			WHERE is_terminated = FALSE AND deleted_at IS NULL AND (valid_until IS NULL OR valid_until > CURRENT_TIMESTAMP)
+			GROUP BY category ORDER BY category`)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		result := []CategoryCost{}
+		for rows.Next() {
+			var c CategoryCost
+			if err := rows.Scan(&c.Category, &c.Contracts, &c.AnnualCost); err != nil {
+				continue
+			}
+			result = append(result, c)
+		}
+		return result, rows.Err()
+
+	case widgetSavedSearch:
+		s, err := findSavedSearch(repos.db, strconv.Itoa(wd.Config.SavedSearchID), userID, role)
+		if err != nil {
+			return nil, fmt.Errorf("gespeicherte Suche %d nicht gefunden", wd.Config.SavedSearchID)
+		}
+		q := s.query()
+		q.Set("limit", strconv.Itoa(limit))
+		where, args, err := contractFilter(repos.dialect, q, userID)
+		if err != nil {
+			return nil, err
+		}
+		searchOpts, err := parseListOptions(q, "-created_at")
+		if err != nil {
+			return nil, err
+		}
+		if searchOpts.Fields == nil {
+			searchOpts.Fields = map[string]bool{}
+		}
+		return contractWidgetData(ctx, repos, where, args, searchOpts)
+	}
+	return nil, fmt.Errorf("unbekannter Widget-Typ: %s", wd.Type)
+}
+
+// contractWidgetData liefert Verträge ohne die großen Textfelder sowie die Gesamtanzahl.
+func contractWidgetData(ctx context.Context, repos *Repositories, where string, args []interface{}, opts listOptions) (interface{}, error) {
+	contracts, total, err := repos.Contracts.List(ctx, where, args, opts)
+	if err != nil {
+		return nil, err
+	}
+	if contracts == nil {
+		contracts = []Contract{}
+	}
+	if len(opts.Fields) > 0 {
+		return map[string]interface{}{"total": total, "contracts": projectContracts(contracts, opts.Fields)}, nil
+	}
+	return map[string]interface{}{"total": total, "contracts": contracts}, nil
+}
+
+func scanWidgets(db *DB, userID int) ([]DashboardWidget, error) {
+	rows, err := db.Query("SELECT id, user_id, type, title, config, position FROM dashboard_widgets WHERE user_id = ? ORDER BY position, id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	widgets := []DashboardWidget{}
+	for rows.Next() {
+		var wd DashboardWidget
+		var config string
+		if err := rows.Scan(&wd.ID, &wd.UserID, &wd.Type, &wd.Title, &config, &wd.Position); err != nil {
+			continue
+		}
+		json.Unmarshal([]byte(config), &wd.Config)
+		widgets = append(widgets, wd)
+	}
+	return widgets, rows.Err()
+}
+
+// dashboardHandlers bedient das persönliche Dashboard und seine Widgets.
+type dashboardHandlers struct {
+	repos *Repositories
+}
+
+// get liefert alle Widgets des Benutzers inklusive ihrer Daten.
+func (h *dashboardHandlers) get(w http.ResponseWriter, r *http.Request) {
+	userID := mustAtoi(r.Header.Get("X-User-ID"))
+	role := r.Header.Get("X-User-Role")
+
+	widgets, err := scanWidgets(h.repos.db, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	type widgetWithData struct {
+		DashboardWidget
+		Data  interface{} `json:"data"`
+		Error string      `json:"error,omitempty"`
+	}
+	result := make([]widgetWithData, len(widgets))
+	for i, wd := range widgets {
+		result[i].DashboardWidget = wd
+		data, err := wd.data(r.Context(), h.repos, userID, role)
+		if err != nil {
+			// Ein fehlerhaftes Widget soll das restliche Dashboard nicht verhindern
+			result[i].Error = err.Error()
+			continue
+		}
+		result[i].Data = data
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
+func (h *dashboardHandlers) listWidgets(w http.ResponseWriter, r *http.Request) {
+	widgets, err := scanWidgets(h.repos.db, mustAtoi(r.Header.Get("X-User-ID")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(widgets)
+}
+
+func (h *dashboardHandlers) createWidget(w http.ResponseWriter, r *http.Request) {
+	userID := mustAtoi(r.Header.Get("X-User-ID"))
+
+	var wd DashboardWidget
+	if err := json.NewDecoder(r.Body).Decode(&wd); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := wd.validate(h.repos.db, userID, r.Header.Get("X-User-Role")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	wd.UserID = userID
+
+	config, _ := json.Marshal(wd.Config)
+	id, err := h.repos.db.Insert("INSERT INTO dashboard_widgets (user_id, type, title, config, position) VALUES (?, ?, ?, ?, ?)",
+		wd.UserID, wd.Type, wd.Title, string(config), wd.Position)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	wd.ID = int(id)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(wd)
+}
+
+func (h *dashboardHandlers) updateWidget(w http.ResponseWriter, r *http.Request) {
+	userID := mustAtoi(r.Header.Get("X-User-ID"))
+	id := r.PathValue("id")
+
+	var wd DashboardWidget
+	if err := json.NewDecoder(r.Body).Decode(&wd); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := wd.validate(h.repos.db, userID, r.Header.Get("X-User-Role")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	config, _ := json.Marshal(wd.Config)
+	result, err := h.repos.db.Exec("UPDATE dashboard_widgets SET type = ?, title = ?, config = ?, position = ? WHERE id = ? AND user_id = ?",
+		wd.Type, wd.Title, string(config), wd.Position, id, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Widget nicht gefunden", http.StatusNotFound)
+		return
+	}
+
+	wd.ID = mustAtoi(id)
+	wd.UserID = userID
+	json.NewEncoder(w).Encode(wd)
+}
+
+func (h *dashboardHandlers) deleteWidget(w http.ResponseWriter, r *http.Request) {
+	result, err := h.repos.db.Exec("DELETE FROM dashboard_widgets WHERE id = ? AND user_id = ?",
+		r.PathValue("id"), mustAtoi(r.Header.Get("X-User-ID")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Widget nicht gefunden", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
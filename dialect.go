@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// Dialect kapselt die Unterschiede zwischen SQLite und PostgreSQL. Die Abfragen der
+// Handler sind so weit wie möglich portabel geschrieben (CURRENT_DATE,
+// CURRENT_TIMESTAMP, TRUE/FALSE, ON CONFLICT) und verwenden ? als Platzhalter; nur
+// was sich nicht einheitlich formulieren lässt, liefert der Dialekt.
+type Dialect interface {
+	Name() string
+	// Rebind ersetzt die Platzhalter ? durch die Schreibweise des Treibers.
+	Rebind(query string) string
+	// DateInDays ist das Datum in n Tagen, n wird als Platzhalter übergeben.
+	DateInDays() string
+	// DateString liefert eine Datums- oder Zeitspalte als Text JJJJ-MM-TT.
+	DateString(column string) string
+	// Like vergleicht ohne Beachtung der Groß- und Kleinschreibung.
+	Like() string
+	// LeadingInteger liefert die führenden Ziffern eines Textes als Zahl.
+	LeadingInteger(expr string) string
+	// JSONInt liefert eine Zahl aus einer JSON-Textspalte, z. B. JSONInt("payload", "data", "id").
+	JSONInt(column string, path ...string) string
+	// Returning gibt an, ob neue IDs mit RETURNING statt LastInsertId ermittelt werden.
+	Returning() bool
+	// TableExists prüft, ob die Tabelle existiert.
+	TableExists(q querier, table string) (bool, error)
+	// Search liefert die Abfragen der Volltextsuche über contracts_fts, gefiltert auf
+	// die Verträge in der Bedingung where. Platzhalter: Suchausdruck, Argumente von
+	// where, bei query zusätzlich LIMIT und OFFSET. query liefert ID, Relevanz (höher
+	// ist besser) und Ausschnitt mit \x02 und \x03 um die Treffer.
+	Search(where string) (count, query string)
+	// SearchExpression übersetzt die Suchbegriffe in den Suchausdruck des Index.
+	SearchExpression(terms []searchTerm) string
+}
+
+// DB ist die Datenbankverbindung mit ihrem Dialekt. Exec, Query und QueryRow schreiben
+// die Platzhalter für den Treiber um; sonst verhält sich DB wie *sql.DB.
+type DB struct {
+	*sql.DB
+	Dialect Dialect
+}
+
+// Tx ist eine Transaktion auf DB, mit denselben Ergänzungen.
+type Tx struct {
+	*sql.Tx
+	Dialect Dialect
+}
+
+// querier ist *DB oder *Tx.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Insert(query string, args ...interface{}) (int64, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	InsertContext(ctx context.Context, query string, args ...interface{}) (int64, error)
+}
+
+// openDatabase öffnet die Datenbank aus den Umgebungsvariablen: "sqlite" (Standard,
+// Datei contracts.db im Arbeitsverzeichnis) oder "postgres" (Verbindung aus
+// VERTRAGSDB_DATABASE_URL).
+func openDatabase(driver string) (*DB, error) {
+	switch driver {
+	case "", "sqlite":
+		// Hintergrundprozesse schreiben parallel zu Anfragen; kurz warten statt SQLITE_BUSY.
+		// Fremdschlüssel prüft SQLite nur, wenn sie je Verbindung eingeschaltet sind.
+		conn, err := sql.Open("sqlite", "./"+databaseFile+"?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)")
+		if err != nil {
+			return nil, err
+		}
+		return &DB{conn, sqliteDialect{}}, nil
+	case "postgres":
+		url := os.Getenv("VERTRAGSDB_DATABASE_URL")
+		if url == "" {
+			return nil, errors.New("VERTRAGSDB_DATABASE_URL fehlt")
+		}
+		conn, err := sql.Open("pgx", url)
+		if err != nil {
+			return nil, err
+		}
+		return &DB{conn, postgresDialect{}}, nil
+	default:
+		return nil, fmt.Errorf("unbekannte Datenbank: %s", driver)
+	}
+}
+
+func (d *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return d.ExecContext(context.Background(), query, args...)
+}
+
+func (d *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return d.QueryContext(context.Background(), query, args...)
+}
+
+func (d *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return d.QueryRowContext(context.Background(), query, args...)
+}
+
+func (d *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return d.DB.ExecContext(ctx, d.Dialect.Rebind(query), args...)
+}
+
+func (d *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return d.DB.QueryContext(ctx, d.Dialect.Rebind(query), args...)
+}
+
+func (d *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return d.DB.QueryRowContext(ctx, d.Dialect.Rebind(query), args...)
+}
+
+func (d *DB) Begin() (*Tx, error) {
+	return d.BeginTx(context.Background())
+}
+
+func (d *DB) BeginTx(ctx context.Context) (*Tx, error) {
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{tx, d.Dialect}, nil
+}
+
+// Insert führt ein INSERT aus und liefert die ID der neuen Zeile.
+func (d *DB) Insert(query string, args ...interface{}) (int64, error) {
+	return d.InsertContext(context.Background(), query, args...)
+}
+
+func (d *DB) InsertContext(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	return insertID(ctx, d, d.Dialect, query, args)
+}
+
+func (t *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return t.ExecContext(context.Background(), query, args...)
+}
+
+func (t *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return t.QueryContext(context.Background(), query, args...)
+}
+
+func (t *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return t.QueryRowContext(context.Background(), query, args...)
+}
+
+func (t *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return t.Tx.ExecContext(ctx, t.Dialect.Rebind(query), args...)
+}
+
+func (t *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return t.Tx.QueryContext(ctx, t.Dialect.Rebind(query), args...)
+}
+
+func (t *Tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return t.Tx.QueryRowContext(ctx, t.Dialect.Rebind(query), args...)
+}
+
+// Insert führt ein INSERT aus und liefert die ID der neuen Zeile.
+func (t *Tx) Insert(query string, args ...interface{}) (int64, error) {
+	return t.InsertContext(context.Background(), query, args...)
+}
+
+func (t *Tx) InsertContext(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	return insertID(ctx, t, t.Dialect, query, args)
+}
+
+func insertID(ctx context.Context, q querier, d Dialect, query string, args []interface{}) (int64, error) {
+	if d.Returning() {
+		var id int64
+		err := q.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+	result, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string                 { return "sqlite" }
+func (sqliteDialect) Rebind(query string) string   { return query }
+func (sqliteDialect) DateInDays() string           { return "date('now', '+' || ? || ' days')" }
+func (sqliteDialect) DateString(col string) string { return "substr(" + col + ", 1, 10)" }
+func (sqliteDialect) Like() string                 { return "LIKE" }
+func (sqliteDialect) Returning() bool              { return false }
+
+func (sqliteDialect) LeadingInteger(expr string) string {
+	return "CAST(" + expr + " AS INTEGER)"
+}
+
+func (sqliteDialect) JSONInt(col string, path ...string) string {
+	return "json_extract(" + col + ", '$." + strings.Join(path, ".") + "')"
+}
+
+func (sqliteDialect) TableExists(q querier, table string) (bool, error) {
+	var n int
+	err := q.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&n)
+	return n > 0, err
+}
+
+func (sqliteDialect) Search(where string) (count, query string) {
+	filter := "contracts_fts MATCH ? AND rowid IN (SELECT id FROM contracts WHERE deleted_at IS NULL AND (" + where + "))"
+	count = "SELECT COUNT(*) FROM contracts_fts WHERE " + filter
+	// Gewichte in Spaltenreihenfolge: Nummer, Titel, Partner, Kategorie, Inhalt, Konditionen, Dokumente.
+	// bm25 liefert negative Werte, kleinere sind besser.
+	query = `SELECT rowid, -bm25(contracts_fts, 10.0, 10.0, 5.0, 2.0, 1.0, 1.0, 1.0) AS score,
+		snippet(contracts_fts, -1, char(2), char(3), '…', 16)
+		FROM contracts_fts WHERE ` + filter + ` ORDER BY score DESC LIMIT ? OFFSET ?`
+	return count, query
+}
+
+// SearchExpression baut einen FTS5-Ausdruck: Phrasen in Anführungszeichen, Präfixe mit *.
+func (sqliteDialect) SearchExpression(terms []searchTerm) string {
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		switch {
+		case t.Or:
+			parts[i] = "OR"
+		case t.Prefix:
+			parts[i] = quoteFTS(t.Text) + "*"
+		default:
+			parts[i] = quoteFTS(t.Text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func quoteFTS(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string                 { return "postgres" }
+func (postgresDialect) DateInDays() string           { return "(CURRENT_DATE + CAST(? AS INTEGER))" }
+func (postgresDialect) DateString(col string) string { return "to_char(" + col + ", 'YYYY-MM-DD')" }
+func (postgresDialect) Like() string                 { return "ILIKE" }
+func (postgresDialect) Returning() bool              { return true }
+
+// Rebind nummeriert die Platzhalter als $1, $2, …; Zeichenketten, Bezeichner in
+// Anführungszeichen und Kommentare bleiben unverändert.
+func (postgresDialect) Rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end+2])
+			i += end + 1
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end+1])
+			i += end
+		case c == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// LeadingInteger liefert NULL statt eines Fehlers, wenn der Text nicht mit Ziffern
+// beginnt, wie CAST bei SQLite.
+func (postgresDialect) LeadingInteger(expr string) string {
+	return "CAST(substring(" + expr + " FROM '^[0-9]+') AS BIGINT)"
+}
+
+func (postgresDialect) JSONInt(col string, path ...string) string {
+	return "CAST(CAST(" + col + " AS JSONB) #>> '{" + strings.Join(path, ",") + "}' AS BIGINT)"
+}
+
+func (postgresDialect) TableExists(q querier, table string) (bool, error) {
+	var n int
+	err := q.QueryRow("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?", table).Scan(&n)
+	return n > 0, err
+}
+
+func (postgresDialect) Search(where string) (count, query string) {
+	from := `contracts_fts f JOIN contracts c ON c.id = f.contract_id, to_tsquery('simple', ?) q
+		WHERE f.search @@ q AND f.contract_id IN (SELECT id FROM contracts WHERE deleted_at IS NULL AND (` + where + `))`
+	count = "SELECT COUNT(*) FROM " + from
+	// Gewichte D, C, B, A wie bei SQLite: Inhalt 1, Kategorie 2, Partner 5, Nummer und Titel 10
+	query = `SELECT f.contract_id, ts_rank('{0.1, 0.2, 0.5, 1.0}', f.search, q) AS score,
+		ts_headline('simple', concat_ws(' ', c.title, c.content, c.conditions, f.documents), q,
+			'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', MaxWords=16, MinWords=8')
+		FROM ` + from + ` ORDER BY score DESC LIMIT ? OFFSET ?`
+	return count, query
+}
+
+// SearchExpression baut einen tsquery-Ausdruck. Der Index enthält die Wörter klein
+// und ohne Umlaute (contracts_fts_normalize), die Suchbegriffe werden ebenso zerlegt.
+// Begriffe ohne Buchstaben und Ziffern entfallen samt ihrer OR-Verknüpfung.
+func (postgresDialect) SearchExpression(terms []searchTerm) string {
+	var parts []string
+	lastWasOr := true
+	for _, t := range terms {
+		if t.Or {
+			if !lastWasOr {
+				parts = append(parts, "|")
+				lastWasOr = true
+			}
+			continue
+		}
+		words := strings.FieldsFunc(umlautReplacer.Replace(strings.ToLower(t.Text)), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if len(words) == 0 {
+			continue
+		}
+		if t.Prefix {
+			words[len(words)-1] += ":*"
+		}
+		if !lastWasOr {
+			parts = append(parts, "&")
+		}
+		parts = append(parts, "("+strings.Join(words, " <-> ")+")")
+		lastWasOr = false
+	}
+	if len(parts) > 0 && parts[len(parts)-1] == "|" {
+		parts = parts[:len(parts)-1]
+	}
+	return strings.Join(parts, " ")
+}
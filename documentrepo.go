@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// DocumentRepository verwaltet Dokumente und ihre Versionen. Die Dateien selbst liegen
+// im Dokumentenspeicher; das Repository kennt nur ihre Schlüssel.
+type DocumentRepository struct {
+	s *Repositories
+}
+
+// Get liest ein Dokument einschließlich gelöschter.
+func (r *DocumentRepository) Get(ctx context.Context, id int) (*Document, error) {
+	doc, err := scanDocument(r.s.q.QueryRowContext(ctx, "SELECT "+documentColumns+" FROM "+documentFrom+" WHERE d.id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFoundError("Document not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// ListByContract liefert die Dokumente eines Vertrags, mit deleted stattdessen die gelöschten.
+func (r *DocumentRepository) ListByContract(ctx context.Context, contractID int, deleted bool) ([]Document, error) {
+	where := "d.deleted_at IS NULL"
+	if deleted {
+		where = "d.deleted_at IS NOT NULL"
+	}
+	rows, err := r.s.q.QueryContext(ctx, "SELECT "+documentColumns+" FROM "+documentFrom+" WHERE d.contract_id = ? AND "+where+" ORDER BY d.id", contractID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var documents []Document
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, doc)
+	}
+	return documents, rows.Err()
+}
+
+// validateDocument prüft Dokumenttyp und Beschreibung.
+func validateDocument(docType, description string) error {
+	if !validDocumentType(docType) {
+		return validationError("Unbekannter Dokumenttyp: %s", docType)
+	}
+	if len(description) > maxDocumentDescription {
+		return validationError("Beschreibung ist länger als %d Zeichen", maxDocumentDescription)
+	}
+	return nil
+}
+
+// Create legt zu einer gespeicherten Datei ein Dokument mit Version 1 an.
+func (r *DocumentRepository) Create(ctx context.Context, contractID int, f storedFile, docType, description string, userID int) (*Document, error) {
+	if err := validateDocument(docType, description); err != nil {
+		return nil, err
+	}
+	var doc *Document
+	err := r.s.Transaction(ctx, func(tx *Repositories) error {
+		if _, err := tx.Contracts.Get(ctx, contractID); err != nil {
+			return err
+		}
+		id, err := tx.q.InsertContext(ctx, `INSERT INTO documents (contract_id, filename, storage_key, extraction_status, document_type,
+			description, uploaded_by, file_size, mime_type, sha256, version) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1)`,
+			contractID, f.Filename, f.Key, extractionPending, docType, description, userID, f.Size, f.MimeType, f.SHA256)
+		if err != nil {
+			return err
+		}
+		if err := tx.Documents.insertVersion(ctx, int(id), 1, f, userID); err != nil {
+			return err
+		}
+		doc, err = tx.Documents.Get(ctx, int(id))
+		return err
+	})
+	return doc, err
+}
+
+// AddVersion macht eine gespeicherte Datei zur neuen aktuellen Version eines
+// Dokuments, zusammen mit Dokumenttyp und Beschreibung aus doc. Der Text wird danach
+// neu extrahiert.
+func (r *DocumentRepository) AddVersion(ctx context.Context, doc *Document, f storedFile, userID int) (*Document, error) {
+	if err := validateDocument(doc.DocumentType, doc.Description); err != nil {
+		return nil, err
+	}
+	var updated *Document
+	err := r.s.Transaction(ctx, func(tx *Repositories) error {
+		var version int
+		if err := tx.q.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) + 1 FROM document_versions WHERE document_id = ?", doc.ID).
+			Scan(&version); err != nil {
+			return err
+		}
+		if err := tx.Documents.insertVersion(ctx, doc.ID, version, f, userID); err != nil {
+			return err
+		}
+		result, err := tx.q.ExecContext(ctx, `UPDATE documents SET filename = ?, storage_key = ?, file_size = ?, mime_type = ?, sha256 = ?,
+			version = ?, uploaded_by = ?, uploaded_at = ?, document_type = ?, description = ?,
+			extracted_text = NULL, extraction_status = ?, extraction_error = NULL
+			WHERE id = ? AND deleted_at IS NULL`,
+			f.Filename, f.Key, f.Size, f.MimeType, f.SHA256,
+			version, userID, time.Now(), doc.DocumentType, doc.Description, extractionPending, doc.ID)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return notFoundError("Document not found")
+		}
+		updated, err = tx.Documents.Get(ctx, doc.ID)
+		return err
+	})
+	return updated, err
+}
+
+// insertVersion legt die Versionszeile zu einer gespeicherten Datei an.
+func (r *DocumentRepository) insertVersion(ctx context.Context, docID, version int, f storedFile, userID int) error {
+	_, err := r.s.q.ExecContext(ctx, `INSERT INTO document_versions
+		(document_id, version, filename, storage_key, file_size, mime_type, sha256, uploaded_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		docID, version, f.Filename, f.Key, f.Size, f.MimeType, f.SHA256, userID)
+	return err
+}
+
+// UpdateMetadata ändert Dokumenttyp und Beschreibung eines Dokuments außerhalb des
+// Papierkorbs. nil lässt ein Feld unverändert.
+func (r *DocumentRepository) UpdateMetadata(ctx context.Context, id int, docType, description *string) (*Document, error) {
+	var doc *Document
+	err := r.s.Transaction(ctx, func(tx *Repositories) error {
+		var err error
+		if doc, err = tx.Documents.Get(ctx, id); err != nil {
+			return err
+		}
+		if doc.DeletedAt != nil {
+			return notFoundError("Document not found")
+		}
+		if docType != nil {
+			doc.DocumentType = *docType
+		}
+		if description != nil {
+			doc.Description = strings.TrimSpace(*description)
+		}
+		if err := validateDocument(doc.DocumentType, doc.Description); err != nil {
+			return err
+		}
+		_, err = tx.q.ExecContext(ctx, "UPDATE documents SET document_type = ?, description = ? WHERE id = ?",
+			doc.DocumentType, doc.Description, doc.ID)
+		return err
+	})
+	return doc, err
+}
+
+// Trash löscht ein Dokument vorläufig. Dateien und Versionen bleiben erhalten, bis ein
+// Administrator das Dokument wiederherstellt. Der extrahierte Text wird entfernt,
+// damit das Dokument nicht mehr in der Suche erscheint.
+func (r *DocumentRepository) Trash(ctx context.Context, id, userID int) (*Document, error) {
+	var doc *Document
+	err := r.s.Transaction(ctx, func(tx *Repositories) error {
+		var hold bool
+		err := tx.q.QueryRowContext(ctx, "SELECT c.legal_hold FROM documents d JOIN contracts c ON c.id = d.contract_id WHERE d.id = ?", id).Scan(&hold)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if hold {
+			return conflictError("%s, seine Dokumente können nicht gelöscht werden", errLegalHold)
+		}
+
+		result, err := tx.q.ExecContext(ctx, `UPDATE documents SET deleted_at = ?, deleted_by = ?, extracted_text = NULL
+			WHERE id = ? AND deleted_at IS NULL`, time.Now(), userID, id)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return notFoundError("Document not found")
+		}
+		doc, err = tx.Documents.Get(ctx, id)
+		return err
+	})
+	return doc, err
+}
+
+// Restore stellt ein gelöschtes Dokument wieder her. Den Text muss der Aufrufer neu
+// extrahieren lassen.
+func (r *DocumentRepository) Restore(ctx context.Context, id int) (*Document, error) {
+	var doc *Document
+	err := r.s.Transaction(ctx, func(tx *Repositories) error {
+		result, err := tx.q.ExecContext(ctx, "UPDATE documents SET deleted_at = NULL, deleted_by = NULL WHERE id = ? AND deleted_at IS NOT NULL", id)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return notFoundError("Gelöschtes Dokument nicht gefunden")
+		}
+		doc, err = tx.Documents.Get(ctx, id)
+		return err
+	})
+	return doc, err
+}
+
+// Versions liest alle Versionen eines Dokuments, die neueste zuerst.
+func (r *DocumentRepository) Versions(ctx context.Context, docID int) ([]DocumentVersion, error) {
+	rows, err := r.s.q.QueryContext(ctx, `SELECT v.id, v.document_id, v.version, v.filename, v.storage_key, v.file_size, v.mime_type,
+		v.sha256, v.uploaded_by, u.username, v.uploaded_at
+		FROM document_versions v LEFT JOIN users u ON u.id = v.uploaded_by
+		WHERE v.document_id = ? ORDER BY v.version DESC`, docID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []DocumentVersion{}
+	for rows.Next() {
+		var v DocumentVersion
+		if err := rows.Scan(&v.ID, &v.DocumentID, &v.Version, &v.Filename, &v.StorageKey, &v.FileSize, &v.MimeType,
+			&v.SHA256, &v.UploadedBy, &v.UploadedByName, &v.UploadedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// Version liest eine Version eines Dokuments; deleted gibt an, ob das Dokument gelöscht ist.
+func (r *DocumentRepository) Version(ctx context.Context, docID, version int) (v *DocumentVersion, deleted bool, err error) {
+	var deletedAt sql.NullTime
+	v = &DocumentVersion{DocumentID: docID, Version: version}
+	err = r.s.q.QueryRowContext(ctx, `SELECT v.filename, v.storage_key, v.mime_type, d.deleted_at
+		FROM document_versions v JOIN documents d ON d.id = v.document_id
+		WHERE v.document_id = ? AND v.version = ?`, docID, version).
+		Scan(&v.Filename, &v.StorageKey, &v.MimeType, &deletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, notFoundError("Version nicht gefunden")
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return v, deletedAt.Valid, nil
+}
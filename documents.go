@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dokumenttypen
+const (
+	docTypeContract       = "contract"
+	docTypeAmendment      = "amendment"
+	docTypeInvoice        = "invoice"
+	docTypeCorrespondence = "correspondence"
+	docTypeTermination    = "termination"
+)
+
+var documentTypes = []string{docTypeContract, docTypeAmendment, docTypeInvoice, docTypeCorrespondence, docTypeTermination}
+
+// documentTypeLabels sind die Bezeichnungen der Dokumenttypen in Berichten, wie im Frontend.
+var documentTypeLabels = map[string]string{
+	docTypeContract:       "Vertrag",
+	docTypeAmendment:      "Nachtrag",
+	docTypeInvoice:        "Rechnung",
+	docTypeCorrespondence: "Korrespondenz",
+	docTypeTermination:    "Kündigung",
+}
+
+const maxDocumentDescription = 2000
+
+// DocumentVersion ist ein hochgeladener Stand eines Dokuments. Die aktuelle Version
+// steht zusätzlich in der Zeile des Dokuments.
+type DocumentVersion struct {
+	ID             int       `json:"id"`
+	DocumentID     int       `json:"document_id"`
+	Version        int       `json:"version"`
+	Filename       string    `json:"filename"`
+	StorageKey     string    `json:"-"`
+	FileSize       *int64    `json:"file_size"`
+	MimeType       *string   `json:"mime_type"`
+	SHA256         *string   `json:"sha256"`
+	UploadedBy     *int      `json:"uploaded_by"`
+	UploadedByName *string   `json:"uploaded_by_name"`
+	UploadedAt     time.Time `json:"uploaded_at"`
+}
+
+// storedFile beschreibt eine soeben in den Speicher geschriebene Datei.
+type storedFile struct {
+	Key      string
+	Filename string
+	Size     int64
+	MimeType string
+	SHA256   string
+}
+
+// documentColumns passt zu scanDocument; d ist documents, u der hochladende Benutzer.
+const documentColumns = `d.id, d.contract_id, d.filename, d.storage_key, d.uploaded_at, d.extraction_status, d.extraction_error,
+	d.document_type, COALESCE(d.description, ''), d.uploaded_by, u.username, d.file_size, d.mime_type, d.sha256,
+	d.version, d.deleted_at, d.deleted_by`
+
+const documentFrom = "documents d LEFT JOIN users u ON u.id = d.uploaded_by"
+
+func scanDocument(row interface{ Scan(...interface{}) error }) (Document, error) {
+	var doc Document
+	var deletedAt sql.NullTime
+	err := row.Scan(&doc.ID, &doc.ContractID, &doc.Filename, &doc.StorageKey, &doc.UploadedAt,
+		&doc.ExtractionStatus, &doc.ExtractionError, &doc.DocumentType, &doc.Description, &doc.UploadedBy,
+		&doc.UploadedByName, &doc.FileSize, &doc.MimeType, &doc.SHA256, &doc.Version, &deletedAt, &doc.DeletedBy)
+	if deletedAt.Valid {
+		doc.DeletedAt = &deletedAt.Time
+	}
+	return doc, err
+}
+
+func validDocumentType(t string) bool {
+	for _, dt := range documentTypes {
+		if dt == t {
+			return true
+		}
+	}
+	return false
+}
+
+// countingHash zählt die Bytes und bildet dabei den SHA-256-Hash.
+type countingHash struct {
+	hash.Hash
+	n int64
+}
+
+func (c *countingHash) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return c.Hash.Write(p)
+}
+
+// documentUpload ist ein gelesenes Upload-Formular. Die Datei liegt bereits im
+// Speicher; schlägt danach etwas fehl, löscht der Aufrufer sie über discard.
+type documentUpload struct {
+	File         storedFile
+	DocumentType string
+	Description  *string
+}
+
+func (u *documentUpload) discard() {
+	if u.File.Key != "" {
+		store.Delete(context.Background(), u.File.Key)
+	}
+}
+
+// readDocumentUpload liest ein Multipart-Formular mit dem Feld "document" und den
+// optionalen Feldern document_type und description. Die Reihenfolge der Felder ist
+// beliebig; die Datei wird beim Lesen direkt gespeichert.
+func readDocumentUpload(w http.ResponseWriter, r *http.Request, db *DB, contractID, documentID int) (*documentUpload, int, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize+uploadFormOverhead)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	u := &documentUpload{}
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			u.discard()
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return nil, http.StatusRequestEntityTooLarge, err
+			}
+			return nil, http.StatusBadRequest, err
+		}
+		switch {
+		case p.FormName() == "document" && p.FileName() != "" && u.File.Key == "":
+			u.File, err = storeUpload(r.Context(), p)
+			if err != nil {
+				p.Close()
+				var infected *infectedError
+				if errors.As(err, &infected) {
+					recordQuarantine(db, infected, contractID, documentID, mustAtoi(r.Header.Get("X-User-ID")))
+					return nil, http.StatusUnprocessableEntity, err
+				}
+				var ue *uploadError
+				if errors.As(err, &ue) {
+					return nil, ue.status, err
+				}
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					return nil, http.StatusRequestEntityTooLarge, err
+				}
+				return nil, http.StatusInternalServerError, err
+			}
+		case p.FormName() == "document_type" || p.FormName() == "description":
+			value, err := io.ReadAll(io.LimitReader(p, maxDocumentDescription+1))
+			if err != nil {
+				p.Close()
+				u.discard()
+				return nil, http.StatusBadRequest, err
+			}
+			text := strings.TrimSpace(string(value))
+			if p.FormName() == "document_type" {
+				u.DocumentType = text
+			} else {
+				u.Description = &text
+			}
+		}
+		p.Close()
+	}
+
+	switch {
+	case u.File.Key == "":
+		return nil, http.StatusBadRequest, errors.New("Keine Datei übermittelt")
+	case u.DocumentType != "" && !validDocumentType(u.DocumentType):
+		u.discard()
+		return nil, http.StatusBadRequest, fmt.Errorf("Unbekannter Dokumenttyp: %s", u.DocumentType)
+	case u.Description != nil && len(*u.Description) > maxDocumentDescription:
+		u.discard()
+		return nil, http.StatusBadRequest, fmt.Errorf("Beschreibung ist länger als %d Zeichen", maxDocumentDescription)
+	}
+	return u, 0, nil
+}
+
+// documentHandlers bedient die Dokumente eines Vertrags und ihre Versionen.
+type documentHandlers struct {
+	db        *DB
+	documents *DocumentRepository
+	contracts *ContractRepository
+}
+
+func (h *documentHandlers) upload(w http.ResponseWriter, r *http.Request) {
+	contractID := mustAtoi(r.PathValue("id"))
+	if _, err := h.contracts.Get(r.Context(), contractID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Die Datei wird direkt aus der Anfrage in den Speicher gestreamt
+	upload, status, err := readDocumentUpload(w, r, h.db, contractID, 0)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if upload.DocumentType == "" {
+		upload.DocumentType = docTypeContract
+	}
+	description := ""
+	if upload.Description != nil {
+		description = *upload.Description
+	}
+
+	doc, err := h.documents.Create(r.Context(), contractID, upload.File, upload.DocumentType, description,
+		mustAtoi(r.Header.Get("X-User-ID")))
+	if err != nil {
+		upload.discard()
+		writeError(w, err)
+		return
+	}
+	wakeExtractionWorker()
+	publishChange(changeDocumentCreated, map[string]interface{}{"document": doc})
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(doc)
+}
+
+// list listet die Dokumente eines Vertrags. Mit ?deleted=true sehen Administratoren
+// stattdessen die gelöschten Dokumente.
+func (h *documentHandlers) list(w http.ResponseWriter, r *http.Request) {
+	deleted := r.URL.Query().Get("deleted") == "true"
+	if deleted && r.Header.Get("X-User-Role") != "admin" {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	documents, err := h.documents.ListByContract(r.Context(), mustAtoi(r.PathValue("id")), deleted)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(documents)
+}
+
+// visible liest das Dokument der Anfrage. Gelöschte Dokumente sehen nur Administratoren.
+func (h *documentHandlers) visible(r *http.Request) (*Document, error) {
+	doc, err := h.documents.Get(r.Context(), mustAtoi(r.PathValue("docId")))
+	if err != nil {
+		return nil, err
+	}
+	if doc.DeletedAt != nil && r.Header.Get("X-User-Role") != "admin" {
+		return nil, notFoundError("Document not found")
+	}
+	return doc, nil
+}
+
+// get liefert die Metadaten eines Dokuments.
+func (h *documentHandlers) get(w http.ResponseWriter, r *http.Request) {
+	doc, err := h.visible(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(doc)
+}
+
+// download liefert die Datei der aktuellen Version; gelöschte Dokumente wie bei
+// den Versionen nur für Administratoren.
+func (h *documentHandlers) download(w http.ResponseWriter, r *http.Request) {
+	doc, err := h.visible(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	serveStoredFile(w, r, doc.Filename, doc.MimeType, doc.StorageKey)
+}
+
+// update ändert Dokumenttyp und Beschreibung. Nicht übermittelte Felder bleiben
+// unverändert; eine neue Datei wird über /versions hochgeladen.
+func (h *documentHandlers) update(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		DocumentType *string `json:"document_type"`
+		Description  *string `json:"description"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	doc, err := h.documents.UpdateMetadata(r.Context(), mustAtoi(r.PathValue("docId")), input.DocumentType, input.Description)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	publishChange(changeDocumentUpdated, map[string]interface{}{"document": doc})
+
+	json.NewEncoder(w).Encode(doc)
+}
+
+// delete löscht ein Dokument vorläufig, siehe DocumentRepository.Trash.
+func (h *documentHandlers) delete(w http.ResponseWriter, r *http.Request) {
+	doc, err := h.documents.Trash(r.Context(), mustAtoi(r.PathValue("docId")), mustAtoi(r.Header.Get("X-User-ID")))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	publishChange(changeDocumentDeleted, map[string]interface{}{"document": doc})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// restore stellt ein gelöschtes Dokument wieder her und extrahiert den Text erneut.
+func (h *documentHandlers) restore(w http.ResponseWriter, r *http.Request) {
+	doc, err := h.documents.Restore(r.Context(), mustAtoi(r.PathValue("docId")))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	queueExtraction(h.db, "id = ?", doc.ID)
+	publishChange(changeDocumentRestored, map[string]interface{}{"document": doc})
+
+	json.NewEncoder(w).Encode(doc)
+}
+
+// versions listet alle Versionen eines Dokuments, die neueste zuerst.
+func (h *documentHandlers) versions(w http.ResponseWriter, r *http.Request) {
+	doc, err := h.visible(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	versions, err := h.documents.Versions(r.Context(), doc.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(versions)
+}
+
+// uploadVersion lädt eine neue Version hoch. Sie wird zur aktuellen Version des
+// Dokuments; frühere Versionen bleiben abrufbar. Eine Datei, die der aktuellen Version
+// gleicht, wird abgelehnt.
+func (h *documentHandlers) uploadVersion(w http.ResponseWriter, r *http.Request) {
+	doc, err := h.documents.Get(r.Context(), mustAtoi(r.PathValue("docId")))
+	if err == nil && doc.DeletedAt != nil {
+		err = notFoundError("Document not found")
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	upload, status, err := readDocumentUpload(w, r, h.db, doc.ContractID, doc.ID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if doc.SHA256 != nil && *doc.SHA256 == upload.File.SHA256 {
+		upload.discard()
+		http.Error(w, "Die Datei ist identisch mit der aktuellen Version", http.StatusConflict)
+		return
+	}
+	if upload.DocumentType != "" {
+		doc.DocumentType = upload.DocumentType
+	}
+	if upload.Description != nil {
+		doc.Description = *upload.Description
+	}
+
+	updated, err := h.documents.AddVersion(r.Context(), doc, upload.File, mustAtoi(r.Header.Get("X-User-ID")))
+	if err != nil {
+		upload.discard()
+		writeError(w, err)
+		return
+	}
+	wakeExtractionWorker()
+	publishChange(changeDocumentUpdated, map[string]interface{}{"document": updated})
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(updated)
+}
+
+// downloadVersion liefert die Datei einer bestimmten Version.
+func (h *documentHandlers) downloadVersion(w http.ResponseWriter, r *http.Request) {
+	v, deleted, err := h.documents.Version(r.Context(), mustAtoi(r.PathValue("docId")), mustAtoi(r.PathValue("version")))
+	if err == nil && deleted && r.Header.Get("X-User-Role") != "admin" {
+		err = notFoundError("Version nicht gefunden")
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	serveStoredFile(w, r, v.Filename, v.MimeType, v.StorageKey)
+}
+
+// serveStoredFile sendet eine Datei aus dem Speicher als Anhang. Mit inline=true
+// werden PDFs, Bilder und Text zur Anzeige im Browser gesendet.
+func serveStoredFile(w http.ResponseWriter, r *http.Request, filename string, mimeType *string, key string) {
+	file, info, err := store.Get(r.Context(), key)
+	if errors.Is(err, errStorageNotFound) {
+		http.Error(w, "Datei nicht gefunden", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	contentType := "application/pdf"
+	if mimeType != nil && *mimeType != "" {
+		contentType = *mimeType
+	}
+	disposition := "attachment"
+	if r.URL.Query().Get("inline") == "true" && inlineTypes[contentType] {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Disposition", contentDisposition(disposition, filename))
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private")
+	// Range-Anfragen, sofern das Backend wahlfreien Zugriff bietet (lokal und S3)
+	if rs, ok := file.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, filename, info.ModTime, rs)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	io.Copy(w, file)
+}
+
+// backfillDocumentMetadata ergänzt Größe, MIME-Typ und Hash für Dokumente, die vor
+// Migration v12 hochgeladen wurden. Läuft einmal beim Start im Hintergrund.
+func backfillDocumentMetadata(db *DB) {
+	rows, err := db.Query("SELECT id, storage_key, filename FROM document_versions WHERE sha256 IS NULL ORDER BY id")
+	if err != nil {
+		log.Printf("Dokument-Metadaten nicht ergänzt: %v", err)
+		return
+	}
+	type pending struct {
+		id            int
+		key, filename string
+	}
+	var versions []pending
+	for rows.Next() {
+		var p pending
+		if rows.Scan(&p.id, &p.key, &p.filename) == nil {
+			versions = append(versions, p)
+		}
+	}
+	rows.Close()
+
+	done := 0
+	for _, v := range versions {
+		f, err := describeStoredFile(v.key, v.filename)
+		if err != nil {
+			log.Printf("Metadaten für Dokumentversion %d (%s): %v", v.id, v.key, err)
+			continue
+		}
+		db.Exec("UPDATE document_versions SET file_size = ?, mime_type = ?, sha256 = ? WHERE id = ?",
+			f.Size, f.MimeType, f.SHA256, v.id)
+		db.Exec("UPDATE documents SET file_size = ?, mime_type = ?, sha256 = ? WHERE storage_key = ?",
+			f.Size, f.MimeType, f.SHA256, v.key)
+		done++
+	}
+	if done > 0 {
+		log.Printf("Metadaten für %d Dokumentversionen ergänzt", done)
+	}
+}
+
+func describeStoredFile(key, filename string) (storedFile, error) {
+	r, _, err := store.Get(context.Background(), key)
+	if err != nil {
+		return storedFile{}, err
+	}
+	defer r.Close()
+	br := bufio.NewReaderSize(r, 512)
+	head, _ := br.Peek(512)
+	h := &countingHash{Hash: sha256.New()}
+	if _, err := io.Copy(h, br); err != nil {
+		return storedFile{}, err
+	}
+	mimeType := sniffUploadType(head, strings.ToLower(path.Ext(filename)))
+	return storedFile{Key: key, Filename: filename, Size: h.n, MimeType: mimeType, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
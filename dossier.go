@@ -0,0 +1,398 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Eine Vertragsakte ist ein ZIP-Archiv mit allen Dokumenten eines Vertrags und dem
+// Datenblatt als PDF (datenblatt.pdf) und JSON (vertrag.json). Die Dateien werden
+// direkt aus dem Speicher in die Antwort geschrieben, ohne sie vollständig zu laden.
+
+// maxDossierContracts begrenzt die Zahl der Verträge in einer Sammelakte.
+const maxDossierContracts = 500
+
+// ContractRef verweist auf einen Rahmen- oder Einzelvertrag.
+type ContractRef struct {
+	ID             int        `json:"id"`
+	ContractNumber string     `json:"contract_number"`
+	Title          string     `json:"title"`
+	Partner        string     `json:"partner"`
+	ValidFrom      time.Time  `json:"valid_from"`
+	ValidUntil     *time.Time `json:"valid_until"`
+	Status         string     `json:"status"`
+}
+
+// DossierDocument ist ein Dokument mit allen Versionen. Path ist der Pfad der
+// Datei im Archiv.
+type DossierDocument struct {
+	Document
+	Path     string           `json:"path"`
+	Versions []DossierVersion `json:"versions"`
+}
+
+// DossierVersion ist eine Version eines Dokuments; Path ist nur gesetzt, wenn die
+// Datei im Archiv enthalten ist.
+type DossierVersion struct {
+	DocumentVersion
+	Path string `json:"path,omitempty"`
+}
+
+// HistoryEntry ist ein Ereignis im Verlauf eines Vertrags.
+type HistoryEntry struct {
+	At    time.Time `json:"at"`
+	Event string    `json:"event"`
+	User  *string   `json:"user,omitempty"`
+}
+
+// ContractDossier ist das Datenblatt eines Vertrags, Grundlage für vertrag.json
+// und datenblatt.pdf.
+type ContractDossier struct {
+	Contract            Contract          `json:"contract"`
+	Status              string            `json:"status"`
+	OwnerName           *string           `json:"owner_name"`
+	FrameworkContract   *ContractRef      `json:"framework_contract,omitempty"`
+	IndividualContracts []ContractRef     `json:"individual_contracts,omitempty"`
+	Documents           []DossierDocument `json:"documents"`
+	History             []HistoryEntry    `json:"history"`
+	GeneratedAt         time.Time         `json:"generated_at"`
+}
+
+func contractRef(c Contract, now time.Time) ContractRef {
+	return ContractRef{ID: c.ID, ContractNumber: c.ContractNumber, Title: c.Title, Partner: c.Partner,
+		ValidFrom: c.ValidFrom, ValidUntil: c.ValidUntil, Status: contractStatus(c, now)}
+}
+
+// loadContractDossier stellt das Datenblatt eines Vertrags zusammen. Gelöschte
+// Dokumente fehlen, erscheinen aber im Verlauf.
+func loadContractDossier(ctx context.Context, repos *Repositories, c Contract, ec *exportContext) (*ContractDossier, error) {
+	d := &ContractDossier{
+		Contract:    c,
+		Status:      contractStatus(c, ec.now),
+		Documents:   []DossierDocument{},
+		GeneratedAt: ec.now,
+	}
+	if c.OwnerID != nil {
+		if name, ok := ec.usernames[*c.OwnerID]; ok {
+			d.OwnerName = &name
+		}
+	}
+
+	if c.FrameworkContractID != nil {
+		framework, _, err := repos.Contracts.List(ctx, "id = ?", []interface{}{*c.FrameworkContractID},
+			listOptions{Limit: -1, Fields: map[string]bool{}, Sort: []string{"id ASC"}})
+		if err != nil {
+			return nil, err
+		}
+		if len(framework) > 0 {
+			ref := contractRef(framework[0], ec.now)
+			d.FrameworkContract = &ref
+		}
+	}
+	if c.ContractType == "framework" {
+		children, _, err := repos.Contracts.List(ctx, "framework_contract_id = ?", []interface{}{c.ID},
+			listOptions{Limit: -1, Fields: map[string]bool{}, Sort: []string{"contract_number ASC", "id ASC"}})
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			d.IndividualContracts = append(d.IndividualContracts, contractRef(child, ec.now))
+		}
+	}
+
+	rows, err := repos.db.QueryContext(ctx, "SELECT "+documentColumns+" FROM "+documentFrom+
+		" WHERE d.contract_id = ? AND d.deleted_at IS NULL ORDER BY d.uploaded_at, d.id", c.ID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		d.Documents = append(d.Documents, DossierDocument{Document: doc})
+	}
+	rows.Close()
+	for i := range d.Documents {
+		versions, err := repos.Documents.Versions(ctx, d.Documents[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		d.Documents[i].Versions = make([]DossierVersion, len(versions))
+		for j, v := range versions {
+			d.Documents[i].Versions[j] = DossierVersion{DocumentVersion: v}
+		}
+	}
+
+	if d.History, err = contractHistory(repos.db, c); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// contractHistory liefert den Verlauf eines Vertrags: Anlage, hochgeladene
+// Dokumente und Versionen, gelöschte Dokumente und Beendigung.
+func contractHistory(db *DB, c Contract) ([]HistoryEntry, error) {
+	history := []HistoryEntry{{At: c.CreatedAt, Event: "Vertrag angelegt"}}
+
+	rows, err := db.Query(`SELECT v.version, v.filename, v.uploaded_at, u.username
+		FROM document_versions v JOIN documents d ON d.id = v.document_id LEFT JOIN users u ON u.id = v.uploaded_by
+		WHERE d.contract_id = ?`, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var version int
+		var filename string
+		var e HistoryEntry
+		if err := rows.Scan(&version, &filename, &e.At, &e.User); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		e.Event = "Dokument hochgeladen: " + filename
+		if version > 1 {
+			e.Event = fmt.Sprintf("Version %d hochgeladen: %s", version, filename)
+		}
+		history = append(history, e)
+	}
+	rows.Close()
+
+	rows, err = db.Query(`SELECT d.filename, d.deleted_at, u.username
+		FROM documents d LEFT JOIN users u ON u.id = d.deleted_by
+		WHERE d.contract_id = ? AND d.deleted_at IS NOT NULL`, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var filename string
+		var e HistoryEntry
+		if err := rows.Scan(&filename, &e.At, &e.User); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		e.Event = "Dokument gelöscht: " + filename
+		history = append(history, e)
+	}
+	rows.Close()
+
+	if c.TerminatedAt != nil {
+		history = append(history, HistoryEntry{At: *c.TerminatedAt, Event: "Vertrag beendet"})
+	}
+	sort.SliceStable(history, func(i, j int) bool { return history[i].At.Before(history[j].At) })
+	return history, nil
+}
+
+// dossierWriter schreibt Vertragsakten in ein ZIP-Archiv.
+type dossierWriter struct {
+	zw       *zip.Writer
+	ctx      context.Context
+	repos    *Repositories
+	versions bool            // auch frühere Versionen der Dokumente
+	used     map[string]bool // belegte Pfade, klein geschrieben
+	missing  []string        // Dateien, die nicht aus dem Speicher gelesen werden konnten
+}
+
+func newDossierWriter(ctx context.Context, repos *Repositories, w io.Writer, versions bool) *dossierWriter {
+	return &dossierWriter{zw: zip.NewWriter(w), ctx: ctx, repos: repos, versions: versions, used: map[string]bool{}}
+}
+
+// uniquePath hängt bei Namensgleichheit " (2)", " (3)", … an den Dateinamen an.
+func (dw *dossierWriter) uniquePath(dir, name string) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	p := dir + name
+	for i := 2; dw.used[strings.ToLower(p)]; i++ {
+		p = fmt.Sprintf("%s%s (%d)%s", dir, base, i, ext)
+	}
+	dw.used[strings.ToLower(p)] = true
+	return p
+}
+
+func (dw *dossierWriter) create(name string, modified time.Time, method uint16) (io.Writer, error) {
+	return dw.zw.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: modified})
+}
+
+// addContract schreibt Datenblatt und Dokumente eines Vertrags unter dir.
+func (dw *dossierWriter) addContract(dir string, c Contract, ec *exportContext) error {
+	d, err := loadContractDossier(dw.ctx, dw.repos, c, ec)
+	if err != nil {
+		return err
+	}
+
+	// Pfade vorab vergeben, damit sie in vertrag.json stehen
+	for i := range d.Documents {
+		doc := &d.Documents[i]
+		doc.Path = dw.uniquePath(dir+"dokumente/", doc.Filename)
+		for j := range doc.Versions {
+			v := &doc.Versions[j]
+			if v.Version == doc.Version {
+				v.Path = doc.Path
+			} else if dw.versions {
+				ext := path.Ext(v.Filename)
+				name := fmt.Sprintf("%s (Version %d)%s", strings.TrimSuffix(v.Filename, ext), v.Version, ext)
+				v.Path = dw.uniquePath(dir+"dokumente/versionen/", name)
+			}
+		}
+	}
+
+	f, err := dw.create(dw.uniquePath(dir, "datenblatt.pdf"), ec.now, zip.Deflate)
+	if err != nil {
+		return err
+	}
+	if err := contractDatasheet(d, ec).finish(f); err != nil {
+		return err
+	}
+
+	f, err = dw.create(dw.uniquePath(dir, "vertrag.json"), ec.now, zip.Deflate)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(d); err != nil {
+		return err
+	}
+
+	for _, doc := range d.Documents {
+		for _, v := range doc.Versions {
+			if v.Path == "" {
+				continue
+			}
+			if err := dw.copyFile(v.Path, v.StorageKey, v.MimeType, v.UploadedAt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// copyFile streamt eine Datei aus dem Speicher ins Archiv. Fehlt sie im Speicher,
+// wird sie übersprungen und in FEHLER.txt aufgeführt.
+func (dw *dossierWriter) copyFile(name, key string, mimeType *string, modified time.Time) error {
+	r, _, err := store.Get(dw.ctx, key)
+	if err != nil {
+		log.Printf("Vertragsakte: %s (%s) nicht lesbar: %v", name, key, err)
+		dw.missing = append(dw.missing, fmt.Sprintf("%s: %v", name, err))
+		return nil
+	}
+	defer r.Close()
+	f, err := dw.create(name, modified, dossierMethod(mimeType))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	return err
+}
+
+// dossierMethod speichert bereits komprimierte Formate unverändert.
+func dossierMethod(mimeType *string) uint16 {
+	if mimeType != nil {
+		switch *mimeType {
+		case mimePNG, mimeJPEG, mimeDOCX, mimeXLSX:
+			return zip.Store
+		}
+	}
+	return zip.Deflate
+}
+
+// close schreibt FEHLER.txt, falls Dateien fehlen, und schließt das Archiv.
+func (dw *dossierWriter) close() error {
+	if len(dw.missing) > 0 {
+		f, err := dw.create(dw.uniquePath("", "FEHLER.txt"), time.Now(), zip.Deflate)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(f, "Folgende Dateien konnten nicht gelesen werden und fehlen im Archiv:\r\n\r\n")
+		for _, m := range dw.missing {
+			fmt.Fprintf(f, "%s\r\n", m)
+		}
+	}
+	return dw.zw.Close()
+}
+
+// dossier liefert die Vertragsakte eines Vertrags als ZIP.
+// Mit versions=all sind auch frühere Versionen der Dokumente enthalten.
+func (h *contractHandlers) dossier(w http.ResponseWriter, r *http.Request) {
+	contracts, _, err := h.contracts.List(r.Context(), "id = ?", []interface{}{r.PathValue("id")}, listOptions{Limit: -1, Sort: []string{"id ASC"}})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(contracts) == 0 {
+		http.Error(w, "Contract not found", http.StatusNotFound)
+		return
+	}
+	writeDossier(w, r, h.repos, contracts, exportFilename("Vertragsakte "+contracts[0].ContractNumber, time.Now(), "zip"))
+}
+
+// dossiers liefert die Vertragsakten aller Verträge, die den
+// Listenfiltern entsprechen, mit einem Ordner je Vertrag.
+func (h *contractHandlers) dossiers(w http.ResponseWriter, r *http.Request) {
+	where, args, err := contractFilter(h.repos.dialect, r.URL.Query(), mustAtoi(r.Header.Get("X-User-ID")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	contracts, total, err := h.contracts.List(r.Context(), where, args,
+		listOptions{Limit: maxDossierContracts, Sort: []string{"contract_number ASC", "id ASC"}})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if total == 0 {
+		http.Error(w, "Keine Verträge gefunden", http.StatusNotFound)
+		return
+	}
+	if total > maxDossierContracts {
+		http.Error(w, fmt.Sprintf("%d Verträge gefunden, höchstens %d je Archiv; bitte Filter einschränken", total, maxDossierContracts),
+			http.StatusBadRequest)
+		return
+	}
+	writeDossier(w, r, h.repos, contracts, exportFilename("Vertragsakten", time.Now(), "zip"))
+}
+
+// writeDossier streamt die Akten der Verträge als ZIP. Ist es nur ein Vertrag,
+// liegen die Dateien direkt im Archiv, sonst in einem Ordner je Vertrag.
+func writeDossier(w http.ResponseWriter, r *http.Request, repos *Repositories, contracts []Contract, filename string) {
+	versions := r.URL.Query().Get("versions")
+	if versions != "" && versions != "current" && versions != "all" {
+		http.Error(w, "versions muss current oder all sein", http.StatusBadRequest)
+		return
+	}
+	ec, err := newExportContext(repos.db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", filename))
+	dw := newDossierWriter(r.Context(), repos, w, versions == "all")
+	for _, c := range contracts {
+		dir := ""
+		if len(contracts) > 1 {
+			// Schrägstriche im Titel sind kein Pfad, sanitizeFilename würde davor alles abschneiden
+			name := strings.NewReplacer("/", "_", "\\", "_").Replace(c.ContractNumber + " " + c.Title)
+			dir = dw.uniquePath("", sanitizeFilename(name)) + "/"
+		}
+		// Nach Beginn der Antwort lässt sich kein Fehlerstatus mehr senden; das
+		// Archiv bleibt dann unvollständig und ist für den Client erkennbar defekt.
+		if err := dw.addContract(dir, c, ec); err != nil {
+			log.Printf("Vertragsakte %s abgebrochen: %v", filename, err)
+			return
+		}
+	}
+	if err := dw.close(); err != nil {
+		log.Printf("Vertragsakte %s abgebrochen: %v", filename, err)
+	}
+}
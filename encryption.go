@@ -0,0 +1,690 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Dateien werden in Blöcken von encChunkSize Byte mit AES-256-GCM verschlüsselt, jeder
+// mit eigenem Tag. So lassen sich Dateien streamen und für Range-Anfragen an jeder
+// Blockgrenze entschlüsseln. Die Nonce besteht aus der Blocknummer und einer Markierung
+// für den letzten Block, damit abgeschnittene oder umsortierte Dateien auffallen.
+const (
+	encMagic     = "VDBENC\x00\x01"
+	encChunkSize = 64 << 10
+	encTagSize   = 16
+	encKeySize   = 32
+)
+
+// masterKey verschlüsselt die Datenschlüssel der einzelnen Dateien.
+type masterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// keyRing enthält alle konfigurierten Hauptschlüssel; der erste ist aktiv und wird
+// für neue Dateien verwendet, die übrigen nur noch zum Entschlüsseln.
+type keyRing struct {
+	active *masterKey
+	keys   map[string]*masterKey
+}
+
+// loadKeyRing liest die Hauptschlüssel aus VERTRAGSDB_MASTER_KEY_FILE (eine Zeile
+// "<id> <base64>" je Schlüssel) oder VERTRAGSDB_MASTER_KEY ("<id>:<base64>",
+// kommagetrennt). Ohne Konfiguration ist das Ergebnis nil.
+func loadKeyRing() (*keyRing, error) {
+	var entries []string
+	if file := os.Getenv("VERTRAGSDB_MASTER_KEY_FILE"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Schlüsseldatei: %w", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				entries = append(entries, line)
+			}
+		}
+	} else if env := os.Getenv("VERTRAGSDB_MASTER_KEY"); env != "" {
+		for _, entry := range strings.Split(env, ",") {
+			entries = append(entries, strings.Replace(strings.TrimSpace(entry), ":", " ", 1))
+		}
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	ring := &keyRing{keys: map[string]*masterKey{}}
+	for i, entry := range entries {
+		id, encoded, ok := strings.Cut(entry, " ")
+		if !ok || id == "" {
+			// Den Eintrag nicht ausgeben, er enthält womöglich den Schlüssel
+			return nil, fmt.Errorf("Hauptschlüssel Nr. %d: erwartet \"<id> <base64>\"", i+1)
+		}
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil || len(raw) != encKeySize {
+			return nil, fmt.Errorf("Hauptschlüssel %s: %d Byte Base64 erwartet", id, encKeySize)
+		}
+		if ring.keys[id] != nil {
+			return nil, fmt.Errorf("Hauptschlüssel %s ist doppelt angegeben", id)
+		}
+		aead, err := newAEAD(raw)
+		if err != nil {
+			return nil, err
+		}
+		k := &masterKey{id: id, aead: aead}
+		ring.keys[id] = k
+		if ring.active == nil {
+			ring.active = k
+		}
+	}
+	return ring, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// wrap verschlüsselt einen Datenschlüssel. Der Speicherschlüssel geht als
+// zusätzliche Authentisierung ein, damit ein Datenschlüssel nicht einer anderen
+// Datei untergeschoben werden kann.
+func (k *masterKey) wrap(dataKey []byte, storageKey string) []byte {
+	nonce := make([]byte, k.aead.NonceSize())
+	rand.Read(nonce)
+	return k.aead.Seal(nonce, nonce, dataKey, []byte(storageKey))
+}
+
+func (r *keyRing) unwrap(keyID string, wrapped []byte, storageKey string) ([]byte, error) {
+	k := r.keys[keyID]
+	if k == nil {
+		return nil, fmt.Errorf("Hauptschlüssel %s ist nicht konfiguriert", keyID)
+	}
+	n := k.aead.NonceSize()
+	if len(wrapped) < n {
+		return nil, errors.New("verschlüsselter Datenschlüssel ist zu kurz")
+	}
+	dataKey, err := k.aead.Open(nil, wrapped[:n], wrapped[n:], []byte(storageKey))
+	if err != nil {
+		return nil, fmt.Errorf("Datenschlüssel für %s nicht entschlüsselbar: %w", storageKey, err)
+	}
+	return dataKey, nil
+}
+
+func chunkNonce(index uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], index)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// encryptedSize berechnet die Größe der verschlüsselten Datei aus der Klartextgröße.
+func encryptedSize(size int64) int64 {
+	if size < 0 {
+		return -1
+	}
+	chunks := (size + encChunkSize - 1) / encChunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	return int64(len(encMagic)) + size + chunks*encTagSize
+}
+
+// plaintextSize ist die Umkehrung von encryptedSize.
+func plaintextSize(size int64) (int64, error) {
+	body := size - int64(len(encMagic))
+	sealed := int64(encChunkSize + encTagSize)
+	chunks := body / sealed
+	if rest := body % sealed; rest > 0 {
+		if rest < encTagSize {
+			return 0, errors.New("verschlüsselte Datei ist beschädigt")
+		}
+		chunks++
+	}
+	if chunks == 0 {
+		return 0, errors.New("verschlüsselte Datei ist beschädigt")
+	}
+	return body - chunks*encTagSize, nil
+}
+
+// encryptReader liefert die verschlüsselte Form des Klartexts aus src.
+type encryptReader struct {
+	src    *bufio.Reader
+	aead   cipher.AEAD
+	index  uint64
+	buf    []byte
+	sealed []byte
+	out    []byte // noch nicht gelesener Teil von sealed
+	done   bool
+}
+
+func newEncryptReader(src io.Reader, aead cipher.AEAD) *encryptReader {
+	return &encryptReader{
+		src:  bufio.NewReaderSize(src, encChunkSize),
+		aead: aead,
+		buf:  make([]byte, encChunkSize),
+		out:  []byte(encMagic),
+	}
+}
+
+func (e *encryptReader) Read(p []byte) (int, error) {
+	for len(e.out) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(e.src, e.buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		// Ein Block ist der letzte, wenn danach nichts mehr folgt
+		last := err != nil
+		if !last {
+			if _, perr := e.src.Peek(1); perr == io.EOF {
+				last = true
+			} else if perr != nil {
+				return 0, perr
+			}
+		}
+		e.sealed = e.aead.Seal(e.sealed[:0], chunkNonce(e.index, last), e.buf[:n], nil)
+		e.out = e.sealed
+		e.index++
+		e.done = last
+	}
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+// decryptReader entschlüsselt eine mit encryptReader geschriebene Datei. Ist die
+// Quelle ein io.Seeker, ist auch wahlfreier Zugriff möglich (decryptReadSeeker).
+type decryptReader struct {
+	src     io.ReadCloser
+	aead    cipher.AEAD
+	size    int64 // Klartextgröße
+	pos     int64
+	next    int64 // Block, an dem src gerade steht
+	index   int64 // Block in plain, -1 wenn leer
+	plain   []byte
+	sealed  []byte
+	checked bool
+}
+
+func newDecryptReader(src io.ReadCloser, aead cipher.AEAD, size int64) *decryptReader {
+	return &decryptReader{src: src, aead: aead, size: size, index: -1, sealed: make([]byte, encChunkSize+encTagSize)}
+}
+
+func (d *decryptReader) lastIndex() int64 {
+	if d.size == 0 {
+		return 0
+	}
+	return (d.size - 1) / encChunkSize
+}
+
+func (d *decryptReader) load(index int64) error {
+	if !d.checked {
+		magic := make([]byte, len(encMagic))
+		if _, err := io.ReadFull(d.src, magic); err != nil || string(magic) != encMagic {
+			return errors.New("Datei ist nicht im erwarteten Format verschlüsselt")
+		}
+		d.checked = true
+	}
+	if index != d.next {
+		seeker, ok := d.src.(io.Seeker)
+		if !ok {
+			return errors.New("wahlfreier Zugriff wird nicht unterstützt")
+		}
+		if _, err := seeker.Seek(int64(len(encMagic))+index*(encChunkSize+encTagSize), io.SeekStart); err != nil {
+			return err
+		}
+	}
+	n := int64(encChunkSize)
+	last := index == d.lastIndex()
+	if last {
+		n = d.size - index*encChunkSize
+	}
+	sealed := d.sealed[:n+encTagSize]
+	if _, err := io.ReadFull(d.src, sealed); err != nil {
+		return fmt.Errorf("verschlüsselte Datei ist unvollständig: %w", err)
+	}
+	plain, err := d.aead.Open(d.plain[:0], chunkNonce(uint64(index), last), sealed, nil)
+	if err != nil {
+		return errors.New("verschlüsselte Datei ist beschädigt oder manipuliert")
+	}
+	d.plain, d.index, d.next = plain, index, index+1
+	return nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	if d.pos >= d.size {
+		// Auch bei leeren Dateien den letzten Block prüfen
+		if d.size == 0 && d.index < 0 {
+			if err := d.load(0); err != nil {
+				return 0, err
+			}
+		}
+		return 0, io.EOF
+	}
+	index := d.pos / encChunkSize
+	if index != d.index {
+		if err := d.load(index); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain[d.pos-index*encChunkSize:])
+	d.pos += int64(n)
+	return n, nil
+}
+
+func (d *decryptReader) Close() error {
+	return d.src.Close()
+}
+
+type decryptReadSeeker struct {
+	*decryptReader
+}
+
+func (d decryptReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += d.pos
+	case io.SeekEnd:
+		offset += d.size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative Position")
+	}
+	d.pos = offset
+	return offset, nil
+}
+
+// encryptedStorage verschlüsselt Dateien transparent mit je einem eigenen
+// Datenschlüssel. Die mit dem Hauptschlüssel verschlüsselten Datenschlüssel stehen
+// in storage_encryption; eine Rotation der Hauptschlüssel ändert nur diese Zeilen.
+// Dateien ohne Eintrag werden unverändert gelesen (Altbestand vor der Verschlüsselung).
+type encryptedStorage struct {
+	inner Storage
+	keys  *keyRing
+	db    *DB
+}
+
+func (s *encryptedStorage) String() string {
+	return s.inner.String() + " (verschlüsselt)"
+}
+
+// dataKey liefert den Datenschlüssel einer Datei oder nil für unverschlüsselte Dateien.
+func (s *encryptedStorage) dataKey(key string) ([]byte, error) {
+	var keyID string
+	var wrapped []byte
+	err := s.db.QueryRow("SELECT key_id, wrapped_key FROM storage_encryption WHERE storage_key = ?", key).Scan(&keyID, &wrapped)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.keys.unwrap(keyID, wrapped, key)
+}
+
+// putEncrypted schreibt r verschlüsselt unter key und liefert den verschlüsselten
+// Datenschlüssel, ohne ihn zu speichern.
+func (s *encryptedStorage) putEncrypted(ctx context.Context, key string, r io.Reader, size int64) ([]byte, error) {
+	dataKey := make([]byte, encKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.inner.Put(ctx, key, newEncryptReader(r, aead), encryptedSize(size)); err != nil {
+		return nil, err
+	}
+	return s.keys.active.wrap(dataKey, key), nil
+}
+
+func (s *encryptedStorage) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	wrapped, err := s.putEncrypted(ctx, key, r, size)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO storage_encryption (storage_key, key_id, wrapped_key) VALUES (?, ?, ?)
+		ON CONFLICT (storage_key) DO UPDATE SET key_id = excluded.key_id, wrapped_key = excluded.wrapped_key,
+			created_at = CURRENT_TIMESTAMP, rotated_at = NULL`,
+		key, s.keys.active.id, wrapped)
+	if err != nil {
+		s.inner.Delete(context.Background(), key)
+		return err
+	}
+	return nil
+}
+
+func (s *encryptedStorage) Get(ctx context.Context, key string) (io.ReadCloser, StorageInfo, error) {
+	dataKey, err := s.dataKey(key)
+	if err != nil {
+		return nil, StorageInfo{}, err
+	}
+	r, info, err := s.inner.Get(ctx, key)
+	if err != nil || dataKey == nil {
+		return r, info, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err == nil {
+		info.Size, err = plaintextSize(info.Size)
+	}
+	if err != nil {
+		r.Close()
+		return nil, StorageInfo{}, err
+	}
+	d := newDecryptReader(r, aead, info.Size)
+	if _, ok := r.(io.Seeker); ok {
+		return decryptReadSeeker{d}, info, nil
+	}
+	return d, info, nil
+}
+
+func (s *encryptedStorage) Stat(ctx context.Context, key string) (StorageInfo, error) {
+	info, err := s.inner.Stat(ctx, key)
+	if err != nil {
+		return info, err
+	}
+	var encrypted int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM storage_encryption WHERE storage_key = ?", key).Scan(&encrypted); err != nil {
+		return StorageInfo{}, err
+	}
+	if encrypted > 0 {
+		info.Size, err = plaintextSize(info.Size)
+	}
+	return info, err
+}
+
+func (s *encryptedStorage) Delete(ctx context.Context, key string) error {
+	if err := s.inner.Delete(ctx, key); err != nil {
+		return err
+	}
+	_, err := s.db.Exec("DELETE FROM storage_encryption WHERE storage_key = ?", key)
+	return err
+}
+
+// enableEncryption schaltet die Verschlüsselung ein, wenn Hauptschlüssel konfiguriert
+// sind, und prüft, ob alle verwendeten Hauptschlüssel vorhanden sind.
+func enableEncryption(db *DB) error {
+	keys, err := loadKeyRing()
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query("SELECT key_id, COUNT(*) FROM storage_encryption GROUP BY key_id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var count int
+		if err := rows.Scan(&id, &count); err != nil {
+			return err
+		}
+		if keys == nil || keys.keys[id] == nil {
+			return fmt.Errorf("%d Dateien sind mit Hauptschlüssel %s verschlüsselt, der nicht konfiguriert ist", count, id)
+		}
+	}
+
+	if keys != nil {
+		store = &encryptedStorage{inner: store, keys: keys, db: db}
+	}
+	return nil
+}
+
+// openEncryptedStorage öffnet das konfigurierte Backend für die Verwaltungsbefehle.
+func openEncryptedStorage(db *DB) (*encryptedStorage, error) {
+	inner, err := openStorage(os.Getenv("VERTRAGSDB_STORAGE"))
+	if err != nil {
+		return nil, err
+	}
+	keys, err := loadKeyRing()
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		return nil, errors.New("kein Hauptschlüssel konfiguriert (VERTRAGSDB_MASTER_KEY_FILE oder VERTRAGSDB_MASTER_KEY)")
+	}
+	return &encryptedStorage{inner: inner, keys: keys, db: db}, nil
+}
+
+// generateKeyCommand gibt einen neuen Hauptschlüssel im Format der Schlüsseldatei aus:
+//
+//	vertragsdb generate-key [-id <Kennung>]
+func generateKeyCommand(args []string) error {
+	fset := flag.NewFlagSet("generate-key", flag.ContinueOnError)
+	id := fset.String("id", "k"+time.Now().Format("20060102"), "Kennung des Schlüssels")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if *id == "" || strings.ContainsAny(*id, " \t:,") {
+		return errors.New("die Kennung darf keine Leerzeichen, Doppelpunkte oder Kommas enthalten")
+	}
+	key := make([]byte, encKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	fmt.Printf("%s %s\n", *id, base64.StdEncoding.EncodeToString(key))
+	return nil
+}
+
+// rotateKeysCommand verschlüsselt alle Datenschlüssel mit dem aktiven Hauptschlüssel
+// neu. Die Dateien selbst bleiben unverändert; der Befehl kann bei laufendem Server
+// ausgeführt werden.
+//
+//	vertragsdb rotate-keys
+func rotateKeysCommand(args []string) error {
+	fset := flag.NewFlagSet("rotate-keys", flag.ContinueOnError)
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	db, err := initDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	s, err := openEncryptedStorage(db)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query("SELECT storage_key, key_id, wrapped_key FROM storage_encryption WHERE key_id != ?", s.keys.active.id)
+	if err != nil {
+		return err
+	}
+	type entry struct {
+		key, keyID string
+		wrapped    []byte
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.key, &e.keyID, &e.wrapped); err != nil {
+			rows.Close()
+			return err
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+
+	var failed int
+	for _, e := range entries {
+		dataKey, err := s.keys.unwrap(e.keyID, e.wrapped, e.key)
+		if err == nil {
+			_, err = db.Exec("UPDATE storage_encryption SET key_id = ?, wrapped_key = ?, rotated_at = ? WHERE storage_key = ? AND key_id = ?",
+				s.keys.active.id, s.keys.active.wrap(dataKey, e.key), time.Now(), e.key, e.keyID)
+		}
+		if err != nil {
+			log.Printf("%s: %v", e.key, err)
+			failed++
+		}
+	}
+
+	log.Printf("Schlüsselrotation auf %s: %d Datenschlüssel neu verschlüsselt, %d fehlgeschlagen", s.keys.active.id, len(entries)-failed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d Datenschlüssel nicht rotiert", failed)
+	}
+	return nil
+}
+
+// encryptStorageCommand verschlüsselt alle noch unverschlüsselten Dateien. Jede Datei
+// wird unter einem neuen Schlüssel verschlüsselt abgelegt, danach werden die
+// Verweise in einer Transaktion umgestellt und der Klartext gelöscht. Ein Abbruch
+// hinterlässt daher höchstens eine überzählige verschlüsselte Kopie.
+//
+//	vertragsdb encrypt-storage [-dry-run]
+func encryptStorageCommand(args []string) error {
+	fset := flag.NewFlagSet("encrypt-storage", flag.ContinueOnError)
+	dryRun := fset.Bool("dry-run", false, "nur anzeigen, was verschlüsselt würde")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	db, err := initDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	s, err := openEncryptedStorage(db)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`SELECT storage_key FROM document_versions
+		UNION SELECT storage_key FROM quarantined_uploads
+		EXCEPT SELECT storage_key FROM storage_encryption`)
+	if err != nil {
+		return err
+	}
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+
+	ctx := context.Background()
+	var encrypted, failed int
+	for _, key := range keys {
+		if *dryRun {
+			log.Printf("%s würde verschlüsselt", key)
+			encrypted++
+			continue
+		}
+		if err := encryptStoredFile(ctx, s, key); err != nil {
+			log.Printf("%s: %v", key, err)
+			failed++
+			continue
+		}
+		encrypted++
+	}
+
+	log.Printf("Verschlüsselung %s: %d Dateien verschlüsselt, %d fehlgeschlagen", s, encrypted, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d Dateien nicht verschlüsselt", failed)
+	}
+	return nil
+}
+
+func encryptStoredFile(ctx context.Context, s *encryptedStorage, oldKey string) error {
+	r, info, err := s.inner.Get(ctx, oldKey)
+	if err != nil {
+		return err
+	}
+	head := make([]byte, len(encMagic))
+	n, _ := io.ReadFull(r, head)
+	if string(head[:n]) == encMagic {
+		r.Close()
+		return errors.New("Datei ist bereits verschlüsselt, aber ohne Datenschlüssel")
+	}
+	// Neuer Schlüssel im selben Bereich (documents/, quarantine/); Altbestand liegt direkt im Wurzelverzeichnis
+	newKey := newStorageKey()
+	if dir := path.Dir(oldKey); dir != "." {
+		newKey = dir + "/" + randomHex(16)
+	}
+	wrapped, err := s.putEncrypted(ctx, newKey, io.MultiReader(bytes.NewReader(head[:n]), r), info.Size)
+	r.Close()
+	if err != nil {
+		return err
+	}
+
+	// Miniaturansichten werden nicht umgeschlüsselt, sondern gelöscht und beim
+	// nächsten Abruf verschlüsselt neu erzeugt
+	var thumbKeys []string
+	thumbRows, err := s.db.Query("SELECT thumbnail_key FROM document_versions WHERE storage_key = ? AND thumbnail_key != ''", oldKey)
+	if err != nil {
+		s.inner.Delete(ctx, newKey)
+		return err
+	}
+	for thumbRows.Next() {
+		var key string
+		if err := thumbRows.Scan(&key); err == nil {
+			thumbKeys = append(thumbKeys, key)
+		}
+	}
+	thumbRows.Close()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		s.inner.Delete(ctx, newKey)
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range []string{
+		"UPDATE documents SET storage_key = ? WHERE storage_key = ?",
+		"UPDATE document_versions SET storage_key = ?, thumbnail_key = NULL WHERE storage_key = ?",
+		"UPDATE quarantined_uploads SET storage_key = ? WHERE storage_key = ?",
+	} {
+		if _, err = tx.Exec(stmt, newKey, oldKey); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		_, err = tx.Exec("INSERT INTO storage_encryption (storage_key, key_id, wrapped_key) VALUES (?, ?, ?)",
+			newKey, s.keys.active.id, wrapped)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		s.inner.Delete(ctx, newKey)
+		return err
+	}
+	for _, key := range thumbKeys {
+		s.Delete(ctx, key)
+	}
+	return s.inner.Delete(ctx, oldKey)
+}
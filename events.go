@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Änderungsereignisse für die Live-Aktualisierung der Oberfläche
+const (
+	changeContractCreated    = "contract.created"
+	changeContractUpdated    = "contract.updated"
+	changeContractTerminated = "contract.terminated"
+	changeContractDeleted    = "contract.deleted" // in den Papierkorb verschoben oder endgültig gelöscht
+	changeContractRestored   = "contract.restored"
+	changeContractsChanged   = "contracts.changed" // viele Verträge auf einmal, z. B. Import oder Fristberechnung
+	changeDocumentCreated    = "document.created"
+	changeDocumentUpdated    = "document.updated" // Metadaten, neue Version oder Textextraktion abgeschlossen
+	changeDocumentDeleted    = "document.deleted"
+	changeDocumentRestored   = "document.restored"
+	changeCategoryCreated    = "category.created"
+	changeCategoryUpdated    = "category.updated"
+	changeCategoryDeleted    = "category.deleted"
+	changeCategoryRestored   = "category.restored"
+	changeReset              = "reset" // Puffer reicht nicht zurück, der Client lädt alles neu
+)
+
+const (
+	eventBufferSize    = 500              // Ereignisse, die für Wiederverbindungen aufbewahrt werden
+	eventBufferMaxAge  = 10 * time.Minute // ältere Ereignisse werden nicht nachgeliefert
+	eventHeartbeat     = 25 * time.Second
+	eventRetry         = 3 * time.Second // Wartezeit des Clients vor einer Wiederverbindung
+	eventClientBacklog = 64              // Ereignisse je Verbindung, bevor sie als zu langsam getrennt wird
+)
+
+// changeEvent ist ein Ereignis im Stream. ID setzt sich aus der Startkennung des
+// Servers und einer laufenden Nummer zusammen, damit eine Last-Event-ID aus der Zeit
+// vor einem Neustart erkannt wird.
+type changeEvent struct {
+	Seq     uint64
+	Type    string
+	Data    []byte
+	Created time.Time
+}
+
+func (e changeEvent) id() string {
+	return fmt.Sprintf("%s-%d", hub.boot, e.Seq)
+}
+
+type eventSubscriber struct {
+	ch chan changeEvent
+}
+
+// eventHub verteilt Ereignisse an alle offenen Streams und hält einen kurzen
+// Puffer für Wiederverbindungen mit Last-Event-ID vor.
+type eventHub struct {
+	mu          sync.Mutex
+	boot        string
+	seq         uint64
+	buffer      []changeEvent
+	subscribers map[*eventSubscriber]bool
+}
+
+var hub = &eventHub{
+	boot:        strconv.FormatInt(time.Now().UnixMilli(), 36),
+	subscribers: map[*eventSubscriber]bool{},
+}
+
+// publishChange sendet ein Ereignis an alle Streams. Fehler werden nur protokolliert,
+// damit die auslösende Änderung nicht scheitert.
+func publishChange(eventType string, data interface{}) {
+	hub.publish(eventType, data)
+}
+
+func (h *eventHub) publish(eventType string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Ereignis %s nicht gesendet: %v", eventType, err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	e := changeEvent{Seq: h.seq, Type: eventType, Data: payload, Created: time.Now()}
+	h.buffer = append(h.buffer, e)
+	if len(h.buffer) > eventBufferSize {
+		h.buffer = h.buffer[len(h.buffer)-eventBufferSize:]
+	}
+
+	for s := range h.subscribers {
+		select {
+		case s.ch <- e:
+		default:
+			// Zu langsamer Client: Verbindung trennen, er holt die Ereignisse über Last-Event-ID nach
+			close(s.ch)
+			delete(h.subscribers, s)
+		}
+	}
+}
+
+// subscribe meldet einen Stream an und liefert die seit lastID verpassten Ereignisse.
+// Liegt lastID nicht mehr im Puffer oder stammt sie von einem früheren Serverstart,
+// ist das Ergebnis ein einzelnes reset-Ereignis.
+func (h *eventHub) subscribe(lastID string) (*eventSubscriber, []changeEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := &eventSubscriber{ch: make(chan changeEvent, eventClientBacklog)}
+	h.subscribers[s] = true
+
+	if lastID == "" {
+		return s, nil
+	}
+	reset := []changeEvent{{Seq: h.seq, Type: changeReset, Data: []byte("{}"), Created: time.Now()}}
+	boot, seqText, _ := strings.Cut(lastID, "-")
+	seq, err := strconv.ParseUint(seqText, 10, 64)
+	if boot != h.boot || err != nil || seq > h.seq {
+		return s, reset
+	}
+	// Ohne Lücke nachlieferbar, wenn das nächste Ereignis noch im Puffer liegt
+	if seq < h.seq && h.buffer[0].Seq > seq+1 {
+		return s, reset
+	}
+
+	cutoff := time.Now().Add(-eventBufferMaxAge)
+	var missed []changeEvent
+	for _, e := range h.buffer {
+		if e.Seq <= seq {
+			continue
+		}
+		if e.Created.Before(cutoff) {
+			return s, reset
+		}
+		missed = append(missed, e)
+	}
+	return s, missed
+}
+
+func (h *eventHub) unsubscribe(s *eventSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[s] {
+		delete(h.subscribers, s)
+		close(s.ch)
+	}
+}
+
+// events liefert Änderungen als Server-Sent Events. Nach einem Verbindungsabbruch
+// setzt der Client mit dem Header Last-Event-ID fort; reicht der Puffer nicht zurück,
+// erhält er ein reset-Ereignis. Der Stream endet, wenn das Token abläuft oder der
+// Benutzer gelöscht bzw. seine Rolle geändert wird. Alle Ereignisse betreffen Daten,
+// die jede Rolle lesen darf; Schreibrechte spielen für den Stream keine Rolle.
+func (h *userHandlers) events(w http.ResponseWriter, r *http.Request) {
+	claims, err := verifyToken(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	rc := http.NewResponseController(w)
+
+	s, missed := hub.subscribe(r.Header.Get("Last-Event-ID"))
+	defer hub.unsubscribe(s)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Puffern in nginx abschalten
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", eventRetry.Milliseconds())
+
+	send := func(e changeEvent) error {
+		_, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.id(), e.Type, e.Data)
+		return err
+	}
+	for _, e := range missed {
+		if send(e) != nil {
+			return
+		}
+	}
+	if rc.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	lifetime := 24 * time.Hour
+	if claims.ExpiresAt != nil {
+		lifetime = time.Until(claims.ExpiresAt.Time)
+	}
+	expiry := time.NewTimer(lifetime)
+	defer expiry.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-expiry.C:
+			return
+		case <-heartbeat.C:
+			if u, err := h.users.Get(r.Context(), claims.UserID); err != nil || u.Role != claims.Role {
+				return
+			}
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case e, open := <-s.ch:
+			if !open {
+				return
+			}
+			if send(e) != nil {
+				return
+			}
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Exportformate für Vertragslisten (Parameter format)
+const (
+	exportCSV  = "csv"
+	exportXLSX = "xlsx"
+	exportPDF  = "pdf"
+	exportHTML = "html"
+)
+
+// Datentypen einer Exportspalte, bestimmen Formatierung in CSV und XLSX
+const (
+	exportText = iota
+	exportNumber
+	exportAmount
+	exportDate
+	exportDateTime
+	exportBool
+)
+
+// exportColumn beschreibt eine Spalte des Exports. Neben den Vertragsfeldern
+// gibt es berechnete Spalten wie status oder days_until_action.
+type exportColumn struct {
+	Key     string
+	Label   string
+	Kind    int
+	Width   float64
+	Default bool // ohne fields-Parameter enthalten
+	Value   func(c Contract, ctx *exportContext) interface{}
+}
+
+// exportContext enthält Daten, die für berechnete Spalten einmal je Export geladen werden.
+type exportContext struct {
+	now       time.Time
+	usernames map[int]string
+}
+
+var exportColumns = []exportColumn{
+	{"id", "ID", exportNumber, 6, false, func(c Contract, _ *exportContext) interface{} { return c.ID }},
+	{"contract_number", "Vertragsnummer", exportText, 16, true, func(c Contract, _ *exportContext) interface{} { return c.ContractNumber }},
+	{"title", "Titel", exportText, 36, true, func(c Contract, _ *exportContext) interface{} { return c.Title }},
+	{"partner", "Partner", exportText, 24, true, func(c Contract, _ *exportContext) interface{} { return c.Partner }},
+	{"category", "Kategorie", exportText, 16, true, func(c Contract, _ *exportContext) interface{} { return c.Category }},
+	{"contract_type", "Vertragsart", exportText, 14, true, func(c Contract, _ *exportContext) interface{} {
+		if c.ContractType == "framework" {
+			return "Rahmenvertrag"
+		}
+		return "Einzelvertrag"
+	}},
+	{"framework_contract_id", "Rahmenvertrag-ID", exportNumber, 10, false, func(c Contract, _ *exportContext) interface{} { return intValue(c.FrameworkContractID) }},
+	{"status", "Status", exportText, 11, true, func(c Contract, ctx *exportContext) interface{} { return contractStatus(c, ctx.now) }},
+	{"owner", "Verantwortlich", exportText, 16, true, func(c Contract, ctx *exportContext) interface{} {
+		if c.OwnerID == nil {
+			return nil
+		}
+		return ctx.usernames[*c.OwnerID]
+	}},
+	{"owner_id", "Verantwortlich (ID)", exportNumber, 10, false, func(c Contract, _ *exportContext) interface{} { return intValue(c.OwnerID) }},
+	{"valid_from", "Gültig ab", exportDate, 12, true, func(c Contract, _ *exportContext) interface{} { return c.ValidFrom }},
+	{"valid_until", "Gültig bis", exportDate, 12, true, func(c Contract, _ *exportContext) interface{} { return timeValue(c.ValidUntil) }},
+	{"notice_period", "Kündigungsfrist (Monate)", exportNumber, 12, true, func(c Contract, _ *exportContext) interface{} { return intValue(c.NoticePeriod) }},
+	{"minimum_term", "Mindestlaufzeit bis", exportDate, 12, true, func(c Contract, _ *exportContext) interface{} { return timeValue(c.MinimumTerm) }},
+	{"term_months", "Laufzeit (Monate)", exportNumber, 12, true, func(c Contract, _ *exportContext) interface{} { return intValue(c.TermMonths) }},
+	{"cancellation_date", "Kündigungstermin", exportDate, 14, true, func(c Contract, _ *exportContext) interface{} { return timeValue(c.CancellationDate) }},
+	{"cancellation_action_date", "Kündigungsvornahme", exportDate, 14, true, func(c Contract, _ *exportContext) interface{} { return timeValue(c.CancellationActionDate) }},
+	{"days_until_action", "Tage bis Kündigungsvornahme", exportNumber, 12, true, func(c Contract, ctx *exportContext) interface{} {
+		if c.CancellationActionDate == nil || c.IsTerminated {
+			return nil
+		}
+		return daysBetween(ctx.now, *c.CancellationActionDate)
+	}},
+	{"annual_cost", "Jährliche Kosten", exportAmount, 14, true, func(c Contract, _ *exportContext) interface{} {
+		if c.AnnualCost == nil {
+			return nil
+		}
+		return *c.AnnualCost
+	}},
+	{"is_terminated", "Beendet", exportBool, 9, false, func(c Contract, _ *exportContext) interface{} { return c.IsTerminated }},
+	{"terminated_at", "Beendet am", exportDateTime, 16, true, func(c Contract, _ *exportContext) interface{} { return timeValue(c.TerminatedAt) }},
+	{"created_at", "Angelegt am", exportDateTime, 16, true, func(c Contract, _ *exportContext) interface{} { return c.CreatedAt }},
+	{"content", "Inhalt", exportText, 50, false, func(c Contract, _ *exportContext) interface{} { return c.Content }},
+	{"conditions", "Konditionen", exportText, 50, false, func(c Contract, _ *exportContext) interface{} { return c.Conditions }},
+}
+
+// pdfDefaultColumns sind die Spalten einer PDF-Liste ohne fields-Parameter.
+var pdfDefaultColumns = []string{"contract_number", "title", "partner", "category", "owner",
+	"valid_until", "cancellation_date", "cancellation_action_date", "days_until_action", "annual_cost"}
+
+// exportOptions sind die Parameter eines Exports.
+type exportOptions struct {
+	Format    string
+	Delimiter rune
+	BOM       bool
+	Columns   []exportColumn
+}
+
+// parseExportOptions liest format, delimiter, bom und fields aus der Query.
+func parseExportOptions(q url.Values) (exportOptions, error) {
+	opts := exportOptions{Format: q.Get("format"), Delimiter: ';', BOM: true}
+	switch opts.Format {
+	case exportCSV, exportXLSX, exportPDF, exportHTML:
+	default:
+		return opts, fmt.Errorf("unbekanntes Exportformat: %s", opts.Format)
+	}
+
+	switch d := q.Get("delimiter"); d {
+	case "", ";", "semicolon":
+	case ",", "comma":
+		opts.Delimiter = ','
+	case "tab", "\t":
+		opts.Delimiter = '\t'
+	case "|", "pipe":
+		opts.Delimiter = '|'
+	default:
+		return opts, fmt.Errorf("ungültiges Trennzeichen: %s", d)
+	}
+
+	if b := q.Get("bom"); b != "" {
+		v, err := strconv.ParseBool(b)
+		if err != nil {
+			return opts, fmt.Errorf("ungültiger Wert für bom: %s", b)
+		}
+		opts.BOM = v
+	}
+
+	if f := q.Get("fields"); f != "" {
+		for _, key := range strings.Split(f, ",") {
+			key = strings.TrimSpace(key)
+			if key == "" {
+				continue
+			}
+			col, ok := findExportColumn(key)
+			if !ok {
+				return opts, fmt.Errorf("unbekanntes Feld: %s", key)
+			}
+			opts.Columns = append(opts.Columns, col)
+		}
+	}
+	if len(opts.Columns) == 0 && (opts.Format == exportPDF || opts.Format == exportHTML) {
+		for _, key := range pdfDefaultColumns {
+			col, _ := findExportColumn(key)
+			opts.Columns = append(opts.Columns, col)
+		}
+	}
+	if len(opts.Columns) == 0 {
+		for _, col := range exportColumns {
+			if col.Default {
+				opts.Columns = append(opts.Columns, col)
+			}
+		}
+	}
+	return opts, nil
+}
+
+func findExportColumn(key string) (exportColumn, bool) {
+	for _, col := range exportColumns {
+		if col.Key == key {
+			return col, true
+		}
+	}
+	return exportColumn{}, false
+}
+
+// exportContracts schreibt die Verträge der Abfrage als CSV-, XLSX-, PDF- oder HTML-Datei.
+// CSV und XLSX werden direkt aus dem Datenbank-Cursor geschrieben, PDF-Listen
+// werden für den Seitenumbruch zunächst gesammelt.
+func exportContracts(w http.ResponseWriter, db *DB, q url.Values, title, where string, args []interface{}, defaultSort string) {
+	eo, err := parseExportOptions(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// fields bezieht sich beim Export auf die Exportspalten, nicht auf JSON-Felder
+	listQuery := url.Values{}
+	for k, v := range q {
+		if k != "fields" {
+			listQuery[k] = v
+		}
+	}
+	opts, err := parseListOptions(listQuery, defaultSort)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.Fields = map[string]bool{}
+	for _, col := range eo.Columns {
+		opts.Fields[col.Key] = true
+	}
+
+	ctx, err := newExportContext(db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	query := "SELECT " + opts.selectList() + " FROM contracts WHERE deleted_at IS NULL AND (" + where + ")" +
+		" ORDER BY " + strings.Join(opts.Sort, ", ")
+	queryArgs := append([]interface{}{}, args...)
+	if opts.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		queryArgs = append(queryArgs, opts.Limit, opts.Offset)
+	}
+	rows, err := db.Query(query, queryArgs...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	filename := exportFilename(title, ctx.now, eo.Format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	var write func(values []interface{}) error
+	var finish func() error
+
+	switch eo.Format {
+	case exportCSV:
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		if eo.BOM {
+			bw.WriteString("\xEF\xBB\xBF")
+		}
+		cw := csv.NewWriter(bw)
+		cw.Comma = eo.Delimiter
+		cw.UseCRLF = true
+
+		header := make([]string, len(eo.Columns))
+		for i, col := range eo.Columns {
+			header[i] = col.Label
+		}
+		cw.Write(header)
+
+		record := make([]string, len(eo.Columns))
+		write = func(values []interface{}) error {
+			for i, col := range eo.Columns {
+				record[i] = formatCSVValue(values[i], col.Kind)
+				if col.Kind == exportText {
+					record[i] = escapeCSVFormula(record[i])
+				}
+			}
+			return cw.Write(record)
+		}
+		finish = func() error {
+			cw.Flush()
+			if err := cw.Error(); err != nil {
+				return err
+			}
+			return bw.Flush()
+		}
+
+	case exportXLSX:
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		widths := make([]float64, len(eo.Columns))
+		header := make([]xlsxCell, len(eo.Columns))
+		for i, col := range eo.Columns {
+			widths[i] = col.Width
+			header[i] = xlsxCell{Value: col.Label, Style: xlsxStyleHeader}
+		}
+		xw, err := newXLSXWriter(w, title, widths)
+		if err != nil {
+			log.Printf("Export %s abgebrochen: %v", filename, err)
+			return
+		}
+		xw.WriteRow(header)
+
+		cells := make([]xlsxCell, len(eo.Columns))
+		write = func(values []interface{}) error {
+			for i, col := range eo.Columns {
+				cells[i] = xlsxCell{Value: values[i], Style: xlsxStyleFor(col.Kind)}
+			}
+			return xw.WriteRow(cells)
+		}
+		finish = xw.Close
+
+	case exportPDF, exportHTML:
+		var collected [][]interface{}
+		write = func(values []interface{}) error {
+			collected = append(collected, append([]interface{}{}, values...))
+			return nil
+		}
+		finish = func() error {
+			if eo.Format == exportHTML {
+				writeContractListHTML(w, q, title, eo.Columns, collected, filename)
+			} else {
+				writeContractListPDF(w, q, title, eo.Columns, collected, filename)
+			}
+			return nil
+		}
+	}
+
+	values := make([]interface{}, len(eo.Columns))
+	for rows.Next() {
+		contract, err := scanContract(rows)
+		if err != nil {
+			log.Printf("Export %s abgebrochen: %v", filename, err)
+			return
+		}
+		for i, col := range eo.Columns {
+			values[i] = col.Value(contract, ctx)
+		}
+		if err := write(values); err != nil {
+			// Der Status ist bereits gesendet, der Abbruch kann nur protokolliert werden
+			log.Printf("Export %s abgebrochen: %v", filename, err)
+			return
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Export %s abgebrochen: %v", filename, err)
+		return
+	}
+	if err := finish(); err != nil {
+		log.Printf("Export %s abgebrochen: %v", filename, err)
+	}
+}
+
+func newExportContext(db *DB) (*exportContext, error) {
+	ctx := &exportContext{now: time.Now(), usernames: map[int]string{}}
+	rows, err := db.Query("SELECT id, username FROM users")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var username string
+		if err := rows.Scan(&id, &username); err != nil {
+			continue
+		}
+		ctx.usernames[id] = username
+	}
+	return ctx, rows.Err()
+}
+
+// contractStatus entspricht der Statusanzeige im Frontend.
+func contractStatus(c Contract, now time.Time) string {
+	switch {
+	case c.IsTerminated:
+		return "Beendet"
+	case c.ValidUntil != nil && !c.ValidUntil.After(now):
+		return "Abgelaufen"
+	}
+	return "Gültig"
+}
+
+// daysBetween liefert die Anzahl Kalendertage von from bis to (negativ, wenn to zurückliegt).
+func daysBetween(from, to time.Time) int {
+	a := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	b := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(b.Sub(a).Hours() / 24)
+}
+
+func intValue(p *int) interface{} {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+func timeValue(p *time.Time) interface{} {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+// formatCSVValue formatiert einen Wert im deutschen Format (Datum TT.MM.JJJJ, Dezimalkomma).
+func formatCSVValue(v interface{}, kind int) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		if kind == exportAmount {
+			return strings.Replace(strconv.FormatFloat(v, 'f', 2, 64), ".", ",", 1)
+		}
+		return strings.Replace(strconv.FormatFloat(v, 'f', -1, 64), ".", ",", 1)
+	case bool:
+		if v {
+			return "ja"
+		}
+		return "nein"
+	case time.Time:
+		if kind == exportDateTime {
+			return v.Local().Format("02.01.2006 15:04")
+		}
+		return v.Format("02.01.2006")
+	}
+	return fmt.Sprint(v)
+}
+
+// escapeCSVFormula stellt Texten, die Excel oder LibreOffice beim Öffnen als Formel
+// ausführen würden, ein Apostroph voran (CSV-Injection). Zahlen und Daten sind nicht
+// betroffen, nur Textspalten mit Eingaben der Benutzer.
+func escapeCSVFormula(s string) string {
+	if s != "" && strings.IndexByte("=+-@\t\r", s[0]) >= 0 {
+		return "'" + s
+	}
+	return s
+}
+
+func xlsxStyleFor(kind int) int {
+	switch kind {
+	case exportDate:
+		return xlsxStyleDate
+	case exportDateTime:
+		return xlsxStyleDateTime
+	case exportAmount:
+		return xlsxStyleAmount
+	}
+	return xlsxStyleDefault
+}
+
+// exportFilename bildet aus dem Titel einen ASCII-Dateinamen, z. B. vertraege_2024-05-31.csv.
+func exportFilename(title string, now time.Time, format string) string {
+	replacer := strings.NewReplacer("ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss", "Ä", "Ae", "Ö", "Oe", "Ü", "Ue")
+	var sb strings.Builder
+	for _, r := range replacer.Replace(strings.ToLower(title)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			sb.WriteRune(r)
+		case r < utf8.RuneSelf && sb.Len() > 0 && !strings.HasSuffix(sb.String(), "-"):
+			sb.WriteByte('-')
+		}
+	}
+	name := strings.Trim(sb.String(), "-")
+	if name == "" {
+		name = "export"
+	}
+	return fmt.Sprintf("%s_%s.%s", name, now.Format("2006-01-02"), format)
+}
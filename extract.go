@@ -0,0 +1,284 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Status der Textextraktion eines Dokuments
+const (
+	extractionPending     = "pending"
+	extractionRunning     = "running"
+	extractionDone        = "done"
+	extractionFailed      = "failed"
+	extractionUnsupported = "unsupported"
+)
+
+// maxExtractedText begrenzt den gespeicherten Text je Dokument.
+const maxExtractedText = 2 << 20
+
+// extractionRetryDelay ist die Pause, bevor der Worker es nach einem Datenbankfehler
+// erneut versucht.
+const extractionRetryDelay = 30 * time.Second
+
+var errUnsupportedFormat = errors.New("Dateiformat wird für die Textextraktion nicht unterstützt")
+
+// extractionWake weckt den Extraktions-Worker, wenn neue Dokumente anstehen.
+var extractionWake = make(chan struct{}, 1)
+
+// extractText ermittelt das Format anhand des Inhalts und liefert den enthaltenen Text.
+func extractText(data []byte, filename string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	switch {
+	case bytes.HasPrefix(data, []byte("%PDF")) || ext == ".pdf":
+		return extractPDFText(data)
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")) && ext == ".docx":
+		return extractDOCXText(data)
+	case ext == ".txt" || ext == ".csv" || ext == ".md" ||
+		strings.HasPrefix(http.DetectContentType(data), "text/plain"):
+		return decodePlainText(data), nil
+	}
+	return "", errUnsupportedFormat
+}
+
+// decodePlainText liest UTF-8 und fällt bei ungültigen Bytes auf Windows-1252 zurück.
+func decodePlainText(data []byte) string {
+	data = bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	var sb strings.Builder
+	for _, b := range data {
+		sb.WriteRune(winAnsiRune(b))
+	}
+	return sb.String()
+}
+
+// extractDOCXText liest den Fließtext aus word/document.xml.
+func extractDOCXText(data []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	for _, f := range zr.File {
+		if f.Name != "word/document.xml" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+
+		var sb strings.Builder
+		dec := xml.NewDecoder(io.LimitReader(rc, 64<<20))
+		inText := false
+		for {
+			tok, err := dec.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				switch t.Name.Local {
+				case "t":
+					inText = true
+				case "tab":
+					sb.WriteByte('\t')
+				case "br", "cr":
+					sb.WriteByte('\n')
+				}
+			case xml.EndElement:
+				switch t.Name.Local {
+				case "t":
+					inText = false
+				case "p":
+					sb.WriteByte('\n')
+				}
+			case xml.CharData:
+				if inText {
+					sb.Write(t)
+				}
+			}
+		}
+		return normalizeExtractedText(sb.String()), nil
+	}
+	return "", errors.New("word/document.xml fehlt")
+}
+
+// queueExtraction markiert Dokumente zur Extraktion und weckt den Worker.
+func queueExtraction(db *DB, where string, args ...interface{}) (int64, error) {
+	result, err := db.Exec(`UPDATE documents SET extraction_status = ?, extraction_error = NULL WHERE `+where,
+		append([]interface{}{extractionPending}, args...)...)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := result.RowsAffected()
+	wakeExtractionWorker()
+	return n, nil
+}
+
+func wakeExtractionWorker() {
+	select {
+	case extractionWake <- struct{}{}:
+	default:
+	}
+}
+
+// runExtractionWorker verarbeitet nacheinander alle Dokumente im Status pending.
+// Beim Start werden auch Dokumente fortgesetzt, die bei einem Abbruch in Bearbeitung waren.
+func runExtractionWorker(repos *Repositories) {
+	repos.db.Exec("UPDATE documents SET extraction_status = ? WHERE extraction_status = ?", extractionPending, extractionRunning)
+	wakeExtractionWorker()
+
+	for range extractionWake {
+		for {
+			var id int
+			var filename, key string
+			err := repos.db.QueryRow("SELECT id, filename, storage_key FROM documents WHERE extraction_status = ? AND deleted_at IS NULL ORDER BY id LIMIT 1",
+				extractionPending).Scan(&id, &filename, &key)
+			if err != nil {
+				break
+			}
+			// Ohne den Status running würde dasselbe Dokument sofort erneut gewählt
+			if _, err := repos.db.Exec("UPDATE documents SET extraction_status = ? WHERE id = ?", extractionRunning, id); err != nil {
+				log.Printf("Textextraktion für Dokument %d nicht gestartet, neuer Versuch in %s: %v", id, extractionRetryDelay, err)
+				time.AfterFunc(extractionRetryDelay, wakeExtractionWorker)
+				break
+			}
+			extractDocument(repos, id, filename, key)
+		}
+	}
+}
+
+func extractDocument(repos *Repositories, id int, filename, key string) {
+	data, err := readStoredFile(key)
+	var text string
+	if err == nil {
+		text, err = extractTextRecover(data, filename)
+	}
+
+	status := extractionDone
+	var errMsg interface{}
+	switch {
+	case errors.Is(err, errUnsupportedFormat):
+		status = extractionUnsupported
+	case err != nil:
+		status = extractionFailed
+		errMsg = err.Error()
+		log.Printf("Textextraktion für Dokument %d fehlgeschlagen: %v", id, err)
+	}
+	if len(text) > maxExtractedText {
+		text = strings.ToValidUTF8(text[:maxExtractedText], "")
+	}
+	var textValue interface{}
+	if status == extractionDone {
+		textValue = text
+	}
+
+	// Wurde inzwischen eine neue Version hochgeladen, verwirft der Schlüsselvergleich das Ergebnis
+	_, err = repos.db.Exec("UPDATE documents SET extracted_text = ?, extraction_status = ?, extraction_error = ? WHERE id = ? AND storage_key = ? AND deleted_at IS NULL",
+		textValue, status, errMsg, id, key)
+	if err != nil {
+		log.Printf("Textextraktion für Dokument %d nicht gespeichert: %v", id, err)
+		return
+	}
+
+	if doc, err := repos.Documents.Get(context.Background(), id); err == nil {
+		publishChange(changeDocumentUpdated, map[string]interface{}{"document": doc})
+	}
+}
+
+// extractTextRecover ruft extractText auf und meldet einen Absturz des Parsers als
+// Fehler: Eine einzelne beschädigte Datei darf den Server nicht beenden, sonst
+// stürzt er nach jedem Neustart an derselben Datei erneut ab.
+func extractTextRecover(data []byte, filename string) (text string, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("Datei nicht lesbar: %v", p)
+		}
+	}()
+	return extractText(data, filename)
+}
+
+// text liefert den extrahierten Text eines Dokuments.
+func (h *documentHandlers) text(w http.ResponseWriter, r *http.Request) {
+	docID := r.PathValue("docId")
+
+	var status string
+	var text, errMsg *string
+	err := h.db.QueryRow("SELECT extraction_status, extracted_text, extraction_error FROM documents WHERE id = ? AND deleted_at IS NULL", docID).
+		Scan(&status, &text, &errMsg)
+	if err != nil {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"extraction_status": status,
+		"extraction_error":  errMsg,
+		"text":              text,
+	})
+}
+
+// reindex stößt die Extraktion für ein einzelnes Dokument erneut an.
+func (h *documentHandlers) reindex(w http.ResponseWriter, r *http.Request) {
+	docID := r.PathValue("docId")
+
+	n, err := queueExtraction(h.db, "id = ? AND deleted_at IS NULL", docID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n == 0 {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Textextraktion gestartet"})
+}
+
+// reindexAll stößt die Extraktion für alle Dokumente erneut an. Mit ?status=failed
+// (oder einem anderen Status) nur für Dokumente in diesem Status.
+func (h *documentHandlers) reindexAll(w http.ResponseWriter, r *http.Request) {
+	where := "deleted_at IS NULL"
+	var args []interface{}
+	if status := r.URL.Query().Get("status"); status != "" {
+		switch status {
+		case extractionPending, extractionRunning, extractionDone, extractionFailed, extractionUnsupported:
+		default:
+			http.Error(w, fmt.Sprintf("Unbekannter Extraktionsstatus: %s", status), http.StatusBadRequest)
+			return
+		}
+		where += " AND extraction_status = ?"
+		args = append(args, status)
+	}
+
+	n, err := queueExtraction(h.db, where, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Textextraktion für %d Dokumente gestartet", n),
+		"queued":  n,
+	})
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// contractDateFilters sind die Datumsspalten, die über <spalte>_from und <spalte>_to
+// eingegrenzt werden können (jeweils einschließlich).
+var contractDateFilters = []string{"valid_from", "valid_until", "cancellation_action_date", "created_at"}
+
+// contractFilter baut aus den Query-Parametern die WHERE-Bedingung für Vertragslisten.
+// Alle Filter außer search werden mit match=all (Standard) per AND bzw. mit match=any
+// per OR verknüpft. Mehrfachwerte eines Parameters (kommagetrennt oder wiederholt)
+// werden immer per OR verknüpft. userID ersetzt den Wert owner=me; dialect liefert
+// Datumsformat und LIKE der Datenbank.
+func contractFilter(dialect Dialect, q url.Values, userID int) (string, []interface{}, error) {
+	var conds []string
+	var args []interface{}
+
+	// Mehrfachwerte sammeln: ?category=IT&category=Gebäude oder ?category=IT,Gebäude
+	values := func(name string) []string {
+		var result []string
+		for _, v := range q[name] {
+			for _, part := range strings.Split(v, ",") {
+				if part = strings.TrimSpace(part); part != "" {
+					result = append(result, part)
+				}
+			}
+		}
+		return result
+	}
+
+	// inList erzeugt "spalte IN (?, ?, …)" und hängt die Werte an args an
+	inList := func(column string, vals []interface{}) string {
+		args = append(args, vals...)
+		return column + " IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(vals)), ", ") + ")"
+	}
+	strs := func(vals []string) []interface{} {
+		result := make([]interface{}, len(vals))
+		for i, v := range vals {
+			result[i] = v
+		}
+		return result
+	}
+
+	if vals := values("category"); len(vals) > 0 {
+		conds = append(conds, inList("category", strs(vals)))
+	}
+	if vals := values("partner"); len(vals) > 0 {
+		conds = append(conds, inList("partner", strs(vals)))
+	}
+	if vals := values("contract_type"); len(vals) > 0 {
+		for _, v := range vals {
+			if v != "framework" && v != "individual" {
+				return "", nil, fmt.Errorf("ungültiger Vertragstyp: %s", v)
+			}
+		}
+		conds = append(conds, inList("contract_type", strs(vals)))
+	}
+
+	if vals := values("framework_contract_id"); len(vals) > 0 {
+		var ids []interface{}
+		var sub []string
+		for _, v := range vals {
+			if v == "none" {
+				sub = append(sub, "framework_contract_id IS NULL")
+				continue
+			}
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				return "", nil, fmt.Errorf("ungültige Rahmenvertrags-ID: %s", v)
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) > 0 {
+			sub = append(sub, inList("framework_contract_id", ids))
+		}
+		conds = append(conds, "("+strings.Join(sub, " OR ")+")")
+	}
+
+	if vals := values("owner"); len(vals) > 0 {
+		var ids []interface{}
+		for _, v := range vals {
+			if v == "me" {
+				ids = append(ids, userID)
+				continue
+			}
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				return "", nil, fmt.Errorf("ungültige Benutzer-ID für owner: %s", v)
+			}
+			ids = append(ids, id)
+		}
+		conds = append(conds, inList("owner_id", ids))
+	}
+
+	if t := q.Get("terminated"); t != "" {
+		b, err := strconv.ParseBool(t)
+		if err != nil {
+			return "", nil, fmt.Errorf("ungültiger Wert für terminated: %s", t)
+		}
+		if b {
+			conds = append(conds, "is_terminated = TRUE")
+		} else {
+			conds = append(conds, "is_terminated = FALSE")
+		}
+	}
+
+	if h := q.Get("legal_hold"); h != "" {
+		b, err := strconv.ParseBool(h)
+		if err != nil {
+			return "", nil, fmt.Errorf("ungültiger Wert für legal_hold: %s", h)
+		}
+		if b {
+			conds = append(conds, "legal_hold = TRUE")
+		} else {
+			conds = append(conds, "legal_hold = FALSE")
+		}
+	}
+
+	if d := q.Get("has_documents"); d != "" {
+		b, err := strconv.ParseBool(d)
+		if err != nil {
+			return "", nil, fmt.Errorf("ungültiger Wert für has_documents: %s", d)
+		}
+		exists := "EXISTS (SELECT 1 FROM documents WHERE documents.contract_id = contracts.id AND documents.deleted_at IS NULL)"
+		if !b {
+			exists = "NOT " + exists
+		}
+		conds = append(conds, exists)
+	}
+
+	if q.Get("only_valid") == "true" {
+		conds = append(conds, "(is_terminated = FALSE AND (valid_until IS NULL OR valid_until > CURRENT_TIMESTAMP))")
+	}
+
+	for _, col := range contractDateFilters {
+		for _, bound := range []struct{ suffix, op string }{{"_from", ">="}, {"_to", "<="}} {
+			v := q.Get(col + bound.suffix)
+			if v == "" {
+				continue
+			}
+			if _, err := time.Parse("2006-01-02", v); err != nil {
+				return "", nil, fmt.Errorf("ungültiges Datum für %s%s: %s (erwartet JJJJ-MM-TT)", col, bound.suffix, v)
+			}
+			conds = append(conds, fmt.Sprintf("%s %s ?", dialect.DateString(col), bound.op))
+			args = append(args, v)
+		}
+	}
+
+	where := "1=1"
+	if len(conds) > 0 {
+		switch q.Get("match") {
+		case "", "all":
+			where = strings.Join(conds, " AND ")
+		case "any":
+			where = "(" + strings.Join(conds, " OR ") + ")"
+		default:
+			return "", nil, fmt.Errorf("ungültiger Wert für match: %s (erlaubt: all, any)", q.Get("match"))
+		}
+	}
+
+	// Die Volltextsuche schränkt immer zusätzlich ein
+	if search := q.Get("search"); search != "" {
+		like := dialect.Like()
+		where += " AND (title " + like + " ? OR partner " + like + " ? OR content " + like + " ?)"
+		searchParam := "%" + search + "%"
+		args = append(args, searchParam, searchParam, searchParam)
+	}
+
+	return where, args, nil
+}
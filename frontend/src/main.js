@@ -6,7 +6,13 @@ const state = {
     user: null,
     token: null,
     currentContract: null,
+    showDeletedDocuments: false,
     frameworkContracts: [],
+    contractFilters: {},
+    liveUpdates: null,
+    lastEventId: null,
+    thumbnailUrls: [],
+    previewUrl: null,
 };
 
 // API helper
@@ -62,6 +68,7 @@ function loadAuth() {
 }
 
 function logout() {
+    disconnectLiveUpdates();
     state.token = null;
     state.user = null;
     localStorage.removeItem('token');
@@ -102,6 +109,8 @@ function showContent(contentName) {
         loadUsers();
     } else if (contentName === 'settings') {
         loadCategoriesAdmin();
+        loadRetentionAdmin();
+        loadTrash();
     }
 }
 
@@ -121,6 +130,10 @@ function formatDate(dateString) {
     return date.toLocaleDateString('de-DE');
 }
 
+function formatCurrency(value) {
+    return value.toLocaleString('de-DE', { style: 'currency', currency: 'EUR' });
+}
+
 function formatDateTime(dateString) {
     if (!dateString) return '-';
     const date = new Date(dateString);
@@ -128,7 +141,8 @@ function formatDateTime(dateString) {
 }
 
 // Contracts
-async function loadContracts(filters = {}) {
+async function loadContracts(filters = state.contractFilters) {
+    state.contractFilters = filters;
     try {
         const params = new URLSearchParams();
         if (filters.search) params.append('search', filters.search);
@@ -155,14 +169,17 @@ function renderContracts(contracts) {
         return;
     }
     
-    container.innerHTML = contracts.map(contract => {
-        const isValid = !contract.is_terminated && 
-            (!contract.valid_until || new Date(contract.valid_until) > new Date());
-        const status = contract.is_terminated ? 'beendet' : (isValid ? 'gültig' : 'abgelaufen');
-        const badgeClass = contract.is_terminated ? 'badge-danger' : (isValid ? 'badge-success' : 'badge-warning');
-        
-        return `
-            <div class="contract-card" onclick="viewContract(${contract.id})">
+    container.innerHTML = contracts.map(renderContractCard).join('');
+}
+
+function renderContractCard(contract) {
+    const isValid = !contract.is_terminated && 
+        (!contract.valid_until || new Date(contract.valid_until) > new Date());
+    const status = contract.is_terminated ? 'beendet' : (isValid ? 'gültig' : 'abgelaufen');
+    const badgeClass = contract.is_terminated ? 'badge-danger' : (isValid ? 'badge-success' : 'badge-warning');
+    
+    return `
+            <div class="contract-card" data-contract-id="${contract.id}" onclick="viewContract(${contract.id})">
                 <div class="contract-header">
                     <div>
                         <div class="contract-title">${escapeHtml(contract.title)}</div>
@@ -181,7 +198,6 @@ function renderContracts(contracts) {
                 </div>
             </div>
         `;
-    }).join('');
 }
 
 async function viewContract(id) {
@@ -200,6 +216,9 @@ async function renderContractDetail(contract) {
     
     // Load documents
     const documents = await api(`/contracts/${contract.id}/documents`);
+    const deletedDocuments = state.user?.role === 'admin' && state.showDeletedDocuments
+        ? await api(`/contracts/${contract.id}/documents?deleted=true`)
+        : null;
     
     // Load framework contract if exists
     let frameworkInfo = '';
@@ -253,6 +272,12 @@ async function renderContractDetail(contract) {
                     <div class="detail-value">${contract.contract_type === 'framework' ? 'Rahmenvertrag' : 'Einzelvertrag'}</div>
                 </div>
                 ${frameworkInfo}
+                ${contract.legal_hold ? `
+                <div class="detail-item">
+                    <div class="detail-label">Legal Hold</div>
+                    <div class="detail-value"><span class="badge badge-danger">Löschsperre</span> ${escapeHtml(contract.legal_hold_reason)}</div>
+                </div>
+                ` : ''}
             </div>
         </div>
 
@@ -279,6 +304,10 @@ async function renderContractDetail(contract) {
                     <div class="detail-label">Laufzeit</div>
                     <div class="detail-value">${contract.term_months != null ? contract.term_months + ' Monate' : '-'}</div>
                 </div>
+                <div class="detail-item">
+                    <div class="detail-label">Jährliche Kosten</div>
+                    <div class="detail-value">${contract.annual_cost != null ? formatCurrency(contract.annual_cost) : '-'}</div>
+                </div>
                 <div class="detail-item">
                     <div class="detail-label">Kündigungstermin</div>
                     <div class="detail-value">${formatDate(contract.cancellation_date)}</div>
@@ -314,29 +343,176 @@ async function renderContractDetail(contract) {
             <h3>Dokumente</h3>
             ${state.user?.role === 'admin' ? `
             <div class="upload-area">
-                <input type="file" id="document-upload" accept=".pdf" />
+                <input type="file" id="document-upload" accept="${UPLOAD_ACCEPT}" />
+                <div class="upload-meta">
+                    <select id="document-type">
+                        ${Object.entries(DOCUMENT_TYPES).map(([value, label]) => `<option value="${value}">${label}</option>`).join('')}
+                    </select>
+                    <input type="text" id="document-description" placeholder="Beschreibung (optional)" />
+                </div>
                 <button onclick="uploadDocument()" class="btn btn-primary">Dokument hochladen</button>
             </div>
             ` : ''}
             ${documents && documents.length > 0 ? `
                 <ul class="document-list">
-                    ${documents.map(doc => `
-                        <li class="document-item">
-                            <div>
-                                <div class="document-name">${escapeHtml(doc.filename)}</div>
-                                <div class="document-date">Hochgeladen: ${formatDateTime(doc.uploaded_at)}</div>
-                            </div>
-                            <button onclick="downloadDocument(${doc.id})" class="btn btn-secondary">Download</button>
-                        </li>
-                    `).join('')}
+                    ${documents.map(doc => renderDocumentItem(doc)).join('')}
                 </ul>
             ` : '<p>Keine Dokumente vorhanden</p>'}
+            ${state.user?.role === 'admin' ? `
+                <label class="document-deleted-toggle">
+                    <input type="checkbox" ${state.showDeletedDocuments ? 'checked' : ''} onchange="toggleDeletedDocuments(this.checked)" />
+                    Gelöschte Dokumente anzeigen
+                </label>
+                ${deletedDocuments ? (deletedDocuments.length > 0 ? `
+                    <ul class="document-list">
+                        ${deletedDocuments.map(doc => renderDocumentItem(doc)).join('')}
+                    </ul>
+                ` : '<p>Keine gelöschten Dokumente</p>') : ''}
+            ` : ''}
         </div>
     `;
+    document.getElementById('legal-hold-btn').textContent = contract.legal_hold ? 'Legal Hold aufheben' : 'Legal Hold setzen';
+    loadDocumentThumbnails(container);
 }
 
 window.viewContract = viewContract;
 
+// Standardmäßig erlaubte Dateitypen (VERTRAGSDB_UPLOAD_TYPES); der Server prüft den Inhalt
+const UPLOAD_ACCEPT = '.pdf,.docx,.png,.jpg,.jpeg';
+
+// Dateitypen mit Miniaturansicht bzw. Anzeige im Browser (wie inlineTypes im Backend)
+const THUMBNAIL_TYPES = ['application/pdf', 'image/png', 'image/jpeg'];
+const PREVIEW_TYPES = ['application/pdf', 'image/png', 'image/jpeg', 'text/plain'];
+
+const DOCUMENT_TYPES = {
+    contract: 'Vertrag',
+    amendment: 'Nachtrag',
+    invoice: 'Rechnung',
+    correspondence: 'Korrespondenz',
+    termination: 'Kündigung',
+};
+
+function formatFileSize(bytes) {
+    if (bytes == null) return '';
+    if (bytes < 1024) return `${bytes} B`;
+    if (bytes < 1024 * 1024) return `${(bytes / 1024).toLocaleString('de-DE', { maximumFractionDigits: 1 })} KB`;
+    return `${(bytes / 1024 / 1024).toLocaleString('de-DE', { maximumFractionDigits: 1 })} MB`;
+}
+
+function renderDocumentItem(doc) {
+    const isAdmin = state.user?.role === 'admin';
+    const details = [
+        doc.version > 1 ? `Version ${doc.version}` : '',
+        formatFileSize(doc.file_size),
+        `Hochgeladen: ${formatDateTime(doc.uploaded_at)}${doc.uploaded_by_name ? ` von ${escapeHtml(doc.uploaded_by_name)}` : ''}`,
+    ].filter(Boolean).join(' · ');
+
+    let actions;
+    if (doc.deleted_at) {
+        actions = `<button onclick="restoreDocument(${doc.id})" class="btn btn-secondary">Wiederherstellen</button>`;
+    } else {
+        actions = `
+            ${PREVIEW_TYPES.includes(doc.mime_type) ? `<button onclick="previewDocument(${doc.id})" class="btn btn-secondary">Vorschau</button>` : ''}
+            <button onclick="downloadDocument(${doc.id})" class="btn btn-secondary">Download</button>
+            ${doc.version > 1 ? `<button onclick="showDocumentVersions(${doc.id})" class="btn btn-secondary">Versionen</button>` : ''}
+            ${isAdmin ? `
+                <button onclick="editDocument(${doc.id})" class="btn btn-secondary">Bearbeiten</button>
+                <button onclick="uploadDocumentVersion(${doc.id})" class="btn btn-secondary">Neue Version</button>
+                <button onclick="deleteDocument(${doc.id})" class="btn btn-danger">Löschen</button>
+            ` : ''}
+        `;
+    }
+
+    return `
+        <li class="document-item${doc.deleted_at ? ' document-deleted' : ''}" data-document-id="${doc.id}">
+            <div class="document-main">
+                ${doc.deleted_at ? '' : `
+                    <div class="document-thumbnail" data-thumbnail-id="${THUMBNAIL_TYPES.includes(doc.mime_type) ? doc.id : ''}"
+                        ${PREVIEW_TYPES.includes(doc.mime_type) ? `onclick="previewDocument(${doc.id})"` : ''}>
+                        ${escapeHtml(fileExtension(doc.filename))}
+                    </div>
+                `}
+                <div>
+                    <div class="document-name">
+                        ${escapeHtml(doc.filename)}
+                        <span class="badge">${DOCUMENT_TYPES[doc.document_type] || escapeHtml(doc.document_type)}</span>
+                    </div>
+                    ${doc.description ? `<div class="document-description">${escapeHtml(doc.description)}</div>` : ''}
+                    <div class="document-date">${details}</div>
+                    ${doc.deleted_at ? `<div class="document-date">Gelöscht: ${formatDateTime(doc.deleted_at)}</div>` : ''}
+                    <div class="document-versions"></div>
+                </div>
+            </div>
+            <div class="document-actions">${actions}</div>
+        </li>
+    `;
+}
+
+function fileExtension(filename) {
+    const dot = filename.lastIndexOf('.');
+    return dot > 0 ? filename.slice(dot + 1).toUpperCase() : '';
+}
+
+// Lädt die Miniaturansichten der Dokumentliste; ohne Vorschau bleibt die Dateiendung stehen
+async function loadDocumentThumbnails(container) {
+    state.thumbnailUrls.forEach(url => URL.revokeObjectURL(url));
+    state.thumbnailUrls = [];
+    for (const el of container.querySelectorAll('[data-thumbnail-id]')) {
+        const docId = el.dataset.thumbnailId;
+        if (!docId) continue;
+        try {
+            const response = await fetch(`${API_BASE}/documents/${docId}/thumbnail`, {
+                headers: { 'Authorization': `Bearer ${state.token}` },
+            });
+            if (!response.ok) continue;
+            const url = URL.createObjectURL(await response.blob());
+            state.thumbnailUrls.push(url);
+            el.innerHTML = `<img src="${url}" alt="">`;
+        } catch (error) {
+            console.error('Error loading thumbnail:', error);
+        }
+    }
+}
+
+async function previewDocument(docId) {
+    try {
+        const response = await fetch(`${API_BASE}/documents/${docId}/download?inline=true`, {
+            headers: { 'Authorization': `Bearer ${state.token}` },
+        });
+        if (!response.ok) throw new Error(await response.text() || 'Vorschau fehlgeschlagen');
+        const blob = await response.blob();
+        closePreview();
+        state.previewUrl = URL.createObjectURL(blob);
+        document.getElementById('preview-title').textContent =
+            parseContentDispositionFilename(response.headers.get('Content-Disposition') || '');
+        document.getElementById('preview-body').innerHTML = blob.type.startsWith('image/')
+            ? `<img src="${state.previewUrl}" alt="">`
+            : `<iframe src="${state.previewUrl}" title="Vorschau"></iframe>`;
+        document.getElementById('preview-modal').classList.remove('hidden');
+    } catch (error) {
+        console.error('Error previewing document:', error);
+        alert('Fehler bei der Vorschau: ' + error.message);
+    }
+}
+
+function closePreview() {
+    document.getElementById('preview-modal').classList.add('hidden');
+    document.getElementById('preview-body').innerHTML = '';
+    if (state.previewUrl) {
+        URL.revokeObjectURL(state.previewUrl);
+        state.previewUrl = null;
+    }
+}
+
+window.previewDocument = previewDocument;
+
+function toggleDeletedDocuments(show) {
+    state.showDeletedDocuments = show;
+    renderContractDetail(state.currentContract);
+}
+
+window.toggleDeletedDocuments = toggleDeletedDocuments;
+
 async function uploadDocument() {
     const fileInput = document.getElementById('document-upload');
     const file = fileInput.files[0];
@@ -346,12 +522,9 @@ async function uploadDocument() {
         return;
     }
     
-    if (!file.name.toLowerCase().endsWith('.pdf')) {
-        alert('Bitte wählen Sie eine PDF-Datei aus');
-        return;
-    }
-    
     const formData = new FormData();
+    formData.append('document_type', document.getElementById('document-type').value);
+    formData.append('description', document.getElementById('document-description').value);
     formData.append('document', file);
     
     try {
@@ -367,7 +540,8 @@ async function uploadDocument() {
             alert('Dokument erfolgreich hochgeladen');
             viewContract(state.currentContract.id);
         } else {
-            alert('Fehler beim Hochladen');
+            // Der Server prüft Dateityp, Größe und Viren und nennt den Grund
+            alert('Fehler beim Hochladen: ' + await response.text());
         }
     } catch (error) {
         console.error('Error uploading document:', error);
@@ -378,15 +552,31 @@ async function uploadDocument() {
 window.uploadDocument = uploadDocument;
 
 async function downloadDocument(docId) {
+    await downloadFile(`/documents/${docId}/download`);
+}
+
+// Bevorzugt den UTF-8-Namen aus filename* (RFC 6266), sonst den ASCII-Ersatz
+function parseContentDispositionFilename(disposition) {
+    const extended = disposition.match(/filename\*=UTF-8''([^;]+)/i);
+    if (extended) {
+        try {
+            return decodeURIComponent(extended[1]);
+        } catch (e) {
+            // fällt auf filename zurück
+        }
+    }
+    const plain = disposition.match(/filename="([^"]*)"/) || disposition.match(/filename=([^;]+)/);
+    return plain ? plain[1] : 'dokument';
+}
+
+async function downloadFile(endpoint) {
     try {
-        const response = await fetch(`${API_BASE}/documents/${docId}/download`, {
+        const response = await fetch(`${API_BASE}${endpoint}`, {
             headers: { 'Authorization': `Bearer ${state.token}` },
         });
-        if (!response.ok) throw new Error('Download fehlgeschlagen');
+        if (!response.ok) throw new Error(await response.text() || 'Download fehlgeschlagen');
         const blob = await response.blob();
-        const disposition = response.headers.get('Content-Disposition') || '';
-        const match = disposition.match(/filename=(.+)/);
-        const filename = match ? match[1] : 'dokument.pdf';
+        const filename = parseContentDispositionFilename(response.headers.get('Content-Disposition') || '');
         const url = URL.createObjectURL(blob);
         const a = document.createElement('a');
         a.href = url;
@@ -395,12 +585,116 @@ async function downloadDocument(docId) {
         URL.revokeObjectURL(url);
     } catch (error) {
         console.error('Error downloading document:', error);
-        alert('Fehler beim Herunterladen des Dokuments');
+        alert('Fehler beim Herunterladen: ' + error.message);
     }
 }
 
 window.downloadDocument = downloadDocument;
 
+async function showDocumentVersions(docId) {
+    const container = document.querySelector(`[data-document-id="${docId}"] .document-versions`);
+    if (container.innerHTML) {
+        container.innerHTML = '';
+        return;
+    }
+    try {
+        const versions = await api(`/documents/${docId}/versions`);
+        container.innerHTML = `
+            <ul class="version-list">
+                ${versions.map(v => `
+                    <li>
+                        Version ${v.version}: ${escapeHtml(v.filename)}
+                        (${formatDateTime(v.uploaded_at)}${v.uploaded_by_name ? `, ${escapeHtml(v.uploaded_by_name)}` : ''}${v.file_size != null ? `, ${formatFileSize(v.file_size)}` : ''})
+                        <a href="#" onclick="downloadDocumentVersion(${docId}, ${v.version}); return false;">Download</a>
+                    </li>
+                `).join('')}
+            </ul>
+        `;
+    } catch (error) {
+        console.error('Error loading versions:', error);
+        alert('Fehler beim Laden der Versionen');
+    }
+}
+
+window.showDocumentVersions = showDocumentVersions;
+
+async function downloadDocumentVersion(docId, version) {
+    await downloadFile(`/documents/${docId}/versions/${version}/download`);
+}
+
+window.downloadDocumentVersion = downloadDocumentVersion;
+
+async function editDocument(docId) {
+    try {
+        const doc = await api(`/documents/${docId}`);
+        const typeList = Object.entries(DOCUMENT_TYPES).map(([value, label]) => `${value} = ${label}`).join(', ');
+        const documentType = prompt(`Dokumenttyp (${typeList}):`, doc.document_type);
+        if (documentType === null) return;
+        const description = prompt('Beschreibung:', doc.description || '');
+        if (description === null) return;
+        await api(`/documents/${docId}`, {
+            method: 'PUT',
+            body: JSON.stringify({ document_type: documentType.trim(), description }),
+        });
+        renderContractDetail(state.currentContract);
+    } catch (error) {
+        alert('Fehler beim Speichern: ' + error.message);
+    }
+}
+
+window.editDocument = editDocument;
+
+function uploadDocumentVersion(docId) {
+    const input = document.createElement('input');
+    input.type = 'file';
+    input.accept = UPLOAD_ACCEPT;
+    input.onchange = async () => {
+        const file = input.files[0];
+        if (!file) return;
+        const formData = new FormData();
+        formData.append('document', file);
+        try {
+            const response = await fetch(`${API_BASE}/documents/${docId}/versions`, {
+                method: 'POST',
+                headers: { 'Authorization': `Bearer ${state.token}` },
+                body: formData,
+            });
+            if (!response.ok) throw new Error(await response.text());
+            renderContractDetail(state.currentContract);
+        } catch (error) {
+            alert('Fehler beim Hochladen: ' + error.message);
+        }
+    };
+    input.click();
+}
+
+window.uploadDocumentVersion = uploadDocumentVersion;
+
+async function deleteDocument(docId) {
+    if (!confirm('Möchten Sie dieses Dokument wirklich löschen? Ein Administrator kann es wiederherstellen.')) {
+        return;
+    }
+    try {
+        await api(`/documents/${docId}`, { method: 'DELETE' });
+        renderContractDetail(state.currentContract);
+    } catch (error) {
+        alert('Fehler beim Löschen: ' + error.message);
+    }
+}
+
+window.deleteDocument = deleteDocument;
+
+async function restoreDocument(docId) {
+    try {
+        await api(`/documents/${docId}/restore`, { method: 'POST' });
+        renderContractDetail(state.currentContract);
+    } catch (error) {
+        alert('Fehler beim Wiederherstellen: ' + error.message);
+    }
+}
+
+window.restoreDocument = restoreDocument;
+
 async function terminateContract() {
     if (!confirm('Möchten Sie diesen Vertrag wirklich beenden? Diese Aktion kann nicht rückgängig gemacht werden.')) {
         return;
@@ -418,6 +712,42 @@ async function terminateContract() {
 
 window.terminateContract = terminateContract;
 
+async function deleteContract() {
+    if (!confirm('Möchten Sie diesen Vertrag in den Papierkorb verschieben? Ein Administrator kann ihn dort wiederherstellen.')) {
+        return;
+    }
+
+    try {
+        await api(`/contracts/${state.currentContract.id}`, { method: 'DELETE' });
+        state.currentContract = null;
+        showContent('contracts');
+    } catch (error) {
+        alert('Fehler beim Löschen: ' + error.message);
+    }
+}
+
+async function toggleLegalHold() {
+    const contract = state.currentContract;
+    let reason = '';
+    if (!contract.legal_hold) {
+        reason = prompt('Begründung für den Legal Hold (z. B. Aktenzeichen des Rechtsstreits):');
+        if (reason === null) return;
+    } else if (!confirm('Legal Hold wirklich aufheben? Der Vertrag kann danach nach Ablauf der Aufbewahrungsfrist gelöscht werden.')) {
+        return;
+    }
+
+    try {
+        const updated = await api(`/contracts/${contract.id}/legal-hold`, {
+            method: 'PUT',
+            body: JSON.stringify({ legal_hold: !contract.legal_hold, reason }),
+        });
+        state.currentContract = updated;
+        renderContractDetail(updated);
+    } catch (error) {
+        alert('Fehler beim Ändern des Legal Hold: ' + error.message);
+    }
+}
+
 // Contract form
 async function showContractForm(contractId = null) {
     const formTitle = document.getElementById('form-title');
@@ -449,6 +779,7 @@ async function showContractForm(contractId = null) {
         form.elements['notice_period'].value = contract.notice_period != null ? contract.notice_period : '';
         form.elements['minimum_term'].value = contract.minimum_term ? contract.minimum_term.split('T')[0] : '';
         form.elements['term_months'].value = contract.term_months != null ? contract.term_months : '';
+        form.elements['annual_cost'].value = contract.annual_cost != null ? contract.annual_cost : '';
         if (contract.framework_contract_id) {
             form.elements['framework_contract_id'].value = contract.framework_contract_id;
         }
@@ -499,6 +830,7 @@ async function saveContract(formData) {
         notice_period: formData.get('notice_period') ? parseInt(formData.get('notice_period')) : null,
         minimum_term: formData.get('minimum_term') ? new Date(formData.get('minimum_term')).toISOString() : null,
         term_months: formData.get('term_months') ? parseInt(formData.get('term_months')) : null,
+        annual_cost: formData.get('annual_cost') ? parseFloat(formData.get('annual_cost')) : null,
         framework_contract_id: formData.get('framework_contract_id') ? parseInt(formData.get('framework_contract_id')) : null,
     };
     
@@ -747,11 +1079,12 @@ async function editCategory(categoryId) {
 window.editCategory = editCategory;
 
 async function deleteCategory(categoryId, name) {
-    if (!confirm(`Kategorie "${name}" wirklich löschen?`)) return;
+    if (!confirm(`Kategorie "${name}" in den Papierkorb verschieben?`)) return;
     try {
         await api(`/categories/${categoryId}`, { method: 'DELETE' });
         loadCategoriesAdmin();
         loadCategories();
+        loadTrash();
     } catch (error) {
         console.error('Error deleting category:', error);
         alert('Fehler beim Löschen: ' + error.message);
@@ -785,6 +1118,255 @@ async function saveCategory(formData) {
     }
 }
 
+// Retention
+async function loadRetentionAdmin() {
+    try {
+        const [categories, rules, candidates] = await Promise.all([
+            api('/categories'),
+            api('/retention/rules'),
+            api('/retention/candidates'),
+        ]);
+        const categorySelect = document.getElementById('retention-category');
+        const current = categorySelect.value;
+        categorySelect.innerHTML = '<option value="">Kategorie wählen...</option>' +
+            (categories || []).map(c => `<option value="${c.id}">${escapeHtml(c.name)}</option>`).join('');
+        categorySelect.value = current;
+        const typeSelect = document.getElementById('retention-document-type');
+        if (!typeSelect.options.length) {
+            typeSelect.innerHTML = '<option value="">Vertrag mit allen Dokumenten</option>' +
+                Object.entries(DOCUMENT_TYPES).map(([value, label]) => `<option value="${value}">Dokumente: ${label}</option>`).join('');
+        }
+        renderRetentionRules(rules || []);
+        renderRetentionCandidates(candidates || []);
+    } catch (error) {
+        console.error('Error loading retention rules:', error);
+    }
+}
+
+function renderRetentionRules(rules) {
+    const container = document.getElementById('retention-rules-list');
+
+    if (rules.length === 0) {
+        container.innerHTML = '<p>Keine Aufbewahrungsregeln vorhanden</p>';
+        return;
+    }
+
+    container.innerHTML = `
+        <table class="table">
+            <thead>
+                <tr>
+                    <th>Kategorie</th>
+                    <th>Gilt für</th>
+                    <th>Jahre</th>
+                    <th>Aktionen</th>
+                </tr>
+            </thead>
+            <tbody>
+                ${rules.map(rule => `
+                    <tr>
+                        <td>${escapeHtml(rule.category)}</td>
+                        <td>${rule.document_type ? 'Dokumente: ' + (DOCUMENT_TYPES[rule.document_type] || escapeHtml(rule.document_type)) : 'Vertrag mit allen Dokumenten'}</td>
+                        <td>${rule.years}</td>
+                        <td>
+                            <button onclick="editRetentionRule(${rule.id}, ${rule.category_id}, '${rule.document_type}', ${rule.years})" class="btn btn-secondary" style="margin-right:4px">Bearbeiten</button>
+                            <button onclick="deleteRetentionRule(${rule.id})" class="btn btn-danger">Löschen</button>
+                        </td>
+                    </tr>
+                `).join('')}
+            </tbody>
+        </table>
+    `;
+}
+
+function renderRetentionCandidates(candidates) {
+    const container = document.getElementById('retention-candidates-list');
+
+    if (candidates.length === 0) {
+        container.innerHTML = '<p>Keine offenen Löschvorschläge</p>';
+        return;
+    }
+
+    container.innerHTML = `
+        <table class="table">
+            <thead>
+                <tr>
+                    <th>Vertrag</th>
+                    <th>Kategorie</th>
+                    <th>Löschen</th>
+                    <th>Frist seit</th>
+                    <th>Aktionen</th>
+                </tr>
+            </thead>
+            <tbody>
+                ${candidates.map(rc => `
+                    <tr>
+                        <td>${escapeHtml(rc.contract_number)} - ${escapeHtml(rc.contract_title)}</td>
+                        <td>${escapeHtml(rc.category)}</td>
+                        <td>${rc.document_id ? 'Dokument ' + escapeHtml(rc.document_filename) : 'Vertrag mit allen Dokumenten'}</td>
+                        <td>${formatDate(rc.due_at)} (${rc.years} Jahre ab ${formatDate(rc.retention_start)})</td>
+                        <td>
+                            <button onclick="approveRetentionCandidate(${rc.id})" class="btn btn-danger" style="margin-right:4px">Endgültig löschen</button>
+                            <button onclick="rejectRetentionCandidate(${rc.id})" class="btn btn-secondary">Ablehnen</button>
+                        </td>
+                    </tr>
+                `).join('')}
+            </tbody>
+        </table>
+    `;
+}
+
+async function saveRetentionRule(formData) {
+    const form = document.getElementById('retention-rule-form');
+    const ruleId = form.dataset.ruleId;
+    const data = {
+        category_id: parseInt(formData.get('category_id')),
+        document_type: formData.get('document_type'),
+        years: parseInt(formData.get('years')),
+    };
+
+    try {
+        await api(ruleId ? `/retention/rules/${ruleId}` : '/retention/rules', {
+            method: ruleId ? 'PUT' : 'POST',
+            body: JSON.stringify(data),
+        });
+        form.reset();
+        form.dataset.ruleId = '';
+        form.querySelector('button[type="submit"]').textContent = 'Regel anlegen';
+        loadRetentionAdmin();
+    } catch (error) {
+        console.error('Error saving retention rule:', error);
+        alert('Fehler beim Speichern: ' + error.message);
+    }
+}
+
+function editRetentionRule(ruleId, categoryId, documentType, years) {
+    const form = document.getElementById('retention-rule-form');
+    form.dataset.ruleId = ruleId;
+    form.elements['category_id'].value = categoryId;
+    form.elements['document_type'].value = documentType;
+    form.elements['years'].value = years;
+    form.querySelector('button[type="submit"]').textContent = 'Regel speichern';
+}
+window.editRetentionRule = editRetentionRule;
+
+async function deleteRetentionRule(ruleId) {
+    if (!confirm('Aufbewahrungsregel wirklich löschen?')) return;
+    try {
+        await api(`/retention/rules/${ruleId}`, { method: 'DELETE' });
+        loadRetentionAdmin();
+    } catch (error) {
+        console.error('Error deleting retention rule:', error);
+        alert('Fehler beim Löschen: ' + error.message);
+    }
+}
+window.deleteRetentionRule = deleteRetentionRule;
+
+async function approveRetentionCandidate(candidateId) {
+    if (!confirm('Vertrag bzw. Dokument endgültig löschen? Diese Aktion kann nicht rückgängig gemacht werden.')) {
+        return;
+    }
+    try {
+        await api(`/retention/candidates/${candidateId}/approve`, { method: 'POST' });
+        loadRetentionAdmin();
+    } catch (error) {
+        console.error('Error approving retention candidate:', error);
+        alert('Fehler beim Löschen: ' + error.message);
+    }
+}
+window.approveRetentionCandidate = approveRetentionCandidate;
+
+async function rejectRetentionCandidate(candidateId) {
+    const reason = prompt('Begründung für die Ablehnung:');
+    if (reason === null) return;
+    try {
+        await api(`/retention/candidates/${candidateId}/reject`, {
+            method: 'POST',
+            body: JSON.stringify({ reason }),
+        });
+        loadRetentionAdmin();
+    } catch (error) {
+        console.error('Error rejecting retention candidate:', error);
+        alert('Fehler beim Ablehnen: ' + error.message);
+    }
+}
+window.rejectRetentionCandidate = rejectRetentionCandidate;
+
+// Trash
+async function loadTrash() {
+    try {
+        const entries = await api('/trash');
+        renderTrash(entries || []);
+    } catch (error) {
+        console.error('Error loading trash:', error);
+    }
+}
+
+function renderTrash(entries) {
+    const container = document.getElementById('trash-list');
+
+    if (entries.length === 0) {
+        container.innerHTML = '<p>Der Papierkorb ist leer</p>';
+        return;
+    }
+
+    container.innerHTML = `
+        <table class="table">
+            <thead>
+                <tr>
+                    <th>Typ</th>
+                    <th>Name</th>
+                    <th>Gelöscht</th>
+                    <th>Endgültig gelöscht ab</th>
+                    <th>Aktionen</th>
+                </tr>
+            </thead>
+            <tbody>
+                ${entries.map(e => `
+                    <tr>
+                        <td>${e.type === 'contract' ? 'Vertrag' : 'Kategorie'}</td>
+                        <td>${escapeHtml(e.name)}</td>
+                        <td>${formatDateTime(e.deleted_at)}${e.deleted_by_name ? ' von ' + escapeHtml(e.deleted_by_name) : ''}</td>
+                        <td>${e.purge_at ? formatDate(e.purge_at) : '-'}</td>
+                        <td>
+                            <button onclick="restoreTrashEntry('${e.type}', ${e.id})" class="btn btn-secondary" style="margin-right:4px">Wiederherstellen</button>
+                            <button onclick="purgeTrashEntry('${e.type}', ${e.id})" class="btn btn-danger">Endgültig löschen</button>
+                        </td>
+                    </tr>
+                `).join('')}
+            </tbody>
+        </table>
+    `;
+}
+
+async function restoreTrashEntry(type, id) {
+    try {
+        await api(`/${type === 'contract' ? 'contracts' : 'categories'}/${id}/restore`, { method: 'POST' });
+        loadTrash();
+        if (type === 'category') {
+            loadCategoriesAdmin();
+            loadCategories();
+        }
+    } catch (error) {
+        console.error('Error restoring trash entry:', error);
+        alert('Fehler beim Wiederherstellen: ' + error.message);
+    }
+}
+window.restoreTrashEntry = restoreTrashEntry;
+
+async function purgeTrashEntry(type, id) {
+    if (!confirm('Endgültig löschen? Diese Aktion kann nicht rückgängig gemacht werden.')) {
+        return;
+    }
+    try {
+        await api(`/trash/${type === 'contract' ? 'contracts' : 'categories'}/${id}`, { method: 'DELETE' });
+        loadTrash();
+    } catch (error) {
+        console.error('Error purging trash entry:', error);
+        alert('Fehler beim Löschen: ' + error.message);
+    }
+}
+window.purgeTrashEntry = purgeTrashEntry;
+
 // Reports
 async function showValidContracts() {
     try {
@@ -869,6 +1451,176 @@ async function showExpiringContracts() {
 
 window.showExpiringContracts = showExpiringContracts;
 
+// Lädt eine Liste im angegebenen Format (csv, xlsx oder pdf) als Datei herunter
+async function exportList(path, format) {
+    try {
+        const separator = path.includes('?') ? '&' : '?';
+        const response = await fetch(`${API_BASE}${path}${separator}format=${format}`, {
+            headers: { 'Authorization': `Bearer ${state.token}` },
+        });
+        if (!response.ok) throw new Error('Export fehlgeschlagen');
+        const blob = await response.blob();
+        const disposition = response.headers.get('Content-Disposition') || '';
+        const match = disposition.match(/filename="?([^"]+)"?/);
+        const filename = match ? match[1] : `export.${format}`;
+        const url = URL.createObjectURL(blob);
+        const a = document.createElement('a');
+        a.href = url;
+        a.download = filename;
+        a.click();
+        URL.revokeObjectURL(url);
+    } catch (error) {
+        console.error('Error exporting list:', error);
+        alert('Fehler beim Export');
+    }
+}
+
+function exportExpiringContracts(format) {
+    const days = document.getElementById('warning-days').value || 90;
+    exportList(`/reports/expiring?days=${days}`, format);
+}
+
+// Live-Aktualisierung über Server-Sent Events. fetch statt EventSource, damit das
+// Token im Authorization-Header und die Last-Event-ID selbst gesendet werden können.
+async function connectLiveUpdates() {
+    disconnectLiveUpdates();
+    const controller = new AbortController();
+    state.liveUpdates = controller;
+    let retry = 3000;
+
+    while (!controller.signal.aborted) {
+        try {
+            const headers = { 'Authorization': `Bearer ${state.token}` };
+            if (state.lastEventId) {
+                headers['Last-Event-ID'] = state.lastEventId;
+            }
+            const response = await fetch(`${API_BASE}/events`, { headers, signal: controller.signal });
+            if (response.status === 401) {
+                logout();
+                return;
+            }
+            if (!response.ok) throw new Error(`Status ${response.status}`);
+
+            const reader = response.body.pipeThrough(new TextDecoderStream()).getReader();
+            let buffer = '';
+            for (;;) {
+                const { value, done } = await reader.read();
+                if (done) break;
+                buffer += value.replace(/\r\n?/g, '\n');
+                let end;
+                while ((end = buffer.indexOf('\n\n')) >= 0) {
+                    const event = parseServerSentEvent(buffer.slice(0, end));
+                    buffer = buffer.slice(end + 2);
+                    if (event.retry) retry = event.retry;
+                    if (event.id) state.lastEventId = event.id;
+                    if (event.data) handleLiveEvent(event.type, JSON.parse(event.data));
+                }
+            }
+        } catch (error) {
+            if (controller.signal.aborted) return;
+            console.error('Live-Verbindung unterbrochen:', error);
+        }
+        await new Promise(resolve => setTimeout(resolve, retry));
+    }
+}
+
+function disconnectLiveUpdates() {
+    if (state.liveUpdates) {
+        state.liveUpdates.abort();
+        state.liveUpdates = null;
+    }
+    state.lastEventId = null;
+}
+
+function parseServerSentEvent(block) {
+    const event = { type: 'message', data: '' };
+    const data = [];
+    block.split('\n').forEach(line => {
+        if (line.startsWith(':')) return;
+        const colon = line.indexOf(':');
+        const field = colon < 0 ? line : line.slice(0, colon);
+        const value = colon < 0 ? '' : line.slice(colon + 1).replace(/^ /, '');
+        if (field === 'event') event.type = value;
+        else if (field === 'data') data.push(value);
+        else if (field === 'id') event.id = value;
+        else if (field === 'retry' && /^\d+$/.test(value)) event.retry = parseInt(value);
+    });
+    event.data = data.join('\n');
+    return event;
+}
+
+function isPageVisible(pageId) {
+    const page = document.getElementById(pageId);
+    return page && !page.classList.contains('hidden');
+}
+
+// Aktualisiert die sichtbaren Ansichten; Formulare werden nicht angetastet
+function handleLiveEvent(type, data) {
+    const detailVisible = isPageVisible('contract-detail-page') && state.currentContract;
+
+    switch (type) {
+    case 'contract.updated':
+    case 'contract.terminated': {
+        const card = document.querySelector(`#contracts-list [data-contract-id="${data.contract.id}"]`);
+        if (card) {
+            card.outerHTML = renderContractCard(data.contract);
+        }
+        if (detailVisible && state.currentContract.id === data.contract.id) {
+            state.currentContract = data.contract;
+            renderContractDetail(data.contract);
+        }
+        break;
+    }
+    case 'contract.created':
+        if (isPageVisible('contracts-page')) loadContracts();
+        break;
+    case 'contract.restored':
+        if (isPageVisible('contracts-page')) loadContracts();
+        if (isPageVisible('settings-page')) loadTrash();
+        break;
+    case 'contract.deleted':
+        if (isPageVisible('contracts-page')) loadContracts();
+        if (isPageVisible('settings-page')) loadTrash();
+        if (detailVisible && state.currentContract.id === data.contract_id) {
+            state.currentContract = null;
+            showContent('contracts');
+        }
+        break;
+    case 'document.created':
+    case 'document.updated':
+    case 'document.deleted':
+    case 'document.restored':
+        if (detailVisible && state.currentContract.id === data.document.contract_id) {
+            renderContractDetail(state.currentContract);
+        }
+        break;
+    case 'category.created':
+    case 'category.updated':
+    case 'category.deleted':
+    case 'category.restored':
+        loadCategories();
+        if (isPageVisible('settings-page')) {
+            loadCategoriesAdmin();
+            loadTrash();
+        }
+        // Umbenennungen ändern die Kategorie der Verträge
+        if (type === 'category.updated') {
+            if (isPageVisible('contracts-page')) loadContracts();
+            if (detailVisible) viewContract(state.currentContract.id);
+        }
+        break;
+    case 'contracts.changed':
+    case 'reset':
+        if (isPageVisible('contracts-page')) loadContracts();
+        if (detailVisible) viewContract(state.currentContract.id);
+        if (type === 'reset') {
+            loadCategories();
+            if (isPageVisible('settings-page')) loadCategoriesAdmin();
+        }
+        break;
+    }
+}
+
 // Utility
 function escapeHtml(text) {
     if (!text) return '';
@@ -896,6 +1648,7 @@ document.addEventListener('DOMContentLoaded', () => {
             saveAuth(response.token, response.user);
             updateUIForRole();
             loadCategories();
+            connectLiveUpdates();
             showPage('main');
             showContent('contracts');
         } catch (error) {
@@ -924,6 +1677,16 @@ document.addEventListener('DOMContentLoaded', () => {
         }
     });
     document.getElementById('terminate-contract-btn').addEventListener('click', terminateContract);
+    document.getElementById('delete-contract-btn').addEventListener('click', () => {
+        if (state.currentContract) {
+            deleteContract();
+        }
+    });
+    document.getElementById('legal-hold-btn').addEventListener('click', () => {
+        if (state.currentContract) {
+            toggleLegalHold();
+        }
+    });
     
     // Contract form
     document.getElementById('contract-form').addEventListener('submit', async (e) => {
@@ -972,6 +1735,11 @@ document.addEventListener('DOMContentLoaded', () => {
         });
     });
 
+    document.getElementById('close-preview-btn').addEventListener('click', closePreview);
+    document.getElementById('preview-modal').addEventListener('click', (e) => {
+        if (e.target.id === 'preview-modal') closePreview();
+    });
+
     document.getElementById('cancel-category-btn').addEventListener('click', () => {
         document.getElementById('category-modal').classList.add('hidden');
     });
@@ -982,9 +1750,42 @@ document.addEventListener('DOMContentLoaded', () => {
         await saveCategory(formData);
     });
     
+    // Retention
+    document.getElementById('retention-rule-form').addEventListener('submit', async (e) => {
+        e.preventDefault();
+        await saveRetentionRule(new FormData(e.target));
+    });
+    document.getElementById('retention-run-btn').addEventListener('click', async () => {
+        try {
+            await api('/retention/run', { method: 'POST' });
+            loadRetentionAdmin();
+        } catch (error) {
+            console.error('Error checking retention:', error);
+            alert('Fehler bei der Prüfung: ' + error.message);
+        }
+    });
+
     // Reports
     document.getElementById('show-valid-contracts').addEventListener('click', showValidContracts);
     document.getElementById('show-expiring-contracts').addEventListener('click', showExpiringContracts);
+    document.getElementById('export-valid-csv').addEventListener('click', () => exportList('/contracts?only_valid=true', 'csv'));
+    document.getElementById('export-valid-xlsx').addEventListener('click', () => exportList('/contracts?only_valid=true', 'xlsx'));
+    document.getElementById('export-expiring-csv').addEventListener('click', () => exportExpiringContracts('csv'));
+    document.getElementById('export-expiring-xlsx').addEventListener('click', () => exportExpiringContracts('xlsx'));
+    document.getElementById('export-expiring-pdf').addEventListener('click', () => exportExpiringContracts('pdf'));
+    document.getElementById('export-valid-pdf').addEventListener('click', () => exportList('/contracts?only_valid=true', 'pdf'));
+    document.getElementById('export-portfolio-pdf').addEventListener('click', () => exportList('/reports/portfolio', 'pdf'));
+    document.getElementById('contract-pdf-btn').addEventListener('click', () => {
+        if (state.currentContract) {
+            exportList(`/contracts/${state.currentContract.id}`, 'pdf');
+        }
+    });
+    document.getElementById('contract-dossier-btn').addEventListener('click', () => {
+        if (state.currentContract) {
+            downloadFile(`/contracts/${state.currentContract.id}/dossier?versions=all`);
+        }
+    });
+    document.getElementById('export-valid-dossier').addEventListener('click', () => downloadFile('/contracts/dossier?only_valid=true'));
     document.getElementById('calculate-dates-btn').addEventListener('click', async () => {
         try {
             const result = await api('/contracts/calculate-dates', { method: 'POST' });
@@ -999,6 +1800,7 @@ document.addEventListener('DOMContentLoaded', () => {
     if (loadAuth()) {
         updateUIForRole();
         loadCategories();
+        connectLiveUpdates();
         showPage('main');
         showContent('contracts');
     } else {
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fuzzJSON prüft, dass beliebige Anfragerümpfe für eine Route weder zu einem
+// Serverfehler noch zu einer ungültigen Antwort führen: Fehleingaben müssen als
+// 4xx abgewiesen werden. setup legt vorab Daten an, auf die sich path bezieht.
+func fuzzJSON(f *testing.F, method, path string, setup func(s *testServer), seeds ...string) {
+	s := newTestServer(f)
+	if setup != nil {
+		setup(s)
+	}
+	for _, seed := range append(seeds, "", "null", "{}", "[]", `{"id":"x"}`, "{", `"\u0000"`) {
+		f.Add([]byte(seed))
+	}
+
+	handler := s.Config.Handler
+	f.Fuzz(func(t *testing.T, body []byte) {
+		req := httptest.NewRequest(method, "/vertragsdb/api"+path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+s.admin)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code >= 500 {
+			t.Fatalf("%s %s mit %q: Status %d: %s", method, path, body, rec.Code, rec.Body)
+		}
+		if rec.Code < 300 && rec.Code != http.StatusNoContent && !json.Valid(rec.Body.Bytes()) {
+			t.Fatalf("%s %s mit %q: ungültiges JSON in der Antwort: %s", method, path, body, rec.Body)
+		}
+	})
+}
+
+func FuzzLogin(f *testing.F) {
+	fuzzJSON(f, "POST", "/login", nil,
+		`{"username":"admin","password":"admin"}`,
+		`{"username":"admin","password":""}`,
+		`{"username":["admin"]}`)
+}
+
+func FuzzUserInput(f *testing.F) {
+	fuzzJSON(f, "POST", "/users", nil,
+		`{"username":"neu","password":"geheim","role":"viewer"}`,
+		`{"username":"neu","password":"geheim","role":"root"}`,
+		`{"username":"","password":"","role":"admin"}`)
+}
+
+func FuzzUserUpdate(f *testing.F) {
+	fuzzJSON(f, "PUT", "/users/1", nil,
+		`{"username":"admin","role":"admin"}`,
+		`{"username":"admin","role":"viewer"}`,
+		`{"password":"neu"}`)
+}
+
+func FuzzContractInput(f *testing.F) {
+	fuzzJSON(f, "POST", "/contracts", nil,
+		`{"title":"Wartung","contract_type":"individual","category":"IT","partner":"ACME","valid_from":"2024-01-31T00:00:00Z","notice_period":3,"term_months":12}`,
+		`{"title":"Rahmen","contract_type":"framework","category":"IT","partner":"ACME","minimum_term":"2025-12-31T00:00:00Z"}`,
+		`{"title":"x","contract_type":"individual","framework_contract_id":999,"category":"IT","partner":"ACME"}`,
+		`{"title":"x","contract_type":"sonstiges","category":"IT","partner":"ACME","notice_period":-1,"annual_cost":-5}`,
+		`{"title":"x","valid_from":"31.01.2024","valid_until":"2020-01-01T00:00:00Z"}`)
+}
+
+func FuzzContractUpdate(f *testing.F) {
+	fuzzJSON(f, "PUT", "/contracts/1", func(s *testServer) { s.createContract(nil) },
+		`{"title":"Wartung","contract_type":"individual","category":"IT","partner":"ACME","term_months":0}`,
+		`{"title":"Wartung","contract_type":"individual","category":"IT","partner":"ACME","framework_contract_id":1}`,
+		`{"title":"Wartung","contract_type":"individual","category":"Unbekannt","partner":"ACME","owner_id":999}`)
+}
+
+func FuzzLegalHold(f *testing.F) {
+	fuzzJSON(f, "PUT", "/contracts/1/legal-hold", func(s *testServer) { s.createContract(nil) },
+		`{"legal_hold":true,"reason":"Klage"}`,
+		`{"legal_hold":true}`,
+		`{"legal_hold":false}`)
+}
+
+func FuzzCategoryInput(f *testing.F) {
+	fuzzJSON(f, "POST", "/categories", nil,
+		`{"name":"Leasing"}`,
+		`{"name":"IT"}`,
+		`{"name":" "}`)
+}
+
+func FuzzDocumentInput(f *testing.F) {
+	fuzzJSON(f, "PUT", "/documents/1", func(s *testServer) {
+		c := s.createContract(nil)
+		s.expect("POST", fmt.Sprintf("/contracts/%d/documents", c.ID), s.admin, uploadForm(s.t, "vertrag.pdf", testPDF("fuzz"), nil), http.StatusCreated, nil)
+	},
+		`{"document_type":"invoice","description":"Rechnung"}`,
+		`{"document_type":"brief"}`,
+		`{"description":null}`)
+}
+
+func FuzzSavedSearchInput(f *testing.F) {
+	fuzzJSON(f, "POST", "/saved-searches", nil,
+		`{"name":"IT","params":{"category":"IT","expiring_days":"90"},"sort":"-valid_from","shared_with_roles":["viewer"]}`,
+		`{"name":"x","params":{"unbekannt":"1"}}`,
+		`{"name":"x","sort":"passwort"}`)
+}
+
+func FuzzDashboardWidgetInput(f *testing.F) {
+	fuzzJSON(f, "POST", "/dashboard/widgets", nil,
+		`{"type":"cost_by_category","title":"Kosten"}`,
+		`{"type":"expiring","config":{"days":30}}`,
+		`{"type":"saved_search","config":{"saved_search_id":-1}}`)
+}
+
+func FuzzReportSubscriptionInput(f *testing.F) {
+	fuzzJSON(f, "POST", "/report-subscriptions", nil,
+		`{"name":"Fristen","report":"expiring","params":{"days":"90"},"format":"pdf","delivery":"attachment","recipients":["a@example.com"],"schedule":"0 8 * * 1","enabled":true}`,
+		`{"name":"x","report":"saved_search","params":{"saved_search_id":"999"},"format":"csv","delivery":"inline","recipients":["a@example.com"],"schedule":"*/5 * * * *"}`,
+		`{"name":"x","report":"expiring","format":"pdf","recipients":["a"],"schedule":"99 * * * *"}`)
+}
+
+func FuzzWebhookInput(f *testing.F) {
+	fuzzJSON(f, "POST", "/webhooks", nil,
+		`{"name":"Empfänger","url":"https://example.com/hook","events":["contract.created"],"enabled":true,"deadline_days":30}`,
+		`{"name":"x","url":"ftp://example.com","events":["contract.exploded"]}`,
+		`{"name":"x","url":"http://","deadline_days":-1}`)
+}
+
+func FuzzRetentionRuleInput(f *testing.F) {
+	fuzzJSON(f, "POST", "/retention/rules", nil,
+		`{"category_id":1,"years":10}`,
+		`{"category_id":1,"document_type":"invoice","years":8}`,
+		`{"category_id":999,"years":0}`)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Farben der HTML-Berichte, entsprechen pdfAccent, pdfGray und pdfLightGray
+const (
+	htmlAccent    = "#29548c"
+	htmlGray      = "#666666"
+	htmlLightGray = "#ebebeb"
+	htmlZebra     = "#f6f6f6"
+)
+
+// htmlReport setzt Berichte als eigenständiges HTML-Dokument. Alle Styles stehen
+// inline, damit der Bericht auch als Text einer E-Mail korrekt dargestellt wird.
+type htmlReport struct {
+	cfg      reportConfig
+	title    string
+	subtitle string
+	created  time.Time
+	body     strings.Builder
+}
+
+func newHTMLReport(title, subtitle string) *htmlReport {
+	return &htmlReport{cfg: loadReportConfig(), title: title, subtitle: subtitle, created: time.Now()}
+}
+
+func (r *htmlReport) heading(s string) {
+	fmt.Fprintf(&r.body, `<h2 style="margin:24px 0 8px;font-size:16px;color:%s">%s</h2>`+"\n", htmlAccent, html.EscapeString(s))
+}
+
+func (r *htmlReport) paragraph(s string, small bool) {
+	style := "margin:8px 0;font-size:13px"
+	if small {
+		style = "margin:8px 0;font-size:12px;color:" + htmlGray
+	}
+	fmt.Fprintf(&r.body, `<p style="%s">%s</p>`+"\n", style, strings.ReplaceAll(html.EscapeString(s), "\n", "<br>"))
+}
+
+// table gibt eine Tabelle aus; totals wird, falls angegeben, fett als letzte Zeile ausgegeben.
+func (r *htmlReport) table(cols []pdfColumn, rows [][]string, totals []string) {
+	cell := func(tag, text string, col pdfColumn, extra string) {
+		align := "left"
+		if col.Right {
+			align = "right"
+		}
+		fmt.Fprintf(&r.body, `<%s style="padding:4px 6px;text-align:%s;vertical-align:top;%s">%s</%s>`,
+			tag, align, extra, html.EscapeString(text), tag)
+	}
+
+	r.body.WriteString(`<table style="border-collapse:collapse;width:100%;font-size:12px">` + "\n<tr>")
+	for _, col := range cols {
+		cell("th", col.Label, col, "background:"+htmlLightGray)
+	}
+	r.body.WriteString("</tr>\n")
+	for n, row := range rows {
+		background := ""
+		if n%2 == 1 {
+			background = "background:" + htmlZebra
+		}
+		r.body.WriteString("<tr>")
+		for i, text := range row {
+			cell("td", text, cols[i], background)
+		}
+		r.body.WriteString("</tr>\n")
+	}
+	if totals != nil {
+		r.body.WriteString("<tr>")
+		for i, text := range totals {
+			cell("td", text, cols[i], "font-weight:bold;border-top:1px solid #000")
+		}
+		r.body.WriteString("</tr>\n")
+	}
+	r.body.WriteString("</table>\n")
+}
+
+// finish ergänzt Firmenkopf und Fußzeile und schreibt das Dokument.
+func (r *htmlReport) finish(w io.Writer) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<!DOCTYPE html>\n<html lang=\"de\">\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n</head>\n", html.EscapeString(r.title))
+	sb.WriteString(`<body style="margin:0;padding:24px;font-family:Helvetica,Arial,sans-serif;color:#000">` + "\n")
+	fmt.Fprintf(&sb, `<table style="width:100%%;border-bottom:1px solid %s;margin-bottom:8px"><tr>`, htmlAccent)
+	fmt.Fprintf(&sb, `<td style="vertical-align:top;padding-bottom:8px"><div style="font-size:20px">%s</div><div style="font-size:12px;color:%s">%s</div></td>`,
+		html.EscapeString(r.title), htmlGray, html.EscapeString(r.subtitle))
+	if r.cfg.Company != "" {
+		fmt.Fprintf(&sb, `<td style="vertical-align:top;text-align:right;padding-bottom:8px"><div style="font-size:14px">%s</div>`, html.EscapeString(r.cfg.Company))
+		for _, line := range r.cfg.Address {
+			fmt.Fprintf(&sb, `<div style="font-size:12px;color:%s">%s</div>`, htmlGray, html.EscapeString(line))
+		}
+		sb.WriteString("</td>")
+	}
+	sb.WriteString("</tr></table>\n")
+	sb.WriteString(r.body.String())
+	fmt.Fprintf(&sb, `<p style="margin-top:24px;font-size:11px;color:%s">Erstellt am %s</p>`+"\n</body>\n</html>\n",
+		htmlGray, r.created.Format("02.01.2006 15:04"))
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func sendHTML(w http.ResponseWriter, r *htmlReport, filename string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, filename))
+	if err := r.finish(w); err != nil {
+		log.Printf("HTML-Bericht %s abgebrochen: %v", filename, err)
+	}
+}
+
+// writeContractListHTML gibt eine Vertragsliste als HTML-Tabelle aus.
+func writeContractListHTML(w http.ResponseWriter, q url.Values, title string, cols []exportColumn, rows [][]interface{}, filename string) {
+	r := newHTMLReport(title, listSubtitle(q, len(rows)))
+	tableCols, cells := listTable(cols, rows)
+	if len(cells) == 0 {
+		r.paragraph("Keine Verträge gefunden.", false)
+	} else {
+		r.table(tableCols, cells, nil)
+	}
+	sendHTML(w, r, filename)
+}
+
+// writePortfolioHTML gibt die Portfolio-Übersicht als HTML aus.
+func writePortfolioHTML(ctx context.Context, w http.ResponseWriter, repos *Repositories, q url.Values, report *PortfolioReport, where string, args []interface{}) {
+	deadlines, err := upcomingDeadlines(ctx, repos, where, args, report.Days)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	r := newHTMLReport("Vertragsportfolio", portfolioSubtitle(q))
+	r.heading("Verträge nach Kategorie")
+	var rows [][]string
+	for _, c := range report.Categories {
+		rows = append(rows, portfolioRow(c))
+	}
+	r.table(portfolioColumns(report.Days), rows, portfolioRow(report.Total))
+	r.paragraph(portfolioNote(report.Days), true)
+
+	r.heading(fmt.Sprintf("Anstehende Kündigungsvornahmen (nächste %d Tage)", report.Days))
+	if len(deadlines) == 0 {
+		r.paragraph("Keine anstehenden Kündigungsvornahmen.", false)
+	} else {
+		r.table(deadlineColumns, deadlines, nil)
+	}
+
+	sendHTML(w, r, exportFilename("Vertragsportfolio", time.Now(), exportHTML))
+}
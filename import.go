@@ -0,0 +1,757 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxImportSize begrenzt die Größe einer Importdatei.
+const maxImportSize = 32 << 20
+
+// importField ist ein Zielfeld des Imports. Spaltenüberschriften werden ohne
+// Zuordnung über den Feldnamen, die Bezeichnung oder einen Alias erkannt.
+type importField struct {
+	Key     string   `json:"key"`
+	Label   string   `json:"label"`
+	Aliases []string `json:"-"`
+}
+
+// importFields enthält die Bezeichnungen des Exports, damit exportierte Dateien
+// ohne Zuordnung wieder importiert werden können.
+var importFields = []importField{
+	{"contract_number", "Vertragsnummer", []string{"Vertragsnr.", "Nummer"}},
+	{"title", "Titel", []string{"Bezeichnung", "Vertrag"}},
+	{"content", "Inhalt", nil},
+	{"conditions", "Konditionen", []string{"Bedingungen"}},
+	{"partner", "Partner", []string{"Vertragspartner"}},
+	{"category", "Kategorie", nil},
+	{"contract_type", "Vertragsart", []string{"Typ"}},
+	{"framework_contract_id", "Rahmenvertrag-ID", nil},
+	{"framework_contract_number", "Rahmenvertrag (Nummer)", []string{"Rahmenvertrag"}},
+	{"owner", "Verantwortlich", nil},
+	{"owner_id", "Verantwortlich (ID)", nil},
+	{"valid_from", "Gültig ab", []string{"Beginn", "Vertragsbeginn"}},
+	{"valid_until", "Gültig bis", []string{"Ende", "Vertragsende"}},
+	{"notice_period", "Kündigungsfrist (Monate)", []string{"Kündigungsfrist"}},
+	{"minimum_term", "Mindestlaufzeit bis", []string{"Mindestlaufzeit"}},
+	{"term_months", "Laufzeit (Monate)", []string{"Laufzeit"}},
+	{"annual_cost", "Jährliche Kosten", []string{"Kosten", "Kosten p.a."}},
+	{"is_terminated", "Beendet", nil},
+	{"terminated_at", "Beendet am", nil},
+}
+
+// ImportOptions steuert Zuordnung und Verhalten eines Imports.
+type ImportOptions struct {
+	DryRun           bool
+	Mapping          map[string]string // Spaltenüberschrift -> Feld, "" = ignorieren
+	Delimiter        rune              // 0 = automatisch erkennen
+	CreateCategories bool
+	CreatePartners   bool
+	UserID           int
+}
+
+// ImportRow ist das Ergebnis einer Datenzeile.
+type ImportRow struct {
+	Row            int      `json:"row"` // Zeilennummer in der Datei
+	ContractNumber string   `json:"contract_number,omitempty"`
+	Title          string   `json:"title,omitempty"`
+	Errors         []string `json:"errors,omitempty"`
+	ContractID     int      `json:"contract_id,omitempty"` // nach dem Import
+
+	contract        Contract
+	frameworkNumber string
+}
+
+// ImportReport ist das Ergebnis eines Imports bzw. Probelaufs.
+type ImportReport struct {
+	DryRun          bool              `json:"dry_run"`
+	Mapping         map[string]string `json:"mapping"`  // erkannte Zuordnung
+	Unmapped        []string          `json:"unmapped"` // ignorierte Spalten
+	TotalRows       int               `json:"total_rows"`
+	ValidRows       int               `json:"valid_rows"`
+	InvalidRows     int               `json:"invalid_rows"`
+	Imported        int               `json:"imported"`
+	NewCategories   []string          `json:"new_categories"`
+	NewPartners     []string          `json:"new_partners"`
+	Rows            []ImportRow       `json:"rows"`
+	AvailableFields []importField     `json:"available_fields"`
+	Error           string            `json:"error,omitempty"` // Datei nicht verarbeitbar
+}
+
+// importLookups enthält die vorhandenen Stammdaten für die Prüfung.
+type importLookups struct {
+	categories map[string]string // klein geschrieben -> Schreibweise in der DB
+	partners   map[string]string
+	users      map[string]int // Benutzername klein geschrieben -> ID
+	userIDs    map[int]bool
+	contracts  map[string]existingContract // Vertragsnummer -> Vertrag
+	frameworks map[int]bool                // IDs der Rahmenverträge
+}
+
+type existingContract struct {
+	id          int
+	isFramework bool
+	deleted     bool // im Papierkorb; die Vertragsnummer bleibt belegt
+}
+
+// importFile importiert Verträge aus einer CSV- oder XLSX-Datei. Ohne dry_run=false
+// werden die Zeilen nur geprüft.
+func (h *contractHandlers) importFile(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize+1<<20)
+	if err := r.ParseMultipartForm(maxImportSize); err != nil {
+		http.Error(w, "Datei zu groß oder ungültige Anfrage", http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Keine Datei übermittelt", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts := ImportOptions{DryRun: true, UserID: mustAtoi(r.Header.Get("X-User-ID"))}
+	for _, opt := range []struct {
+		name   string
+		target *bool
+	}{{"dry_run", &opts.DryRun}, {"create_categories", &opts.CreateCategories}, {"create_partners", &opts.CreatePartners}} {
+		if v := r.FormValue(opt.name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("ungültiger Wert für %s: %s", opt.name, v), http.StatusBadRequest)
+				return
+			}
+			*opt.target = b
+		}
+	}
+	if m := r.FormValue("mapping"); m != "" {
+		if err := json.Unmarshal([]byte(m), &opts.Mapping); err != nil {
+			http.Error(w, "ungültige Zuordnung: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if opts.Delimiter, err = parseImportDelimiter(r.FormValue("delimiter")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	records, err := readImportFile(data, header.Filename, opts.Delimiter)
+	if err != nil {
+		http.Error(w, "Datei kann nicht gelesen werden: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := importContracts(h.repos.db, records, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if report.Imported > 0 {
+		publishChange(changeContractsChanged, map[string]interface{}{"reason": "import", "count": report.Imported})
+	}
+	if report.Error != "" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// parseImportDelimiter liest das Trennzeichen einer CSV-Datei; "" bedeutet automatisch erkennen.
+func parseImportDelimiter(d string) (rune, error) {
+	switch d {
+	case "":
+		return 0, nil
+	case ";", "semicolon":
+		return ';', nil
+	case ",", "comma":
+		return ',', nil
+	case "tab", "\t":
+		return '\t', nil
+	case "|", "pipe":
+		return '|', nil
+	}
+	return 0, fmt.Errorf("ungültiges Trennzeichen: %s", d)
+}
+
+// readImportFile liest eine XLSX-Datei oder eine CSV-Datei (UTF-8 oder Windows-1252).
+func readImportFile(data []byte, filename string, delimiter rune) ([][]string, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) || ext == ".xlsx" {
+		return readXLSX(data)
+	}
+
+	text := decodePlainText(data)
+	if delimiter == 0 {
+		delimiter = detectDelimiter(text)
+	}
+	cr := csv.NewReader(strings.NewReader(text))
+	cr.Comma = delimiter
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	return cr.ReadAll()
+}
+
+// detectDelimiter wählt das häufigste Trennzeichen der Kopfzeile.
+func detectDelimiter(text string) rune {
+	line, _, _ := strings.Cut(text, "\n")
+	best, count := ';', 0
+	for _, d := range []rune{';', ',', '\t', '|'} {
+		if n := strings.Count(line, string(d)); n > count {
+			best, count = d, n
+		}
+	}
+	return best
+}
+
+// importContracts prüft alle Zeilen und legt die gültigen in einer Transaktion an.
+func importContracts(db *DB, records [][]string, opts ImportOptions) (*ImportReport, error) {
+	report := &ImportReport{
+		DryRun:          opts.DryRun,
+		Mapping:         map[string]string{},
+		Unmapped:        []string{},
+		NewCategories:   []string{},
+		NewPartners:     []string{},
+		Rows:            []ImportRow{},
+		AvailableFields: importFields,
+	}
+
+	// Kopfzeile ist die erste nicht leere Zeile
+	headerIdx := 0
+	for headerIdx < len(records) && isEmptyRecord(records[headerIdx]) {
+		headerIdx++
+	}
+	if headerIdx == len(records) {
+		report.Error = "Die Datei enthält keine Kopfzeile"
+		return report, nil
+	}
+
+	columns, err := mapImportColumns(records[headerIdx], opts.Mapping, report)
+	if err != nil {
+		report.Error = err.Error()
+		return report, nil
+	}
+
+	lookups, err := loadImportLookups(db)
+	if err != nil {
+		return nil, err
+	}
+
+	newCategories := map[string]string{}
+	newPartners := map[string]string{}
+	seen := map[string]int{} // Vertragsnummer -> Zeile in der Datei
+
+	for i := headerIdx + 1; i < len(records); i++ {
+		if isEmptyRecord(records[i]) {
+			continue
+		}
+		row := parseImportRow(records[i], columns, i+1, opts, lookups)
+
+		if row.ContractNumber != "" {
+			if first, ok := seen[row.ContractNumber]; ok {
+				row.Errors = append(row.Errors, fmt.Sprintf("Vertragsnummer %s ist bereits in Zeile %d enthalten", row.ContractNumber, first))
+			} else {
+				seen[row.ContractNumber] = row.Row
+			}
+		}
+
+		c := &row.contract
+		if c.Category != "" {
+			if name, ok := lookups.categories[strings.ToLower(c.Category)]; ok {
+				c.Category = name
+			} else if name, ok := newCategories[strings.ToLower(c.Category)]; ok {
+				c.Category = name
+			} else if opts.CreateCategories {
+				newCategories[strings.ToLower(c.Category)] = c.Category
+			} else {
+				row.Errors = append(row.Errors, fmt.Sprintf("Kategorie %q existiert nicht", c.Category))
+			}
+		}
+		if c.Partner != "" {
+			if name, ok := lookups.partners[strings.ToLower(c.Partner)]; ok {
+				c.Partner = name
+			} else if name, ok := newPartners[strings.ToLower(c.Partner)]; ok {
+				c.Partner = name
+			} else if opts.CreatePartners {
+				newPartners[strings.ToLower(c.Partner)] = c.Partner
+			} else {
+				row.Errors = append(row.Errors, fmt.Sprintf("Partner %q ist unbekannt", c.Partner))
+			}
+		}
+
+		report.Rows = append(report.Rows, row)
+	}
+
+	// Verweise auf Rahmenverträge innerhalb der Datei erst prüfen, wenn alle Zeilen gelesen sind
+	inFile := map[string]*ImportRow{}
+	for i := range report.Rows {
+		if n := report.Rows[i].ContractNumber; n != "" && seen[n] == report.Rows[i].Row {
+			inFile[n] = &report.Rows[i]
+		}
+	}
+	for i := range report.Rows {
+		row := &report.Rows[i]
+		if row.frameworkNumber == "" {
+			continue
+		}
+		if existing, ok := lookups.contracts[row.frameworkNumber]; ok {
+			if existing.deleted {
+				row.Errors = append(row.Errors, fmt.Sprintf("Rahmenvertrag %s liegt im Papierkorb", row.frameworkNumber))
+			} else if !existing.isFramework {
+				row.Errors = append(row.Errors, fmt.Sprintf("Vertrag %s ist kein Rahmenvertrag", row.frameworkNumber))
+			} else {
+				id := existing.id
+				row.contract.FrameworkContractID = &id
+			}
+			continue
+		}
+		target, ok := inFile[row.frameworkNumber]
+		switch {
+		case !ok:
+			row.Errors = append(row.Errors, fmt.Sprintf("Rahmenvertrag %s nicht gefunden", row.frameworkNumber))
+		case target.contract.ContractType != "framework":
+			row.Errors = append(row.Errors, fmt.Sprintf("Vertrag %s ist kein Rahmenvertrag", row.frameworkNumber))
+		case len(target.Errors) > 0:
+			row.Errors = append(row.Errors, fmt.Sprintf("Rahmenvertrag %s ist fehlerhaft (Zeile %d)", row.frameworkNumber, target.Row))
+		}
+	}
+
+	report.TotalRows = len(report.Rows)
+	for _, row := range report.Rows {
+		if len(row.Errors) > 0 {
+			report.InvalidRows++
+		} else {
+			report.ValidRows++
+		}
+	}
+	// Nur Kategorien und Partner melden, die von gültigen Zeilen verwendet werden
+	usedCategories, usedPartners := map[string]bool{}, map[string]bool{}
+	for _, row := range report.Rows {
+		if len(row.Errors) == 0 {
+			usedCategories[row.contract.Category] = true
+			usedPartners[row.contract.Partner] = true
+		}
+	}
+	for _, name := range newCategories {
+		if usedCategories[name] {
+			report.NewCategories = append(report.NewCategories, name)
+		}
+	}
+	for _, name := range newPartners {
+		if usedPartners[name] {
+			report.NewPartners = append(report.NewPartners, name)
+		}
+	}
+	sort.Strings(report.NewCategories)
+	sort.Strings(report.NewPartners)
+
+	if opts.DryRun || report.ValidRows == 0 {
+		return report, nil
+	}
+	if err := commitImport(db, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// mapImportColumns ordnet jeder Spalte ein Feld zu (Index -> Feldname).
+func mapImportColumns(header []string, mapping map[string]string, report *ImportReport) (map[int]string, error) {
+	known := map[string]string{}
+	for _, f := range importFields {
+		known[strings.ToLower(f.Key)] = f.Key
+		known[strings.ToLower(f.Label)] = f.Key
+		for _, a := range f.Aliases {
+			known[strings.ToLower(a)] = f.Key
+		}
+	}
+
+	columns := map[int]string{}
+	used := map[string]string{}
+	for i, h := range header {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		field, explicit := mapping[h]
+		if explicit && field != "" {
+			if _, ok := known[strings.ToLower(field)]; !ok {
+				return nil, fmt.Errorf("unbekanntes Zielfeld %q für Spalte %q", field, h)
+			}
+			field = known[strings.ToLower(field)]
+		} else if !explicit {
+			field = known[strings.ToLower(h)]
+		}
+		if field == "" {
+			report.Unmapped = append(report.Unmapped, h)
+			continue
+		}
+		if other, ok := used[field]; ok {
+			return nil, fmt.Errorf("Feld %s ist den Spalten %q und %q zugeordnet", field, other, h)
+		}
+		used[field] = h
+		columns[i] = field
+		report.Mapping[h] = field
+	}
+	for h := range mapping {
+		found := false
+		for _, col := range header {
+			if strings.TrimSpace(col) == h {
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Spalte %q aus der Zuordnung ist in der Datei nicht vorhanden", h)
+		}
+	}
+
+	for _, required := range []string{"title", "partner", "category", "valid_from"} {
+		if _, ok := used[required]; !ok {
+			return nil, fmt.Errorf("Pflichtfeld %s ist keiner Spalte zugeordnet", required)
+		}
+	}
+	return columns, nil
+}
+
+func loadImportLookups(db *DB) (*importLookups, error) {
+	l := &importLookups{
+		categories: map[string]string{},
+		partners:   map[string]string{},
+		users:      map[string]int{},
+		userIDs:    map[int]bool{},
+		contracts:  map[string]existingContract{},
+		frameworks: map[int]bool{},
+	}
+
+	queries := []struct {
+		query string
+		scan  func(rows *sql.Rows) error
+	}{
+		{"SELECT name FROM categories WHERE deleted_at IS NULL", func(rows *sql.Rows) error {
+			var name string
+			err := rows.Scan(&name)
+			l.categories[strings.ToLower(name)] = name
+			return err
+		}},
+		{"SELECT DISTINCT partner FROM contracts", func(rows *sql.Rows) error {
+			var name string
+			err := rows.Scan(&name)
+			l.partners[strings.ToLower(name)] = name
+			return err
+		}},
+		{"SELECT id, username FROM users", func(rows *sql.Rows) error {
+			var id int
+			var name string
+			err := rows.Scan(&id, &name)
+			l.users[strings.ToLower(name)] = id
+			l.userIDs[id] = true
+			return err
+		}},
+		{"SELECT id, contract_number, contract_type, deleted_at IS NOT NULL FROM contracts", func(rows *sql.Rows) error {
+			var id int
+			var number, contractType string
+			var deleted bool
+			err := rows.Scan(&id, &number, &contractType, &deleted)
+			l.contracts[number] = existingContract{id: id, isFramework: contractType == "framework", deleted: deleted}
+			if contractType == "framework" && !deleted {
+				l.frameworks[id] = true
+			}
+			return err
+		}},
+	}
+	for _, q := range queries {
+		rows, err := db.Query(q.query)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			if err := q.scan(rows); err != nil {
+				rows.Close()
+				return nil, err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// parseImportRow wandelt eine Datenzeile in einen Vertrag um und sammelt alle Fehler.
+func parseImportRow(record []string, columns map[int]string, line int, opts ImportOptions, l *importLookups) ImportRow {
+	row := ImportRow{Row: line}
+	c := &row.contract
+	c.ContractType = "individual"
+	values := map[string]string{}
+	for i, field := range columns {
+		if i < len(record) {
+			values[field] = strings.TrimSpace(record[i])
+		}
+	}
+	fail := func(format string, args ...interface{}) {
+		row.Errors = append(row.Errors, fmt.Sprintf(format, args...))
+	}
+
+	c.ContractNumber = values["contract_number"]
+	c.Title = values["title"]
+	c.Content = values["content"]
+	c.Conditions = values["conditions"]
+	c.Partner = values["partner"]
+	c.Category = values["category"]
+	row.ContractNumber = c.ContractNumber
+	row.Title = c.Title
+
+	if c.Title == "" {
+		fail("Titel fehlt")
+	}
+	if c.Partner == "" {
+		fail("Partner fehlt")
+	}
+	if c.Category == "" {
+		fail("Kategorie fehlt")
+	}
+	if c.ContractNumber != "" {
+		if _, ok := l.contracts[c.ContractNumber]; ok {
+			fail("Vertragsnummer %s existiert bereits", c.ContractNumber)
+		}
+	}
+
+	if v := values["contract_type"]; v != "" {
+		switch strings.ToLower(v) {
+		case "framework", "rahmenvertrag":
+			c.ContractType = "framework"
+		case "individual", "einzelvertrag":
+			c.ContractType = "individual"
+		default:
+			fail("ungültige Vertragsart %q (erlaubt: Rahmenvertrag, Einzelvertrag)", v)
+		}
+	}
+
+	date := func(field, label string, required bool) *time.Time {
+		v := values[field]
+		if v == "" {
+			if required {
+				fail("%s fehlt", label)
+			}
+			return nil
+		}
+		t, err := parseImportDate(v)
+		if err != nil {
+			fail("%s: ungültiges Datum %q", label, v)
+			return nil
+		}
+		return &t
+	}
+	if t := date("valid_from", "Gültig ab", true); t != nil {
+		c.ValidFrom = *t
+	}
+	c.ValidUntil = date("valid_until", "Gültig bis", false)
+	c.MinimumTerm = date("minimum_term", "Mindestlaufzeit bis", false)
+	c.TerminatedAt = date("terminated_at", "Beendet am", false)
+	if c.ValidUntil != nil && !c.ValidFrom.IsZero() && c.ValidUntil.Before(c.ValidFrom) {
+		fail("Gültig bis liegt vor Gültig ab")
+	}
+
+	integer := func(field, label string, min int) *int {
+		v := values[field]
+		if v == "" {
+			return nil
+		}
+		f, err := parseImportNumber(v)
+		if err != nil || f != math.Trunc(f) || f < float64(min) {
+			fail("%s: ungültige Zahl %q", label, v)
+			return nil
+		}
+		n := int(f)
+		return &n
+	}
+	c.NoticePeriod = integer("notice_period", "Kündigungsfrist", 0)
+	c.TermMonths = integer("term_months", "Laufzeit", 1)
+
+	if v := values["annual_cost"]; v != "" {
+		f, err := parseImportNumber(v)
+		if err != nil || f < 0 {
+			fail("Jährliche Kosten: ungültiger Betrag %q", v)
+		} else {
+			c.AnnualCost = &f
+		}
+	}
+
+	if v := values["is_terminated"]; v != "" {
+		b, ok := parseImportBool(v)
+		if !ok {
+			fail("Beendet: ungültiger Wert %q", v)
+		}
+		c.IsTerminated = b
+	}
+	if c.TerminatedAt != nil {
+		c.IsTerminated = true
+	}
+
+	if v := values["owner"]; v != "" {
+		if id, ok := l.users[strings.ToLower(v)]; ok {
+			c.OwnerID = &id
+		} else {
+			fail("Benutzer %q existiert nicht", v)
+		}
+	}
+	if v := values["owner_id"]; v != "" && c.OwnerID == nil {
+		id, err := strconv.Atoi(v)
+		if err != nil || !l.userIDs[id] {
+			fail("Benutzer mit ID %s existiert nicht", v)
+		} else {
+			c.OwnerID = &id
+		}
+	}
+	if c.OwnerID == nil && opts.UserID != 0 {
+		c.OwnerID = &opts.UserID
+	}
+
+	if v := values["framework_contract_id"]; v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || !l.frameworks[id] {
+			fail("Rahmenvertrag mit ID %s nicht gefunden", v)
+		} else {
+			c.FrameworkContractID = &id
+		}
+	}
+	row.frameworkNumber = values["framework_contract_number"]
+	if (c.FrameworkContractID != nil || row.frameworkNumber != "") && c.ContractType == "framework" {
+		fail("Ein Rahmenvertrag kann keinem anderen Rahmenvertrag zugeordnet werden")
+	}
+
+	return row
+}
+
+// commitImport legt Kategorien und alle gültigen Verträge in einer Transaktion an.
+// Rahmenverträge werden zuerst angelegt, damit Einzelverträge der Datei auf sie verweisen können.
+func commitImport(db *DB, report *ImportReport) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, name := range report.NewCategories {
+		if _, err := tx.Exec("INSERT INTO categories (name) VALUES (?)", name); err != nil {
+			return fmt.Errorf("Kategorie %s: %w", name, err)
+		}
+	}
+
+	// Fortlaufende Nummern für Zeilen ohne Vertragsnummer, ohne Nummern der Datei zu belegen
+	var maxNumber int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(" + tx.Dialect.LeadingInteger("SUBSTR(contract_number, 2)") + "), 0) FROM contracts WHERE contract_number LIKE 'V%'").Scan(&maxNumber); err != nil {
+		return err
+	}
+	taken := map[string]bool{}
+	for _, row := range report.Rows {
+		taken[row.ContractNumber] = true
+	}
+	nextNumber := func() string {
+		for {
+			maxNumber++
+			if n := fmt.Sprintf("V%06d", maxNumber); !taken[n] {
+				return n
+			}
+		}
+	}
+
+	ids := map[string]int{}
+	for _, framework := range []bool{true, false} {
+		for i := range report.Rows {
+			row := &report.Rows[i]
+			c := &row.contract
+			if len(row.Errors) > 0 || (c.ContractType == "framework") != framework {
+				continue
+			}
+			if c.ContractNumber == "" {
+				c.ContractNumber = nextNumber()
+				row.ContractNumber = c.ContractNumber
+			}
+			if row.frameworkNumber != "" && c.FrameworkContractID == nil {
+				id := ids[row.frameworkNumber]
+				c.FrameworkContractID = &id
+			}
+
+			var terminatedAt interface{}
+			if c.TerminatedAt != nil {
+				terminatedAt = *c.TerminatedAt
+			}
+			id, err := tx.Insert(`INSERT INTO contracts
+				(contract_number, title, content, conditions, notice_period, minimum_term,
+				term_months, valid_from, valid_until, partner, category, contract_type, framework_contract_id,
+				is_terminated, terminated_at, owner_id, annual_cost)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				c.ContractNumber, c.Title, c.Content, c.Conditions, c.NoticePeriod, c.MinimumTerm,
+				c.TermMonths, c.ValidFrom, c.ValidUntil, c.Partner, c.Category, c.ContractType, c.FrameworkContractID,
+				c.IsTerminated, terminatedAt, *c.OwnerID, c.AnnualCost)
+			if err != nil {
+				return fmt.Errorf("Zeile %d: %w", row.Row, err)
+			}
+			row.ContractID = int(id)
+			ids[c.ContractNumber] = int(id)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	report.Imported = report.ValidRows
+	return nil
+}
+
+func isEmptyRecord(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// parseImportDate akzeptiert TT.MM.JJJJ (optional mit Uhrzeit), JJJJ-MM-TT,
+// RFC 3339 sowie Excel-Seriennummern.
+func parseImportDate(s string) (time.Time, error) {
+	for _, layout := range []string{"2.1.2006", "2.1.06", "2006-01-02", "2.1.2006 15:04", "2.1.2006 15:04:05", time.RFC3339} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && f >= 1 && f < 2958466 {
+		return xlsxDate(f), nil
+	}
+	return time.Time{}, fmt.Errorf("ungültiges Datum: %s", s)
+}
+
+// parseImportNumber akzeptiert deutsche (1.234,50) und englische (1234.50) Schreibweise.
+func parseImportNumber(s string) (float64, error) {
+	s = strings.NewReplacer("€", "", " ", "", " ", "", "EUR", "").Replace(s)
+	if strings.Contains(s, ",") {
+		s = strings.ReplaceAll(s, ".", "")
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func parseImportBool(s string) (bool, bool) {
+	switch strings.ToLower(s) {
+	case "ja", "j", "x", "true", "wahr", "1", "yes":
+		return true, true
+	case "nein", "n", "false", "falsch", "0", "no":
+		return false, true
+	}
+	return false, false
+}
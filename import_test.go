@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestImportContracts(t *testing.T) {
+	s := newTestServer(t)
+	s.createContract(map[string]interface{}{"contract_number": "V-1", "partner": "ACME"})
+
+	csv := "Vertragsnummer;Titel;Partner;Kategorie;Vertragsart;Gültig ab;Kündigungsfrist;Laufzeit;Kosten\n" +
+		"R-1;Rahmen Telefonie;Telekom;IT;Rahmenvertrag;01.01.2024;3;12;1.200,50\n" +
+		"E-1;Mobilfunk;Telekom;Telefonie;Einzelvertrag;2024-02-01;1;1;\n" +
+		"V-1;Doppelt;ACME;IT;;01.01.2024;;;\n" +
+		";;ACME;IT;;31.02.2024;-1;0;teuer\n"
+	form := func(fields map[string]string) multipartBody {
+		return uploadFormField(t, "file", "vertraege.csv", []byte(csv), fields)
+	}
+
+	var report ImportReport
+	s.expect("POST", "/contracts/import", s.admin, form(nil), http.StatusOK, &report)
+	if !report.DryRun || report.TotalRows != 4 || report.ValidRows != 0 || report.Imported != 0 {
+		t.Errorf("Probelauf: %+v", report)
+	}
+	for _, row := range report.Rows {
+		if len(row.Errors) == 0 {
+			t.Errorf("Zeile %d ohne Fehler", row.Row)
+		}
+	}
+	if errs := strings.Join(report.Rows[3].Errors, "; "); !strings.Contains(errs, "Titel fehlt") || !strings.Contains(errs, "ungültiges Datum") ||
+		!strings.Contains(errs, "Kündigungsfrist") || !strings.Contains(errs, "Jährliche Kosten") {
+		t.Errorf("Fehler der letzten Zeile: %s", errs)
+	}
+
+	fields := map[string]string{"create_categories": "true", "create_partners": "true"}
+	s.expect("POST", "/contracts/import", s.admin, form(fields), http.StatusOK, &report)
+	if report.ValidRows != 2 || strings.Join(report.NewCategories, ",") != "Telefonie" || strings.Join(report.NewPartners, ",") != "Telekom" {
+		t.Errorf("Probelauf mit neuen Stammdaten: %+v", report)
+	}
+	var contracts []Contract
+	s.expect("GET", "/contracts", s.admin, nil, http.StatusOK, &contracts)
+	if len(contracts) != 1 {
+		t.Fatalf("Probelauf hat %d Verträge angelegt", len(contracts)-1)
+	}
+
+	fields["dry_run"] = "false"
+	s.expect("POST", "/contracts/import", s.admin, form(fields), http.StatusOK, &report)
+	if report.Imported != 2 {
+		t.Fatalf("Import: %+v", report)
+	}
+	s.expect("GET", "/contracts?search=Mobilfunk", s.admin, nil, http.StatusOK, &contracts)
+	if len(contracts) != 1 || contracts[0].FrameworkContractID != nil || contracts[0].Category != "Telefonie" || *contracts[0].TermMonths != 1 {
+		t.Errorf("importiert: %+v", contracts)
+	}
+
+	for name, f := range map[string]map[string]string{
+		"ungültiger Probelauf":    {"dry_run": "vielleicht"},
+		"ungültige Zuordnung":     {"mapping": "{"},
+		"ungültiges Trennzeichen": {"delimiter": "#"},
+	} {
+		resp := s.do("POST", "/contracts/import", s.admin, form(f))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: Status %d statt 400", name, resp.StatusCode)
+		}
+	}
+	s.expect("POST", "/contracts/import", s.admin, uploadFormField(t, "file", "leer.csv", []byte("\n\n"), nil), http.StatusUnprocessableEntity, nil)
+}
+
+// TestExportCSVFormulas stellt sicher, dass Texte, die eine Tabellenkalkulation als
+// Formel ausführen würde, im CSV-Export als Text bleiben.
+func TestExportCSVFormulas(t *testing.T) {
+	s := newTestServer(t)
+	for _, title := range []string{"=HYPERLINK(\"http://example.com\")", "+49 30 1234", "-Rabatt", "@SUMME(A1)", "\tEingerückt", "Wartung = Pflege"} {
+		s.createContract(map[string]interface{}{"title": title, "partner": "@ACME", "annual_cost": 1200})
+	}
+
+	resp := s.do("GET", "/contracts?format=csv&bom=false&fields=title,partner,annual_cost&sort=id", s.admin, nil)
+	r := csv.NewReader(resp.Body)
+	r.Comma = ';'
+	records, err := r.ReadAll()
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"'=HYPERLINK(\"http://example.com\")", "'+49 30 1234", "'-Rabatt", "'@SUMME(A1)", "'\tEingerückt", "Wartung = Pflege"}
+	if len(records) != len(want)+1 {
+		t.Fatalf("%d Zeilen: %q", len(records), records)
+	}
+	for i, row := range records[1:] {
+		if row[0] != want[i] || row[1] != "'@ACME" || row[2] != "1200,00" {
+			t.Errorf("Zeile %d: %q, erwartet Titel %q", i+1, row, want[i])
+		}
+	}
+}
+
+// TestExportImportRoundTrip stellt sicher, dass ein Export ohne Zuordnung wieder
+// importiert werden kann.
+func TestExportImportRoundTrip(t *testing.T) {
+	s := newTestServer(t)
+	s.createContract(map[string]interface{}{"title": "Wartung Server", "valid_from": "2024-01-31T00:00:00Z",
+		"notice_period": 3, "term_months": 12, "annual_cost": 1234.5})
+
+	resp := s.do("GET", "/contracts?format=csv", s.admin, nil)
+	exported, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/csv") {
+		t.Fatalf("Export: Status %d, %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	for _, format := range []string{"xlsx", "pdf", "html"} {
+		s.expect("GET", "/contracts?format="+format, s.admin, nil, http.StatusOK, nil)
+	}
+	s.expect("GET", "/contracts?format=doc", s.admin, nil, http.StatusBadRequest, nil)
+
+	// Ohne Vertragsnummer, sonst wäre sie doppelt
+	mapping, _ := json.Marshal(map[string]string{"Vertragsnummer": ""})
+	var report ImportReport
+	s.expect("POST", "/contracts/import", s.admin, uploadFormField(t, "file", "export.csv", exported,
+		map[string]string{"mapping": string(mapping), "dry_run": "false"}), http.StatusOK, &report)
+	if report.Imported != 1 {
+		t.Fatalf("Import des Exports: %+v", report)
+	}
+	var contracts []Contract
+	s.expect("GET", "/contracts?sort=id", s.admin, nil, http.StatusOK, &contracts)
+	if len(contracts) != 2 {
+		t.Fatalf("%d Verträge", len(contracts))
+	}
+	a, b := contracts[0], contracts[1]
+	if a.Title != b.Title || !a.ValidFrom.Equal(b.ValidFrom) || *a.NoticePeriod != *b.NoticePeriod ||
+		*a.TermMonths != *b.TermMonths || *a.AnnualCost != *b.AnnualCost {
+		t.Errorf("Original %+v, importiert %+v", a, b)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// contractColumns enthält alle Spalten der contracts-Tabelle in der Reihenfolge,
+// in der scanContracts sie erwartet.
+var contractColumns = []string{
+	"id", "contract_number", "title", "content", "conditions", "notice_period",
+	"minimum_term", "term_months", "cancellation_date", "cancellation_action_date",
+	"valid_from", "valid_until", "partner", "category", "contract_type",
+	"framework_contract_id", "is_terminated", "terminated_at", "created_at", "owner_id",
+	"annual_cost", "legal_hold", "legal_hold_reason",
+}
+
+// largeContractColumns werden nur gelesen, wenn sie über fields angefordert werden.
+var largeContractColumns = map[string]bool{
+	"content":    true,
+	"conditions": true,
+}
+
+// contractSortColumns sind die Spalten, nach denen Vertragslisten sortiert werden dürfen.
+var contractSortColumns = map[string]bool{
+	"id": true, "contract_number": true, "title": true, "partner": true,
+	"category": true, "contract_type": true, "notice_period": true,
+	"minimum_term": true, "term_months": true, "cancellation_date": true,
+	"cancellation_action_date": true, "valid_from": true, "valid_until": true,
+	"is_terminated": true, "terminated_at": true, "created_at": true, "owner_id": true,
+	"annual_cost": true, "legal_hold": true,
+}
+
+// listOptions beschreibt Paginierung, Sortierung und Feldauswahl einer Liste.
+type listOptions struct {
+	Limit  int
+	Offset int
+	Sort   []string        // fertige ORDER-BY-Ausdrücke
+	Fields map[string]bool // nil = alle Felder
+	// WithDeleted schließt Verträge im Papierkorb ein, die sonst in keiner Liste erscheinen
+	WithDeleted bool
+}
+
+// parseListOptions liest limit, offset, sort und fields aus der Query.
+// sort ist eine kommagetrennte Spaltenliste, ein vorangestelltes "-" sortiert absteigend.
+// Ohne limit wird die komplette Liste geliefert.
+func parseListOptions(q url.Values, defaultSort string) (listOptions, error) {
+	opts := listOptions{Limit: -1}
+
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			return opts, fmt.Errorf("ungültiger Wert für limit: %s", l)
+		}
+		if n > maxListLimit {
+			n = maxListLimit
+		}
+		opts.Limit = n
+	}
+	if o := q.Get("offset"); o != "" {
+		n, err := strconv.Atoi(o)
+		if err != nil || n < 0 {
+			return opts, fmt.Errorf("ungültiger Wert für offset: %s", o)
+		}
+		opts.Offset = n
+		if opts.Limit < 0 {
+			opts.Limit = defaultListLimit
+		}
+	}
+
+	sort := q.Get("sort")
+	if sort == "" {
+		sort = defaultSort
+	}
+	for _, key := range strings.Split(sort, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		dir := "ASC"
+		if strings.HasPrefix(key, "-") {
+			dir = "DESC"
+			key = key[1:]
+		}
+		if !contractSortColumns[key] {
+			return opts, fmt.Errorf("Sortierung nach %s nicht möglich", key)
+		}
+		// NULL-Werte unabhängig von der Richtung ans Ende sortieren
+		opts.Sort = append(opts.Sort, fmt.Sprintf("(%s IS NULL), %s %s", key, key, dir))
+	}
+	// Eindeutige Reihenfolge für stabile Seiten
+	opts.Sort = append(opts.Sort, "id ASC")
+
+	if f := q.Get("fields"); f != "" {
+		opts.Fields = map[string]bool{}
+		for _, name := range strings.Split(f, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if !isContractField(name) {
+				return opts, fmt.Errorf("unbekanntes Feld: %s", name)
+			}
+			opts.Fields[name] = true
+		}
+	}
+
+	return opts, nil
+}
+
+func isContractField(name string) bool {
+	for _, col := range contractColumns {
+		if col == name {
+			return true
+		}
+	}
+	return false
+}
+
+// selectList erzeugt die Spaltenliste für scanContracts. Nicht angeforderte
+// große Textspalten werden durch einen Leerstring ersetzt.
+func (o listOptions) selectList() string {
+	cols := make([]string, len(contractColumns))
+	for i, col := range contractColumns {
+		if largeContractColumns[col] && o.Fields != nil && !o.Fields[col] {
+			cols[i] = "'' AS " + col
+		} else {
+			cols[i] = col
+		}
+	}
+	return strings.Join(cols, ", ")
+}
+
+// listContracts führt eine Vertragsabfrage mit der übergebenen WHERE-Bedingung aus
+// und schreibt das Ergebnis inklusive X-Total-Count-Header als JSON-Array.
+// Mit format=csv, xlsx, pdf oder html wird die Liste stattdessen als Datei exportiert,
+// title dient dabei als Dateiname und Blattname.
+func listContracts(w http.ResponseWriter, r *http.Request, repos *Repositories, q url.Values, title, where string, args []interface{}, defaultSort string) {
+	if format := q.Get("format"); format != "" && format != "json" {
+		exportContracts(w, repos.db, q, title, where, args, defaultSort)
+		return
+	}
+
+	opts, err := parseListOptions(q, defaultSort)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	contracts, total, err := repos.Contracts.List(r.Context(), where, args, opts)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if opts.Fields == nil {
+		json.NewEncoder(w).Encode(contracts)
+		return
+	}
+	json.NewEncoder(w).Encode(projectContracts(contracts, opts.Fields))
+}
+
+// projectContracts reduziert die Verträge auf die angeforderten JSON-Felder.
+func projectContracts(contracts []Contract, fields map[string]bool) []map[string]json.RawMessage {
+	result := make([]map[string]json.RawMessage, 0, len(contracts))
+	for _, c := range contracts {
+		data, err := json.Marshal(c)
+		if err != nil {
+			continue
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(data, &all); err != nil {
+			continue
+		}
+		item := make(map[string]json.RawMessage, len(fields))
+		for name := range fields {
+			item[name] = all[name]
+		}
+		result = append(result, item)
+	}
+	return result
+}
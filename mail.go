@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// mailConfig enthält den SMTP-Zugang für den Berichtsversand. Er wird über die
+// Umgebungsvariablen VERTRAGSDB_SMTP_HOST, VERTRAGSDB_SMTP_PORT (Standard 25),
+// VERTRAGSDB_SMTP_USER, VERTRAGSDB_SMTP_PASSWORD und VERTRAGSDB_SMTP_FROM gesetzt.
+type mailConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func loadMailConfig() mailConfig {
+	cfg := mailConfig{
+		Host:     os.Getenv("VERTRAGSDB_SMTP_HOST"),
+		Port:     os.Getenv("VERTRAGSDB_SMTP_PORT"),
+		Username: os.Getenv("VERTRAGSDB_SMTP_USER"),
+		Password: os.Getenv("VERTRAGSDB_SMTP_PASSWORD"),
+		From:     os.Getenv("VERTRAGSDB_SMTP_FROM"),
+	}
+	if cfg.Port == "" {
+		cfg.Port = "25"
+	}
+	if cfg.From == "" {
+		cfg.From = "vertragsdb@localhost"
+	}
+	return cfg
+}
+
+// mailTimeout begrenzt eine SMTP-Sitzung, damit ein hängender Server den Versand nicht blockiert.
+const mailTimeout = 2 * time.Minute
+
+type mailAttachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// mailMessage ist eine E-Mail mit Text- oder HTML-Inhalt und optionalen Anhängen.
+type mailMessage struct {
+	To          []string
+	Subject     string
+	Text        string // wird verwendet, wenn HTML leer ist
+	HTML        string
+	Attachments []mailAttachment
+}
+
+// validateMailAddress prüft eine einzelne Empfängeradresse.
+func validateMailAddress(addr string) error {
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil || parsed.Address != addr {
+		return fmt.Errorf("ungültige E-Mail-Adresse: %s", addr)
+	}
+	return nil
+}
+
+// bytes erzeugt die MIME-Nachricht (multipart/mixed).
+func (m mailMessage) bytes(from string, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	id := make([]byte, 12)
+	rand.Read(id)
+	domain := "localhost"
+	if _, d, ok := strings.Cut(from, "@"); ok {
+		domain = d
+	}
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+
+	contentType, content := "text/plain; charset=utf-8", m.Text
+	if m.HTML != "" {
+		contentType, content = "text/html; charset=utf-8", m.HTML
+	}
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write([]byte(content)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+
+	for _, a := range m.Attachments {
+		mediaType, params, err := mime.ParseMediaType(a.ContentType)
+		if err != nil {
+			mediaType, params = "application/octet-stream", map[string]string{}
+		}
+		params["name"] = a.Filename
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(mediaType, params)},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(a.Data)
+		for len(encoded) > 76 {
+			part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		part.Write([]byte(encoded + "\r\n"))
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sendMail versendet die Nachricht über den konfigurierten SMTP-Server. STARTTLS
+// wird verwendet, sofern der Server es anbietet.
+func sendMail(cfg mailConfig, m mailMessage) error {
+	if cfg.Host == "" {
+		return errors.New("kein SMTP-Server konfiguriert (VERTRAGSDB_SMTP_HOST)")
+	}
+	msg, err := m.bytes(cfg.From, time.Now())
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(cfg.Host, cfg.Port), 30*time.Second)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(mailTimeout))
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: cfg.Host}); err != nil {
+			return err
+		}
+	}
+	if cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(cfg.From); err != nil {
+		return err
+	}
+	for _, to := range m.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("Empfänger %s: %w", to, err)
+		}
+	}
+	wc, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := wc.Write(msg); err != nil {
+		return err
+	}
+	if err := wc.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
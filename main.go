@@ -1,24 +1,24 @@
 package main
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
-	_ "modernc.org/sqlite"
 )
 
-var db *sql.DB
+// databaseFile ist die SQLite-Datenbank im Arbeitsverzeichnis.
+const databaseFile = "contracts.db"
+
 var jwtSecret = []byte("your-secret-key-change-in-production")
 
 type User struct {
@@ -48,14 +48,30 @@ type Contract struct {
 	IsTerminated           bool       `json:"is_terminated"`
 	TerminatedAt           *time.Time `json:"terminated_at"`
 	CreatedAt              time.Time  `json:"created_at"`
+	OwnerID                *int       `json:"owner_id"`    // Verantwortlicher Benutzer
+	AnnualCost             *float64   `json:"annual_cost"` // Jährliche Kosten in Euro
+	LegalHold              bool       `json:"legal_hold"`  // Löschsperre, z. B. wegen eines Rechtsstreits
+	LegalHoldReason        *string    `json:"legal_hold_reason"`
 }
 
 type Document struct {
-	ID         int       `json:"id"`
-	ContractID int       `json:"contract_id"`
-	Filename   string    `json:"filename"`
-	FilePath   string    `json:"file_path"`
-	UploadedAt time.Time `json:"uploaded_at"`
+	ID               int        `json:"id"`
+	ContractID       int        `json:"contract_id"`
+	Filename         string     `json:"filename"`
+	StorageKey       string     `json:"-"`
+	UploadedAt       time.Time  `json:"uploaded_at"`
+	ExtractionStatus string     `json:"extraction_status"` // pending, running, done, failed, unsupported
+	ExtractionError  *string    `json:"extraction_error"`
+	DocumentType     string     `json:"document_type"` // contract, amendment, invoice, correspondence, termination
+	Description      string     `json:"description"`
+	UploadedBy       *int       `json:"uploaded_by"`
+	UploadedByName   *string    `json:"uploaded_by_name"`
+	FileSize         *int64     `json:"file_size"` // in Byte
+	MimeType         *string    `json:"mime_type"`
+	SHA256           *string    `json:"sha256"`
+	Version          int        `json:"version"` // Nummer der aktuellen Version
+	DeletedAt        *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy        *int       `json:"deleted_by,omitempty"`
 }
 
 type Category struct {
@@ -70,213 +86,44 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
-func initDB() error {
-	var err error
-	db, err = sql.Open("sqlite", "./contracts.db")
-	if err != nil {
-		return err
-	}
-
-	schema := `
-	CREATE TABLE IF NOT EXISTS users (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		username TEXT UNIQUE NOT NULL,
-		password TEXT NOT NULL,
-		role TEXT NOT NULL CHECK(role IN ('admin', 'viewer'))
-	);
-
-	CREATE TABLE IF NOT EXISTS contracts (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		contract_number TEXT UNIQUE NOT NULL,
-		title TEXT NOT NULL,
-		content TEXT,
-		conditions TEXT,
-		notice_period INTEGER,
-		minimum_term DATE,
-		term_months INTEGER,
-		cancellation_date DATE,
-		cancellation_action_date DATE,
-		valid_from DATETIME NOT NULL,
-		valid_until DATETIME,
-		partner TEXT NOT NULL,
-		category TEXT NOT NULL,
-		contract_type TEXT NOT NULL CHECK(contract_type IN ('framework', 'individual')),
-		framework_contract_id INTEGER,
-		is_terminated BOOLEAN DEFAULT 0,
-		terminated_at DATETIME,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (framework_contract_id) REFERENCES contracts(id)
-	);
-
-	CREATE TABLE IF NOT EXISTS documents (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		contract_id INTEGER NOT NULL,
-		filename TEXT NOT NULL,
-		file_path TEXT NOT NULL,
-		uploaded_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (contract_id) REFERENCES contracts(id)
-	);
-
-	CREATE TABLE IF NOT EXISTS categories (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT UNIQUE NOT NULL
-	);
-	`
-
-	_, err = db.Exec(schema)
-	if err != nil {
-		return err
-	}
-
-	// Create default admin user (password: admin)
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("admin"), bcrypt.DefaultCost)
-	_, err = db.Exec("INSERT OR IGNORE INTO users (username, password, role) VALUES (?, ?, ?)",
-		"admin", string(hashedPassword), "admin")
-	if err != nil {
-		return err
-	}
-
-	return migrateDB()
+// openDB öffnet die Datenbank aus VERTRAGSDB_DATABASE, ohne das Schema anzulegen
+// oder zu migrieren.
+func openDB() (*DB, error) {
+	return openDatabase(os.Getenv("VERTRAGSDB_DATABASE"))
 }
 
-// migrateDB migriert das Schema falls nötig.
-// Schema-Version 2: notice_period als INTEGER (Monate), minimum_term als DATE
-func migrateDB() error {
-	var version int
-	db.QueryRow("PRAGMA user_version").Scan(&version)
-
-	if version >= 4 {
-		return nil
-	}
+// initDB öffnet die Datenbank und migriert sie auf die aktuelle Schema-Version.
+func initDB() (*DB, error) {
+	return initDBVersion(schemaVersion)
+}
 
-	// Prüfe ob notice_period noch TEXT ist (alter Stand)
-	rows, err := db.Query("PRAGMA table_info(contracts)")
+// initDBVersion öffnet die Datenbank und migriert sie bis einschließlich target.
+func initDBVersion(target int) (*DB, error) {
+	db, err := openDB()
 	if err != nil {
-		return err
-	}
-	needsMigration := false
-	for rows.Next() {
-		var cid int
-		var name, dataType string
-		var notNull int
-		var dfltValue interface{}
-		var pk int
-		rows.Scan(&cid, &name, &dataType, &notNull, &dfltValue, &pk)
-		if name == "notice_period" && dataType == "TEXT" {
-			needsMigration = true
-		}
+		return nil, err
 	}
-	rows.Close()
-
-	if needsMigration {
-		log.Println("Migriere contracts-Tabelle: notice_period TEXT→INTEGER, minimum_term TEXT→DATE")
-		_, err = db.Exec(`
-			CREATE TABLE contracts_v2 (
-				id INTEGER PRIMARY KEY AUTOINCREMENT,
-				contract_number TEXT UNIQUE NOT NULL,
-				title TEXT NOT NULL,
-				content TEXT,
-				conditions TEXT,
-				notice_period INTEGER,
-				minimum_term DATE,
-				valid_from DATETIME NOT NULL,
-				valid_until DATETIME,
-				partner TEXT NOT NULL,
-				category TEXT NOT NULL,
-				contract_type TEXT NOT NULL CHECK(contract_type IN ('framework', 'individual')),
-				framework_contract_id INTEGER,
-				is_terminated BOOLEAN DEFAULT 0,
-				terminated_at DATETIME,
-				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-				FOREIGN KEY (framework_contract_id) REFERENCES contracts_v2(id)
-			)`)
-		if err != nil {
-			return fmt.Errorf("migration create table: %w", err)
-		}
-
-		// Daten übertragen; notice_period: führende Zahl extrahieren (z.B. "3 Monate" → 3)
-		// minimum_term: kann nicht automatisch konvertiert werden → NULL
-		_, err = db.Exec(`
-			INSERT INTO contracts_v2
-				(id, contract_number, title, content, conditions,
-				 notice_period, minimum_term, valid_from, valid_until,
-				 partner, category, contract_type, framework_contract_id,
-				 is_terminated, terminated_at, created_at)
-			SELECT
-				id, contract_number, title, content, conditions,
-				NULLIF(CAST(notice_period AS INTEGER), 0),
-				NULL,
-				valid_from, valid_until,
-				partner, category, contract_type, framework_contract_id,
-				is_terminated, terminated_at, created_at
-			FROM contracts`)
-		if err != nil {
-			return fmt.Errorf("migration copy data: %w", err)
-		}
-
-		_, err = db.Exec("DROP TABLE contracts")
-		if err != nil {
-			return fmt.Errorf("migration drop old table: %w", err)
-		}
-
-		_, err = db.Exec("ALTER TABLE contracts_v2 RENAME TO contracts")
-		if err != nil {
-			return fmt.Errorf("migration rename table: %w", err)
-		}
-		log.Println("Migration erfolgreich abgeschlossen")
+	if err := setupDB(db, target); err != nil {
+		db.Close()
+		return nil, err
 	}
+	return db, nil
+}
 
-	_, err = db.Exec("PRAGMA user_version = 2")
-	if err != nil {
+// setupDB migriert db bis einschließlich target und legt den Standard-Admin an.
+func setupDB(db *DB, target int) error {
+	if err := migrateDB(db, target); err != nil {
 		return err
 	}
-	version = 2
-
-	// Migration v3: Neue Spalten term_months, cancellation_date, cancellation_action_date
-	if version < 3 {
-		for _, col := range []string{
-			"ALTER TABLE contracts ADD COLUMN term_months INTEGER",
-			"ALTER TABLE contracts ADD COLUMN cancellation_date DATE",
-			"ALTER TABLE contracts ADD COLUMN cancellation_action_date DATE",
-		} {
-			db.Exec(col) // Fehler ignorieren falls Spalte schon existiert
-		}
-		_, err = db.Exec("PRAGMA user_version = 3")
-		if err != nil {
-			return err
-		}
-		version = 3
-	}
-
-	// Migration v4: Kategorien-Tabelle
-	if version < 4 {
-		_, err = db.Exec(`CREATE TABLE IF NOT EXISTS categories (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT UNIQUE NOT NULL
-		)`)
-		if err != nil {
-			return fmt.Errorf("migration v4 create categories: %w", err)
-		}
-
-		for _, cat := range []string{"IT", "Gebäude", "Versicherungen"} {
-			db.Exec("INSERT OR IGNORE INTO categories (name) VALUES (?)", cat)
-		}
-
-		// Kategorien aus bestehenden Verträgen übernehmen
-		_, err = db.Exec(`INSERT OR IGNORE INTO categories (name)
-			SELECT DISTINCT category FROM contracts
-			WHERE category NOT IN ('IT', 'Gebäude', 'Versicherungen') AND category != ''`)
-		if err != nil {
-			return fmt.Errorf("migration v4 seed from contracts: %w", err)
-		}
-
-		_, err = db.Exec("PRAGMA user_version = 4")
-		if err != nil {
-			return err
-		}
+	if target == 0 {
+		return nil
 	}
 
-	return nil
+	// Create default admin user (password: admin)
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("admin"), bcrypt.DefaultCost)
+	_, err := db.Exec("INSERT INTO users (username, password, role) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+		"admin", string(hashedPassword), "admin")
+	return err
 }
 
 func generateToken(user User) (string, error) {
@@ -341,7 +188,12 @@ func adminOnly(next http.HandlerFunc) http.HandlerFunc {
 	})
 }
 
-func loginHandler(w http.ResponseWriter, r *http.Request) {
+// userHandlers bedient die Benutzerverwaltung und die Anmeldung.
+type userHandlers struct {
+	users *UserRepository
+}
+
+func (h *userHandlers) login(w http.ResponseWriter, r *http.Request) {
 	var credentials struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
@@ -352,21 +204,17 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var user User
-	err := db.QueryRow("SELECT id, username, password, role FROM users WHERE username = ?",
-		credentials.Username).Scan(&user.ID, &user.Username, &user.Password, &user.Role)
-
-	if err != nil {
+	user, err := h.users.Authenticate(r.Context(), credentials.Username, credentials.Password)
+	if errors.Is(err, errInvalidCredentials) {
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
-
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(credentials.Password)); err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	token, err := generateToken(user)
+	token, err := generateToken(*user)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -382,478 +230,161 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func createUserHandler(w http.ResponseWriter, r *http.Request) {
-	var user User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+// decodeUserInput liest Benutzername, Passwort und Rolle aus der Anfrage.
+func decodeUserInput(r *http.Request) (UserInput, error) {
+	var input struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Role     string `json:"role"`
 	}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	return UserInput(input), err
+}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+func (h *userHandlers) create(w http.ResponseWriter, r *http.Request) {
+	input, err := decodeUserInput(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	result, err := db.Exec("INSERT INTO users (username, password, role) VALUES (?, ?, ?)",
-		user.Username, string(hashedPassword), user.Role)
+	user, err := h.users.Create(r.Context(), input)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	id, _ := result.LastInsertId()
-	user.ID = int(id)
-	user.Password = ""
-
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(user)
 }
 
-func getUsersHandler(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query("SELECT id, username, role FROM users")
+func (h *userHandlers) list(w http.ResponseWriter, r *http.Request) {
+	users, err := h.users.List(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var users []User
-	for rows.Next() {
-		var user User
-		if err := rows.Scan(&user.ID, &user.Username, &user.Role); err != nil {
-			continue
-		}
-		users = append(users, user)
-	}
 
 	json.NewEncoder(w).Encode(users)
 }
 
-func updateUserHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-
-	var input struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-		Role     string `json:"role"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+func (h *userHandlers) update(w http.ResponseWriter, r *http.Request) {
+	input, err := decodeUserInput(r)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Letzten Admin nicht herabstufen
-	if input.Role != "admin" {
-		var adminCount int
-		db.QueryRow("SELECT COUNT(*) FROM users WHERE role = 'admin' AND id != ?", id).Scan(&adminCount)
-		if adminCount == 0 {
-			http.Error(w, "Der letzte Admin kann nicht herabgestuft werden", http.StatusBadRequest)
-			return
-		}
-	}
-
-	var err error
-	if input.Password != "" {
-		hashedPassword, hashErr := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
-		if hashErr != nil {
-			http.Error(w, hashErr.Error(), http.StatusInternalServerError)
-			return
-		}
-		_, err = db.Exec("UPDATE users SET username = ?, password = ?, role = ? WHERE id = ?",
-			input.Username, string(hashedPassword), input.Role, id)
-	} else {
-		_, err = db.Exec("UPDATE users SET username = ?, role = ? WHERE id = ?",
-			input.Username, input.Role, id)
-	}
+	user, err := h.users.Update(r.Context(), mustAtoi(r.PathValue("id")), input)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
-
-	var user User
-	db.QueryRow("SELECT id, username, role FROM users WHERE id = ?", id).Scan(&user.ID, &user.Username, &user.Role)
 	json.NewEncoder(w).Encode(user)
 }
 
-func deleteUserHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-
-	// Selbstlöschung verhindern
-	if r.Header.Get("X-User-ID") == id {
-		http.Error(w, "Sie können Ihren eigenen Account nicht löschen", http.StatusBadRequest)
-		return
-	}
-
-	// Letzten Admin nicht löschen
-	var userRole string
-	db.QueryRow("SELECT role FROM users WHERE id = ?", id).Scan(&userRole)
-	if userRole == "admin" {
-		var adminCount int
-		db.QueryRow("SELECT COUNT(*) FROM users WHERE role = 'admin'").Scan(&adminCount)
-		if adminCount <= 1 {
-			http.Error(w, "Der letzte Admin kann nicht gelöscht werden", http.StatusBadRequest)
-			return
-		}
-	}
-
-	_, err := db.Exec("DELETE FROM users WHERE id = ?", id)
+func (h *userHandlers) delete(w http.ResponseWriter, r *http.Request) {
+	err := h.users.Delete(r.Context(), mustAtoi(r.PathValue("id")), mustAtoi(r.Header.Get("X-User-ID")))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func getNextContractNumber() (string, error) {
-	var maxNumber int
-	err := db.QueryRow("SELECT COALESCE(MAX(CAST(SUBSTR(contract_number, 2) AS INTEGER)), 0) FROM contracts WHERE contract_number LIKE 'V%'").Scan(&maxNumber)
-	if err != nil {
-		return "", err
-	}
-	return fmt.Sprintf("V%06d", maxNumber+1), nil
+// contractHandlers bedient Anlegen, Ändern, Kündigen und den Papierkorb von
+// Verträgen. Listen und Berichte laufen über listContracts.
+type contractHandlers struct {
+	repos     *Repositories
+	contracts *ContractRepository
 }
 
-func createContractHandler(w http.ResponseWriter, r *http.Request) {
+func (h *contractHandlers) create(w http.ResponseWriter, r *http.Request) {
 	var contract Contract
 	if err := json.NewDecoder(r.Body).Decode(&contract); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if contract.ContractNumber == "" {
-		number, err := getNextContractNumber()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		contract.ContractNumber = number
-	}
-
-	var frameworkID interface{}
-	if contract.FrameworkContractID != nil {
-		frameworkID = *contract.FrameworkContractID
-	}
-	var noticePeriod interface{}
-	if contract.NoticePeriod != nil {
-		noticePeriod = *contract.NoticePeriod
-	}
-	var minimumTerm interface{}
-	if contract.MinimumTerm != nil {
-		minimumTerm = *contract.MinimumTerm
-	}
-	var termMonths interface{}
-	if contract.TermMonths != nil {
-		termMonths = *contract.TermMonths
+	// Ohne Angabe ist der anlegende Benutzer verantwortlich
+	if contract.OwnerID == nil {
+		userID := mustAtoi(r.Header.Get("X-User-ID"))
+		contract.OwnerID = &userID
 	}
 
-	result, err := db.Exec(`INSERT INTO contracts
-		(contract_number, title, content, conditions, notice_period, minimum_term,
-		term_months, valid_from, valid_until, partner, category, contract_type, framework_contract_id)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		contract.ContractNumber, contract.Title, contract.Content, contract.Conditions,
-		noticePeriod, minimumTerm, termMonths, contract.ValidFrom, contract.ValidUntil,
-		contract.Partner, contract.Category, contract.ContractType, frameworkID)
-
+	created, err := h.contracts.Create(r.Context(), &contract)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
-
-	id, _ := result.LastInsertId()
-	contract.ID = int(id)
+	emitContractEvent(h.repos.db, eventContractCreated, *created, nil)
+	publishChange(changeContractCreated, map[string]interface{}{"contract": created})
 
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(contract)
+	json.NewEncoder(w).Encode(created)
 }
 
-func updateContractHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-
+func (h *contractHandlers) update(w http.ResponseWriter, r *http.Request) {
 	var contract Contract
 	if err := json.NewDecoder(r.Body).Decode(&contract); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	var frameworkID interface{}
-	if contract.FrameworkContractID != nil {
-		frameworkID = *contract.FrameworkContractID
-	}
-	var noticePeriod interface{}
-	if contract.NoticePeriod != nil {
-		noticePeriod = *contract.NoticePeriod
-	}
-	var minimumTerm interface{}
-	if contract.MinimumTerm != nil {
-		minimumTerm = *contract.MinimumTerm
-	}
-	var termMonths interface{}
-	if contract.TermMonths != nil {
-		termMonths = *contract.TermMonths
-	}
-
-	_, err := db.Exec(`UPDATE contracts SET
-		title = ?, content = ?, conditions = ?, notice_period = ?,
-		minimum_term = ?, term_months = ?, valid_from = ?, valid_until = ?, partner = ?,
-		category = ?, contract_type = ?, framework_contract_id = ?
-		WHERE id = ?`,
-		contract.Title, contract.Content, contract.Conditions, noticePeriod,
-		minimumTerm, termMonths, contract.ValidFrom, contract.ValidUntil, contract.Partner,
-		contract.Category, contract.ContractType, frameworkID, id)
-
+	previous, updated, err := h.contracts.Update(r.Context(), mustAtoi(r.PathValue("id")), &contract)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
+	emitContractEvent(h.repos.db, eventContractUpdated, *updated, previous)
+	publishChange(changeContractUpdated, map[string]interface{}{"contract": updated})
 
-	json.NewEncoder(w).Encode(contract)
-}
-
-func getContractsHandler(w http.ResponseWriter, r *http.Request) {
-	query := "SELECT id, contract_number, title, content, conditions, notice_period, minimum_term, term_months, cancellation_date, cancellation_action_date, valid_from, valid_until, partner, category, contract_type, framework_contract_id, is_terminated, terminated_at, created_at FROM contracts WHERE 1=1"
-
-	args := []interface{}{}
-
-	if search := r.URL.Query().Get("search"); search != "" {
-		query += " AND (title LIKE ? OR partner LIKE ? OR content LIKE ?)"
-		searchParam := "%" + search + "%"
-		args = append(args, searchParam, searchParam, searchParam)
-	}
-
-	if category := r.URL.Query().Get("category"); category != "" {
-		query += " AND category = ?"
-		args = append(args, category)
-	}
-
-	if onlyValid := r.URL.Query().Get("only_valid"); onlyValid == "true" {
-		query += " AND is_terminated = 0 AND (valid_until IS NULL OR valid_until > datetime('now'))"
-	}
-
-	query += " ORDER BY created_at DESC"
-
-	rows, err := db.Query(query, args...)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	defer rows.Close()
-
-	contracts := scanContracts(rows)
-	json.NewEncoder(w).Encode(contracts)
-}
-
-// scanContracts liest alle Zeilen aus einem Contracts-Query und gibt sie als Slice zurück.
-func scanContracts(rows *sql.Rows) []Contract {
-	var contracts []Contract
-	for rows.Next() {
-		var contract Contract
-		var validUntil, minimumTerm, cancDate, cancActionDate, terminatedAt sql.NullTime
-		var frameworkID, noticePeriod, termMonths sql.NullInt64
-
-		if err := rows.Scan(&contract.ID, &contract.ContractNumber, &contract.Title,
-			&contract.Content, &contract.Conditions, &noticePeriod,
-			&minimumTerm, &termMonths, &cancDate, &cancActionDate,
-			&contract.ValidFrom, &validUntil, &contract.Partner,
-			&contract.Category, &contract.ContractType, &frameworkID,
-			&contract.IsTerminated, &terminatedAt, &contract.CreatedAt); err != nil {
-			continue
-		}
-
-		if validUntil.Valid {
-			contract.ValidUntil = &validUntil.Time
-		}
-		if minimumTerm.Valid {
-			contract.MinimumTerm = &minimumTerm.Time
-		}
-		if termMonths.Valid {
-			n := int(termMonths.Int64)
-			contract.TermMonths = &n
-		}
-		if cancDate.Valid {
-			contract.CancellationDate = &cancDate.Time
-		}
-		if cancActionDate.Valid {
-			contract.CancellationActionDate = &cancActionDate.Time
-		}
-		if noticePeriod.Valid {
-			n := int(noticePeriod.Int64)
-			contract.NoticePeriod = &n
-		}
-		if frameworkID.Valid {
-			id := int(frameworkID.Int64)
-			contract.FrameworkContractID = &id
-		}
-		if terminatedAt.Valid {
-			contract.TerminatedAt = &terminatedAt.Time
-		}
-
-		contracts = append(contracts, contract)
-	}
-	return contracts
+	json.NewEncoder(w).Encode(updated)
 }
 
-func getContractHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-
-	var contract Contract
-	var validUntil, minimumTerm, cancDate, cancActionDate, terminatedAt sql.NullTime
-	var frameworkID, noticePeriod, termMonths sql.NullInt64
-
-	err := db.QueryRow(`SELECT id, contract_number, title, content, conditions,
-		notice_period, minimum_term, term_months, cancellation_date, cancellation_action_date,
-		valid_from, valid_until, partner, category,
-		contract_type, framework_contract_id, is_terminated, terminated_at, created_at
-		FROM contracts WHERE id = ?`, id).Scan(
-		&contract.ID, &contract.ContractNumber, &contract.Title, &contract.Content,
-		&contract.Conditions, &noticePeriod, &minimumTerm, &termMonths, &cancDate, &cancActionDate,
-		&contract.ValidFrom, &validUntil, &contract.Partner, &contract.Category,
-		&contract.ContractType, &frameworkID, &contract.IsTerminated,
-		&terminatedAt, &contract.CreatedAt)
-
+func (h *contractHandlers) list(w http.ResponseWriter, r *http.Request) {
+	where, args, err := contractFilter(h.repos.dialect, r.URL.Query(), mustAtoi(r.Header.Get("X-User-ID")))
 	if err != nil {
-		http.Error(w, "Contract not found", http.StatusNotFound)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if validUntil.Valid {
-		contract.ValidUntil = &validUntil.Time
-	}
-	if minimumTerm.Valid {
-		contract.MinimumTerm = &minimumTerm.Time
-	}
-	if termMonths.Valid {
-		n := int(termMonths.Int64)
-		contract.TermMonths = &n
-	}
-	if cancDate.Valid {
-		contract.CancellationDate = &cancDate.Time
-	}
-	if cancActionDate.Valid {
-		contract.CancellationActionDate = &cancActionDate.Time
-	}
-	if noticePeriod.Valid {
-		n := int(noticePeriod.Int64)
-		contract.NoticePeriod = &n
-	}
-	if frameworkID.Valid {
-		id := int(frameworkID.Int64)
-		contract.FrameworkContractID = &id
-	}
-	if terminatedAt.Valid {
-		contract.TerminatedAt = &terminatedAt.Time
-	}
-
-	json.NewEncoder(w).Encode(contract)
+	listContracts(w, r, h.repos, r.URL.Query(), "Verträge", where, args, "-created_at")
 }
 
-func terminateContractHandler(w http.ResponseWriter, r *http.Request) {
+func (h *contractHandlers) get(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
-
-	now := time.Now()
-	_, err := db.Exec("UPDATE contracts SET is_terminated = 1, terminated_at = ? WHERE id = ?", now, id)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	json.NewEncoder(w).Encode(map[string]string{"message": "Contract terminated"})
-}
-
-func uploadDocumentHandler(w http.ResponseWriter, r *http.Request) {
-	contractID := r.PathValue("id")
-
-	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if r.URL.Query().Get("format") == exportPDF {
+		writeContractPDF(w, r, h.repos, id)
 		return
 	}
 
-	file, handler, err := r.FormFile("document")
+	contract, err := h.contracts.Get(r.Context(), mustAtoi(id))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-	defer file.Close()
-
-	uploadsDir := "./uploads"
-	os.MkdirAll(uploadsDir, os.ModePerm)
-
-	filename := fmt.Sprintf("%s_%s", time.Now().Format("20060102150405"), handler.Filename)
-	filepath := filepath.Join(uploadsDir, filename)
-
-	dst, err := os.Create(filepath)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
-	defer dst.Close()
-
-	if _, err := io.Copy(dst, file); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	result, err := db.Exec("INSERT INTO documents (contract_id, filename, file_path) VALUES (?, ?, ?)",
-		contractID, handler.Filename, filepath)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	id, _ := result.LastInsertId()
-	doc := Document{
-		ID:         int(id),
-		ContractID: mustAtoi(contractID),
-		Filename:   handler.Filename,
-		FilePath:   filepath,
-		UploadedAt: time.Now(),
-	}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(doc)
+	json.NewEncoder(w).Encode(contract)
 }
 
-func getDocumentsHandler(w http.ResponseWriter, r *http.Request) {
-	contractID := r.PathValue("id")
-
-	rows, err := db.Query("SELECT id, contract_id, filename, file_path, uploaded_at FROM documents WHERE contract_id = ?", contractID)
+func (h *contractHandlers) terminate(w http.ResponseWriter, r *http.Request) {
+	previous, terminated, err := h.contracts.Terminate(r.Context(), mustAtoi(r.PathValue("id")))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
-	defer rows.Close()
-
-	var documents []Document
-	for rows.Next() {
-		var doc Document
-		if err := rows.Scan(&doc.ID, &doc.ContractID, &doc.Filename, &doc.FilePath, &doc.UploadedAt); err != nil {
-			continue
-		}
-		documents = append(documents, doc)
-	}
-
-	json.NewEncoder(w).Encode(documents)
-}
-
-func downloadDocumentHandler(w http.ResponseWriter, r *http.Request) {
-	docID := r.PathValue("docId")
-
-	var doc Document
-	err := db.QueryRow("SELECT id, filename, file_path FROM documents WHERE id = ?", docID).
-		Scan(&doc.ID, &doc.Filename, &doc.FilePath)
-
-	if err != nil {
-		http.Error(w, "Document not found", http.StatusNotFound)
-		return
+	// Nur die erste Kündigung wird gemeldet
+	if !previous.IsTerminated {
+		emitContractEvent(h.repos.db, eventContractTerminated, *terminated, nil)
+		publishChange(changeContractTerminated, map[string]interface{}{"contract": terminated})
 	}
 
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", doc.Filename))
-	w.Header().Set("Content-Type", "application/pdf")
-	http.ServeFile(w, r, doc.FilePath)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Contract terminated"})
 }
 
-func getExpiringContractsHandler(w http.ResponseWriter, r *http.Request) {
+func (h *contractHandlers) expiring(w http.ResponseWriter, r *http.Request) {
 	days := 90
 	if d := r.URL.Query().Get("days"); d != "" {
 		if parsed, err := strconv.Atoi(d); err == nil && parsed > 0 {
@@ -862,199 +393,130 @@ func getExpiringContractsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Zeige Verträge, bei denen die Kündigungsvornahme innerhalb des Vorlaufzeitraums liegt.
-	query := `SELECT id, contract_number, title, content, conditions, notice_period,
-		minimum_term, term_months, cancellation_date, cancellation_action_date,
-		valid_from, valid_until, partner, category, contract_type,
-		framework_contract_id, is_terminated, terminated_at, created_at
-		FROM contracts
-		WHERE is_terminated = 0
-		AND cancellation_action_date IS NOT NULL
-		AND cancellation_action_date BETWEEN date('now') AND date('now', '+' || ? || ' days')
-		ORDER BY cancellation_action_date ASC`
-
-	rows, err := db.Query(query, days)
+	where, args, err := contractFilter(h.repos.dialect, r.URL.Query(), mustAtoi(r.Header.Get("X-User-ID")))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer rows.Close()
+	where = `is_terminated = FALSE
+		AND cancellation_action_date IS NOT NULL
+		AND cancellation_action_date BETWEEN CURRENT_DATE AND ` + h.repos.dialect.DateInDays() + `
+		AND ` + where
 
-	contracts := scanContracts(rows)
-	json.NewEncoder(w).Encode(contracts)
+	listContracts(w, r, h.repos, r.URL.Query(), "Ablaufende Kündigungsfristen", where, append([]interface{}{days}, args...), "cancellation_action_date")
 }
 
 // calculateCancellationDates berechnet Kündigungstermin und Kündigungsvornahme für alle Verträge.
-func calculateCancellationDatesHandler(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query(`SELECT id, valid_from, notice_period, minimum_term, term_months
-		FROM contracts WHERE is_terminated = 0`)
+func (h *contractHandlers) calculateCancellationDates(w http.ResponseWriter, r *http.Request) {
+	updated, err := h.contracts.RecalculateDates(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	type calcContract struct {
-		id           int
-		validFrom    time.Time
-		noticePeriod sql.NullInt64
-		termMonths   sql.NullInt64
-		minimumTerm  sql.NullTime
-	}
-
-	var contracts []calcContract
-	for rows.Next() {
-		var c calcContract
-		if err := rows.Scan(&c.id, &c.validFrom, &c.noticePeriod, &c.minimumTerm, &c.termMonths); err != nil {
-			continue
-		}
-		contracts = append(contracts, c)
-	}
-	rows.Close()
+	publishChange(changeContractsChanged, map[string]interface{}{"reason": "calculate-dates", "count": updated})
 
-	today := time.Now().Truncate(24 * time.Hour)
-	updated := 0
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Kündigungstermine für %d Verträge berechnet", updated),
+		"updated": updated,
+	})
+}
 
-	for _, c := range contracts {
-		// Alle Felder müssen gesetzt sein
-		if !c.noticePeriod.Valid || !c.minimumTerm.Valid || !c.termMonths.Valid || c.termMonths.Int64 <= 0 {
-			db.Exec("UPDATE contracts SET cancellation_date = NULL, cancellation_action_date = NULL WHERE id = ?", c.id)
-			continue
-		}
+// cancellationDates liefert Kündigungstermin und Kündigungsvornahme: den ersten Termin
+// ab Vertragsbeginn im Takt der Laufzeit, der die Mindestlaufzeit erreicht und dessen
+// Kündigungsvornahme nicht vor today liegt. termMonths muss größer als 0 sein.
+func cancellationDates(validFrom, minTerm time.Time, noticePeriod, termMonths int, today time.Time) (time.Time, time.Time) {
+	// Jede Periodengrenze wird ab Vertragsbeginn gerechnet, damit ein Monatsende nicht
+	// wandert: 31.01. → 29.02. → 31.03. statt 31.01. → 29.02. → 29.03.
+	periods := 0
+	termin := validFrom
 
-		np := int(c.noticePeriod.Int64)
-		tm := int(c.termMonths.Int64)
-		minTerm := c.minimumTerm.Time
+	// Schritt 1: Erste Periodengrenze >= Mindestlaufzeit
+	for termin.Before(minTerm) {
+		periods++
+		termin = addMonths(validFrom, periods*termMonths)
+	}
 
-		// Schritt 1: Erste Periodengrenze >= Mindestlaufzeit
-		termin := c.validFrom
-		for termin.Before(minTerm) {
-			termin = termin.AddDate(0, tm, 0)
-		}
+	// Schritt 2: Kündigungsvornahme muss in der Zukunft liegen
+	for addMonths(termin, -noticePeriod).Before(today) {
+		periods++
+		termin = addMonths(validFrom, periods*termMonths)
+	}
 
-		// Schritt 2: Kündigungsvornahme muss in der Zukunft liegen
-		for termin.AddDate(0, -np, 0).Before(today) {
-			termin = termin.AddDate(0, tm, 0)
-		}
+	return termin, addMonths(termin, -noticePeriod)
+}
 
-		cancDate := termin
-		cancActionDate := termin.AddDate(0, -np, 0)
-		_, err = db.Exec("UPDATE contracts SET cancellation_date = ?, cancellation_action_date = ? WHERE id = ?",
-			cancDate, cancActionDate, c.id)
-		if err == nil {
-			updated++
-		}
+// addMonths verschiebt t um months Monate. Fehlt der Tag im Zielmonat, gilt dessen
+// letzter Tag (§ 188 Abs. 3 BGB): 31.01. + 1 Monat = 28.02. bzw. 29.02.
+func addMonths(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	first := time.Date(year, month+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
 	}
-
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": fmt.Sprintf("Kündigungstermine für %d Verträge berechnet", updated),
-		"updated": updated,
-	})
+	return first.AddDate(0, 0, day-1)
 }
 
-// Category handlers
+// categoryHandlers bedient die Kategorieverwaltung.
+type categoryHandlers struct {
+	categories *CategoryRepository
+}
 
-func getCategoriesHandler(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query("SELECT id, name FROM categories ORDER BY name")
+func (h *categoryHandlers) list(w http.ResponseWriter, r *http.Request) {
+	categories, err := h.categories.List(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var categories []Category
-	for rows.Next() {
-		var cat Category
-		if err := rows.Scan(&cat.ID, &cat.Name); err != nil {
-			continue
-		}
-		categories = append(categories, cat)
-	}
 
 	json.NewEncoder(w).Encode(categories)
 }
 
-func createCategoryHandler(w http.ResponseWriter, r *http.Request) {
-	var cat Category
-	if err := json.NewDecoder(r.Body).Decode(&cat); err != nil {
+func (h *categoryHandlers) create(w http.ResponseWriter, r *http.Request) {
+	var input Category
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	cat.Name = strings.TrimSpace(cat.Name)
-	if cat.Name == "" {
-		http.Error(w, "Kategoriename darf nicht leer sein", http.StatusBadRequest)
-		return
-	}
-
-	result, err := db.Exec("INSERT INTO categories (name) VALUES (?)", cat.Name)
+	cat, err := h.categories.Create(r.Context(), input.Name)
 	if err != nil {
-		http.Error(w, "Kategorie existiert bereits", http.StatusConflict)
+		writeError(w, err)
 		return
 	}
-
-	id, _ := result.LastInsertId()
-	cat.ID = int(id)
+	publishChange(changeCategoryCreated, map[string]interface{}{"category": cat})
 
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(cat)
 }
 
-func updateCategoryHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-
+func (h *categoryHandlers) update(w http.ResponseWriter, r *http.Request) {
 	var cat Category
 	if err := json.NewDecoder(r.Body).Decode(&cat); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	cat.Name = strings.TrimSpace(cat.Name)
-	if cat.Name == "" {
-		http.Error(w, "Kategoriename darf nicht leer sein", http.StatusBadRequest)
-		return
-	}
-
-	var oldName string
-	err := db.QueryRow("SELECT name FROM categories WHERE id = ?", id).Scan(&oldName)
-	if err != nil {
-		http.Error(w, "Kategorie nicht gefunden", http.StatusNotFound)
-		return
-	}
-
-	_, err = db.Exec("UPDATE categories SET name = ? WHERE id = ?", cat.Name, id)
+	cat.ID = mustAtoi(r.PathValue("id"))
+	oldName, err := h.categories.Rename(r.Context(), cat.ID, cat.Name)
 	if err != nil {
-		http.Error(w, "Kategoriename existiert bereits", http.StatusConflict)
+		writeError(w, err)
 		return
 	}
+	cat.Name = strings.TrimSpace(cat.Name)
+	publishChange(changeCategoryUpdated, map[string]interface{}{"category": cat, "previous_name": oldName})
 
-	// Verträge mit altem Namen aktualisieren
-	db.Exec("UPDATE contracts SET category = ? WHERE category = ?", cat.Name, oldName)
-
-	cat.ID = mustAtoi(id)
 	json.NewEncoder(w).Encode(cat)
 }
 
-func deleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-
-	var catName string
-	err := db.QueryRow("SELECT name FROM categories WHERE id = ?", id).Scan(&catName)
+// delete verschiebt eine unbenutzte Kategorie in den Papierkorb.
+func (h *categoryHandlers) delete(w http.ResponseWriter, r *http.Request) {
+	cat, err := h.categories.Trash(r.Context(), mustAtoi(r.PathValue("id")), mustAtoi(r.Header.Get("X-User-ID")))
 	if err != nil {
-		http.Error(w, "Kategorie nicht gefunden", http.StatusNotFound)
-		return
-	}
-
-	var count int
-	db.QueryRow("SELECT COUNT(*) FROM contracts WHERE category = ?", catName).Scan(&count)
-	if count > 0 {
-		http.Error(w, fmt.Sprintf("Kategorie wird von %d Vertrag/Verträgen verwendet", count), http.StatusConflict)
-		return
-	}
-
-	_, err = db.Exec("DELETE FROM categories WHERE id = ?", id)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
+	publishChange(changeCategoryDeleted, map[string]interface{}{"category": cat})
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -1065,48 +527,199 @@ func mustAtoi(s string) int {
 }
 
 func main() {
-	if err := initDB(); err != nil {
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		printUsage()
+		return
+	}
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Unbekannter Befehl: %s\n\n", name)
+		printUsage()
+		os.Exit(2)
+	}
+	if err := cmd.run(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
 		log.Fatal(err)
 	}
+}
+
+// serveCommand startet den Server; ohne Befehl ist er die Voreinstellung.
+//
+//	vertragsdb [serve] [-addr <Adresse>]
+func serveCommand(args []string) error {
+	fset := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fset.String("addr", ":8091", "Adresse, auf der der Server lauscht")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	db, err := initDB()
+	if err != nil {
+		return err
+	}
 	defer db.Close()
+	if err := enableEncryption(db); err != nil {
+		return err
+	}
+	resetMissingThumbnails(db)
+
+	repos := newRepositories(db)
+
+	go runExtractionWorker(repos)
+	go backfillDocumentMetadata(db)
+	go runReportScheduler(repos)
+	go runWebhookWorker(db)
+	go runDeadlineScheduler(repos)
+	go runRetentionScheduler(db)
+	go runTrashPurger(repos)
+	go runBackupScheduler(db)
+
+	log.Println("Server starting on " + *addr)
+	return http.ListenAndServe(*addr, newRouter(repos))
+}
+
+// newRouter legt alle Routen der API und des Frontends an.
+func newRouter(repos *Repositories) *http.ServeMux {
+	users := &userHandlers{repos.Users}
+	contracts := &contractHandlers{repos, repos.Contracts}
+	documents := &documentHandlers{repos.db, repos.Documents, repos.Contracts}
+	categories := &categoryHandlers{repos.Categories}
+	searches := &savedSearchHandlers{repos}
+	dashboard := &dashboardHandlers{repos}
+	subscriptions := &subscriptionHandlers{repos}
+	webhooks := &webhookHandlers{repos.db}
+	retention := &retentionHandlers{repos}
+	audit := &auditHandlers{repos.db}
+	trash := &trashHandlers{repos.db}
+	backups := &backupHandlers{repos.db}
 
 	r := http.NewServeMux()
 	base := "/vertragsdb/api"
 
 	// Public routes
-	r.HandleFunc("POST "+base+"/login", loginHandler)
+	r.HandleFunc("POST "+base+"/login", users.login)
 
 	// User routes
-	r.HandleFunc("GET "+base+"/users", authMiddleware(getUsersHandler))
-	r.HandleFunc("POST "+base+"/users", adminOnly(createUserHandler))
-	r.HandleFunc("PUT "+base+"/users/{id}", adminOnly(updateUserHandler))
-	r.HandleFunc("DELETE "+base+"/users/{id}", adminOnly(deleteUserHandler))
+	r.HandleFunc("GET "+base+"/users", authMiddleware(users.list))
+	r.HandleFunc("POST "+base+"/users", adminOnly(users.create))
+	r.HandleFunc("PUT "+base+"/users/{id}", adminOnly(users.update))
+	r.HandleFunc("DELETE "+base+"/users/{id}", adminOnly(users.delete))
 
 	// Contract routes
-	r.HandleFunc("GET "+base+"/contracts", authMiddleware(getContractsHandler))
-	r.HandleFunc("POST "+base+"/contracts", adminOnly(createContractHandler))
-	r.HandleFunc("POST "+base+"/contracts/calculate-dates", adminOnly(calculateCancellationDatesHandler))
-	r.HandleFunc("GET "+base+"/contracts/{id}", authMiddleware(getContractHandler))
-	r.HandleFunc("PUT "+base+"/contracts/{id}", adminOnly(updateContractHandler))
-	r.HandleFunc("POST "+base+"/contracts/{id}/terminate", adminOnly(terminateContractHandler))
+	r.HandleFunc("GET "+base+"/contracts", authMiddleware(contracts.list))
+	r.HandleFunc("POST "+base+"/contracts", adminOnly(contracts.create))
+	r.HandleFunc("POST "+base+"/contracts/calculate-dates", adminOnly(contracts.calculateCancellationDates))
+	r.HandleFunc("POST "+base+"/contracts/import", adminOnly(contracts.importFile))
+	r.HandleFunc("GET "+base+"/contracts/dossier", authMiddleware(contracts.dossiers))
+	r.HandleFunc("GET "+base+"/contracts/{id}", authMiddleware(contracts.get))
+	r.HandleFunc("GET "+base+"/contracts/{id}/dossier", authMiddleware(contracts.dossier))
+	r.HandleFunc("PUT "+base+"/contracts/{id}", adminOnly(contracts.update))
+	r.HandleFunc("POST "+base+"/contracts/{id}/terminate", adminOnly(contracts.terminate))
+	r.HandleFunc("PUT "+base+"/contracts/{id}/legal-hold", adminOnly(contracts.setLegalHold))
+	r.HandleFunc("DELETE "+base+"/contracts/{id}", adminOnly(contracts.trash))
+	r.HandleFunc("POST "+base+"/contracts/{id}/restore", adminOnly(contracts.restore))
 
 	// Document routes
-	r.HandleFunc("GET "+base+"/contracts/{id}/documents", authMiddleware(getDocumentsHandler))
-	r.HandleFunc("POST "+base+"/contracts/{id}/documents", adminOnly(uploadDocumentHandler))
-	r.HandleFunc("GET "+base+"/documents/{docId}/download", authMiddleware(downloadDocumentHandler))
+	r.HandleFunc("GET "+base+"/contracts/{id}/documents", authMiddleware(documents.list))
+	r.HandleFunc("POST "+base+"/contracts/{id}/documents", adminOnly(documents.upload))
+	r.HandleFunc("GET "+base+"/documents/{docId}", authMiddleware(documents.get))
+	r.HandleFunc("PUT "+base+"/documents/{docId}", adminOnly(documents.update))
+	r.HandleFunc("DELETE "+base+"/documents/{docId}", adminOnly(documents.delete))
+	r.HandleFunc("POST "+base+"/documents/{docId}/restore", adminOnly(documents.restore))
+	r.HandleFunc("GET "+base+"/documents/{docId}/download", authMiddleware(documents.download))
+	r.HandleFunc("GET "+base+"/documents/{docId}/thumbnail", authMiddleware(documents.thumbnail))
+	r.HandleFunc("GET "+base+"/documents/{docId}/versions", authMiddleware(documents.versions))
+	r.HandleFunc("POST "+base+"/documents/{docId}/versions", adminOnly(documents.uploadVersion))
+	r.HandleFunc("GET "+base+"/documents/{docId}/versions/{version}/download", authMiddleware(documents.downloadVersion))
+	r.HandleFunc("GET "+base+"/documents/{docId}/text", authMiddleware(documents.text))
+	r.HandleFunc("POST "+base+"/documents/{docId}/reindex", adminOnly(documents.reindex))
+	r.HandleFunc("POST "+base+"/documents/reindex", adminOnly(documents.reindexAll))
+	r.HandleFunc("GET "+base+"/quarantine", adminOnly(documents.quarantine))
+	r.HandleFunc("DELETE "+base+"/quarantine/{id}", adminOnly(documents.deleteQuarantine))
+
+	// Live update routes
+	r.HandleFunc("GET "+base+"/events", users.events)
+
+	// Search routes
+	r.HandleFunc("GET "+base+"/search", authMiddleware(contracts.search))
+
+	// Saved search routes
+	r.HandleFunc("GET "+base+"/saved-searches", authMiddleware(searches.list))
+	r.HandleFunc("POST "+base+"/saved-searches", authMiddleware(searches.create))
+	r.HandleFunc("GET "+base+"/saved-searches/{id}", authMiddleware(searches.get))
+	r.HandleFunc("PUT "+base+"/saved-searches/{id}", authMiddleware(searches.update))
+	r.HandleFunc("DELETE "+base+"/saved-searches/{id}", authMiddleware(searches.delete))
+	r.HandleFunc("GET "+base+"/saved-searches/{id}/contracts", authMiddleware(searches.run))
+
+	// Dashboard routes
+	r.HandleFunc("GET "+base+"/dashboard", authMiddleware(dashboard.get))
+	r.HandleFunc("GET "+base+"/dashboard/widgets", authMiddleware(dashboard.listWidgets))
+	r.HandleFunc("POST "+base+"/dashboard/widgets", authMiddleware(dashboard.createWidget))
+	r.HandleFunc("PUT "+base+"/dashboard/widgets/{id}", authMiddleware(dashboard.updateWidget))
+	r.HandleFunc("DELETE "+base+"/dashboard/widgets/{id}", authMiddleware(dashboard.deleteWidget))
 
 	// Reporting routes
-	r.HandleFunc("GET "+base+"/reports/expiring", authMiddleware(getExpiringContractsHandler))
+	r.HandleFunc("GET "+base+"/reports/expiring", authMiddleware(contracts.expiring))
+	r.HandleFunc("GET "+base+"/reports/portfolio", authMiddleware(contracts.portfolio))
+
+	// Report subscription routes
+	r.HandleFunc("GET "+base+"/report-subscriptions", authMiddleware(subscriptions.list))
+	r.HandleFunc("POST "+base+"/report-subscriptions", authMiddleware(subscriptions.create))
+	r.HandleFunc("GET "+base+"/report-subscriptions/{id}", authMiddleware(subscriptions.get))
+	r.HandleFunc("PUT "+base+"/report-subscriptions/{id}", authMiddleware(subscriptions.update))
+	r.HandleFunc("DELETE "+base+"/report-subscriptions/{id}", authMiddleware(subscriptions.delete))
+	r.HandleFunc("POST "+base+"/report-subscriptions/{id}/run", authMiddleware(subscriptions.run))
+	r.HandleFunc("GET "+base+"/report-subscriptions/{id}/runs", authMiddleware(subscriptions.runs))
+
+	// Webhook routes
+	r.HandleFunc("GET "+base+"/webhooks", adminOnly(webhooks.list))
+	r.HandleFunc("POST "+base+"/webhooks", adminOnly(webhooks.create))
+	r.HandleFunc("GET "+base+"/webhooks/{id}", adminOnly(webhooks.get))
+	r.HandleFunc("PUT "+base+"/webhooks/{id}", adminOnly(webhooks.update))
+	r.HandleFunc("DELETE "+base+"/webhooks/{id}", adminOnly(webhooks.delete))
+	r.HandleFunc("POST "+base+"/webhooks/{id}/test", adminOnly(webhooks.test))
+	r.HandleFunc("GET "+base+"/webhooks/{id}/deliveries", adminOnly(webhooks.deliveries))
+	r.HandleFunc("POST "+base+"/webhooks/{id}/deliveries/{deliveryId}/redeliver", adminOnly(webhooks.redeliver))
+
+	// Retention routes
+	r.HandleFunc("GET "+base+"/retention/rules", adminOnly(retention.rules))
+	r.HandleFunc("POST "+base+"/retention/rules", adminOnly(retention.createRule))
+	r.HandleFunc("PUT "+base+"/retention/rules/{id}", adminOnly(retention.updateRule))
+	r.HandleFunc("DELETE "+base+"/retention/rules/{id}", adminOnly(retention.deleteRule))
+	r.HandleFunc("GET "+base+"/retention/candidates", adminOnly(retention.candidates))
+	r.HandleFunc("POST "+base+"/retention/candidates/{id}/approve", adminOnly(retention.approve))
+	r.HandleFunc("POST "+base+"/retention/candidates/{id}/reject", adminOnly(retention.reject))
+	r.HandleFunc("POST "+base+"/retention/run", adminOnly(retention.check))
+	r.HandleFunc("GET "+base+"/audit-log", adminOnly(audit.list))
 
 	// Category routes
-	r.HandleFunc("GET "+base+"/categories", authMiddleware(getCategoriesHandler))
-	r.HandleFunc("POST "+base+"/categories", adminOnly(createCategoryHandler))
-	r.HandleFunc("PUT "+base+"/categories/{id}", adminOnly(updateCategoryHandler))
-	r.HandleFunc("DELETE "+base+"/categories/{id}", adminOnly(deleteCategoryHandler))
+	r.HandleFunc("GET "+base+"/categories", authMiddleware(categories.list))
+	r.HandleFunc("POST "+base+"/categories", adminOnly(categories.create))
+	r.HandleFunc("PUT "+base+"/categories/{id}", adminOnly(categories.update))
+	r.HandleFunc("DELETE "+base+"/categories/{id}", adminOnly(categories.delete))
+	r.HandleFunc("POST "+base+"/categories/{id}/restore", adminOnly(categories.restore))
+
+	// Trash routes
+	r.HandleFunc("GET "+base+"/trash", adminOnly(trash.list))
+	r.HandleFunc("DELETE "+base+"/trash/contracts/{id}", adminOnly(contracts.purge))
+	r.HandleFunc("DELETE "+base+"/trash/categories/{id}", adminOnly(categories.purge))
+
+	// Backup routes
+	r.HandleFunc("GET "+base+"/backups", adminOnly(backups.list))
+	r.HandleFunc("POST "+base+"/backups", adminOnly(backups.create))
+	r.HandleFunc("GET "+base+"/backups/{name}", adminOnly(backups.download))
 
 	// Serve frontend files
 	r.Handle("GET /vertragsdb/", http.StripPrefix("/vertragsdb", http.FileServer(http.Dir("frontend/dist"))))
 
-	log.Println("Server starting on :8091")
-	log.Fatal(http.ListenAndServe(":8091", r))
+	return r
 }
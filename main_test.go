@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestAddMonths(t *testing.T) {
+	tests := []struct {
+		from   string
+		months int
+		want   string
+	}{
+		{"2024-01-15", 1, "2024-02-15"},
+		{"2024-01-15", -1, "2023-12-15"},
+		{"2024-12-15", 1, "2025-01-15"},
+		{"2024-01-15", 0, "2024-01-15"},
+		{"2024-03-15", -15, "2022-12-15"},
+		// Monatsende
+		{"2024-01-31", 1, "2024-02-29"},
+		{"2023-01-31", 1, "2023-02-28"},
+		{"2024-08-31", 1, "2024-09-30"},
+		{"2024-03-31", -1, "2024-02-29"},
+		{"2024-05-31", -3, "2024-02-29"},
+		{"2024-12-31", -10, "2024-02-29"},
+		// Schaltjahre
+		{"2024-02-29", 12, "2025-02-28"},
+		{"2024-02-29", 48, "2028-02-29"},
+		{"2024-02-29", -12, "2023-02-28"},
+		{"2000-02-29", 1200, "2100-02-28"},
+	}
+	for _, tt := range tests {
+		if got := addMonths(date(tt.from), tt.months).Format("2006-01-02"); got != tt.want {
+			t.Errorf("addMonths(%s, %d) = %s, erwartet %s", tt.from, tt.months, got, tt.want)
+		}
+	}
+}
+
+func TestCancellationDates(t *testing.T) {
+	tests := []struct {
+		name                 string
+		validFrom, minTerm   string
+		noticePeriod, term   int
+		today                string
+		wantDate, wantAction string
+	}{
+		{"Beispiel aus der Dokumentation", "2024-01-01", "2026-01-01", 3, 12, "2026-02-12", "2027-01-01", "2026-10-01"},
+		{"Mindestlaufzeit auf Periodengrenze", "2024-01-01", "2025-01-01", 3, 12, "2024-06-01", "2025-01-01", "2024-10-01"},
+		{"Mindestlaufzeit zwischen Periodengrenzen", "2024-01-01", "2024-08-15", 3, 6, "2024-02-01", "2025-01-01", "2024-10-01"},
+		{"Kündigungsvornahme heute", "2024-01-01", "2025-01-01", 3, 12, "2025-10-01", "2026-01-01", "2025-10-01"},
+		{"Kündigungsvornahme gestern", "2024-01-01", "2025-01-01", 3, 12, "2025-10-02", "2027-01-01", "2026-10-01"},
+		{"Mindestlaufzeit vor Vertragsbeginn", "2024-06-15", "2020-01-01", 1, 12, "2024-01-01", "2024-06-15", "2024-05-15"},
+		{"Mindestlaufzeit vor Vertragsbeginn, Vornahme verpasst", "2024-06-15", "2020-01-01", 1, 12, "2024-06-01", "2025-06-15", "2025-05-15"},
+		{"Mindestlaufzeit gleich Vertragsbeginn", "2024-06-15", "2024-06-15", 0, 12, "2024-01-01", "2024-06-15", "2024-06-15"},
+		{"ohne Kündigungsfrist", "2024-01-01", "2024-03-01", 0, 1, "2024-04-10", "2024-05-01", "2024-05-01"},
+		{"Kündigungsfrist länger als Laufzeit", "2024-01-01", "2024-01-01", 3, 1, "2024-01-15", "2024-05-01", "2024-02-01"},
+		{"Monatsende im Februar (Schaltjahr)", "2024-01-31", "2024-02-01", 0, 1, "2024-01-01", "2024-02-29", "2024-02-29"},
+		{"Monatsende im Februar", "2023-01-31", "2023-02-01", 0, 1, "2023-01-01", "2023-02-28", "2023-02-28"},
+		{"Monatsende wandert nicht", "2024-01-31", "2024-03-01", 0, 1, "2024-01-01", "2024-03-31", "2024-03-31"},
+		{"Kündigungsvornahme am Monatsende", "2023-05-31", "2024-05-31", 3, 12, "2023-01-01", "2024-05-31", "2024-02-29"},
+		{"Vertragsbeginn 29.02., jährlich", "2024-02-29", "2025-01-01", 0, 12, "2024-01-01", "2025-02-28", "2025-02-28"},
+		{"Vertragsbeginn 29.02., nächstes Schaltjahr", "2024-02-29", "2028-01-01", 1, 12, "2024-01-01", "2028-02-29", "2028-01-29"},
+		{"Vertragsbeginn 29.02., Kündigungsfrist ein Jahr", "2024-02-29", "2024-03-01", 12, 12, "2024-01-01", "2025-02-28", "2024-02-28"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotAction := cancellationDates(date(tt.validFrom), date(tt.minTerm), tt.noticePeriod, tt.term, date(tt.today))
+			if got.Format("2006-01-02") != tt.wantDate || gotAction.Format("2006-01-02") != tt.wantAction {
+				t.Errorf("Kündigungstermin %s, Kündigungsvornahme %s; erwartet %s und %s",
+					got.Format("2006-01-02"), gotAction.Format("2006-01-02"), tt.wantDate, tt.wantAction)
+			}
+			if gotAction.Before(date(tt.today)) {
+				t.Errorf("Kündigungsvornahme %s liegt vor heute", gotAction.Format("2006-01-02"))
+			}
+			if got.Before(date(tt.minTerm)) {
+				t.Errorf("Kündigungstermin %s liegt vor der Mindestlaufzeit", got.Format("2006-01-02"))
+			}
+		})
+	}
+}
+
+func TestRecalculateDates(t *testing.T) {
+	repos := setupTestDB(t)
+	ctx := context.Background()
+
+	intp := func(i int) *int { return &i }
+	timep := func(s string) *time.Time { d := date(s); return &d }
+
+	// Vertragsbeginn weit in der Zukunft, damit das Ergebnis nicht vom heutigen Tag abhängt
+	complete, err := repos.Contracts.Create(ctx, &Contract{Title: "vollständig", ContractType: "individual", Category: "IT",
+		ValidFrom: date("2090-01-31"), MinimumTerm: timep("2090-03-01"), NoticePeriod: intp(1), TermMonths: intp(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	incomplete, err := repos.Contracts.Create(ctx, &Contract{Title: "ohne Laufzeit", ContractType: "individual", Category: "IT",
+		ValidFrom: date("2090-01-01"), MinimumTerm: timep("2090-03-01"), NoticePeriod: intp(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	terminated, err := repos.Contracts.Create(ctx, &Contract{Title: "beendet", ContractType: "individual", Category: "IT",
+		ValidFrom: date("2090-01-01"), MinimumTerm: timep("2090-03-01"), NoticePeriod: intp(1), TermMonths: intp(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := repos.Contracts.Terminate(ctx, terminated.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := repos.Contracts.RecalculateDates(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 1 {
+		t.Errorf("%d Verträge berechnet, erwartet 1", updated)
+	}
+
+	c, err := repos.Contracts.Get(ctx, complete.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.CancellationDate == nil || c.CancellationActionDate == nil {
+		t.Fatal("Kündigungstermine nicht gespeichert")
+	}
+	if got := c.CancellationDate.Format("2006-01-02"); got != "2090-03-31" {
+		t.Errorf("Kündigungstermin %s, erwartet 2090-03-31", got)
+	}
+	if got := c.CancellationActionDate.Format("2006-01-02"); got != "2090-02-28" {
+		t.Errorf("Kündigungsvornahme %s, erwartet 2090-02-28", got)
+	}
+
+	c, err = repos.Contracts.Get(ctx, incomplete.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.CancellationDate != nil || c.CancellationActionDate != nil {
+		t.Error("Vertrag ohne Laufzeit hat Kündigungstermine")
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Die Migrationen liegen je Dialekt als migrations/<Dialekt>/<Version>_<Name>.up.sql
+// und .down.sql im Programm; beide Dialekte haben dieselben Versionen. Eingespielte
+// Migrationen stehen mit Prüfsumme in schema_migrations, bei SQLite die Version
+// zusätzlich in PRAGMA user_version.
+//
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+type migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // SHA-256 von Up
+}
+
+var migrationFilePattern = regexp.MustCompile(`^(\d{4})_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+var migrationSets = map[string][]migration{
+	"sqlite":   loadMigrations("migrations/sqlite"),
+	"postgres": loadMigrations("migrations/postgres"),
+}
+
+// schemaVersion ist die Schema-Version nach allen Migrationen.
+var schemaVersion = checkMigrationSets()
+
+// migrationLockID sperrt bei PostgreSQL parallele Migrationen mehrerer Instanzen.
+const migrationLockID = 0x76657274 // "vert"
+
+const migrationTableSchema = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	checksum TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL
+)`
+
+// loadMigrations liest die eingebetteten Migrationen eines Verzeichnisses. Die
+// Versionen müssen lückenlos bei 1 beginnen und je eine up- und eine down-Datei haben.
+func loadMigrations(dir string) []migration {
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		panic(err)
+	}
+	byVersion := map[int]*migration{}
+	for _, e := range entries {
+		match := migrationFilePattern.FindStringSubmatch(e.Name())
+		if match == nil {
+			panic("ungültiger Dateiname einer Migration: " + e.Name())
+		}
+		data, err := migrationFiles.ReadFile(dir + "/" + e.Name())
+		if err != nil {
+			panic(err)
+		}
+		version, _ := strconv.Atoi(match[1])
+		m := byVersion[version]
+		if m == nil {
+			m = &migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			panic(fmt.Sprintf("Migration %d hat zwei Namen: %s und %s", version, m.Name, match[2]))
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+			sum := sha256.Sum256(data)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	list := make([]migration, len(byVersion))
+	for version, m := range byVersion {
+		if version < 1 || version > len(list) {
+			panic(fmt.Sprintf("Migrationen sind nicht lückenlos nummeriert (%d)", version))
+		}
+		if m.Up == "" || m.Down == "" {
+			panic(fmt.Sprintf("Migration %d: up- oder down-Datei fehlt", version))
+		}
+		list[version-1] = *m
+	}
+	if len(list) == 0 {
+		panic("keine Migrationen vorhanden")
+	}
+	return list
+}
+
+// checkMigrationSets stellt sicher, dass alle Dialekte dieselben Migrationen haben,
+// und liefert die letzte Version.
+func checkMigrationSets() int {
+	sqlite := migrationSets["sqlite"]
+	for dialect, set := range migrationSets {
+		if len(set) != len(sqlite) {
+			panic(fmt.Sprintf("Migrationen für %s: %d statt %d Versionen", dialect, len(set), len(sqlite)))
+		}
+		for i, m := range set {
+			if m.Name != sqlite[i].Name {
+				panic(fmt.Sprintf("Migration %d heißt für %s %s statt %s", m.Version, dialect, m.Name, sqlite[i].Name))
+			}
+		}
+	}
+	return len(sqlite)
+}
+
+// dbMigrations liefert die Migrationen für einen Dialekt.
+func dbMigrations(dialect Dialect) []migration {
+	return migrationSets[dialect.Name()]
+}
+
+// migrationState beschreibt den Stand der Datenbank.
+type migrationState struct {
+	Version  int
+	Baseline bool // schema_migrations fehlt noch, Version stammt aus PRAGMA user_version
+}
+
+// readMigrationState ermittelt den Stand und prüft die Prüfsummen der eingespielten
+// Migrationen. SQLite-Datenbanken aus der Zeit vor schema_migrations werden anhand
+// von PRAGMA user_version übernommen; ohne Version, aber mit Verträgen gelten sie als
+// Version 1.
+func readMigrationState(q querier, dialect Dialect) (migrationState, error) {
+	var state migrationState
+	exists, err := dialect.TableExists(q, "schema_migrations")
+	if err != nil {
+		return state, err
+	}
+	if !exists {
+		state.Baseline = true
+		if dialect.Name() != "sqlite" {
+			return state, nil
+		}
+		if err := q.QueryRow("PRAGMA user_version").Scan(&state.Version); err != nil {
+			return state, err
+		}
+		if state.Version == 0 {
+			if legacy, _ := dialect.TableExists(q, "contracts"); legacy {
+				state.Version = 1
+			}
+		}
+		if state.Version > schemaVersion {
+			return state, fmt.Errorf("die Datenbank hat Schema-Version %d, dieses Programm kennt höchstens Version %d", state.Version, schemaVersion)
+		}
+		return state, nil
+	}
+
+	rows, err := q.Query("SELECT version, name, checksum FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return state, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var name, checksum string
+		if err := rows.Scan(&version, &name, &checksum); err != nil {
+			return state, err
+		}
+		if version != state.Version+1 {
+			return state, fmt.Errorf("schema_migrations ist unvollständig: Version %d fehlt", state.Version+1)
+		}
+		if version > schemaVersion {
+			return state, fmt.Errorf("die Datenbank hat Schema-Version %d (%s), dieses Programm kennt höchstens Version %d", version, name, schemaVersion)
+		}
+		if m := dbMigrations(dialect)[version-1]; checksum != m.Checksum {
+			return state, fmt.Errorf("Migration %d (%s) wurde nach dem Einspielen geändert, die Prüfsumme weicht ab", version, m.Name)
+		}
+		state.Version = version
+	}
+	return state, rows.Err()
+}
+
+// migrationStep ist eine auszuführende Migration, mit Reverse rückwärts.
+type migrationStep struct {
+	migration
+	Reverse bool
+}
+
+func (s migrationStep) String() string {
+	if s.Reverse {
+		return fmt.Sprintf("%d %s (zurück)", s.Version, s.Name)
+	}
+	return fmt.Sprintf("%d %s", s.Version, s.Name)
+}
+
+// migrationPlan liefert die Schritte von Version from nach target.
+func migrationPlan(dialect Dialect, from, target int) []migrationStep {
+	migrations := dbMigrations(dialect)
+	var steps []migrationStep
+	for v := from + 1; v <= target; v++ {
+		steps = append(steps, migrationStep{migrations[v-1], false})
+	}
+	for v := from; v > target; v-- {
+		steps = append(steps, migrationStep{migrations[v-1], true})
+	}
+	return steps
+}
+
+// migrateDB bringt die Datenbank auf die Schema-Version target, vorwärts oder rückwärts.
+// Vor dem ersten Schritt wird eine bestehende SQLite-Datenbank gesichert; PostgreSQL
+// sichert der Betrieb der Datenbank. Alle Schritte laufen in einer Transaktion:
+// Schlägt einer fehl, bleibt die Datenbank unverändert.
+func migrateDB(db *DB, target int) error {
+	state, err := readMigrationState(db, db.Dialect)
+	if err != nil {
+		return err
+	}
+	steps := migrationPlan(db.Dialect, state.Version, target)
+	if len(steps) == 0 && !state.Baseline {
+		return nil
+	}
+
+	if db.Dialect.Name() == "sqlite" && state.Version > 0 && len(steps) > 0 {
+		path, err := backupBeforeMigration(db, state.Version)
+		if err != nil {
+			return fmt.Errorf("Sicherung vor der Migration fehlgeschlagen: %w", err)
+		}
+		log.Printf("Datenbank vor der Migration gesichert: %s", path)
+	}
+
+	var tx *Tx
+	if db.Dialect.Name() == "sqlite" {
+		// Migrationen bauen Tabellen mit DROP und RENAME neu auf, das scheitert an
+		// geprüften Fremdschlüsseln. Abschalten lassen sie sich nur außerhalb einer
+		// Transaktion, daher auf einer eigenen Verbindung.
+		ctx := context.Background()
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+			return err
+		}
+		defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+		sqlTx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		tx = &Tx{sqlTx, db.Dialect}
+	} else if tx, err = db.Begin(); err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if db.Dialect.Name() == "postgres" {
+		// Startet eine zweite Instanz gleichzeitig, wartet sie hier und findet danach
+		// den neuen Stand vor
+		if _, err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockID); err != nil {
+			return err
+		}
+		if state, err = readMigrationState(tx, db.Dialect); err != nil {
+			return err
+		}
+		steps = migrationPlan(db.Dialect, state.Version, target)
+		if len(steps) == 0 && !state.Baseline {
+			return nil
+		}
+	}
+
+	if _, err := tx.Exec(migrationTableSchema); err != nil {
+		return err
+	}
+	now := time.Now()
+	if state.Baseline {
+		for _, m := range dbMigrations(db.Dialect)[:state.Version] {
+			if _, err := tx.Exec("INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+				m.Version, m.Name, m.Checksum, now); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Migrationen sind reines SQL ohne Platzhalter und gehen unverändert an den Treiber
+	for _, step := range steps {
+		if step.Reverse {
+			_, err = tx.Tx.Exec(step.Down)
+			if err == nil {
+				_, err = tx.Exec("DELETE FROM schema_migrations WHERE version = ?", step.Version)
+			}
+		} else {
+			_, err = tx.Tx.Exec(step.Up)
+			if err == nil {
+				_, err = tx.Exec("INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+					step.Version, step.Name, step.Checksum, now)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("Migration %s fehlgeschlagen, die Datenbank bleibt unverändert: %w", step, err)
+		}
+	}
+
+	if db.Dialect.Name() == "sqlite" {
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", target)); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, step := range steps {
+		log.Printf("Migration %s eingespielt", step)
+	}
+	return nil
+}
+
+// backupBeforeMigration kopiert die Datenbank mit VACUUM INTO ins Sicherungsverzeichnis.
+// Migrationen ändern nur die Datenbank, die Dateien im Speicher bleiben unberührt.
+func backupBeforeMigration(db *DB, version int) (string, error) {
+	dir := backupDir
+	if dir == "" {
+		dir = "./backups"
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("contracts-v%d-%s.db", version, time.Now().Format("20060102-150405")))
+	if _, err := os.Stat(path); err == nil {
+		return "", errors.New(path + " existiert bereits")
+	}
+	if _, err := db.Exec("VACUUM INTO ?", path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
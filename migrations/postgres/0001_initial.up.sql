@@ -0,0 +1,34 @@
+-- Ausgangsschema: Benutzer, Verträge und Dokumente
+CREATE TABLE users (
+	id SERIAL PRIMARY KEY,
+	username TEXT UNIQUE NOT NULL,
+	password TEXT NOT NULL,
+	role TEXT NOT NULL CHECK(role IN ('admin', 'viewer'))
+);
+
+CREATE TABLE contracts (
+	id SERIAL PRIMARY KEY,
+	contract_number TEXT UNIQUE NOT NULL,
+	title TEXT NOT NULL,
+	content TEXT,
+	conditions TEXT,
+	notice_period TEXT,
+	minimum_term TEXT,
+	valid_from TIMESTAMPTZ NOT NULL,
+	valid_until TIMESTAMPTZ,
+	partner TEXT NOT NULL,
+	category TEXT NOT NULL,
+	contract_type TEXT NOT NULL CHECK(contract_type IN ('framework', 'individual')),
+	framework_contract_id INTEGER REFERENCES contracts(id),
+	is_terminated BOOLEAN DEFAULT FALSE,
+	terminated_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE documents (
+	id SERIAL PRIMARY KEY,
+	contract_id INTEGER NOT NULL REFERENCES contracts(id),
+	filename TEXT NOT NULL,
+	file_path TEXT NOT NULL,
+	uploaded_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,4 @@
+ALTER TABLE contracts ALTER COLUMN notice_period TYPE TEXT
+	USING CASE WHEN notice_period IS NULL THEN NULL ELSE notice_period || ' Monate' END;
+ALTER TABLE contracts ALTER COLUMN minimum_term TYPE TEXT
+	USING to_char(minimum_term, 'YYYY-MM-DD');
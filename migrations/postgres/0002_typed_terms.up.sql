@@ -0,0 +1,16 @@
+-- notice_period: TEXT -> INTEGER (Monate), führende Zahl wird übernommen ("3 Monate" -> 3).
+-- minimum_term: TEXT -> DATE. Werte im Format JJJJ-MM-TT oder TT.MM.JJJJ werden
+-- übernommen; andere Angaben bleiben unter den Konditionen erhalten.
+ALTER TABLE contracts ALTER COLUMN notice_period TYPE INTEGER
+	USING NULLIF(CAST(substring(TRIM(notice_period) FROM '^[0-9]+') AS INTEGER), 0);
+
+UPDATE contracts
+SET conditions = COALESCE(conditions || chr(10) || chr(10), '') || 'Mindestlaufzeit: ' || TRIM(minimum_term)
+WHERE TRIM(COALESCE(minimum_term, '')) != ''
+	AND TRIM(minimum_term) !~ '^([0-9]{4}-[0-9]{2}-[0-9]{2}|[0-9]{2}\.[0-9]{2}\.[0-9]{4})$';
+
+ALTER TABLE contracts ALTER COLUMN minimum_term TYPE DATE
+	USING CASE
+		WHEN TRIM(minimum_term) ~ '^[0-9]{4}-[0-9]{2}-[0-9]{2}$' THEN to_date(TRIM(minimum_term), 'YYYY-MM-DD')
+		WHEN TRIM(minimum_term) ~ '^[0-9]{2}\.[0-9]{2}\.[0-9]{4}$' THEN to_date(TRIM(minimum_term), 'DD.MM.YYYY')
+	END;
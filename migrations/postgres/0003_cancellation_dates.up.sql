@@ -0,0 +1,4 @@
+-- Laufzeit sowie berechneter Kündigungstermin und Kündigungsvornahme
+ALTER TABLE contracts ADD COLUMN term_months INTEGER;
+ALTER TABLE contracts ADD COLUMN cancellation_date DATE;
+ALTER TABLE contracts ADD COLUMN cancellation_action_date DATE;
@@ -0,0 +1,12 @@
+-- Kategorien als eigene Tabelle, mit den bisher fest vorgegebenen und allen in
+-- Verträgen verwendeten Werten
+CREATE TABLE categories (
+	id SERIAL PRIMARY KEY,
+	name TEXT UNIQUE NOT NULL
+);
+
+INSERT INTO categories (name) VALUES ('IT'), ('Gebäude'), ('Versicherungen');
+
+INSERT INTO categories (name)
+SELECT DISTINCT category FROM contracts WHERE category != ''
+ON CONFLICT DO NOTHING;
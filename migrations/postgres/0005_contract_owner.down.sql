@@ -0,0 +1 @@
+ALTER TABLE contracts DROP COLUMN owner_id;
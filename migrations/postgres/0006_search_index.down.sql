@@ -0,0 +1,9 @@
+DROP TRIGGER documents_fts_aiud ON documents;
+DROP TRIGGER contracts_fts_au ON contracts;
+DROP TRIGGER contracts_fts_aid ON contracts;
+DROP FUNCTION contracts_fts_document_changed();
+DROP FUNCTION contracts_fts_contract_changed();
+DROP FUNCTION contracts_fts_refresh(INTEGER);
+DROP FUNCTION contracts_fts_normalize(TEXT);
+DROP TABLE contracts_fts;
+ALTER TABLE documents DROP COLUMN extracted_text;
@@ -0,0 +1,67 @@
+-- Extrahierter Dokumenttext und Suchindex über Vertragsfelder und Dokumenttexte.
+-- Umlaute und Akzente werden wie bei SQLite (remove_diacritics) entfernt.
+ALTER TABLE documents ADD COLUMN extracted_text TEXT;
+
+CREATE TABLE contracts_fts (
+	contract_id INTEGER PRIMARY KEY,
+	documents TEXT,
+	search TSVECTOR NOT NULL
+);
+
+CREATE INDEX idx_contracts_fts_search ON contracts_fts USING GIN (search);
+
+CREATE FUNCTION contracts_fts_normalize(t TEXT) RETURNS TEXT AS $$
+	SELECT translate(lower(COALESCE(t, '')), 'äöüàáâèéêìíîòóôùúû', 'aouaaaeeeiiiooouuu')
+$$ LANGUAGE sql IMMUTABLE;
+
+-- Gewichte: A Nummer und Titel, B Partner, C Kategorie, D Inhalt, Konditionen und Dokumente
+CREATE FUNCTION contracts_fts_refresh(cid INTEGER) RETURNS void AS $$
+	DELETE FROM contracts_fts WHERE contract_id = cid;
+	INSERT INTO contracts_fts (contract_id, documents, search)
+	SELECT c.id, d.text,
+		setweight(to_tsvector('simple', contracts_fts_normalize(c.contract_number || ' ' || c.title)), 'A') ||
+		setweight(to_tsvector('simple', contracts_fts_normalize(c.partner)), 'B') ||
+		setweight(to_tsvector('simple', contracts_fts_normalize(c.category)), 'C') ||
+		setweight(to_tsvector('simple', contracts_fts_normalize(
+			concat_ws(' ', c.content, c.conditions, d.text))), 'D')
+	FROM contracts c
+	LEFT JOIN LATERAL (
+		SELECT string_agg(extracted_text, chr(10) ORDER BY id) AS text FROM documents WHERE contract_id = c.id
+	) d ON TRUE
+	WHERE c.id = cid;
+$$ LANGUAGE sql;
+
+CREATE FUNCTION contracts_fts_contract_changed() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		DELETE FROM contracts_fts WHERE contract_id = OLD.id;
+	ELSE
+		PERFORM contracts_fts_refresh(NEW.id);
+	END IF;
+	RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION contracts_fts_document_changed() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP IN ('UPDATE', 'DELETE') THEN
+		PERFORM contracts_fts_refresh(OLD.contract_id);
+	END IF;
+	IF TG_OP IN ('INSERT', 'UPDATE') AND (TG_OP = 'INSERT' OR NEW.contract_id != OLD.contract_id) THEN
+		PERFORM contracts_fts_refresh(NEW.contract_id);
+	END IF;
+	RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER contracts_fts_aid AFTER INSERT OR DELETE ON contracts
+	FOR EACH ROW EXECUTE FUNCTION contracts_fts_contract_changed();
+
+CREATE TRIGGER contracts_fts_au
+	AFTER UPDATE OF contract_number, title, partner, category, content, conditions ON contracts
+	FOR EACH ROW EXECUTE FUNCTION contracts_fts_contract_changed();
+
+CREATE TRIGGER documents_fts_aiud AFTER INSERT OR DELETE OR UPDATE OF extracted_text, contract_id ON documents
+	FOR EACH ROW EXECUTE FUNCTION contracts_fts_document_changed();
+
+SELECT contracts_fts_refresh(id) FROM contracts;
@@ -0,0 +1,3 @@
+-- Status der Textextraktion; bestehende Dokumente werden beim nächsten Start extrahiert
+ALTER TABLE documents ADD COLUMN extraction_status TEXT NOT NULL DEFAULT 'pending';
+ALTER TABLE documents ADD COLUMN extraction_error TEXT;
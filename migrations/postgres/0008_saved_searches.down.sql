@@ -0,0 +1,4 @@
+DROP TABLE dashboard_widgets;
+DROP TABLE saved_search_shares;
+DROP TABLE saved_searches;
+ALTER TABLE contracts DROP COLUMN annual_cost;
@@ -0,0 +1,33 @@
+-- Berichtsabonnements und Versandläufe
+CREATE TABLE report_subscriptions (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	name TEXT NOT NULL,
+	report TEXT NOT NULL,
+	params TEXT NOT NULL DEFAULT '{}',
+	format TEXT NOT NULL DEFAULT 'pdf',
+	delivery TEXT NOT NULL DEFAULT 'attachment',
+	recipients TEXT NOT NULL,
+	schedule TEXT NOT NULL,
+	enabled BOOLEAN NOT NULL DEFAULT TRUE,
+	next_run_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE report_runs (
+	id SERIAL PRIMARY KEY,
+	subscription_id INTEGER NOT NULL REFERENCES report_subscriptions(id),
+	scheduled_for TIMESTAMPTZ NOT NULL,
+	manual BOOLEAN NOT NULL DEFAULT FALSE,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMPTZ,
+	started_at TIMESTAMPTZ,
+	finished_at TIMESTAMPTZ,
+	error TEXT,
+	filename TEXT,
+	size BIGINT
+);
+
+CREATE INDEX idx_report_runs_subscription ON report_runs (subscription_id, id);
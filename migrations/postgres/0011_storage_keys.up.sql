@@ -0,0 +1,5 @@
+-- file_path wird zum Schlüssel im Dokumentenspeicher. Bisherige Pfade unter uploads/
+-- werden relativ zum lokalen Speicherverzeichnis.
+ALTER TABLE documents RENAME COLUMN file_path TO storage_key;
+UPDATE documents SET storage_key = substr(storage_key, 9) WHERE substr(storage_key, 1, 8) = 'uploads/';
+UPDATE documents SET storage_key = substr(storage_key, 11) WHERE substr(storage_key, 1, 10) = './uploads/';
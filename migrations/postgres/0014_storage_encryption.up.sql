@@ -0,0 +1,8 @@
+-- Verschlüsselte Datenschlüssel je gespeicherter Datei
+CREATE TABLE storage_encryption (
+	storage_key TEXT PRIMARY KEY,
+	key_id TEXT NOT NULL,
+	wrapped_key BYTEA NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	rotated_at TIMESTAMPTZ
+);
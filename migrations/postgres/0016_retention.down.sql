@@ -0,0 +1,5 @@
+DROP TABLE audit_log;
+DROP TABLE retention_candidates;
+DROP TABLE retention_rules;
+ALTER TABLE contracts DROP COLUMN legal_hold_reason;
+ALTER TABLE contracts DROP COLUMN legal_hold;
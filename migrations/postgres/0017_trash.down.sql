@@ -0,0 +1,4 @@
+ALTER TABLE categories DROP COLUMN deleted_by;
+ALTER TABLE categories DROP COLUMN deleted_at;
+ALTER TABLE contracts DROP COLUMN deleted_by;
+ALTER TABLE contracts DROP COLUMN deleted_at;
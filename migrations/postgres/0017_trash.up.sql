@@ -0,0 +1,5 @@
+-- Papierkorb für Verträge und Kategorien
+ALTER TABLE contracts ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE contracts ADD COLUMN deleted_by INTEGER REFERENCES users(id);
+ALTER TABLE categories ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE categories ADD COLUMN deleted_by INTEGER REFERENCES users(id);
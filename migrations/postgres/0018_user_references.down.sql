@@ -0,0 +1,20 @@
+ALTER TABLE audit_log DROP CONSTRAINT audit_log_user_id_fkey,
+	ADD CONSTRAINT audit_log_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+ALTER TABLE retention_candidates DROP CONSTRAINT retention_candidates_decided_by_fkey,
+	ADD CONSTRAINT retention_candidates_decided_by_fkey FOREIGN KEY (decided_by) REFERENCES users(id);
+ALTER TABLE quarantined_uploads DROP CONSTRAINT quarantined_uploads_uploaded_by_fkey,
+	ADD CONSTRAINT quarantined_uploads_uploaded_by_fkey FOREIGN KEY (uploaded_by) REFERENCES users(id);
+ALTER TABLE document_versions DROP CONSTRAINT document_versions_uploaded_by_fkey,
+	ADD CONSTRAINT document_versions_uploaded_by_fkey FOREIGN KEY (uploaded_by) REFERENCES users(id);
+ALTER TABLE documents DROP CONSTRAINT documents_deleted_by_fkey,
+	ADD CONSTRAINT documents_deleted_by_fkey FOREIGN KEY (deleted_by) REFERENCES users(id);
+ALTER TABLE documents DROP CONSTRAINT documents_uploaded_by_fkey,
+	ADD CONSTRAINT documents_uploaded_by_fkey FOREIGN KEY (uploaded_by) REFERENCES users(id);
+ALTER TABLE categories DROP CONSTRAINT categories_deleted_by_fkey,
+	ADD CONSTRAINT categories_deleted_by_fkey FOREIGN KEY (deleted_by) REFERENCES users(id);
+ALTER TABLE contracts DROP CONSTRAINT contracts_deleted_by_fkey,
+	ADD CONSTRAINT contracts_deleted_by_fkey FOREIGN KEY (deleted_by) REFERENCES users(id);
+ALTER TABLE contracts DROP CONSTRAINT contracts_owner_id_fkey,
+	ADD CONSTRAINT contracts_owner_id_fkey FOREIGN KEY (owner_id) REFERENCES users(id);
+
+ALTER TABLE audit_log DROP COLUMN user_name;
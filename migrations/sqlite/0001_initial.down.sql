@@ -0,0 +1,3 @@
+DROP TABLE documents;
+DROP TABLE contracts;
+DROP TABLE users;
@@ -0,0 +1,36 @@
+-- Ausgangsschema: Benutzer, Verträge und Dokumente
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT UNIQUE NOT NULL,
+	password TEXT NOT NULL,
+	role TEXT NOT NULL CHECK(role IN ('admin', 'viewer'))
+);
+
+CREATE TABLE contracts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	contract_number TEXT UNIQUE NOT NULL,
+	title TEXT NOT NULL,
+	content TEXT,
+	conditions TEXT,
+	notice_period TEXT,
+	minimum_term TEXT,
+	valid_from DATETIME NOT NULL,
+	valid_until DATETIME,
+	partner TEXT NOT NULL,
+	category TEXT NOT NULL,
+	contract_type TEXT NOT NULL CHECK(contract_type IN ('framework', 'individual')),
+	framework_contract_id INTEGER,
+	is_terminated BOOLEAN DEFAULT 0,
+	terminated_at DATETIME,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (framework_contract_id) REFERENCES contracts(id)
+);
+
+CREATE TABLE documents (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	contract_id INTEGER NOT NULL,
+	filename TEXT NOT NULL,
+	file_path TEXT NOT NULL,
+	uploaded_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (contract_id) REFERENCES contracts(id)
+);
@@ -0,0 +1,36 @@
+CREATE TABLE contracts_v1 (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	contract_number TEXT UNIQUE NOT NULL,
+	title TEXT NOT NULL,
+	content TEXT,
+	conditions TEXT,
+	notice_period TEXT,
+	minimum_term TEXT,
+	valid_from DATETIME NOT NULL,
+	valid_until DATETIME,
+	partner TEXT NOT NULL,
+	category TEXT NOT NULL,
+	contract_type TEXT NOT NULL CHECK(contract_type IN ('framework', 'individual')),
+	framework_contract_id INTEGER,
+	is_terminated BOOLEAN DEFAULT 0,
+	terminated_at DATETIME,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (framework_contract_id) REFERENCES contracts_v1(id)
+);
+
+INSERT INTO contracts_v1
+	(id, contract_number, title, content, conditions,
+	 notice_period, minimum_term, valid_from, valid_until,
+	 partner, category, contract_type, framework_contract_id,
+	 is_terminated, terminated_at, created_at)
+SELECT
+	id, contract_number, title, content, conditions,
+	CASE WHEN notice_period IS NULL THEN NULL ELSE notice_period || ' Monate' END,
+	date(minimum_term),
+	valid_from, valid_until,
+	partner, category, contract_type, framework_contract_id,
+	is_terminated, terminated_at, created_at
+FROM contracts;
+
+DROP TABLE contracts;
+ALTER TABLE contracts_v1 RENAME TO contracts;
@@ -0,0 +1,50 @@
+-- notice_period: TEXT -> INTEGER (Monate), führende Zahl wird übernommen ("3 Monate" -> 3).
+-- minimum_term: TEXT -> DATE. Werte im Format JJJJ-MM-TT oder TT.MM.JJJJ werden
+-- übernommen; andere Angaben bleiben unter den Konditionen erhalten.
+CREATE TABLE contracts_v2 (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	contract_number TEXT UNIQUE NOT NULL,
+	title TEXT NOT NULL,
+	content TEXT,
+	conditions TEXT,
+	notice_period INTEGER,
+	minimum_term DATE,
+	valid_from DATETIME NOT NULL,
+	valid_until DATETIME,
+	partner TEXT NOT NULL,
+	category TEXT NOT NULL,
+	contract_type TEXT NOT NULL CHECK(contract_type IN ('framework', 'individual')),
+	framework_contract_id INTEGER,
+	is_terminated BOOLEAN DEFAULT 0,
+	terminated_at DATETIME,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (framework_contract_id) REFERENCES contracts_v2(id)
+);
+
+INSERT INTO contracts_v2
+	(id, contract_number, title, content, conditions,
+	 notice_period, minimum_term, valid_from, valid_until,
+	 partner, category, contract_type, framework_contract_id,
+	 is_terminated, terminated_at, created_at)
+SELECT
+	id, contract_number, title, content,
+	CASE WHEN term IS NULL AND TRIM(COALESCE(minimum_term, '')) != ''
+		THEN COALESCE(conditions || char(10) || char(10), '') || 'Mindestlaufzeit: ' || TRIM(minimum_term)
+		ELSE conditions END,
+	NULLIF(CAST(notice_period AS INTEGER), 0),
+	term,
+	valid_from, valid_until,
+	partner, category, contract_type, framework_contract_id,
+	is_terminated, terminated_at, created_at
+FROM (
+	SELECT *, COALESCE(
+		date(TRIM(minimum_term)),
+		CASE WHEN TRIM(minimum_term) GLOB '[0-9][0-9].[0-9][0-9].[0-9][0-9][0-9][0-9]'
+			THEN date(substr(TRIM(minimum_term), 7, 4) || '-' || substr(TRIM(minimum_term), 4, 2) || '-' || substr(TRIM(minimum_term), 1, 2))
+		END
+	) AS term
+	FROM contracts
+);
+
+DROP TABLE contracts;
+ALTER TABLE contracts_v2 RENAME TO contracts;
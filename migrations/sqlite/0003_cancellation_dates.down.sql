@@ -0,0 +1,3 @@
+ALTER TABLE contracts DROP COLUMN cancellation_action_date;
+ALTER TABLE contracts DROP COLUMN cancellation_date;
+ALTER TABLE contracts DROP COLUMN term_months;
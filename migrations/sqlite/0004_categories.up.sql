@@ -0,0 +1,11 @@
+-- Kategorien als eigene Tabelle, mit den bisher fest vorgegebenen und allen in
+-- Verträgen verwendeten Werten
+CREATE TABLE categories (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT UNIQUE NOT NULL
+);
+
+INSERT INTO categories (name) VALUES ('IT'), ('Gebäude'), ('Versicherungen');
+
+INSERT OR IGNORE INTO categories (name)
+SELECT DISTINCT category FROM contracts WHERE category != '';
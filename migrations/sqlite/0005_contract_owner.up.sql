@@ -0,0 +1,2 @@
+-- Verantwortlicher Benutzer je Vertrag
+ALTER TABLE contracts ADD COLUMN owner_id INTEGER REFERENCES users(id);
@@ -0,0 +1,8 @@
+DROP TRIGGER documents_fts_ad;
+DROP TRIGGER documents_fts_au;
+DROP TRIGGER documents_fts_ai;
+DROP TRIGGER contracts_fts_ad;
+DROP TRIGGER contracts_fts_au;
+DROP TRIGGER contracts_fts_ai;
+DROP TABLE contracts_fts;
+ALTER TABLE documents DROP COLUMN extracted_text;
@@ -0,0 +1,52 @@
+-- Extrahierter Dokumenttext und FTS5-Index über Vertragsfelder und Dokumenttexte
+ALTER TABLE documents ADD COLUMN extracted_text TEXT;
+
+CREATE VIRTUAL TABLE contracts_fts USING fts5(
+	contract_number, title, partner, category, content, conditions, documents,
+	tokenize = 'unicode61 remove_diacritics 2',
+	prefix = '2 3'
+);
+
+CREATE TRIGGER contracts_fts_ai AFTER INSERT ON contracts BEGIN
+	INSERT INTO contracts_fts (rowid, contract_number, title, partner, category, content, conditions, documents)
+	VALUES (new.id, new.contract_number, new.title, new.partner, new.category, new.content, new.conditions,
+		(SELECT group_concat(extracted_text, char(10)) FROM documents WHERE contract_id = new.id));
+END;
+
+CREATE TRIGGER contracts_fts_au
+AFTER UPDATE OF contract_number, title, partner, category, content, conditions ON contracts BEGIN
+	DELETE FROM contracts_fts WHERE rowid = old.id;
+	INSERT INTO contracts_fts (rowid, contract_number, title, partner, category, content, conditions, documents)
+	VALUES (new.id, new.contract_number, new.title, new.partner, new.category, new.content, new.conditions,
+		(SELECT group_concat(extracted_text, char(10)) FROM documents WHERE contract_id = new.id));
+END;
+
+CREATE TRIGGER contracts_fts_ad AFTER DELETE ON contracts BEGIN
+	DELETE FROM contracts_fts WHERE rowid = old.id;
+END;
+
+CREATE TRIGGER documents_fts_ai AFTER INSERT ON documents BEGIN
+	UPDATE contracts_fts
+	SET documents = (SELECT group_concat(extracted_text, char(10)) FROM documents WHERE contract_id = new.contract_id)
+	WHERE rowid = new.contract_id;
+END;
+
+CREATE TRIGGER documents_fts_au AFTER UPDATE OF extracted_text, contract_id ON documents BEGIN
+	UPDATE contracts_fts
+	SET documents = (SELECT group_concat(extracted_text, char(10)) FROM documents WHERE contract_id = old.contract_id)
+	WHERE rowid = old.contract_id;
+	UPDATE contracts_fts
+	SET documents = (SELECT group_concat(extracted_text, char(10)) FROM documents WHERE contract_id = new.contract_id)
+	WHERE rowid = new.contract_id;
+END;
+
+CREATE TRIGGER documents_fts_ad AFTER DELETE ON documents BEGIN
+	UPDATE contracts_fts
+	SET documents = (SELECT group_concat(extracted_text, char(10)) FROM documents WHERE contract_id = old.contract_id)
+	WHERE rowid = old.contract_id;
+END;
+
+INSERT INTO contracts_fts (rowid, contract_number, title, partner, category, content, conditions, documents)
+SELECT c.id, c.contract_number, c.title, c.partner, c.category, c.content, c.conditions,
+	(SELECT group_concat(d.extracted_text, char(10)) FROM documents d WHERE d.contract_id = c.id)
+FROM contracts c;
@@ -0,0 +1,2 @@
+ALTER TABLE documents DROP COLUMN extraction_error;
+ALTER TABLE documents DROP COLUMN extraction_status;
@@ -0,0 +1,30 @@
+-- Jährliche Kosten, gespeicherte Suchen und Dashboards
+ALTER TABLE contracts ADD COLUMN annual_cost REAL;
+
+CREATE TABLE saved_searches (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	name TEXT NOT NULL,
+	params TEXT NOT NULL DEFAULT '{}',
+	sort TEXT NOT NULL DEFAULT '',
+	columns TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (user_id, name)
+);
+
+CREATE TABLE saved_search_shares (
+	saved_search_id INTEGER NOT NULL REFERENCES saved_searches(id),
+	user_id INTEGER REFERENCES users(id),
+	role TEXT CHECK(role IN ('admin', 'viewer')),
+	CHECK ((user_id IS NULL) != (role IS NULL))
+);
+
+CREATE TABLE dashboard_widgets (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	type TEXT NOT NULL,
+	title TEXT NOT NULL DEFAULT '',
+	config TEXT NOT NULL DEFAULT '{}',
+	position INTEGER NOT NULL DEFAULT 0
+);
@@ -0,0 +1,33 @@
+-- Berichtsabonnements und Versandläufe
+CREATE TABLE report_subscriptions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	name TEXT NOT NULL,
+	report TEXT NOT NULL,
+	params TEXT NOT NULL DEFAULT '{}',
+	format TEXT NOT NULL DEFAULT 'pdf',
+	delivery TEXT NOT NULL DEFAULT 'attachment',
+	recipients TEXT NOT NULL,
+	schedule TEXT NOT NULL,
+	enabled BOOLEAN NOT NULL DEFAULT 1,
+	next_run_at DATETIME,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE report_runs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	subscription_id INTEGER NOT NULL REFERENCES report_subscriptions(id),
+	scheduled_for DATETIME NOT NULL,
+	manual BOOLEAN NOT NULL DEFAULT 0,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at DATETIME,
+	started_at DATETIME,
+	finished_at DATETIME,
+	error TEXT,
+	filename TEXT,
+	size INTEGER
+);
+
+CREATE INDEX idx_report_runs_subscription ON report_runs (subscription_id, id);
@@ -0,0 +1,3 @@
+DROP TABLE webhook_deadline_notices;
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
@@ -0,0 +1,39 @@
+-- Webhooks, Zustellprotokoll und gemeldete Kündigungsfristen
+CREATE TABLE webhooks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	events TEXT NOT NULL DEFAULT '[]',
+	categories TEXT NOT NULL DEFAULT '[]',
+	deadline_days INTEGER NOT NULL DEFAULT 90,
+	enabled BOOLEAN NOT NULL DEFAULT 1,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE webhook_deliveries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	webhook_id INTEGER NOT NULL REFERENCES webhooks(id),
+	event_id TEXT NOT NULL,
+	event TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at DATETIME,
+	response_code INTEGER,
+	response_body TEXT,
+	error TEXT,
+	duration_ms INTEGER,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	delivered_at DATETIME
+);
+
+CREATE INDEX idx_webhook_deliveries_webhook ON webhook_deliveries (webhook_id, id);
+
+CREATE TABLE webhook_deadline_notices (
+	webhook_id INTEGER NOT NULL REFERENCES webhooks(id),
+	contract_id INTEGER NOT NULL REFERENCES contracts(id),
+	action_date TEXT NOT NULL,
+	PRIMARY KEY (webhook_id, contract_id, action_date)
+);
@@ -0,0 +1,3 @@
+-- Gilt nur für den lokalen Speicher im Standardverzeichnis uploads/
+UPDATE documents SET storage_key = 'uploads/' || storage_key;
+ALTER TABLE documents RENAME COLUMN storage_key TO file_path;
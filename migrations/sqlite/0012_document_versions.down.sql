@@ -0,0 +1,11 @@
+-- Der Stand der Dokumente bleibt erhalten, frühere Versionen entfallen
+DROP TABLE document_versions;
+ALTER TABLE documents DROP COLUMN deleted_by;
+ALTER TABLE documents DROP COLUMN deleted_at;
+ALTER TABLE documents DROP COLUMN version;
+ALTER TABLE documents DROP COLUMN sha256;
+ALTER TABLE documents DROP COLUMN mime_type;
+ALTER TABLE documents DROP COLUMN file_size;
+ALTER TABLE documents DROP COLUMN uploaded_by;
+ALTER TABLE documents DROP COLUMN description;
+ALTER TABLE documents DROP COLUMN document_type;
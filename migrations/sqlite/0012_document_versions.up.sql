@@ -0,0 +1,29 @@
+-- Metadaten, Versionen und vorläufiges Löschen von Dokumenten. Bestehende Dokumente
+-- werden zu Version 1; Größe und Hash ergänzt backfillDocumentMetadata beim Start.
+ALTER TABLE documents ADD COLUMN document_type TEXT NOT NULL DEFAULT 'contract'
+	CHECK(document_type IN ('contract', 'amendment', 'invoice', 'correspondence', 'termination'));
+ALTER TABLE documents ADD COLUMN description TEXT;
+ALTER TABLE documents ADD COLUMN uploaded_by INTEGER REFERENCES users(id);
+ALTER TABLE documents ADD COLUMN file_size INTEGER;
+ALTER TABLE documents ADD COLUMN mime_type TEXT;
+ALTER TABLE documents ADD COLUMN sha256 TEXT;
+ALTER TABLE documents ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE documents ADD COLUMN deleted_at DATETIME;
+ALTER TABLE documents ADD COLUMN deleted_by INTEGER REFERENCES users(id);
+
+CREATE TABLE document_versions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	document_id INTEGER NOT NULL REFERENCES documents(id),
+	version INTEGER NOT NULL,
+	filename TEXT NOT NULL,
+	storage_key TEXT NOT NULL,
+	file_size INTEGER,
+	mime_type TEXT,
+	sha256 TEXT,
+	uploaded_by INTEGER REFERENCES users(id),
+	uploaded_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (document_id, version)
+);
+
+INSERT INTO document_versions (document_id, version, filename, storage_key, uploaded_at)
+SELECT id, 1, filename, storage_key, uploaded_at FROM documents;
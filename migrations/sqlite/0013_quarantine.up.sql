@@ -0,0 +1,14 @@
+-- Quarantäne für Uploads, in denen der Virenscanner etwas gefunden hat
+CREATE TABLE quarantined_uploads (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	contract_id INTEGER REFERENCES contracts(id),
+	document_id INTEGER REFERENCES documents(id),
+	filename TEXT NOT NULL,
+	storage_key TEXT NOT NULL,
+	file_size INTEGER NOT NULL,
+	mime_type TEXT NOT NULL,
+	sha256 TEXT NOT NULL,
+	signature TEXT NOT NULL,
+	uploaded_by INTEGER REFERENCES users(id),
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,2 @@
+-- Verschlüsselte Dateien sind danach nicht mehr lesbar; vorher entschlüsseln
+DROP TABLE storage_encryption;
@@ -0,0 +1 @@
+ALTER TABLE document_versions DROP COLUMN thumbnail_key;
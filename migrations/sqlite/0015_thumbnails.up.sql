@@ -0,0 +1,2 @@
+-- Miniaturansichten der Dokumentversionen
+ALTER TABLE document_versions ADD COLUMN thumbnail_key TEXT;
@@ -0,0 +1,41 @@
+-- Legal Hold, Aufbewahrungsregeln, Löschvorschläge und Prüfprotokoll
+ALTER TABLE contracts ADD COLUMN legal_hold BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE contracts ADD COLUMN legal_hold_reason TEXT;
+
+CREATE TABLE retention_rules (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	category_id INTEGER NOT NULL REFERENCES categories(id),
+	document_type TEXT NOT NULL DEFAULT '',
+	years INTEGER NOT NULL CHECK(years > 0),
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (category_id, document_type)
+);
+
+CREATE TABLE retention_candidates (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	contract_id INTEGER NOT NULL REFERENCES contracts(id),
+	document_id INTEGER REFERENCES documents(id),
+	years INTEGER NOT NULL,
+	retention_start DATETIME NOT NULL,
+	due_at DATETIME NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'rejected')),
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	decided_by INTEGER REFERENCES users(id),
+	decided_at DATETIME,
+	reason TEXT
+);
+
+CREATE INDEX idx_retention_candidates_contract ON retention_candidates (contract_id);
+
+CREATE TABLE audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	event TEXT NOT NULL,
+	entity TEXT NOT NULL,
+	entity_id INTEGER,
+	user_id INTEGER REFERENCES users(id),
+	details TEXT NOT NULL DEFAULT '{}',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_audit_log_entity ON audit_log (entity, entity_id);
@@ -0,0 +1,15 @@
+-- Gelöschte Benutzer: Verweise werden NULL, das Prüfprotokoll behält den Namen.
+-- SQLite prüft Fremdschlüssel erst seit dieser Version; Verweise auf bereits
+-- gelöschte Benutzer werden bereinigt.
+ALTER TABLE audit_log ADD COLUMN user_name TEXT;
+UPDATE audit_log SET user_name = (SELECT username FROM users WHERE users.id = audit_log.user_id);
+
+UPDATE contracts SET owner_id = NULL WHERE owner_id NOT IN (SELECT id FROM users);
+UPDATE contracts SET deleted_by = NULL WHERE deleted_by NOT IN (SELECT id FROM users);
+UPDATE categories SET deleted_by = NULL WHERE deleted_by NOT IN (SELECT id FROM users);
+UPDATE documents SET uploaded_by = NULL WHERE uploaded_by NOT IN (SELECT id FROM users);
+UPDATE documents SET deleted_by = NULL WHERE deleted_by NOT IN (SELECT id FROM users);
+UPDATE document_versions SET uploaded_by = NULL WHERE uploaded_by NOT IN (SELECT id FROM users);
+UPDATE quarantined_uploads SET uploaded_by = NULL WHERE uploaded_by NOT IN (SELECT id FROM users);
+UPDATE retention_candidates SET decided_by = NULL WHERE decided_by NOT IN (SELECT id FROM users);
+UPDATE audit_log SET user_id = NULL WHERE user_id NOT IN (SELECT id FROM users);
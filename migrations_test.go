@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// migrateFixture legt aus testdata/migrations/<name>.sql eine SQLite-Datenbank mit
+// älterem Schema an und startet sie wie der Server: mit Migration auf die aktuelle
+// Version und Sicherung vorab.
+func migrateFixture(t *testing.T, name string) *Repositories {
+	t.Helper()
+	fixture, err := os.ReadFile(filepath.Join("testdata", "migrations", name+".sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := openTestDB(t)
+	skipUnlessSQLite(t, legacy)
+	if _, err := legacy.Exec(string(fixture)); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	legacy.Close()
+
+	db, err := initDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return newRepositories(db)
+}
+
+// checkMigrated prüft, dass die Datenbank von version aus vollständig migriert und
+// vorher gesichert wurde.
+func checkMigrated(t *testing.T, repos *Repositories, version int) {
+	t.Helper()
+	var applied, userVersion int
+	if err := repos.db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&applied); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.db.QueryRow("PRAGMA user_version").Scan(&userVersion); err != nil {
+		t.Fatal(err)
+	}
+	if applied != schemaVersion || userVersion != schemaVersion {
+		t.Errorf("schema_migrations: %d Einträge, user_version %d, erwartet %d", applied, userVersion, schemaVersion)
+	}
+	backups, _ := filepath.Glob(filepath.Join(backupDir, fmt.Sprintf("contracts-v%d-*.db", version)))
+	if len(backups) != 1 {
+		t.Errorf("Sicherungen vor der Migration: %v", backups)
+	}
+
+	// Der bisherige Admin bleibt, der Standard-Admin kommt hinzu
+	ctx := context.Background()
+	if _, err := repos.Users.Authenticate(ctx, "chef", "geheim"); err != nil {
+		t.Errorf("Anmeldung nach der Migration: %v", err)
+	}
+	if _, err := repos.Users.GetByUsername(ctx, "admin"); err != nil {
+		t.Errorf("Standard-Admin: %v", err)
+	}
+	if _, _, err := repos.Contracts.List(ctx, "1 = 1", nil, listOptions{Sort: []string{"id"}}); err != nil {
+		t.Errorf("Verträge nach der Migration: %v", err)
+	}
+}
+
+func categoryNames(t *testing.T, repos *Repositories) string {
+	t.Helper()
+	categories, err := repos.Categories.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range categories {
+		names = append(names, c.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestMigrateFromV1(t *testing.T) {
+	repos := migrateFixture(t, "v1")
+	checkMigrated(t, repos, 1)
+	ctx := context.Background()
+
+	tests := []struct {
+		id           int
+		noticePeriod *int
+		minimumTerm  string // leer = keine
+		conditions   string
+	}{
+		{1, intPtr(3), "2024-12-31", ""},
+		{2, intPtr(1), "", "Zahlung jährlich\n\nMindestlaufzeit: bis Projektende"},
+		{3, nil, "2025-06-30", ""},
+	}
+	for _, tt := range tests {
+		c, err := repos.Contracts.Get(ctx, tt.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (c.NoticePeriod == nil) != (tt.noticePeriod == nil) || (c.NoticePeriod != nil && *c.NoticePeriod != *tt.noticePeriod) {
+			t.Errorf("Vertrag %d: Kündigungsfrist %v, erwartet %v", tt.id, c.NoticePeriod, tt.noticePeriod)
+		}
+		var minimumTerm string
+		if c.MinimumTerm != nil {
+			minimumTerm = c.MinimumTerm.Format("2006-01-02")
+		}
+		if minimumTerm != tt.minimumTerm {
+			t.Errorf("Vertrag %d: Mindestlaufzeit %q, erwartet %q", tt.id, minimumTerm, tt.minimumTerm)
+		}
+		if c.Conditions != tt.conditions {
+			t.Errorf("Vertrag %d: Konditionen %q, erwartet %q", tt.id, c.Conditions, tt.conditions)
+		}
+		if c.TermMonths != nil || c.CancellationDate != nil || c.LegalHold {
+			t.Errorf("Vertrag %d: neue Felder vorbelegt: %+v", tt.id, c)
+		}
+	}
+	if c, _ := repos.Contracts.Get(ctx, 2); c.FrameworkContractID == nil || *c.FrameworkContractID != 1 {
+		t.Errorf("Rahmenvertrag von Vertrag 2: %v", c.FrameworkContractID)
+	}
+
+	if got := categoryNames(t, repos); got != "Gebäude,IT,Telefonie,Versicherungen" {
+		t.Errorf("Kategorien: %s", got)
+	}
+
+	// Pfade unter uploads/ werden zu Schlüsseln im Dokumentenspeicher, jedes Dokument zu Version 1
+	for id, key := range map[int]string{1: "1672531200_rahmenvertrag.pdf", 2: "1680220800_wartung.pdf"} {
+		doc, err := repos.Documents.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if doc.StorageKey != key || doc.Version != 1 || doc.DocumentType != "contract" {
+			t.Errorf("Dokument %d: %+v", id, doc)
+		}
+		versions, err := repos.Documents.Versions(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(versions) != 1 || versions[0].StorageKey != key {
+			t.Errorf("Versionen von Dokument %d: %+v", id, versions)
+		}
+	}
+}
+
+func TestMigrateFromV2(t *testing.T) {
+	repos := migrateFixture(t, "v2")
+	checkMigrated(t, repos, 2)
+
+	c, err := repos.Contracts.Get(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.NoticePeriod == nil || *c.NoticePeriod != 3 || c.MinimumTerm == nil || !c.MinimumTerm.Equal(date("2024-12-31")) {
+		t.Errorf("Vertrag 1: %+v", c)
+	}
+	c, err = repos.Contracts.Get(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.IsTerminated || c.TerminatedAt == nil || c.TerminatedAt.Format("2006-01-02") != "2023-06-30" {
+		t.Errorf("beendeter Vertrag: %+v", c)
+	}
+	if got := categoryNames(t, repos); got != "Gebäude,IT,Versicherungen" {
+		t.Errorf("Kategorien: %s", got)
+	}
+}
+
+func TestMigrateFromV3(t *testing.T) {
+	repos := migrateFixture(t, "v3")
+	checkMigrated(t, repos, 3)
+
+	// Berechnete Termine bleiben erhalten, bis sie neu berechnet werden
+	c, err := repos.Contracts.Get(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.TermMonths == nil || *c.TermMonths != 12 || c.CancellationDate == nil || !c.CancellationDate.Equal(date("2025-01-31")) ||
+		c.CancellationActionDate == nil || !c.CancellationActionDate.Equal(date("2024-10-31")) {
+		t.Errorf("Vertrag 1: %+v", c)
+	}
+	if got := categoryNames(t, repos); got != "Gebäude,IT,Leasing,Versicherungen" {
+		t.Errorf("Kategorien: %s", got)
+	}
+}
+
+func TestMigrateFromV4(t *testing.T) {
+	repos := migrateFixture(t, "v4")
+	checkMigrated(t, repos, 4)
+
+	// Auch unbenutzte Kategorien bleiben erhalten
+	if got := categoryNames(t, repos); got != "Gebäude,IT,Leasing,Marketing,Versicherungen" {
+		t.Errorf("Kategorien: %s", got)
+	}
+	doc, err := repos.Documents.Get(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.StorageKey != "1672531200_leasing.pdf" {
+		t.Errorf("Dokument: %+v", doc)
+	}
+}
+
+// TestMigrateDownUp spielt alle Migrationen einzeln zurück und wieder ein.
+func TestMigrateDownUp(t *testing.T) {
+	db := setupTestDB(t).db
+
+	for v := schemaVersion - 1; v >= 0; v-- {
+		if err := migrateDB(db, v); err != nil {
+			t.Fatalf("zurück auf Version %d: %v", v, err)
+		}
+		if state, err := readMigrationState(db, db.Dialect); err != nil || state.Version != v {
+			t.Fatalf("nach dem Zurückspielen auf %d: Version %d, %v", v, state.Version, err)
+		}
+	}
+	// Die Sicherungen vor jedem Schritt tragen die Version im Namen; für den Weg
+	// zurück ein eigenes Verzeichnis, damit sich keine Namen überschneiden
+	backupDir = t.TempDir()
+	for v := 1; v <= schemaVersion; v++ {
+		if err := migrateDB(db, v); err != nil {
+			t.Fatalf("vorwärts auf Version %d: %v", v, err)
+		}
+	}
+	if state, err := readMigrationState(db, db.Dialect); err != nil || state.Version != schemaVersion {
+		t.Fatalf("Version %d, %v", state.Version, err)
+	}
+	if _, err := newRepositories(db).Contracts.Create(context.Background(), &Contract{
+		ContractNumber: "V000001", Title: "Wartung", ValidFrom: date("2024-01-01"), Partner: "ACME", Category: "IT", ContractType: "individual",
+	}); err != nil {
+		t.Errorf("Vertrag nach erneuter Migration: %v", err)
+	}
+}
+
+func TestMigrationStateErrors(t *testing.T) {
+	tests := []struct {
+		name, sql, want string
+	}{
+		{"geänderte Migration", "UPDATE schema_migrations SET checksum = 'x' WHERE version = 3", "Prüfsumme"},
+		{"Lücke", "DELETE FROM schema_migrations WHERE version = 5", "Version 5 fehlt"},
+		{"neuere Version", fmt.Sprintf("INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (%d, 'zukunft', 'x', CURRENT_TIMESTAMP)", schemaVersion+1), "höchstens"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupTestDB(t).db
+			if _, err := db.Exec(tt.sql); err != nil {
+				t.Fatal(err)
+			}
+			err := migrateDB(db, schemaVersion)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Fehler %v, erwartet %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
@@ -0,0 +1,821 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reportConfig enthält den Firmenkopf der PDF-Berichte. Er wird über die
+// Umgebungsvariablen VERTRAGSDB_COMPANY_NAME, VERTRAGSDB_COMPANY_ADDRESS
+// (Zeilen durch "|" getrennt) und VERTRAGSDB_COMPANY_LOGO (Pfad zu PNG/JPEG) gesetzt.
+type reportConfig struct {
+	Company  string
+	Address  []string
+	LogoPath string
+}
+
+func loadReportConfig() reportConfig {
+	cfg := reportConfig{
+		Company:  os.Getenv("VERTRAGSDB_COMPANY_NAME"),
+		LogoPath: os.Getenv("VERTRAGSDB_COMPANY_LOGO"),
+	}
+	if addr := os.Getenv("VERTRAGSDB_COMPANY_ADDRESS"); addr != "" {
+		for _, line := range strings.Split(addr, "|") {
+			if line = strings.TrimSpace(line); line != "" {
+				cfg.Address = append(cfg.Address, line)
+			}
+		}
+	}
+	return cfg
+}
+
+var germanMonths = [...]string{"Januar", "Februar", "März", "April", "Mai", "Juni",
+	"Juli", "August", "September", "Oktober", "November", "Dezember"}
+
+// formatGermanDate liefert ein Datum in der Form "5. März 2024".
+func formatGermanDate(t time.Time) string {
+	return fmt.Sprintf("%d. %s %d", t.Day(), germanMonths[t.Month()-1], t.Year())
+}
+
+// formatGermanAmount liefert einen Betrag in der Form "1.234,50 €".
+func formatGermanAmount(v float64) string {
+	s := strconv.FormatFloat(math.Abs(v), 'f', 2, 64)
+	intPart, frac, _ := strings.Cut(s, ".")
+	var sb strings.Builder
+	if v < 0 {
+		sb.WriteByte('-')
+	}
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String() + "," + frac + " €"
+}
+
+// Layout der Berichte in Punkt
+const (
+	reportMargin     = 40.0
+	reportHeaderH    = 70.0 // Kopfbereich mit Logo, Firma und Titel
+	reportFooterH    = 30.0
+	reportCellPad    = 3.0
+	reportLineHeight = 1.25 // Zeilenabstand relativ zur Schriftgröße
+	reportMaxLines   = 4    // Zeilen je Tabellenzelle
+)
+
+var (
+	reportBody    = pdfStyle{Size: 9, Color: pdfBlack}
+	reportSmall   = pdfStyle{Size: 8, Color: pdfGray}
+	reportLabel   = pdfStyle{Size: 9, Color: pdfGray}
+	reportHeading = pdfStyle{Bold: true, Size: 11, Color: pdfAccent}
+	reportCell    = pdfStyle{Size: 8.5, Color: pdfBlack}
+	reportCellB   = pdfStyle{Bold: true, Size: 8.5, Color: pdfBlack}
+)
+
+// pdfColumn ist eine Tabellenspalte. Width ist ein relatives Gewicht.
+type pdfColumn struct {
+	Label string
+	Width float64
+	Right bool
+}
+
+// pdfReport setzt Berichte mit Kopf- und Fußzeile, Überschriften, Tabellen und
+// Fließtext seitenweise auf einen pdfWriter.
+type pdfReport struct {
+	*pdfWriter
+	cfg      reportConfig
+	title    string
+	subtitle string
+	created  time.Time
+	logo     int
+	y        float64
+}
+
+func newPDFReport(title, subtitle string, landscape bool) *pdfReport {
+	r := &pdfReport{
+		pdfWriter: newPDFWriter(title, landscape),
+		cfg:       loadReportConfig(),
+		title:     title,
+		subtitle:  subtitle,
+		created:   time.Now(),
+		logo:      -1,
+	}
+	if r.cfg.LogoPath != "" {
+		data, err := os.ReadFile(r.cfg.LogoPath)
+		if err == nil {
+			r.logo, err = r.addImage(data)
+		}
+		if err != nil {
+			log.Printf("Logo %s kann nicht geladen werden: %v", r.cfg.LogoPath, err)
+			r.logo = -1
+		}
+	}
+	r.newPage()
+	return r
+}
+
+func (r *pdfReport) contentWidth() float64 {
+	return r.width - 2*reportMargin
+}
+
+func (r *pdfReport) bottom() float64 {
+	return r.height - reportMargin - reportFooterH
+}
+
+// newPage beginnt eine Seite und zeichnet den Kopfbereich.
+func (r *pdfReport) newPage() {
+	r.addPage()
+	top := reportMargin
+	right := r.width - reportMargin
+
+	left := reportMargin
+	if r.logo >= 0 {
+		img := r.images[r.logo]
+		h := 36.0
+		w := h * float64(img.width) / float64(img.height)
+		if w > 140 {
+			w, h = 140, 140*float64(img.height)/float64(img.width)
+		}
+		r.drawImage(r.logo, left, top, w, h)
+		left += w + 12
+	}
+
+	// Firmenkopf rechts, höchstens drei Adresszeilen passen über die Trennlinie
+	companyStyle := pdfStyle{Bold: true, Size: 10, Color: pdfBlack}
+	address := r.cfg.Address
+	if len(address) > 3 {
+		address = address[:3]
+	}
+	companyW := pdfTextWidth(r.cfg.Company, companyStyle)
+	for _, line := range address {
+		companyW = math.Max(companyW, pdfTextWidth(line, reportSmall))
+	}
+	y := top + 8
+	if r.cfg.Company != "" {
+		r.textRight(right, y, companyStyle, r.cfg.Company)
+		y += 11
+	}
+	for _, line := range address {
+		r.textRight(right, y, reportSmall, line)
+		y += 10
+	}
+
+	titleStyle := pdfStyle{Bold: true, Size: 14, Color: pdfBlack}
+	titleW := right - left
+	if companyW > 0 {
+		titleW -= companyW + 20
+	}
+	r.text(left, top+14, titleStyle, pdfEllipsis(r.title, titleStyle, titleW))
+	if r.subtitle != "" {
+		r.text(left, top+28, reportSmall, pdfEllipsis(r.subtitle, reportSmall, titleW))
+	}
+
+	r.line(reportMargin, top+reportHeaderH-22, right, top+reportHeaderH-22, 0.8, pdfAccent)
+	r.y = top + reportHeaderH
+}
+
+// ensure beginnt eine neue Seite, wenn weniger als h Punkt Platz ist.
+func (r *pdfReport) ensure(h float64) bool {
+	if r.y+h <= r.bottom() {
+		return false
+	}
+	r.newPage()
+	return true
+}
+
+// heading gibt eine Abschnittsüberschrift aus. Sie wird nur gesetzt, wenn
+// darunter noch Platz für die ersten Zeilen des Abschnitts ist.
+func (r *pdfReport) heading(s string) {
+	r.ensure(90)
+	r.y += 6
+	r.text(reportMargin, r.y+reportHeading.Size, reportHeading, s)
+	r.y += reportHeading.Size*reportLineHeight + 6
+}
+
+func (r *pdfReport) paragraph(s string, style pdfStyle) {
+	lh := style.Size * reportLineHeight
+	for _, line := range pdfWrap(s, style, r.contentWidth()) {
+		r.ensure(lh)
+		r.text(reportMargin, r.y+style.Size, style, line)
+		r.y += lh
+	}
+	r.y += 4
+}
+
+// keyValues gibt Bezeichnung/Wert-Paare zweispaltig aus.
+func (r *pdfReport) keyValues(pairs [][2]string) {
+	labelW := 150.0
+	lh := reportBody.Size * reportLineHeight
+	for _, kv := range pairs {
+		value := kv[1]
+		if value == "" {
+			value = "–"
+		}
+		lines := pdfWrap(value, reportBody, r.contentWidth()-labelW)
+		r.ensure(float64(len(lines)) * lh)
+		r.text(reportMargin, r.y+reportBody.Size, reportLabel, kv[0])
+		for i, line := range lines {
+			r.text(reportMargin+labelW, r.y+reportBody.Size+float64(i)*lh, reportBody, line)
+		}
+		r.y += float64(len(lines))*lh + 2
+	}
+	r.y += 4
+}
+
+// table gibt eine Tabelle mit Kopfzeile aus, die auf jeder Folgeseite wiederholt wird.
+// totals wird, falls angegeben, fett als letzte Zeile ausgegeben.
+func (r *pdfReport) table(cols []pdfColumn, rows [][]string, totals []string) {
+	widths := r.columnWidths(cols, rows)
+
+	drawRow := func(cells []string, style pdfStyle, fill *pdfColor) {
+		lh := style.Size * reportLineHeight
+		wrapped := make([][]string, len(cells))
+		maxLines := 1
+		for i, cell := range cells {
+			lines := pdfWrap(cell, style, widths[i]-2*reportCellPad)
+			if len(lines) > reportMaxLines {
+				lines = lines[:reportMaxLines]
+				lines[reportMaxLines-1] = pdfEllipsis(lines[reportMaxLines-1]+"…", style, widths[i]-2*reportCellPad)
+			}
+			wrapped[i] = lines
+			if len(lines) > maxLines {
+				maxLines = len(lines)
+			}
+		}
+		h := float64(maxLines)*lh + 2*reportCellPad
+		if fill != nil {
+			r.fillRect(reportMargin, r.y, r.contentWidth(), h, *fill)
+		}
+		x := reportMargin
+		for i, lines := range wrapped {
+			for j, line := range lines {
+				y := r.y + reportCellPad + style.Size + float64(j)*lh - 1
+				if cols[i].Right {
+					r.textRight(x+widths[i]-reportCellPad, y, style, line)
+				} else {
+					r.text(x+reportCellPad, y, style, line)
+				}
+			}
+			x += widths[i]
+		}
+		r.y += h
+	}
+	rowHeight := func(cells []string, style pdfStyle) float64 {
+		maxLines := 1
+		for i, cell := range cells {
+			if n := len(pdfWrap(cell, style, widths[i]-2*reportCellPad)); n > maxLines {
+				maxLines = n
+			}
+		}
+		if maxLines > reportMaxLines {
+			maxLines = reportMaxLines
+		}
+		return float64(maxLines)*style.Size*reportLineHeight + 2*reportCellPad
+	}
+
+	header := make([]string, len(cols))
+	for i, c := range cols {
+		header[i] = c.Label
+	}
+	drawHeader := func() {
+		drawRow(header, reportCellB, &pdfLightGray)
+	}
+
+	r.ensure(rowHeight(header, reportCellB) + 30)
+	drawHeader()
+	for n, row := range rows {
+		if r.ensure(rowHeight(row, reportCell)) {
+			drawHeader()
+		}
+		var fill *pdfColor
+		if n%2 == 1 {
+			fill = &pdfColor{0.97, 0.97, 0.97}
+		}
+		drawRow(row, reportCell, fill)
+	}
+	if totals != nil {
+		if r.ensure(rowHeight(totals, reportCellB)) {
+			drawHeader()
+		}
+		r.line(reportMargin, r.y, reportMargin+r.contentWidth(), r.y, 0.6, pdfBlack)
+		drawRow(totals, reportCellB, nil)
+	}
+	r.y += 10
+}
+
+// columnWidths verteilt die Seitenbreite nach den Gewichten der Spalten. Jede Spalte
+// ist mindestens so breit wie ihr längstes Wort, damit Wörter nicht getrennt werden.
+func (r *pdfReport) columnWidths(cols []pdfColumn, rows [][]string) []float64 {
+	minimum := make([]float64, len(cols))
+	longestWord := func(i int, s string, style pdfStyle) {
+		for _, word := range strings.Fields(s) {
+			minimum[i] = math.Max(minimum[i], pdfTextWidth(word, style)+2*reportCellPad+0.5)
+		}
+	}
+	for i, c := range cols {
+		longestWord(i, c.Label, reportCellB)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			longestWord(i, cell, reportCell)
+		}
+	}
+
+	var sum, minSum float64
+	for i, c := range cols {
+		sum += c.Width
+		minSum += minimum[i]
+	}
+	widths := make([]float64, len(cols))
+	if minSum >= r.contentWidth() {
+		// Passt nicht einmal das längste Wort jeder Spalte, wird im Verhältnis der Minima gekürzt
+		for i := range cols {
+			widths[i] = minimum[i] / minSum * r.contentWidth()
+		}
+		return widths
+	}
+	// Zunächst nach Gewicht verteilen, zu schmale Spalten auf ihr Minimum setzen
+	// und den Rest erneut auf die übrigen Spalten verteilen
+	fixed := make([]bool, len(cols))
+	for {
+		available, weights := r.contentWidth(), 0.0
+		for i, c := range cols {
+			if fixed[i] {
+				available -= minimum[i]
+			} else {
+				weights += c.Width
+			}
+		}
+		changed := false
+		for i, c := range cols {
+			if fixed[i] {
+				widths[i] = minimum[i]
+				continue
+			}
+			widths[i] = c.Width / weights * available
+			if widths[i] < minimum[i] {
+				fixed[i] = true
+				changed = true
+			}
+		}
+		if !changed {
+			return widths
+		}
+	}
+}
+
+// barChart zeichnet ein horizontales Balkendiagramm.
+func (r *pdfReport) barChart(labels []string, values []float64, format func(float64) string) {
+	labelW, valueW, barH := 140.0, 80.0, 12.0
+	var max float64
+	for _, v := range values {
+		max = math.Max(max, v)
+	}
+	for i, label := range labels {
+		r.ensure(barH + 4)
+		r.text(reportMargin, r.y+barH-3, reportCell, pdfEllipsis(label, reportCell, labelW-6))
+		w := 0.0
+		if max > 0 {
+			w = values[i] / max * (r.contentWidth() - labelW - valueW)
+		}
+		r.fillRect(reportMargin+labelW, r.y, math.Max(w, 0.5), barH, pdfAccent)
+		r.text(reportMargin+labelW+w+4, r.y+barH-3, reportCell, format(values[i]))
+		r.y += barH + 4
+	}
+	r.y += 8
+}
+
+// finish ergänzt die Fußzeilen mit Seitenzahlen und schreibt das Dokument.
+func (r *pdfReport) finish(w io.Writer) error {
+	for i := range r.pages {
+		r.selectPage(i)
+		y := r.height - reportMargin - 10
+		r.line(reportMargin, y-10, r.width-reportMargin, y-10, 0.5, pdfGray)
+		r.text(reportMargin, y, reportSmall, "Erstellt am "+r.created.Format("02.01.2006 15:04"))
+		r.textRight(r.width-reportMargin, y, reportSmall, fmt.Sprintf("Seite %d von %d", i+1, len(r.pages)))
+	}
+	return r.writeTo(w)
+}
+
+// pdfEllipsis kürzt s mit "…" auf die Breite width.
+func pdfEllipsis(s string, style pdfStyle, width float64) string {
+	if pdfTextWidth(s, style) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && pdfTextWidth(string(runes)+"…", style) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
+
+// sendPDF schreibt den Bericht als Download.
+func sendPDF(w http.ResponseWriter, r *pdfReport, filename string) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	if err := r.finish(w); err != nil {
+		log.Printf("PDF %s abgebrochen: %v", filename, err)
+	}
+}
+
+// formatPDFValue formatiert einen Exportwert für die Tabellenausgabe.
+func formatPDFValue(v interface{}, kind int) string {
+	if f, ok := v.(float64); ok && kind == exportAmount {
+		return formatGermanAmount(f)
+	}
+	return formatCSVValue(v, kind)
+}
+
+// filterLabels sind die Bezeichnungen der Listenparameter im Untertitel.
+var filterLabels = map[string]string{
+	"days": "Vorlaufzeit (Tage)", "search": "Suche", "category": "Kategorie",
+	"partner": "Partner", "contract_type": "Vertragsart", "framework_contract_id": "Rahmenvertrag",
+	"owner": "Verantwortlich", "terminated": "Beendet", "has_documents": "Mit Dokumenten",
+	"only_valid": "Nur gültige", "match": "Verknüpfung",
+}
+
+// describeFilter fasst die Filter einer Liste für den Untertitel zusammen.
+func describeFilter(q url.Values) string {
+	var parts []string
+	for key, values := range q {
+		switch key {
+		case "format", "fields", "sort", "limit", "offset", "delimiter", "bom":
+			continue
+		}
+		label, ok := filterLabels[key]
+		if !ok {
+			label = strings.NewReplacer("_from", " ab", "_to", " bis").Replace(key)
+			for _, col := range exportColumns {
+				if strings.HasPrefix(key, col.Key+"_") {
+					label = strings.Replace(key, col.Key, col.Label, 1)
+					label = strings.NewReplacer("_from", " ab", "_to", " bis").Replace(label)
+				}
+			}
+		}
+		parts = append(parts, label+": "+strings.Join(values, ", "))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, " · ")
+}
+
+// listSubtitle liefert Stand, Anzahl und Filter einer Vertragsliste.
+func listSubtitle(q url.Values, count int) string {
+	subtitle := fmt.Sprintf("Stand %s · %d Verträge", formatGermanDate(time.Now()), count)
+	if filter := describeFilter(q); filter != "" {
+		subtitle += " · " + filter
+	}
+	return subtitle
+}
+
+// listTable formatiert die Exportwerte einer Vertragsliste als Tabelle.
+func listTable(cols []exportColumn, rows [][]interface{}) ([]pdfColumn, [][]string) {
+	tableCols := make([]pdfColumn, len(cols))
+	for i, col := range cols {
+		tableCols[i] = pdfColumn{Label: col.Label, Width: col.Width,
+			Right: col.Kind == exportNumber || col.Kind == exportAmount}
+	}
+	cells := make([][]string, len(rows))
+	for i, row := range rows {
+		cells[i] = make([]string, len(cols))
+		for j, v := range row {
+			cells[i][j] = formatPDFValue(v, cols[j].Kind)
+		}
+	}
+	return tableCols, cells
+}
+
+// writeContractListPDF gibt eine Vertragsliste als Tabelle im Querformat aus.
+func writeContractListPDF(w http.ResponseWriter, q url.Values, title string, cols []exportColumn, rows [][]interface{}, filename string) {
+	r := newPDFReport(title, listSubtitle(q, len(rows)), true)
+	tableCols, cells := listTable(cols, rows)
+	if len(cells) == 0 {
+		r.paragraph("Keine Verträge gefunden.", reportBody)
+	} else {
+		r.table(tableCols, cells, nil)
+	}
+	sendPDF(w, r, filename)
+}
+
+// PortfolioCategory ist eine Zeile der Portfolio-Übersicht.
+type PortfolioCategory struct {
+	Category          string  `json:"category"`
+	Contracts         int     `json:"contracts"`
+	Valid             int     `json:"valid"`
+	Expired           int     `json:"expired"`
+	Terminated        int     `json:"terminated"`
+	AnnualCost        float64 `json:"annual_cost"`        // Summe der gültigen Verträge
+	UpcomingDeadlines int     `json:"upcoming_deadlines"` // Kündigungsvornahmen im Vorlaufzeitraum
+}
+
+// PortfolioReport fasst den Vertragsbestand je Kategorie zusammen.
+type PortfolioReport struct {
+	Days       int                 `json:"days"`
+	Categories []PortfolioCategory `json:"categories"`
+	Total      PortfolioCategory   `json:"total"`
+}
+
+// portfolio liefert die Portfolio-Übersicht als JSON oder mit format=pdf bzw.
+// format=html als Bericht.
+// Filterparameter schränken den berücksichtigten Bestand ein.
+func (h *contractHandlers) portfolio(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	days := 90
+	if d := q.Get("days"); d != "" {
+		if parsed, err := strconv.Atoi(d); err == nil && parsed > 0 {
+			days = parsed
+		}
+	}
+	where, args, err := contractFilter(h.repos.dialect, q, mustAtoi(r.Header.Get("X-User-ID")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := portfolioReport(h.repos.db, where, args, days)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch q.Get("format") {
+	case "", "json":
+		json.NewEncoder(w).Encode(report)
+	case exportPDF:
+		writePortfolioPDF(r.Context(), w, h.repos, q, report, where, args)
+	case exportHTML:
+		writePortfolioHTML(r.Context(), w, h.repos, q, report, where, args)
+	default:
+		http.Error(w, "unbekanntes Format: "+q.Get("format"), http.StatusBadRequest)
+	}
+}
+
+func portfolioReport(db *DB, where string, args []interface{}, days int) (*PortfolioReport, error) {
+	rows, err := db.Query(`SELECT category, COUNT(*),
+			SUM(CASE WHEN is_terminated = FALSE AND (valid_until IS NULL OR valid_until > CURRENT_TIMESTAMP) THEN 1 ELSE 0 END),
+			SUM(CASE WHEN is_terminated = FALSE AND valid_until IS NOT NULL AND valid_until <= CURRENT_TIMESTAMP THEN 1 ELSE 0 END),
+			SUM(CASE WHEN is_terminated = TRUE THEN 1 ELSE 0 END),
+			COALESCE(SUM(CASE WHEN is_terminated = FALSE AND (valid_until IS NULL OR valid_until > CURRENT_TIMESTAMP) THEN annual_cost END), 0),
+			SUM(CASE WHEN is_terminated = FALSE AND cancellation_action_date BETWEEN CURRENT_DATE AND `+db.Dialect.DateInDays()+` THEN 1 ELSE 0 END)
+		FROM contracts WHERE deleted_at IS NULL AND (`+where+`) GROUP BY category ORDER BY category`,
+		append([]interface{}{days}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &PortfolioReport{Days: days, Categories: []PortfolioCategory{}, Total: PortfolioCategory{Category: "Gesamt"}}
+	for rows.Next() {
+		var c PortfolioCategory
+		if err := rows.Scan(&c.Category, &c.Contracts, &c.Valid, &c.Expired, &c.Terminated, &c.AnnualCost, &c.UpcomingDeadlines); err != nil {
+			return nil, err
+		}
+		report.Categories = append(report.Categories, c)
+		report.Total.Contracts += c.Contracts
+		report.Total.Valid += c.Valid
+		report.Total.Expired += c.Expired
+		report.Total.Terminated += c.Terminated
+		report.Total.AnnualCost += c.AnnualCost
+		report.Total.UpcomingDeadlines += c.UpcomingDeadlines
+	}
+	return report, rows.Err()
+}
+
+// portfolioColumns sind die Spalten der Kategorienübersicht.
+func portfolioColumns(days int) []pdfColumn {
+	return []pdfColumn{
+		{"Kategorie", 3, false}, {"Gesamt", 1.2, true}, {"Gültig", 1.2, true}, {"Abgelaufen", 1.4, true},
+		{"Beendet", 1.2, true}, {fmt.Sprintf("Fristen %d Tage", days), 1.6, true}, {"Jährliche Kosten", 2.2, true},
+	}
+}
+
+func portfolioRow(c PortfolioCategory) []string {
+	return []string{c.Category, strconv.Itoa(c.Contracts), strconv.Itoa(c.Valid), strconv.Itoa(c.Expired),
+		strconv.Itoa(c.Terminated), strconv.Itoa(c.UpcomingDeadlines), formatGermanAmount(c.AnnualCost)}
+}
+
+func portfolioSubtitle(q url.Values) string {
+	subtitle := "Stand " + formatGermanDate(time.Now())
+	if filter := describeFilter(q); filter != "" {
+		subtitle += " · " + filter
+	}
+	return subtitle
+}
+
+func portfolioNote(days int) string {
+	return "Jährliche Kosten berücksichtigen nur gültige Verträge. Fristen: Verträge, deren Kündigungsvornahme in den nächsten " +
+		strconv.Itoa(days) + " Tagen liegt."
+}
+
+// deadlineColumns sind die Spalten der anstehenden Kündigungsvornahmen im Portfolio.
+var deadlineColumns = []pdfColumn{
+	{"Vertragsnr.", 1.6, false}, {"Titel", 3, false}, {"Partner", 2.2, false}, {"Kategorie", 1.6, false},
+	{"Kündigungstermin", 1.7, false}, {"Kündigungsvornahme", 1.9, false}, {"Tage", 0.8, true},
+}
+
+// upcomingDeadlines liefert die Kündigungsvornahmen der nächsten days Tage als Tabellenzeilen.
+func upcomingDeadlines(ctx context.Context, repos *Repositories, where string, args []interface{}, days int) ([][]string, error) {
+	opts := listOptions{Limit: -1, Fields: map[string]bool{}, Sort: []string{"cancellation_action_date ASC", "id ASC"}}
+	contracts, _, err := repos.Contracts.List(ctx, `is_terminated = FALSE
+		AND cancellation_action_date IS NOT NULL
+		AND cancellation_action_date BETWEEN CURRENT_DATE AND `+repos.dialect.DateInDays()+`
+		AND `+where, append([]interface{}{days}, args...), opts)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var rows [][]string
+	for _, c := range contracts {
+		rows = append(rows, []string{
+			c.ContractNumber, c.Title, c.Partner, c.Category,
+			formatCSVValue(timeValue(c.CancellationDate), exportDate),
+			formatCSVValue(timeValue(c.CancellationActionDate), exportDate),
+			strconv.Itoa(daysBetween(now, *c.CancellationActionDate)),
+		})
+	}
+	return rows, nil
+}
+
+func writePortfolioPDF(ctx context.Context, w http.ResponseWriter, repos *Repositories, q url.Values, report *PortfolioReport, where string, args []interface{}) {
+	r := newPDFReport("Vertragsportfolio", portfolioSubtitle(q), false)
+
+	r.heading("Verträge nach Kategorie")
+	var rows [][]string
+	labels := make([]string, len(report.Categories))
+	costs := make([]float64, len(report.Categories))
+	for i, c := range report.Categories {
+		rows = append(rows, portfolioRow(c))
+		labels[i], costs[i] = c.Category, c.AnnualCost
+	}
+	r.table(portfolioColumns(report.Days), rows, portfolioRow(report.Total))
+	r.paragraph(portfolioNote(report.Days), reportSmall)
+
+	if report.Total.AnnualCost > 0 {
+		r.heading("Jährliche Kosten nach Kategorie")
+		r.barChart(labels, costs, formatGermanAmount)
+	}
+
+	r.heading(fmt.Sprintf("Anstehende Kündigungsvornahmen (nächste %d Tage)", report.Days))
+	deadlines, err := upcomingDeadlines(ctx, repos, where, args, report.Days)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(deadlines) == 0 {
+		r.paragraph("Keine anstehenden Kündigungsvornahmen.", reportBody)
+	} else {
+		r.table(deadlineColumns, deadlines, nil)
+	}
+
+	sendPDF(w, r, exportFilename("Vertragsportfolio", time.Now(), exportPDF))
+}
+
+// writeContractPDF liefert das Datenblatt eines Vertrags als PDF.
+func writeContractPDF(w http.ResponseWriter, r *http.Request, repos *Repositories, id string) {
+	contracts, _, err := repos.Contracts.List(r.Context(), "id = ?", []interface{}{id}, listOptions{Limit: -1, Sort: []string{"id ASC"}})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if len(contracts) == 0 {
+		http.Error(w, "Contract not found", http.StatusNotFound)
+		return
+	}
+	ctx, err := newExportContext(repos.db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	d, err := loadContractDossier(r.Context(), repos, contracts[0], ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sendPDF(w, contractDatasheet(d, ctx), exportFilename("Vertrag "+d.Contract.ContractNumber, time.Now(), exportPDF))
+}
+
+// contractDatasheet setzt das Datenblatt eines Vertrags mit Nachträgen, Dokumenten
+// und Verlauf.
+func contractDatasheet(d *ContractDossier, ctx *exportContext) *pdfReport {
+	c := d.Contract
+	date := func(t *time.Time) string { return formatCSVValue(timeValue(t), exportDate) }
+	dateTime := func(t time.Time) string { return formatCSVValue(t, exportDateTime) }
+	months := func(n *int) string {
+		if n == nil {
+			return ""
+		}
+		return fmt.Sprintf("%d Monate", *n)
+	}
+
+	r := newPDFReport("Vertragsdatenblatt", c.ContractNumber+" · "+c.Title, false)
+	r.created = ctx.now
+
+	contractType := "Einzelvertrag"
+	if c.ContractType == "framework" {
+		contractType = "Rahmenvertrag"
+	}
+	framework := ""
+	if d.FrameworkContract != nil {
+		framework = d.FrameworkContract.ContractNumber + " – " + d.FrameworkContract.Title
+	}
+	owner := ""
+	if d.OwnerName != nil {
+		owner = *d.OwnerName
+	}
+	cost := ""
+	if c.AnnualCost != nil {
+		cost = formatGermanAmount(*c.AnnualCost)
+	}
+
+	r.heading("Stammdaten")
+	pairs := [][2]string{
+		{"Vertragsnummer", c.ContractNumber},
+		{"Titel", c.Title},
+		{"Partner", c.Partner},
+		{"Kategorie", c.Category},
+		{"Vertragsart", contractType},
+	}
+	if c.ContractType != "framework" {
+		pairs = append(pairs, [2]string{"Rahmenvertrag", framework})
+	}
+	pairs = append(pairs,
+		[2]string{"Verantwortlich", owner},
+		[2]string{"Status", d.Status},
+		[2]string{"Jährliche Kosten", cost})
+	r.keyValues(pairs)
+
+	r.heading("Laufzeit und Kündigung")
+	r.keyValues([][2]string{
+		{"Gültig ab", date(&c.ValidFrom)},
+		{"Gültig bis", date(c.ValidUntil)},
+		{"Mindestlaufzeit bis", date(c.MinimumTerm)},
+		{"Laufzeit", months(c.TermMonths)},
+		{"Kündigungsfrist", months(c.NoticePeriod)},
+		{"Kündigungstermin", date(c.CancellationDate)},
+		{"Kündigungsvornahme", date(c.CancellationActionDate)},
+	})
+
+	if strings.TrimSpace(c.Content) != "" {
+		r.heading("Inhalt")
+		r.paragraph(c.Content, reportBody)
+	}
+	if strings.TrimSpace(c.Conditions) != "" {
+		r.heading("Konditionen")
+		r.paragraph(c.Conditions, reportBody)
+	}
+
+	if len(d.IndividualContracts) > 0 {
+		r.heading("Einzelverträge")
+		var rows [][]string
+		for _, child := range d.IndividualContracts {
+			rows = append(rows, []string{child.ContractNumber, child.Title, child.Partner,
+				date(&child.ValidFrom), date(child.ValidUntil), child.Status})
+		}
+		r.table([]pdfColumn{{"Vertragsnr.", 1.5, false}, {"Titel", 3, false}, {"Partner", 2, false},
+			{"Gültig ab", 1.2, false}, {"Gültig bis", 1.2, false}, {"Status", 1.1, false}}, rows, nil)
+	}
+
+	var amendments, docs [][]string
+	for _, doc := range d.Documents {
+		if doc.DocumentType == docTypeAmendment {
+			amendments = append(amendments, []string{date(&doc.UploadedAt), doc.Filename, doc.Description})
+		}
+		docs = append(docs, []string{doc.Filename, documentTypeLabels[doc.DocumentType],
+			fmt.Sprintf("%d", doc.Version), dateTime(doc.UploadedAt)})
+	}
+	if len(amendments) > 0 {
+		r.heading("Nachträge")
+		r.table([]pdfColumn{{"Datum", 1.2, false}, {"Dateiname", 2.5, false}, {"Beschreibung", 3.5, false}}, amendments, nil)
+	}
+
+	r.heading("Dokumente")
+	if len(docs) == 0 {
+		r.paragraph("Keine Dokumente vorhanden.", reportBody)
+	} else {
+		r.table([]pdfColumn{{"Dateiname", 4, false}, {"Art", 1.4, false}, {"Version", 0.8, true},
+			{"Hochgeladen am", 1.5, false}}, docs, nil)
+	}
+
+	r.heading("Verlauf")
+	var historyRows [][]string
+	for _, h := range d.History {
+		user := ""
+		if h.User != nil {
+			user = *h.User
+		}
+		historyRows = append(historyRows, []string{dateTime(h.At), h.Event, user})
+	}
+	r.table([]pdfColumn{{"Zeitpunkt", 1.5, false}, {"Ereignis", 4, false}, {"Benutzer", 1.2, false}}, historyRows, nil)
+	return r
+}
@@ -0,0 +1,965 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Minimaler PDF-Parser für die Textextraktion. Unterstützt werden unverschlüsselte
+// PDF-Dateien mit Textebene (auch Objekt-Streams), die Filter FlateDecode,
+// ASCIIHexDecode und ASCII85Decode, ToUnicode-CMaps sowie WinAnsi-kodierte Schriften.
+// Reine Bild-Scans ohne Textebene liefern leeren Text.
+
+type pdfName string
+type pdfKeyword string
+type pdfString []byte
+
+type pdfRef struct {
+	num, gen int
+}
+
+type pdfDict map[pdfName]interface{}
+
+type pdfStream struct {
+	dict pdfDict
+	data []byte // noch nicht dekodiert
+}
+
+var errPDFEncrypted = errors.New("verschlüsselte PDF-Dateien werden nicht unterstützt")
+
+// errPDFDamaged meldet Längen und Offsets, die außerhalb der Daten liegen.
+var errPDFDamaged = errors.New("beschädigte PDF-Datei")
+
+// pdfLexer liest PDF-Objekte aus einem Byte-Slice.
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFWhitespace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isPDFWhitespace(c) {
+			l.pos++
+		} else if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		} else {
+			return
+		}
+	}
+}
+
+// next liest das nächste Objekt. Am Ende der Daten wird io.EOF geliefert.
+// Schlüsselwörter (Operatoren, obj, R, …) werden als pdfKeyword zurückgegeben.
+func (l *pdfLexer) next() (interface{}, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		l.pos++
+		start := l.pos
+		for l.pos < len(l.data) && !isPDFWhitespace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+			l.pos++
+		}
+		return pdfName(decodePDFName(l.data[start:l.pos])), nil
+	case c == '(':
+		return l.literalString(), nil
+	case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		l.pos += 2
+		return l.dict()
+	case c == '<':
+		l.pos++
+		end := bytes.IndexByte(l.data[l.pos:], '>')
+		if end < 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		s := decodePDFHex(l.data[l.pos : l.pos+end])
+		l.pos += end + 1
+		return s, nil
+	case c == '>' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '>':
+		l.pos += 2
+		return pdfKeyword(">>"), nil
+	case c == '[':
+		l.pos++
+		var arr []interface{}
+		for {
+			obj, err := l.next()
+			if err != nil {
+				return arr, err
+			}
+			if obj == pdfKeyword("]") {
+				return arr, nil
+			}
+			arr = append(arr, obj)
+		}
+	case c == ']' || c == '{' || c == '}' || c == ')' || c == '>':
+		l.pos++
+		return pdfKeyword(string(c)), nil
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFWhitespace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	tok := string(l.data[start:l.pos])
+	switch tok {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if n, err := strconv.ParseFloat(tok, 64); err == nil {
+		// "n g R" als Referenz erkennen
+		if isInteger(tok) {
+			save := l.pos
+			if gen, ok := l.peekInteger(); ok {
+				l.skipSpace()
+				if l.pos < len(l.data) && l.data[l.pos] == 'R' &&
+					(l.pos+1 == len(l.data) || isPDFWhitespace(l.data[l.pos+1]) || isPDFDelimiter(l.data[l.pos+1])) {
+					l.pos++
+					return pdfRef{num: int(n), gen: gen}, nil
+				}
+			}
+			l.pos = save
+		}
+		return n, nil
+	}
+	if tok == "" {
+		// unbekanntes Zeichen überspringen
+		l.pos++
+		return pdfKeyword(string(c)), nil
+	}
+	return pdfKeyword(tok), nil
+}
+
+func isInteger(tok string) bool {
+	_, err := strconv.Atoi(tok)
+	return err == nil
+}
+
+// peekInteger liest eine Ganzzahl, falls eine folgt.
+func (l *pdfLexer) peekInteger() (int, bool) {
+	l.skipSpace()
+	start := l.pos
+	for l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '9' {
+		l.pos++
+	}
+	if start == l.pos {
+		return 0, false
+	}
+	n, err := strconv.Atoi(string(l.data[start:l.pos]))
+	return n, err == nil
+}
+
+func (l *pdfLexer) dict() (interface{}, error) {
+	d := pdfDict{}
+	for {
+		key, err := l.next()
+		if err != nil {
+			return d, err
+		}
+		if key == pdfKeyword(">>") {
+			break
+		}
+		name, ok := key.(pdfName)
+		if !ok {
+			continue
+		}
+		val, err := l.next()
+		if err != nil {
+			return d, err
+		}
+		d[name] = val
+	}
+
+	// Folgt ein Stream?
+	save := l.pos
+	l.skipSpace()
+	if !bytes.HasPrefix(l.data[l.pos:], []byte("stream")) {
+		l.pos = save
+		return d, nil
+	}
+	l.pos += len("stream")
+	if l.pos < len(l.data) && l.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+		l.pos++
+	}
+	start := l.pos
+
+	// Passt die Länge nicht zu endstream, wird endstream gesucht
+	if n, ok := d["Length"].(float64); ok {
+		if n < 0 || n != math.Trunc(n) || n > float64(len(l.data)-start) {
+			l.pos = len(l.data)
+			return d, fmt.Errorf("%w: Stream-Länge %v bei %d Byte ab Position %d", errPDFDamaged, n, len(l.data), start)
+		}
+		end := start + int(n)
+		rest := bytes.TrimLeft(l.data[end:min(end+20, len(l.data))], "\r\n \t")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			l.pos = end
+			return &pdfStream{dict: d, data: l.data[start:end]}, nil
+		}
+	}
+	end := bytes.Index(l.data[start:], []byte("endstream"))
+	if end < 0 {
+		l.pos = len(l.data)
+		return &pdfStream{dict: d, data: l.data[start:]}, nil
+	}
+	data := bytes.TrimRight(l.data[start:start+end], "\r\n")
+	l.pos = start + end + len("endstream")
+	return &pdfStream{dict: d, data: data}, nil
+}
+
+func (l *pdfLexer) literalString() pdfString {
+	l.pos++ // (
+	var buf []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+			buf = append(buf, c)
+		case ')':
+			depth--
+			if depth == 0 {
+				return buf
+			}
+			buf = append(buf, c)
+		case '\\':
+			if l.pos >= len(l.data) {
+				return buf
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				buf = append(buf, '\n')
+			case 'r':
+				buf = append(buf, '\r')
+			case 't':
+				buf = append(buf, '\t')
+			case 'b':
+				buf = append(buf, '\b')
+			case 'f':
+				buf = append(buf, '\f')
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					buf = append(buf, byte(v))
+				} else {
+					buf = append(buf, e)
+				}
+			}
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return buf
+}
+
+func decodePDFName(b []byte) string {
+	if bytes.IndexByte(b, '#') < 0 {
+		return string(b)
+	}
+	var out []byte
+	for i := 0; i < len(b); i++ {
+		if b[i] == '#' && i+2 < len(b) {
+			if v, err := strconv.ParseUint(string(b[i+1:i+3]), 16, 8); err == nil {
+				out = append(out, byte(v))
+				i += 2
+				continue
+			}
+		}
+		out = append(out, b[i])
+	}
+	return string(out)
+}
+
+func decodePDFHex(b []byte) pdfString {
+	var clean []byte
+	for _, c := range b {
+		if !isPDFWhitespace(c) {
+			clean = append(clean, c)
+		}
+	}
+	if len(clean)%2 == 1 {
+		clean = append(clean, '0')
+	}
+	out := make([]byte, hex.DecodedLen(len(clean)))
+	n, _ := hex.Decode(out, clean)
+	return out[:n]
+}
+
+// pdfDocument hält alle indirekten Objekte einer PDF-Datei.
+type pdfDocument struct {
+	objects map[int]interface{}
+}
+
+var pdfObjHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// parsePDF indiziert alle Objekte der Datei. Statt der Xref-Tabelle werden die
+// Objektköpfe gesucht, das funktioniert auch bei beschädigten Querverweisen.
+// Spätere Definitionen (inkrementelle Updates) überschreiben frühere.
+func parsePDF(data []byte) (*pdfDocument, error) {
+	if !bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF")) {
+		return nil, errors.New("keine PDF-Datei")
+	}
+	doc := &pdfDocument{objects: map[int]interface{}{}}
+
+	for _, m := range pdfObjHeader.FindAllSubmatchIndex(data, -1) {
+		num, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+		l := &pdfLexer{data: data, pos: m[1]}
+		obj, err := l.next()
+		if errors.Is(err, errPDFDamaged) {
+			return nil, err
+		}
+		if err != nil && err != io.EOF {
+			continue
+		}
+		doc.objects[num] = obj
+	}
+
+	// Objekt-Streams auspacken
+	for _, obj := range doc.objects {
+		s, ok := obj.(*pdfStream)
+		if !ok || s.dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+		if err := doc.expandObjectStream(s); err != nil {
+			return nil, err
+		}
+	}
+
+	// Die Verschlüsselung steht im Trailer oder im Dictionary des Xref-Streams
+	for _, obj := range doc.objects {
+		if s, ok := obj.(*pdfStream); ok && s.dict["Type"] == pdfName("XRef") && s.dict["Encrypt"] != nil {
+			return nil, errPDFEncrypted
+		}
+	}
+	if trailerHasEncrypt(data) {
+		return nil, errPDFEncrypted
+	}
+
+	return doc, nil
+}
+
+func trailerHasEncrypt(data []byte) bool {
+	idx := bytes.LastIndex(data, []byte("trailer"))
+	if idx < 0 {
+		return false
+	}
+	l := &pdfLexer{data: data, pos: idx + len("trailer")}
+	obj, _ := l.next()
+	d, ok := obj.(pdfDict)
+	return ok && d["Encrypt"] != nil
+}
+
+// expandObjectStream übernimmt die Objekte eines Objekt-Streams. N, First und die
+// Offsets stammen aus der Datei und werden vor der Verwendung geprüft.
+func (doc *pdfDocument) expandObjectStream(s *pdfStream) error {
+	data, err := decodePDFStream(s)
+	if err != nil {
+		return nil
+	}
+	n, first := doc.number(s.dict["N"]), doc.number(s.dict["First"])
+	if n < 0 || first < 0 || first > float64(len(data)) {
+		return fmt.Errorf("%w: Objekt-Stream mit N %v, First %v bei %d Byte", errPDFDamaged, n, first, len(data))
+	}
+	header := &pdfLexer{data: data[:int(first)]}
+	for i := 0; i < int(n); i++ {
+		numObj, err1 := header.next()
+		offObj, err2 := header.next()
+		if err1 != nil || err2 != nil {
+			return nil
+		}
+		num, _ := numObj.(float64)
+		off, _ := offObj.(float64)
+		if off < 0 || off >= float64(len(data))-first {
+			return fmt.Errorf("%w: Offset %v im Objekt-Stream außerhalb der Daten", errPDFDamaged, off)
+		}
+		if _, exists := doc.objects[int(num)]; exists {
+			continue
+		}
+		l := &pdfLexer{data: data, pos: int(first + off)}
+		obj, err := l.next()
+		if err != nil && err != io.EOF {
+			continue
+		}
+		doc.objects[int(num)] = obj
+	}
+	return nil
+}
+
+// resolve löst Referenzen auf.
+func (doc *pdfDocument) resolve(obj interface{}) interface{} {
+	for i := 0; i < 32; i++ {
+		ref, ok := obj.(pdfRef)
+		if !ok {
+			return obj
+		}
+		obj = doc.objects[ref.num]
+	}
+	return nil
+}
+
+func (doc *pdfDocument) dict(obj interface{}) pdfDict {
+	switch v := doc.resolve(obj).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	}
+	return nil
+}
+
+func (doc *pdfDocument) number(obj interface{}) float64 {
+	n, _ := doc.resolve(obj).(float64)
+	return n
+}
+
+// pages liefert die Seiten in Dokumentreihenfolge.
+func (doc *pdfDocument) pages() []pdfDict {
+	var pages []pdfDict
+	seen := map[int]bool{}
+
+	var walk func(obj interface{}, depth int)
+	walk = func(obj interface{}, depth int) {
+		if depth > 64 {
+			return
+		}
+		if ref, ok := obj.(pdfRef); ok {
+			if seen[ref.num] {
+				return
+			}
+			seen[ref.num] = true
+		}
+		d := doc.dict(obj)
+		if d == nil {
+			return
+		}
+		switch d["Type"] {
+		case pdfName("Pages"):
+			kids, _ := doc.resolve(d["Kids"]).([]interface{})
+			for _, kid := range kids {
+				walk(kid, depth+1)
+			}
+		case pdfName("Page"):
+			pages = append(pages, d)
+		}
+	}
+
+	for _, obj := range doc.objects {
+		d := doc.dict(obj)
+		if d != nil && d["Type"] == pdfName("Catalog") {
+			walk(d["Pages"], 0)
+			break
+		}
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+
+	// Fallback ohne Seitenbaum: alle Seitenobjekte nach Objektnummer
+	var nums []int
+	for num, obj := range doc.objects {
+		if d := doc.dict(obj); d != nil && d["Type"] == pdfName("Page") {
+			nums = append(nums, num)
+		}
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		pages = append(pages, doc.dict(doc.objects[num]))
+	}
+	return pages
+}
+
+// inherited sucht ein Seitenattribut auch in den übergeordneten Knoten.
+func (doc *pdfDocument) inherited(page pdfDict, key pdfName) interface{} {
+	for d, i := page, 0; d != nil && i < 64; i++ {
+		if v, ok := d[key]; ok {
+			return v
+		}
+		d = doc.dict(d["Parent"])
+	}
+	return nil
+}
+
+func decodePDFStream(s *pdfStream) ([]byte, error) {
+	data := s.data
+	var filters []interface{}
+	switch f := s.dict["Filter"].(type) {
+	case pdfName:
+		filters = []interface{}{f}
+	case []interface{}:
+		filters = f
+	}
+	for _, f := range filters {
+		name, _ := f.(pdfName)
+		var err error
+		switch name {
+		case "FlateDecode", "Fl":
+			data, err = inflate(data)
+		case "ASCIIHexDecode", "AHx":
+			end := bytes.IndexByte(data, '>')
+			if end >= 0 {
+				data = data[:end]
+			}
+			data = decodePDFHex(data)
+		case "ASCII85Decode", "A85":
+			data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+			if end := bytes.Index(data, []byte("~>")); end >= 0 {
+				data = data[:end]
+			}
+			dst := make([]byte, len(data)*4/5+4)
+			var n int
+			n, _, err = ascii85.Decode(dst, data, true)
+			data = dst[:n]
+		default:
+			return nil, fmt.Errorf("PDF-Filter %s wird nicht unterstützt", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// inflate entpackt zlib-Daten und liefert bei abgeschnittenen Streams den lesbaren Teil.
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	out, err := io.ReadAll(r)
+	if err != nil && len(out) > 0 {
+		return out, nil
+	}
+	return out, err
+}
+
+// pdfFont dekodiert Zeichencodes einer Schrift nach Unicode.
+type pdfFont struct {
+	toUnicode map[string]string // Code (Bytes) → Unicode
+	codeLen   int               // 1 oder 2 Byte je Code
+	encoding  map[byte]rune     // Differences-Array
+}
+
+func (doc *pdfDocument) loadFont(obj interface{}) *pdfFont {
+	d := doc.dict(obj)
+	f := &pdfFont{codeLen: 1}
+	if d == nil {
+		return f
+	}
+	if d["Subtype"] == pdfName("Type0") {
+		f.codeLen = 2
+	}
+	if s, ok := doc.resolve(d["ToUnicode"]).(*pdfStream); ok {
+		if data, err := decodePDFStream(s); err == nil {
+			f.toUnicode, f.codeLen = parseToUnicode(data, f.codeLen)
+		}
+	}
+	if enc := doc.dict(d["Encoding"]); enc != nil {
+		if diffs, ok := doc.resolve(enc["Differences"]).([]interface{}); ok {
+			f.encoding = map[byte]rune{}
+			code := 0
+			for _, item := range diffs {
+				switch v := doc.resolve(item).(type) {
+				case float64:
+					code = int(v)
+				case pdfName:
+					if r, ok := glyphNameToRune(string(v)); ok && code < 256 {
+						f.encoding[byte(code)] = r
+					}
+					code++
+				}
+			}
+		}
+	}
+	return f
+}
+
+func (f *pdfFont) decode(s []byte) string {
+	var sb strings.Builder
+	if f.toUnicode != nil {
+		for i := 0; i < len(s); {
+			n := f.codeLen
+			if i+n > len(s) {
+				n = len(s) - i
+			}
+			if u, ok := f.toUnicode[string(s[i:i+n])]; ok {
+				sb.WriteString(u)
+			} else if n == 1 {
+				sb.WriteRune(winAnsiRune(s[i]))
+			}
+			i += n
+		}
+		return sb.String()
+	}
+	if f.codeLen == 2 {
+		// Ohne ToUnicode sind CID-Schriften nicht dekodierbar
+		return ""
+	}
+	for _, b := range s {
+		if r, ok := f.encoding[b]; ok {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteRune(winAnsiRune(b))
+		}
+	}
+	return sb.String()
+}
+
+// parseToUnicode liest bfchar- und bfrange-Abschnitte einer ToUnicode-CMap.
+func parseToUnicode(data []byte, defaultLen int) (map[string]string, int) {
+	m := map[string]string{}
+	codeLen := 0
+	l := &pdfLexer{data: data}
+	var operands []interface{}
+	mode := ""
+	for {
+		obj, err := l.next()
+		if err != nil {
+			break
+		}
+		kw, isKeyword := obj.(pdfKeyword)
+		if !isKeyword {
+			if mode != "" {
+				operands = append(operands, obj)
+			}
+			continue
+		}
+		switch kw {
+		case "begincodespacerange":
+			mode = "codespace"
+		case "beginbfchar":
+			mode = "bfchar"
+		case "beginbfrange":
+			mode = "bfrange"
+		case "endcodespacerange":
+			if len(operands) > 0 {
+				if s, ok := operands[0].(pdfString); ok && len(s) > 0 {
+					codeLen = len(s)
+				}
+			}
+			operands, mode = nil, ""
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					m[string(src)] = utf16BytesToString(dst)
+					if codeLen == 0 {
+						codeLen = len(src)
+					}
+				}
+			}
+			operands, mode = nil, ""
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 || len(lo) != len(hi) || len(lo) == 0 || len(lo) > 4 {
+					continue
+				}
+				if codeLen == 0 {
+					codeLen = len(lo)
+				}
+				start, end := bytesToInt(lo), bytesToInt(hi)
+				if end < start || end-start > 0xFFFF {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case pdfString:
+					base := []rune(utf16BytesToString(dst))
+					for code := start; code <= end; code++ {
+						r := append([]rune{}, base...)
+						if len(r) > 0 {
+							r[len(r)-1] += rune(code - start)
+						}
+						m[string(intToBytes(code, len(lo)))] = string(r)
+					}
+				case []interface{}:
+					for j, item := range dst {
+						if s, ok := item.(pdfString); ok && start+j <= end {
+							m[string(intToBytes(start+j, len(lo)))] = utf16BytesToString(s)
+						}
+					}
+				}
+			}
+			operands, mode = nil, ""
+		}
+	}
+	if codeLen == 0 {
+		codeLen = defaultLen
+	}
+	return m, codeLen
+}
+
+func bytesToInt(b []byte) int {
+	n := 0
+	for _, c := range b {
+		n = n<<8 | int(c)
+	}
+	return n
+}
+
+func intToBytes(n, size int) []byte {
+	b := make([]byte, size)
+	for i := size - 1; i >= 0; i-- {
+		b[i] = byte(n)
+		n >>= 8
+	}
+	return b
+}
+
+func utf16BytesToString(b []byte) string {
+	if len(b)%2 == 1 {
+		b = append(b, 0)
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return string(utf16.Decode(u))
+}
+
+// winAnsiHigh enthält die Zeichen 0x80–0x9F der WinAnsi-Kodierung (Windows-1252).
+var winAnsiHigh = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+func winAnsiRune(b byte) rune {
+	if b >= 0x80 && b < 0xA0 {
+		if r := winAnsiHigh[b-0x80]; r != 0 {
+			return r
+		}
+		return ' '
+	}
+	return rune(b)
+}
+
+var glyphNames = map[string]rune{
+	"space": ' ', "adieresis": 'ä', "odieresis": 'ö', "udieresis": 'ü',
+	"Adieresis": 'Ä', "Odieresis": 'Ö', "Udieresis": 'Ü', "germandbls": 'ß',
+	"eacute": 'é', "egrave": 'è', "agrave": 'à', "aacute": 'á', "ccedilla": 'ç',
+	"endash": '–', "emdash": '—', "quoteleft": '‘', "quoteright": '’',
+	"quotedblleft": '“', "quotedblright": '”', "quotedblbase": '„', "bullet": '•',
+	"Euro": '€', "section": '§', "paragraph": '¶', "degree": '°', "hyphen": '-',
+	"period": '.', "comma": ',', "colon": ':', "semicolon": ';', "slash": '/',
+	"parenleft": '(', "parenright": ')', "ellipsis": '…', "fi": 'ﬁ', "fl": 'ﬂ',
+}
+
+func glyphNameToRune(name string) (rune, bool) {
+	if r, ok := glyphNames[name]; ok {
+		return r, true
+	}
+	if len(name) == 1 {
+		return rune(name[0]), true
+	}
+	if strings.HasPrefix(name, "uni") && len(name) == 7 {
+		if v, err := strconv.ParseUint(name[3:], 16, 32); err == nil {
+			return rune(v), true
+		}
+	}
+	return 0, false
+}
+
+// extractPDFText liefert den Text aller Seiten, Seiten getrennt durch Seitenvorschub.
+func extractPDFText(data []byte) (string, error) {
+	doc, err := parsePDF(data)
+	if err != nil {
+		return "", err
+	}
+	var pages []string
+	for _, page := range doc.pages() {
+		var sb strings.Builder
+		resources := doc.dict(doc.inherited(page, "Resources"))
+		for _, content := range doc.contentStreams(page["Contents"]) {
+			doc.interpretContent(content, resources, &sb, 0)
+			sb.WriteByte('\n')
+		}
+		pages = append(pages, normalizeExtractedText(sb.String()))
+	}
+	return strings.TrimSpace(strings.Join(pages, "\f")), nil
+}
+
+func (doc *pdfDocument) contentStreams(obj interface{}) [][]byte {
+	var result [][]byte
+	switch v := doc.resolve(obj).(type) {
+	case *pdfStream:
+		if data, err := decodePDFStream(v); err == nil {
+			result = append(result, data)
+		}
+	case []interface{}:
+		for _, item := range v {
+			result = append(result, doc.contentStreams(item)...)
+		}
+	}
+	return result
+}
+
+// interpretContent wertet die Textoperatoren eines Inhaltsstreams aus.
+func (doc *pdfDocument) interpretContent(data []byte, resources pdfDict, sb *strings.Builder, depth int) {
+	if depth > 8 {
+		return
+	}
+	fonts := map[pdfName]*pdfFont{}
+	fontDict := doc.dict(resources["Font"])
+	font := &pdfFont{codeLen: 1}
+	lastY := 0.0
+
+	getFont := func(name pdfName) *pdfFont {
+		if f, ok := fonts[name]; ok {
+			return f
+		}
+		f := doc.loadFont(fontDict[name])
+		fonts[name] = f
+		return f
+	}
+
+	l := &pdfLexer{data: data}
+	var operands []interface{}
+	for {
+		obj, err := l.next()
+		if err != nil {
+			return
+		}
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+		switch op {
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[0].(pdfName); ok {
+					font = getFont(name)
+				}
+			}
+		case "Tj":
+			if len(operands) >= 1 {
+				if s, ok := operands[len(operands)-1].(pdfString); ok {
+					sb.WriteString(font.decode(s))
+				}
+			}
+		case "'", "\"":
+			sb.WriteByte('\n')
+			if len(operands) >= 1 {
+				if s, ok := operands[len(operands)-1].(pdfString); ok {
+					sb.WriteString(font.decode(s))
+				}
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				arr, _ := operands[len(operands)-1].([]interface{})
+				for _, item := range arr {
+					switch v := item.(type) {
+					case pdfString:
+						sb.WriteString(font.decode(v))
+					case float64:
+						// Große Abstände im TJ-Array entsprechen Wortzwischenräumen
+						if v < -200 {
+							sb.WriteByte(' ')
+						}
+					}
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				if ty, _ := operands[1].(float64); ty != 0 {
+					sb.WriteByte('\n')
+				} else {
+					sb.WriteByte(' ')
+				}
+			}
+		case "T*":
+			sb.WriteByte('\n')
+		case "Tm":
+			if len(operands) >= 6 {
+				if y, _ := operands[5].(float64); y != lastY {
+					sb.WriteByte('\n')
+					lastY = y
+				} else {
+					sb.WriteByte(' ')
+				}
+			}
+		case "ET":
+			sb.WriteByte(' ')
+		case "Do":
+			if len(operands) >= 1 {
+				name, _ := operands[0].(pdfName)
+				xobjects := doc.dict(resources["XObject"])
+				if x, ok := doc.resolve(xobjects[name]).(*pdfStream); ok && x.dict["Subtype"] == pdfName("Form") {
+					if content, err := decodePDFStream(x); err == nil {
+						formResources := doc.dict(x.dict["Resources"])
+						if formResources == nil {
+							formResources = resources
+						}
+						doc.interpretContent(content, formResources, sb, depth+1)
+					}
+				}
+			}
+		case "ID":
+			// Inline-Bilddaten bis EI überspringen
+			if end := bytes.Index(l.data[l.pos:], []byte("EI")); end >= 0 {
+				l.pos += end + 2
+			} else {
+				l.pos = len(l.data)
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+var multiSpace = regexp.MustCompile(`[ \t]+`)
+var multiNewline = regexp.MustCompile(`\n\s*\n+`)
+
+func normalizeExtractedText(s string) string {
+	s = multiSpace.ReplaceAllString(s, " ")
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	s = strings.Join(lines, "\n")
+	return strings.TrimSpace(multiNewline.ReplaceAllString(s, "\n\n"))
+}
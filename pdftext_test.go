@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pdfWithObjects baut eine PDF-Datei aus den angegebenen Objekten.
+func pdfWithObjects(objects ...string) []byte {
+	var sb strings.Builder
+	sb.WriteString("%PDF-1.4\n")
+	for i, obj := range objects {
+		sb.WriteString(strconv.Itoa(i+1) + " 0 obj\n" + obj + "\nendobj\n")
+	}
+	sb.WriteString("trailer\n<</Root 1 0 R>>\n%%EOF\n")
+	return []byte(sb.String())
+}
+
+// objectStream baut einen Objekt-Stream mit den Angaben N und First.
+func objectStream(n, first, content string) string {
+	return "<</Type/ObjStm/N " + n + "/First " + first + "/Length " + strconv.Itoa(len(content)) + ">>\nstream\n" + content + "\nendstream"
+}
+
+// malformedPDFs sind Dateien mit Angaben außerhalb der Daten, die den Parser früher
+// zum Absturz gebracht haben.
+var malformedPDFs = map[string][]byte{
+	"negative Stream-Länge":   pdfWithObjects("<</Length -50>>\nstream\nabc\nendstream"),
+	"riesige Stream-Länge":    pdfWithObjects("<</Length 1e300>>\nstream\nabc\nendstream"),
+	"negatives First":         pdfWithObjects(objectStream("1", "-5", "2 0 <<>>")),
+	"First hinter den Daten":  pdfWithObjects(objectStream("1", "1000", "2 0 <<>>")),
+	"negativer Offset":        pdfWithObjects(objectStream("1", "7", "2 -100 <<>>")),
+	"Offset hinter den Daten": pdfWithObjects(objectStream("1", "7", "2 5000 <<>>")),
+}
+
+func TestExtractPDFTextMalformed(t *testing.T) {
+	for name, data := range malformedPDFs {
+		t.Run(name, func(t *testing.T) {
+			if _, err := extractPDFText(data); err == nil {
+				t.Error("kein Fehler")
+			}
+		})
+	}
+}
+
+// TestExtractDocumentMalformed stellt sicher, dass eine beschädigte Datei als
+// fehlgeschlagen markiert wird, statt den Worker zu beenden.
+func TestExtractDocumentMalformed(t *testing.T) {
+	s := newTestServer(t)
+	c := s.createContract(nil)
+	var doc Document
+	s.expect("POST", fmt.Sprintf("/contracts/%d/documents", c.ID), s.admin,
+		uploadForm(t, "kaputt.pdf", malformedPDFs["negativer Offset"], nil), http.StatusCreated, &doc)
+
+	stored, err := s.repos.Documents.Get(context.Background(), doc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extractDocument(s.repos, doc.ID, stored.Filename, stored.StorageKey)
+	if stored, err = s.repos.Documents.Get(context.Background(), doc.ID); err != nil {
+		t.Fatal(err)
+	}
+	if stored.ExtractionStatus != extractionFailed || stored.ExtractionError == nil {
+		t.Errorf("Status %s, Fehler %v", stored.ExtractionStatus, stored.ExtractionError)
+	}
+}
+
+func FuzzExtractPDFText(f *testing.F) {
+	f.Add(testPDF("fuzz"))
+	f.Add(pdfWithObjects("<</Type/Catalog/Pages 2 0 R>>", "<</Type/Pages/Kids[3 0 R]/Count 1>>",
+		"<</Type/Page/Parent 2 0 R/Contents 4 0 R>>", "<</Length 22>>\nstream\nBT (Hallo Welt) Tj ET\nendstream"))
+	f.Add(pdfWithObjects(objectStream("1", "4", "2 0 <</Type/Catalog>>")))
+	for _, data := range malformedPDFs {
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		extractPDFText(data)
+	})
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Seitengrößen in Punkt (1/72 Zoll)
+const (
+	pdfA4Width  = 595.28
+	pdfA4Height = 841.89
+)
+
+// pdfStyle beschreibt Schrift und Farbe einer Textausgabe. Verwendet werden die
+// Standardschriften Helvetica und Helvetica-Bold mit WinAnsiEncoding, die jeder
+// PDF-Betrachter mitbringt; eingebettet werden muss daher nichts.
+type pdfStyle struct {
+	Bold  bool
+	Size  float64
+	Color pdfColor
+}
+
+type pdfColor struct{ R, G, B float64 }
+
+var (
+	pdfBlack     = pdfColor{0, 0, 0}
+	pdfGray      = pdfColor{0.4, 0.4, 0.4}
+	pdfLightGray = pdfColor{0.92, 0.92, 0.92}
+	pdfAccent    = pdfColor{0.16, 0.33, 0.55}
+)
+
+// pdfWriter erzeugt ein einfaches PDF-Dokument. Koordinaten werden wie am
+// Bildschirm von der linken oberen Ecke aus angegeben.
+type pdfWriter struct {
+	width, height float64
+	pages         []*bytes.Buffer
+	current       int // Seite, auf die gezeichnet wird
+	images        []pdfImage
+	title         string
+}
+
+type pdfImage struct {
+	width, height int
+	data          []byte // zlib-komprimierte RGB-Daten
+}
+
+func newPDFWriter(title string, landscape bool) *pdfWriter {
+	p := &pdfWriter{width: pdfA4Width, height: pdfA4Height, title: title}
+	if landscape {
+		p.width, p.height = p.height, p.width
+	}
+	return p
+}
+
+func (p *pdfWriter) addPage() {
+	p.pages = append(p.pages, &bytes.Buffer{})
+	p.current = len(p.pages) - 1
+}
+
+// selectPage setzt die Ausgabe auf einer bereits angelegten Seite fort.
+func (p *pdfWriter) selectPage(i int) {
+	p.current = i
+}
+
+func (p *pdfWriter) page() *bytes.Buffer {
+	return p.pages[p.current]
+}
+
+// text gibt s mit der Grundlinie bei y aus.
+func (p *pdfWriter) text(x, y float64, f pdfStyle, s string) {
+	font := "F1"
+	if f.Bold {
+		font = "F2"
+	}
+	fmt.Fprintf(p.page(), "BT %.3f %.3f %.3f rg /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n",
+		f.Color.R, f.Color.G, f.Color.B, font, f.Size, x, p.height-y, pdfEscape(pdfWinAnsi(s)))
+}
+
+// textRight gibt s rechtsbündig an x aus.
+func (p *pdfWriter) textRight(x, y float64, f pdfStyle, s string) {
+	p.text(x-pdfTextWidth(s, f), y, f, s)
+}
+
+func (p *pdfWriter) fillRect(x, y, w, h float64, c pdfColor) {
+	fmt.Fprintf(p.page(), "%.3f %.3f %.3f rg %.2f %.2f %.2f %.2f re f\n",
+		c.R, c.G, c.B, x, p.height-y-h, w, h)
+}
+
+func (p *pdfWriter) line(x1, y1, x2, y2, width float64, c pdfColor) {
+	fmt.Fprintf(p.page(), "%.3f %.3f %.3f RG %.2f w %.2f %.2f m %.2f %.2f l S\n",
+		c.R, c.G, c.B, width, x1, p.height-y1, x2, p.height-y2)
+}
+
+// addImage nimmt ein PNG- oder JPEG-Bild auf und liefert dessen Index.
+// Transparente Bereiche werden auf weißem Hintergrund dargestellt.
+func (p *pdfWriter) addImage(data []byte) (int, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	b := img.Bounds()
+	raw := make([]byte, 0, b.Dx()*b.Dy()*3)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			a := int(c.A)
+			raw = append(raw,
+				byte((int(c.R)*a+255*(255-a))/255),
+				byte((int(c.G)*a+255*(255-a))/255),
+				byte((int(c.B)*a+255*(255-a))/255))
+		}
+	}
+	p.images = append(p.images, pdfImage{width: b.Dx(), height: b.Dy(), data: pdfDeflate(raw)})
+	return len(p.images) - 1, nil
+}
+
+// drawImage zeichnet ein Bild mit linker oberer Ecke bei x, y.
+func (p *pdfWriter) drawImage(idx int, x, y, w, h float64) {
+	fmt.Fprintf(p.page(), "q %.2f 0 0 %.2f %.2f %.2f cm /Im%d Do Q\n", w, h, x, p.height-y-h, idx)
+}
+
+// writeTo schreibt das vollständige Dokument.
+func (p *pdfWriter) writeTo(w io.Writer) error {
+	var out bytes.Buffer
+	var offsets []int
+	obj := func(body string) int {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+		return len(offsets)
+	}
+	stream := func(dict string, data []byte) int {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n<< %s /Length %d >>\nstream\n", len(offsets), dict, len(data))
+		out.Write(data)
+		out.WriteString("\nendstream\nendobj\n")
+		return len(offsets)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+
+	// Objekt 1 und 2 sind Katalog und Seitenbaum, die Seitenobjekte folgen am Ende
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	pagesIdx := len(offsets)
+	offsets = append(offsets, 0)
+
+	helvetica := obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	helveticaBold := obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	var xobjects strings.Builder
+	for i, img := range p.images {
+		id := stream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode",
+			img.width, img.height), img.data)
+		fmt.Fprintf(&xobjects, "/Im%d %d 0 R ", i, id)
+	}
+	resources := fmt.Sprintf("<< /Font << /F1 %d 0 R /F2 %d 0 R >> /XObject << %s>> >>", helvetica, helveticaBold, xobjects.String())
+
+	var kids []string
+	for _, content := range p.pages {
+		contentID := stream("/Filter /FlateDecode", pdfDeflate(content.Bytes()))
+		pageID := obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources %s /Contents %d 0 R >>",
+			p.width, p.height, resources, contentID))
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageID))
+	}
+
+	offsets[pagesIdx] = out.Len()
+	fmt.Fprintf(&out, "2 0 obj\n<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", strings.Join(kids, " "), len(kids))
+
+	info := obj(fmt.Sprintf("<< /Title %s /Producer (Vertragsdatenbank) /CreationDate (D:%s) >>",
+		pdfUTF16(p.title), time.Now().Format("20060102150405")))
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, info, xref)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// pdfTextWidth liefert die Breite von s in Punkt.
+func pdfTextWidth(s string, f pdfStyle) float64 {
+	widths := &helveticaWidths
+	if f.Bold {
+		widths = &helveticaBoldWidths
+	}
+	total := 0
+	for _, b := range pdfWinAnsi(s) {
+		total += int(widths[b])
+	}
+	return float64(total) * f.Size / 1000
+}
+
+// pdfWrap bricht s an Wortgrenzen so um, dass jede Zeile höchstens width breit ist.
+// Zu lange Wörter werden zeichenweise getrennt.
+func pdfWrap(s string, f pdfStyle, width float64) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if pdfTextWidth(candidate, f) <= width {
+				line = candidate
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			line = ""
+			for pdfTextWidth(word, f) > width {
+				n := len([]rune(word)) - 1
+				for n > 1 && pdfTextWidth(string([]rune(word)[:n]), f) > width {
+					n--
+				}
+				lines = append(lines, string([]rune(word)[:n]))
+				word = string([]rune(word)[n:])
+			}
+			line = word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// pdfWinAnsi wandelt s in WinAnsiEncoding um, nicht darstellbare Zeichen werden zu "?".
+func pdfWinAnsi(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r == '\t':
+			out = append(out, ' ')
+		case r < 0x20:
+		case r < 0x80 || (r >= 0xA0 && r <= 0xFF):
+			out = append(out, byte(r))
+		default:
+			if b, ok := winAnsiBytes[r]; ok {
+				out = append(out, b)
+			} else {
+				out = append(out, '?')
+			}
+		}
+	}
+	return out
+}
+
+// winAnsiBytes ist die Umkehrung von winAnsiHigh (0x80–0x9F).
+var winAnsiBytes = func() map[rune]byte {
+	m := map[rune]byte{}
+	for i, r := range winAnsiHigh {
+		if r != 0 {
+			m[r] = byte(0x80 + i)
+		}
+	}
+	return m
+}()
+
+func pdfEscape(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		switch c {
+		case '(', ')', '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// pdfUTF16 kodiert s als UTF-16BE-Hexstring für Metadaten.
+func pdfUTF16(s string) string {
+	var sb strings.Builder
+	sb.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&sb, "%04X", u)
+	}
+	sb.WriteString(">")
+	return sb.String()
+}
+
+func pdfDeflate(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// Zeichenbreiten der Standardschriften (Adobe Font Metrics) in WinAnsiEncoding, 1/1000 em
+var helveticaWidths = [256]uint16{
+	278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278,
+	278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278,
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584, 350,
+	556, 350, 222, 556, 333, 1000, 556, 556, 333, 1000, 667, 333, 1000, 350, 611, 350,
+	350, 222, 222, 333, 333, 350, 556, 1000, 333, 1000, 500, 333, 944, 350, 500, 667,
+	278, 333, 556, 556, 556, 556, 260, 556, 333, 737, 370, 556, 584, 333, 737, 333,
+	400, 584, 333, 333, 333, 556, 537, 278, 333, 333, 365, 556, 834, 834, 834, 611,
+	667, 667, 667, 667, 667, 667, 1000, 722, 667, 667, 667, 667, 278, 278, 278, 278,
+	722, 722, 778, 778, 778, 778, 778, 584, 778, 722, 722, 722, 722, 667, 667, 611,
+	556, 556, 556, 556, 556, 556, 889, 500, 556, 556, 556, 556, 278, 278, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 584, 611, 556, 556, 556, 556, 500, 556, 500,
+}
+
+var helveticaBoldWidths = [256]uint16{
+	278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278,
+	278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278, 278,
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584, 350,
+	556, 350, 278, 556, 500, 1000, 556, 556, 333, 1000, 667, 333, 1000, 350, 611, 350,
+	350, 278, 278, 500, 500, 350, 556, 1000, 333, 1000, 556, 333, 944, 350, 500, 667,
+	278, 333, 556, 556, 556, 556, 280, 556, 333, 737, 370, 556, 584, 333, 737, 333,
+	400, 584, 333, 333, 333, 611, 556, 278, 333, 333, 365, 556, 834, 834, 834, 611,
+	722, 722, 722, 722, 722, 722, 1000, 722, 667, 667, 667, 667, 278, 278, 278, 278,
+	722, 722, 778, 778, 778, 778, 778, 584, 778, 722, 722, 722, 722, 667, 667, 611,
+	556, 556, 556, 556, 556, 556, 889, 556, 556, 556, 556, 556, 278, 278, 278, 278,
+	611, 611, 611, 611, 611, 611, 611, 584, 611, 611, 611, 611, 611, 556, 611, 556,
+}
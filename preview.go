@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Vorschau: Anzeige von Dokumenten im Browser und Miniaturansichten der ersten
+// Seite. Miniaturansichten werden beim ersten Abruf erzeugt und als JPEG neben der
+// Datei im Dokumentenspeicher abgelegt (document_versions.thumbnail_key). Ein
+// leerer thumbnail_key bedeutet, dass für die Version keine Vorschau möglich ist.
+
+const (
+	thumbnailSize      = 320      // längere Kante in Pixel
+	thumbnailMaxPixels = 50 << 20 // größere Bilder werden nicht dekodiert
+	thumbnailQuality   = 80
+	thumbnailTimeout   = 30 * time.Second
+)
+
+// inlineTypes dürfen mit inline=true im Browser angezeigt werden.
+var inlineTypes = map[string]bool{mimePDF: true, mimePNG: true, mimeJPEG: true, mimeText: true}
+
+var errNoThumbnail = errors.New("Keine Vorschau verfügbar")
+
+// pdfRenderer ist der Pfad zu pdftoppm (Poppler). Ohne pdftoppm gibt es
+// Vorschaubilder nur für gescannte PDFs, deren erste Seite ein JPEG-Bild ist.
+var pdfRenderer string
+
+// loadPreviewConfig liest VERTRAGSDB_PDFTOPPM; ohne Angabe wird pdftoppm im PATH
+// gesucht, "off" schaltet das Rendern ab.
+func loadPreviewConfig() {
+	switch pdfRenderer = os.Getenv("VERTRAGSDB_PDFTOPPM"); pdfRenderer {
+	case "off":
+		pdfRenderer = ""
+	case "":
+		pdfRenderer, _ = exec.LookPath("pdftoppm")
+	}
+	if pdfRenderer != "" {
+		log.Printf("PDF-Vorschau mit %s", pdfRenderer)
+	}
+}
+
+// resetMissingThumbnails erlaubt einen neuen Versuch für PDFs ohne Vorschau, wenn
+// inzwischen pdftoppm zur Verfügung steht.
+func resetMissingThumbnails(db *DB) {
+	if pdfRenderer == "" {
+		return
+	}
+	if _, err := db.Exec("UPDATE document_versions SET thumbnail_key = NULL WHERE thumbnail_key = '' AND mime_type = ?", mimePDF); err != nil {
+		log.Printf("Vorschau-Markierungen nicht zurückgesetzt: %v", err)
+	}
+}
+
+// thumbnail liefert die Miniaturansicht der aktuellen Version.
+func (h *documentHandlers) thumbnail(w http.ResponseWriter, r *http.Request) {
+	var versionID int
+	var key string
+	var mimeType, thumbKey sql.NullString
+	err := h.db.QueryRow(`SELECT v.id, v.storage_key, v.mime_type, v.thumbnail_key
+		FROM documents d JOIN document_versions v ON v.document_id = d.id AND v.version = d.version
+		WHERE d.id = ? AND d.deleted_at IS NULL`, r.PathValue("docId")).Scan(&versionID, &key, &mimeType, &thumbKey)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	thumb, modTime, err := documentThumbnail(r.Context(), h.db, versionID, key, mimeType.String, thumbKey)
+	if errors.Is(err, errNoThumbnail) {
+		http.Error(w, errNoThumbnail.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(thumb))
+}
+
+// documentThumbnail liest die gespeicherte Miniaturansicht oder erzeugt sie. Fehlt
+// die Datei im Speicher (z. B. nach migrate-storage), wird sie neu erzeugt.
+func documentThumbnail(ctx context.Context, db *DB, versionID int, key, mimeType string, thumbKey sql.NullString) ([]byte, time.Time, error) {
+	if thumbKey.Valid {
+		if thumbKey.String == "" {
+			return nil, time.Time{}, errNoThumbnail
+		}
+		r, info, err := store.Get(ctx, thumbKey.String)
+		if err == nil {
+			defer r.Close()
+			data, err := io.ReadAll(r)
+			return data, info.ModTime, err
+		}
+		if !errors.Is(err, errStorageNotFound) {
+			return nil, time.Time{}, err
+		}
+	}
+
+	data, err := readStoredFile(key)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	thumb, err := makeThumbnail(ctx, data, mimeType)
+	if errors.Is(err, errNoThumbnail) {
+		log.Printf("Keine Vorschau für %s: %v", key, err)
+		db.Exec("UPDATE document_versions SET thumbnail_key = '' WHERE id = ?", versionID)
+		return nil, time.Time{}, errNoThumbnail
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	newKey := key + ".thumb.jpg"
+	if err := store.Put(ctx, newKey, bytes.NewReader(thumb), int64(len(thumb))); err != nil {
+		return nil, time.Time{}, err
+	}
+	if _, err := db.Exec("UPDATE document_versions SET thumbnail_key = ? WHERE id = ?", newKey, versionID); err != nil {
+		return nil, time.Time{}, err
+	}
+	return thumb, time.Now(), nil
+}
+
+// makeThumbnail erzeugt ein JPEG der ersten Seite. Inhalte, aus denen sich keine
+// Vorschau erzeugen lässt, liefern einen Fehler, der errNoThumbnail umschließt.
+func makeThumbnail(ctx context.Context, data []byte, mimeType string) ([]byte, error) {
+	var img image.Image
+	var err error
+	switch mimeType {
+	case mimePNG, mimeJPEG:
+		img, err = decodeImage(data)
+	case mimePDF:
+		img, err = pdfFirstPage(ctx, data)
+	default:
+		return nil, fmt.Errorf("%w: Dateityp %s", errNoThumbnail, mimeType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNoThumbnail, err)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scaleImage(img, thumbnailSize), &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeImage dekodiert PNG und JPEG und lehnt übergroße Bilder vor dem Dekodieren ab.
+func decodeImage(data []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > thumbnailMaxPixels {
+		return nil, fmt.Errorf("Bild mit %d×%d Pixeln ist zu groß", cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// pdfFirstPage rendert die erste Seite mit pdftoppm. Ohne pdftoppm oder wenn das
+// Rendern scheitert, wird das größte Bild der ersten Seite verwendet (Scans).
+func pdfFirstPage(ctx context.Context, data []byte) (image.Image, error) {
+	if pdfRenderer != "" {
+		img, err := renderPDFPage(ctx, data)
+		if err == nil {
+			return img, nil
+		}
+		log.Printf("pdftoppm: %v", err)
+	}
+	doc, err := parsePDF(data)
+	if err != nil {
+		return nil, err
+	}
+	pages := doc.pages()
+	if len(pages) == 0 {
+		return nil, errors.New("PDF ohne Seiten")
+	}
+	return doc.pageImage(pages[0])
+}
+
+func renderPDFPage(ctx context.Context, data []byte) (image.Image, error) {
+	dir, err := os.MkdirTemp("", "vertragsdb-preview-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	in := filepath.Join(dir, "in.pdf")
+	if err := os.WriteFile(in, data, 0o600); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, thumbnailTimeout)
+	defer cancel()
+	out := filepath.Join(dir, "page")
+	cmd := exec.CommandContext(ctx, pdfRenderer, "-f", "1", "-l", "1", "-singlefile", "-png",
+		"-scale-to", strconv.Itoa(2*thumbnailSize), in, out)
+	if msg, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%v: %s", err, bytes.TrimSpace(msg))
+	}
+	f, err := os.Open(out + ".png")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
+
+// pageImage liefert das größte Bild einer Seite. Unterstützt werden JPEG-Bilder
+// (DCTDecode) und unkomprimierte oder Flate-komprimierte RGB- und Graustufenbilder
+// mit 8 Bit je Kanal.
+func (doc *pdfDocument) pageImage(page pdfDict) (image.Image, error) {
+	resources := doc.dict(doc.inherited(page, "Resources"))
+	var best *pdfStream
+	var bestSize float64
+	for _, obj := range doc.dict(resources["XObject"]) {
+		s, ok := doc.resolve(obj).(*pdfStream)
+		if !ok || s.dict["Subtype"] != pdfName("Image") {
+			continue
+		}
+		if size := doc.number(s.dict["Width"]) * doc.number(s.dict["Height"]); size > bestSize {
+			best, bestSize = s, size
+		}
+	}
+	if best == nil {
+		return nil, errors.New("erste Seite enthält kein Bild")
+	}
+	if bestSize > thumbnailMaxPixels {
+		return nil, errors.New("Bild der ersten Seite ist zu groß")
+	}
+
+	if f := best.dict["Filter"]; f == pdfName("DCTDecode") || f == pdfName("DCT") {
+		return jpeg.Decode(bytes.NewReader(best.data))
+	}
+	w, h := int(doc.number(best.dict["Width"])), int(doc.number(best.dict["Height"]))
+	if doc.number(best.dict["BitsPerComponent"]) != 8 {
+		return nil, errors.New("Bildformat wird nicht unterstützt")
+	}
+	channels := 0
+	switch cs := doc.resolve(best.dict["ColorSpace"]).(type) {
+	case pdfName:
+		channels = map[pdfName]int{"DeviceRGB": 3, "DeviceGray": 1}[cs]
+	case []interface{}:
+		// [/ICCBased <<… /N 3>>]
+		if len(cs) == 2 && cs[0] == pdfName("ICCBased") {
+			n := int(doc.number(doc.dict(cs[1])["N"]))
+			if n == 1 || n == 3 {
+				channels = n
+			}
+		}
+	}
+	if channels == 0 {
+		return nil, errors.New("Farbraum wird nicht unterstützt")
+	}
+	pixels, err := decodePDFStream(best)
+	if err != nil {
+		return nil, err
+	}
+	if len(pixels) < w*h*channels {
+		return nil, errors.New("Bilddaten unvollständig")
+	}
+	if channels == 1 {
+		return &image.Gray{Pix: pixels[:w*h], Stride: w, Rect: image.Rect(0, 0, w, h)}, nil
+	}
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < w*h; i++ {
+		copy(img.Pix[4*i:4*i+3], pixels[3*i:3*i+3])
+		img.Pix[4*i+3] = 0xff
+	}
+	return img, nil
+}
+
+// scaleImage verkleinert img mit einem Boxfilter, bis die längere Kante höchstens
+// size Pixel misst. Transparenz wird auf weißen Hintergrund gelegt. Je Zielpixel
+// werden höchstens 4×4 Quellpixel gemittelt, das genügt für Vorschaubilder.
+func scaleImage(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	nw, nh := w, h
+	if w > size || h > size {
+		if w >= h {
+			nw, nh = size, max(1, h*size/w)
+		} else {
+			nw, nh = max(1, w*size/h), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, nw, nh))
+	for y := 0; y < nh; y++ {
+		y0, y1 := b.Min.Y+y*h/nh, b.Min.Y+max((y+1)*h/nh, y*h/nh+1)
+		stepY := max(1, (y1-y0)/4)
+		for x := 0; x < nw; x++ {
+			x0, x1 := b.Min.X+x*w/nw, b.Min.X+max((x+1)*w/nw, x*w/nw+1)
+			stepX := max(1, (x1-x0)/4)
+			var sr, sg, sb, sa, n uint64
+			for sy := y0; sy < y1; sy += stepY {
+				for sx := x0; sx < x1; sx += stepX {
+					r, g, b, a := img.At(sx, sy).RGBA()
+					sr, sg, sb, sa = sr+uint64(r), sg+uint64(g), sb+uint64(b), sa+uint64(a)
+					n++
+				}
+			}
+			// Farben sind vormultipliziert: Weiß für den transparenten Anteil addieren
+			white := 0xffff*n - sa
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8((sr + white) / n >> 8),
+				G: uint8((sg + white) / n >> 8),
+				B: uint8((sb + white) / n >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return dst
+}
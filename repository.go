@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Fehlerarten der Repositories. Die Fehler tragen eine Meldung für den Benutzer und
+// lassen sich mit errors.Is einer Art zuordnen; writeError macht daraus den HTTP-Status.
+var (
+	errNotFound   = errors.New("nicht gefunden")
+	errConflict   = errors.New("Konflikt")
+	errValidation = errors.New("ungültige Eingabe")
+)
+
+// repoError ist ein Fehler der Art kind mit der Meldung msg.
+type repoError struct {
+	kind error
+	msg  string
+}
+
+func (e *repoError) Error() string { return e.msg }
+func (e *repoError) Unwrap() error { return e.kind }
+
+func notFoundError(format string, args ...interface{}) error {
+	return &repoError{errNotFound, fmt.Sprintf(format, args...)}
+}
+
+func conflictError(format string, args ...interface{}) error {
+	return &repoError{errConflict, fmt.Sprintf(format, args...)}
+}
+
+func validationError(format string, args ...interface{}) error {
+	return &repoError{errValidation, fmt.Sprintf(format, args...)}
+}
+
+// writeError schreibt einen Fehler eines Repositories als HTTP-Antwort.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, errConflict):
+		status = http.StatusConflict
+	case errors.Is(err, errValidation):
+		status = http.StatusBadRequest
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// Repositories fasst die Repositories für Verträge, Benutzer, Dokumente und Kategorien zusammen.
+// Alle arbeiten auf derselben Verbindung oder, innerhalb von Transaction, auf
+// derselben Transaktion.
+type Repositories struct {
+	db      *DB // nil innerhalb einer Transaktion
+	q       querier
+	dialect Dialect
+
+	Contracts  *ContractRepository
+	Users      *UserRepository
+	Documents  *DocumentRepository
+	Categories *CategoryRepository
+}
+
+// newRepositories legt die Repositories für eine Datenbankverbindung an.
+func newRepositories(db *DB) *Repositories {
+	s := repositoriesOn(db, db.Dialect)
+	s.db = db
+	return s
+}
+
+func repositoriesOn(q querier, dialect Dialect) *Repositories {
+	s := &Repositories{q: q, dialect: dialect}
+	s.Contracts = &ContractRepository{s}
+	s.Users = &UserRepository{s}
+	s.Documents = &DocumentRepository{s}
+	s.Categories = &CategoryRepository{s}
+	return s
+}
+
+// Transaction führt fn in einer Transaktion aus und bestätigt sie, wenn fn keinen
+// Fehler liefert. Die Repositories von tx arbeiten in der Transaktion. Innerhalb einer
+// Transaktion läuft fn in der bestehenden mit.
+func (s *Repositories) Transaction(ctx context.Context, fn func(tx *Repositories) error) error {
+	if s.db == nil {
+		return fn(s)
+	}
+	tx, err := s.db.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(repositoriesOn(tx, tx.Dialect)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// count liefert das Ergebnis einer COUNT-Abfrage.
+func (s *Repositories) count(ctx context.Context, query string, args ...interface{}) (int, error) {
+	var n int
+	err := s.q.QueryRowContext(ctx, query, args...).Scan(&n)
+	return n, err
+}
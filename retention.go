@@ -0,0 +1,881 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status eines Löschvorschlags. Genehmigte Vorschläge werden sofort ausgeführt und
+// bleiben nur als Grabstein im Prüfprotokoll erhalten.
+const (
+	retentionPending  = "pending"
+	retentionRejected = "rejected"
+)
+
+const (
+	retentionCheckInterval = 24 * time.Hour
+	maxRetentionYears      = 100
+)
+
+const errLegalHold = "Der Vertrag unterliegt einem Legal Hold"
+
+// retentionMu serialisiert Löschprüfung, endgültiges Löschen und Legal Hold, damit
+// zwischen Prüfung und Löschen kein Legal Hold gesetzt werden kann.
+var retentionMu sync.Mutex
+
+// retentionWake weckt die Löschprüfung nach geänderten Regeln.
+var retentionWake = make(chan struct{}, 1)
+
+// RetentionRule legt fest, wie viele Jahre Verträge einer Kategorie nach Vertragsende
+// aufbewahrt werden. Mit document_type gilt die Regel für Dokumente dieses Typs und
+// zählt ab dem Hochladen, unabhängig vom Vertrag.
+type RetentionRule struct {
+	ID           int       `json:"id"`
+	CategoryID   int       `json:"category_id"`
+	Category     string    `json:"category"`
+	DocumentType string    `json:"document_type"` // leer = Vertrag mit allen Dokumenten
+	Years        int       `json:"years"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// RetentionCandidate ist ein Löschvorschlag für einen Vertrag oder ein Dokument,
+// dessen Aufbewahrungsfrist abgelaufen ist.
+type RetentionCandidate struct {
+	ID               int        `json:"id"`
+	ContractID       int        `json:"contract_id"`
+	ContractNumber   string     `json:"contract_number"`
+	ContractTitle    string     `json:"contract_title"`
+	Category         string     `json:"category"`
+	DocumentID       *int       `json:"document_id"` // null = ganzer Vertrag
+	DocumentFilename *string    `json:"document_filename"`
+	DocumentType     *string    `json:"document_type"`
+	Years            int        `json:"years"`
+	RetentionStart   time.Time  `json:"retention_start"` // Vertragsende bzw. Hochladen des Dokuments
+	DueAt            time.Time  `json:"due_at"`          // Ende der Aufbewahrungsfrist
+	Status           string     `json:"status"`          // pending, rejected
+	CreatedAt        time.Time  `json:"created_at"`
+	DecidedBy        *int       `json:"decided_by"`
+	DecidedByName    *string    `json:"decided_by_name"`
+	DecidedAt        *time.Time `json:"decided_at"`
+	Reason           *string    `json:"reason"`
+}
+
+// retentionItem ist ein Vertrag oder Dokument mit abgelaufener Aufbewahrungsfrist.
+type retentionItem struct {
+	ContractID int
+	DocumentID int // 0 = ganzer Vertrag
+	Years      int
+	Start      time.Time
+	Due        time.Time
+}
+
+type retentionKey struct {
+	contractID, documentID int
+}
+
+// Anlass einer endgültigen Löschung im Grabstein
+const (
+	purgeReasonRetention = "retention" // Aufbewahrungsfrist abgelaufen, Löschvorschlag genehmigt
+	purgeReasonTrash     = "trash"     // aus dem Papierkorb gelöscht
+)
+
+// purgeTombstone ist der Grabstein eines endgültig gelöschten Vertrags oder Dokuments.
+// Er belegt die Löschung, ohne personenbezogene Daten wie Titel, Partner oder
+// Dateinamen zu enthalten.
+type purgeTombstone struct {
+	Reason         string     `json:"reason"`
+	ContractID     int        `json:"contract_id"`
+	ContractNumber string     `json:"contract_number"`
+	Category       string     `json:"category"`
+	DocumentType   string     `json:"document_type,omitempty"`
+	SHA256         *string    `json:"sha256,omitempty"` // aktuelle Version des Dokuments
+	Documents      int        `json:"documents"`
+	Versions       int        `json:"versions"`
+	Files          int        `json:"files"`
+	RetentionYears int        `json:"retention_years,omitempty"`
+	RetentionStart *time.Time `json:"retention_start,omitempty"`
+	DueAt          *time.Time `json:"due_at,omitempty"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"` // in den Papierkorb verschoben
+	DeletedBy      *int       `json:"deleted_by,omitempty"`
+}
+
+// tombstone liefert den Grabstein mit den Angaben zur abgelaufenen Frist.
+func (item retentionItem) tombstone() purgeTombstone {
+	return purgeTombstone{
+		Reason: purgeReasonRetention, RetentionYears: item.Years, RetentionStart: &item.Start, DueAt: &item.Due,
+	}
+}
+
+// retentionDue berechnet das Ende der Aufbewahrungsfrist. Wie nach HGB und AO
+// beginnt die Frist mit dem Schluss des Kalenderjahres, in dem sie ausgelöst wird.
+func retentionDue(start time.Time, years int) time.Time {
+	return time.Date(start.Year()+years+1, 1, 1, 0, 0, 0, 0, time.Local)
+}
+
+// contractEnd ist valid_until, bei beendeten Verträgen ohne valid_until der
+// Kündigungstermin oder der Zeitpunkt der Beendigung. Laufende Verträge ohne
+// Enddatum haben kein Ende.
+func contractEnd(terminated bool, validUntil, cancellationDate, terminatedAt sql.NullTime) (time.Time, bool) {
+	switch {
+	case validUntil.Valid:
+		return validUntil.Time, true
+	case terminated && cancellationDate.Valid:
+		return cancellationDate.Time, true
+	case terminated && terminatedAt.Valid:
+		return terminatedAt.Time, true
+	}
+	return time.Time{}, false
+}
+
+// dueRetentionItems liefert alle Verträge und Dokumente, deren Aufbewahrungsfrist
+// abgelaufen ist. where schränkt die Verträge (Alias c) ein. Verträge mit Legal Hold
+// und Rahmenverträge mit Einzelverträgen werden nicht gelöscht; Dokumente eines
+// fälligen Vertrags erscheinen nur mit diesem.
+func dueRetentionItems(db *DB, where string, args ...interface{}) ([]retentionItem, error) {
+	now := time.Now()
+	var items []retentionItem
+	dueContracts := map[int]bool{}
+
+	rows, err := db.Query(`SELECT c.id, c.is_terminated, c.valid_until, c.cancellation_date, c.terminated_at, r.years
+		FROM contracts c
+		JOIN categories cat ON cat.name = c.category
+		JOIN retention_rules r ON r.category_id = cat.id AND r.document_type = ''
+		WHERE c.legal_hold = FALSE AND c.deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM contracts i WHERE i.framework_contract_id = c.id)
+			AND `+where+`
+		ORDER BY c.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var item retentionItem
+		var terminated bool
+		var validUntil, cancellationDate, terminatedAt sql.NullTime
+		if err := rows.Scan(&item.ContractID, &terminated, &validUntil, &cancellationDate, &terminatedAt, &item.Years); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		end, ok := contractEnd(terminated, validUntil, cancellationDate, terminatedAt)
+		if !ok {
+			continue
+		}
+		item.Start = end
+		item.Due = retentionDue(end, item.Years)
+		if now.Before(item.Due) {
+			continue
+		}
+		items = append(items, item)
+		dueContracts[item.ContractID] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`SELECT d.id, d.contract_id, d.uploaded_at, r.years
+		FROM documents d
+		JOIN contracts c ON c.id = d.contract_id
+		JOIN categories cat ON cat.name = c.category
+		JOIN retention_rules r ON r.category_id = cat.id AND r.document_type = d.document_type
+		WHERE c.legal_hold = FALSE AND c.deleted_at IS NULL AND `+where+`
+		ORDER BY d.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item retentionItem
+		if err := rows.Scan(&item.DocumentID, &item.ContractID, &item.Start, &item.Years); err != nil {
+			return nil, err
+		}
+		item.Due = retentionDue(item.Start, item.Years)
+		if now.Before(item.Due) || dueContracts[item.ContractID] {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func runRetentionScheduler(db *DB) {
+	ticker := time.NewTicker(retentionCheckInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := checkRetention(db); err != nil {
+			log.Printf("Prüfung der Aufbewahrungsfristen fehlgeschlagen: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-retentionWake:
+		}
+	}
+}
+
+func wakeRetentionCheck() {
+	select {
+	case retentionWake <- struct{}{}:
+	default:
+	}
+}
+
+// checkRetention legt für jeden fälligen Vertrag und jedes fällige Dokument einen
+// Löschvorschlag an und entfernt offene Vorschläge, die nicht mehr fällig sind, etwa
+// wegen eines Legal Hold oder einer geänderten Regel. Abgelehnte Vorschläge werden
+// nach einem Jahr erneut vorgeschlagen. Liefert die Anzahl neuer Vorschläge.
+func checkRetention(db *DB) (int, error) {
+	retentionMu.Lock()
+	defer retentionMu.Unlock()
+
+	items, err := dueRetentionItems(db, "1 = 1")
+	if err != nil {
+		return 0, err
+	}
+
+	type existing struct {
+		id        int
+		status    string
+		decidedAt sql.NullTime
+	}
+	candidates := map[retentionKey]existing{}
+	rows, err := db.Query("SELECT id, contract_id, COALESCE(document_id, 0), status, decided_at FROM retention_candidates")
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var e existing
+		var k retentionKey
+		if err := rows.Scan(&e.id, &k.contractID, &k.documentID, &e.status, &e.decidedAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		candidates[k] = e
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	reproposeBefore := time.Now().AddDate(-1, 0, 0)
+	proposed := 0
+	for _, item := range items {
+		k := retentionKey{item.ContractID, item.DocumentID}
+		e, ok := candidates[k]
+		delete(candidates, k)
+		switch {
+		case !ok:
+			_, err = tx.Exec(`INSERT INTO retention_candidates (contract_id, document_id, years, retention_start, due_at, status, created_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?)`,
+				item.ContractID, nullableID(item.DocumentID), item.Years, item.Start, item.Due, retentionPending, time.Now())
+		case e.status == retentionRejected && e.decidedAt.Valid && e.decidedAt.Time.Before(reproposeBefore):
+			_, err = tx.Exec(`UPDATE retention_candidates SET years = ?, retention_start = ?, due_at = ?, status = ?,
+				created_at = ?, decided_by = NULL, decided_at = NULL, reason = NULL WHERE id = ?`,
+				item.Years, item.Start, item.Due, retentionPending, time.Now(), e.id)
+		case e.status == retentionPending:
+			_, err = tx.Exec("UPDATE retention_candidates SET years = ?, retention_start = ?, due_at = ? WHERE id = ?",
+				item.Years, item.Start, item.Due, e.id)
+			if err != nil {
+				return 0, err
+			}
+			continue
+		default:
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		proposed++
+	}
+	for _, e := range candidates {
+		if e.status != retentionPending {
+			continue
+		}
+		if _, err := tx.Exec("DELETE FROM retention_candidates WHERE id = ?", e.id); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	if proposed > 0 {
+		log.Printf("Aufbewahrungsfristen: %d neue Löschvorschläge", proposed)
+	}
+	return proposed, nil
+}
+
+// deleteStoredFiles löscht alle Dateien, deren Schlüssel query liefert. Fehlende
+// Dateien zählen als gelöscht, ein abgebrochener Lauf kann also wiederholt werden.
+func deleteStoredFiles(ctx context.Context, db *DB, query string, args ...interface{}) (int, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, key := range keys {
+		if err := store.Delete(ctx, key); err != nil {
+			return 0, fmt.Errorf("Datei %s nicht gelöscht: %w", key, err)
+		}
+	}
+	return len(keys), nil
+}
+
+// purgeContract löscht einen Vertrag mit allen Dokumenten, Versionen und Dateien
+// endgültig, ebenso Zustellungen an Webhooks, die seine Daten enthalten. Im
+// Prüfprotokoll bleibt tomb als Grabstein, ergänzt um Vertrag und Anzahl der
+// gelöschten Dokumente. Einzelverträge im Papierkorb verlieren die Zuordnung.
+func purgeContract(ctx context.Context, db *DB, c *Contract, userID int, tomb purgeTombstone) error {
+	tomb.ContractID, tomb.ContractNumber, tomb.Category = c.ID, c.ContractNumber, c.Category
+	docs := "SELECT id FROM documents WHERE contract_id = ?"
+	db.QueryRow("SELECT COUNT(*) FROM documents WHERE contract_id = ?", c.ID).Scan(&tomb.Documents)
+	db.QueryRow("SELECT COUNT(*) FROM document_versions WHERE document_id IN ("+docs+")", c.ID).Scan(&tomb.Versions)
+
+	// Erst die Dateien, damit keine verwaisten Dateien bleiben, wenn das Löschen abbricht
+	var err error
+	tomb.Files, err = deleteStoredFiles(ctx, db, `
+		SELECT storage_key FROM document_versions WHERE document_id IN (`+docs+`)
+		UNION SELECT thumbnail_key FROM document_versions WHERE document_id IN (`+docs+`) AND thumbnail_key != ''
+		UNION SELECT storage_key FROM documents WHERE contract_id = ?
+		UNION SELECT storage_key FROM quarantined_uploads WHERE contract_id = ? OR document_id IN (`+docs+`)`,
+		c.ID, c.ID, c.ID, c.ID, c.ID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{"DELETE FROM webhook_deadline_notices WHERE contract_id = ?", []interface{}{c.ID}},
+		{"DELETE FROM webhook_deliveries WHERE " + db.Dialect.JSONInt("payload", "data", "contract", "id") + " = ?", []interface{}{c.ID}},
+		{"DELETE FROM quarantined_uploads WHERE contract_id = ? OR document_id IN (" + docs + ")", []interface{}{c.ID, c.ID}},
+		{"DELETE FROM document_versions WHERE document_id IN (" + docs + ")", []interface{}{c.ID}},
+		{"DELETE FROM documents WHERE contract_id = ?", []interface{}{c.ID}},
+		{"DELETE FROM retention_candidates WHERE contract_id = ?", []interface{}{c.ID}},
+		{"UPDATE contracts SET framework_contract_id = NULL WHERE framework_contract_id = ?", []interface{}{c.ID}},
+		{"DELETE FROM contracts WHERE id = ?", []interface{}{c.ID}},
+	} {
+		if _, err := tx.Exec(stmt.query, stmt.args...); err != nil {
+			return err
+		}
+	}
+	if err := writeAudit(tx, auditContractPurged, "contract", c.ID, userID, tomb); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	publishChange(changeContractDeleted, map[string]interface{}{"contract_id": c.ID})
+	return nil
+}
+
+// purgeDocument löscht ein Dokument mit allen Versionen und Dateien endgültig.
+func purgeDocument(ctx context.Context, repos *Repositories, item retentionItem, userID int) error {
+	doc, err := repos.Documents.Get(ctx, item.DocumentID)
+	if err != nil {
+		return err
+	}
+	c, err := repos.Contracts.Get(ctx, doc.ContractID)
+	if err != nil {
+		return err
+	}
+	tomb := item.tombstone()
+	tomb.ContractID, tomb.ContractNumber, tomb.Category = c.ID, c.ContractNumber, c.Category
+	tomb.DocumentType, tomb.SHA256, tomb.Documents = doc.DocumentType, doc.SHA256, 1
+	repos.db.QueryRow("SELECT COUNT(*) FROM document_versions WHERE document_id = ?", doc.ID).Scan(&tomb.Versions)
+
+	tomb.Files, err = deleteStoredFiles(ctx, repos.db, `
+		SELECT storage_key FROM document_versions WHERE document_id = ?
+		UNION SELECT thumbnail_key FROM document_versions WHERE document_id = ? AND thumbnail_key != ''
+		UNION SELECT storage_key FROM documents WHERE id = ?
+		UNION SELECT storage_key FROM quarantined_uploads WHERE document_id = ?`,
+		doc.ID, doc.ID, doc.ID, doc.ID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := repos.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		"DELETE FROM quarantined_uploads WHERE document_id = ?",
+		"DELETE FROM document_versions WHERE document_id = ?",
+		"DELETE FROM documents WHERE id = ?",
+		"DELETE FROM retention_candidates WHERE document_id = ?",
+	} {
+		if _, err := tx.Exec(query, doc.ID); err != nil {
+			return err
+		}
+	}
+	if err := writeAudit(tx, auditDocumentPurged, "document", doc.ID, userID, tomb); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	publishChange(changeDocumentDeleted, map[string]interface{}{"document": doc})
+	return nil
+}
+
+// Handler für Aufbewahrungsregeln
+
+// retentionHandlers bedient Aufbewahrungsregeln und Löschvorschläge.
+type retentionHandlers struct {
+	repos *Repositories
+}
+
+func loadRetentionRules(db *DB, where string, args ...interface{}) ([]RetentionRule, error) {
+	rows, err := db.Query(`SELECT r.id, r.category_id, c.name, r.document_type, r.years, r.created_at, r.updated_at
+		FROM retention_rules r JOIN categories c ON c.id = r.category_id
+		WHERE `+where+` ORDER BY c.name, r.document_type`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []RetentionRule{}
+	for rows.Next() {
+		var rule RetentionRule
+		if err := rows.Scan(&rule.ID, &rule.CategoryID, &rule.Category, &rule.DocumentType, &rule.Years,
+			&rule.CreatedAt, &rule.UpdatedAt); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func (h *retentionHandlers) rules(w http.ResponseWriter, r *http.Request) {
+	rules, err := loadRetentionRules(h.repos.db, "1 = 1")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(rules)
+}
+
+// decodeRetentionRule liest und prüft eine Regel aus dem Request-Body.
+func decodeRetentionRule(db *DB, r *http.Request) (RetentionRule, error) {
+	var rule RetentionRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		return rule, err
+	}
+	if rule.Years < 1 || rule.Years > maxRetentionYears {
+		return rule, fmt.Errorf("Aufbewahrungsdauer muss zwischen 1 und %d Jahren liegen", maxRetentionYears)
+	}
+	if rule.DocumentType != "" && !validDocumentType(rule.DocumentType) {
+		return rule, fmt.Errorf("ungültiger Dokumenttyp: %s", rule.DocumentType)
+	}
+	if err := db.QueryRow("SELECT name FROM categories WHERE id = ?", rule.CategoryID).Scan(&rule.Category); err != nil {
+		return rule, fmt.Errorf("Kategorie %d nicht gefunden", rule.CategoryID)
+	}
+	return rule, nil
+}
+
+func (h *retentionHandlers) createRule(w http.ResponseWriter, r *http.Request) {
+	rule, err := decodeRetentionRule(h.repos.db, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.repos.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	id, err := tx.Insert("INSERT INTO retention_rules (category_id, document_type, years) VALUES (?, ?, ?)",
+		rule.CategoryID, rule.DocumentType, rule.Years)
+	if err != nil {
+		http.Error(w, "Für diese Kategorie und diesen Dokumenttyp gibt es bereits eine Regel", http.StatusConflict)
+		return
+	}
+	rule.ID = int(id)
+	err = writeAudit(tx, auditRetentionRuleCreated, "retention_rule", rule.ID, mustAtoi(r.Header.Get("X-User-ID")), rule)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	wakeRetentionCheck()
+
+	rules, err := loadRetentionRules(h.repos.db, "r.id = ?", id)
+	if err != nil || len(rules) == 0 {
+		http.Error(w, "Regel nicht gefunden", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rules[0])
+}
+
+func (h *retentionHandlers) updateRule(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	previous, err := loadRetentionRules(h.repos.db, "r.id = ?", id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(previous) == 0 {
+		http.Error(w, "Regel nicht gefunden", http.StatusNotFound)
+		return
+	}
+	rule, err := decodeRetentionRule(h.repos.db, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rule.ID = previous[0].ID
+
+	tx, err := h.repos.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE retention_rules SET category_id = ?, document_type = ?, years = ?, updated_at = ? WHERE id = ?",
+		rule.CategoryID, rule.DocumentType, rule.Years, time.Now(), id)
+	if err != nil {
+		http.Error(w, "Für diese Kategorie und diesen Dokumenttyp gibt es bereits eine Regel", http.StatusConflict)
+		return
+	}
+	err = writeAudit(tx, auditRetentionRuleUpdated, "retention_rule", mustAtoi(id), mustAtoi(r.Header.Get("X-User-ID")),
+		map[string]interface{}{"rule": rule, "previous": previous[0]})
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	wakeRetentionCheck()
+
+	rules, err := loadRetentionRules(h.repos.db, "r.id = ?", id)
+	if err != nil || len(rules) == 0 {
+		http.Error(w, "Regel nicht gefunden", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(rules[0])
+}
+
+func (h *retentionHandlers) deleteRule(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	previous, err := loadRetentionRules(h.repos.db, "r.id = ?", id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(previous) == 0 {
+		http.Error(w, "Regel nicht gefunden", http.StatusNotFound)
+		return
+	}
+
+	tx, err := h.repos.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM retention_rules WHERE id = ?", id)
+	if err == nil {
+		err = writeAudit(tx, auditRetentionRuleDeleted, "retention_rule", mustAtoi(id), mustAtoi(r.Header.Get("X-User-ID")), previous[0])
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	wakeRetentionCheck()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Handler für Löschvorschläge
+
+// candidates listet die offenen Löschvorschläge, mit ?status=rejected die
+// abgelehnten.
+func (h *retentionHandlers) candidates(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = retentionPending
+	}
+	if status != retentionPending && status != retentionRejected {
+		http.Error(w, "ungültiger Wert für status: "+status+" (erlaubt: pending, rejected)", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.repos.db.Query(`SELECT rc.id, rc.contract_id, c.contract_number, c.title, c.category,
+		rc.document_id, d.filename, d.document_type, rc.years, rc.retention_start, rc.due_at, rc.status,
+		rc.created_at, rc.decided_by, u.username, rc.decided_at, rc.reason
+		FROM retention_candidates rc
+		JOIN contracts c ON c.id = rc.contract_id
+		LEFT JOIN documents d ON d.id = rc.document_id
+		LEFT JOIN users u ON u.id = rc.decided_by
+		WHERE rc.status = ? ORDER BY rc.due_at, rc.id`, status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	candidates := []RetentionCandidate{}
+	for rows.Next() {
+		var rc RetentionCandidate
+		var decidedAt sql.NullTime
+		if err := rows.Scan(&rc.ID, &rc.ContractID, &rc.ContractNumber, &rc.ContractTitle, &rc.Category,
+			&rc.DocumentID, &rc.DocumentFilename, &rc.DocumentType, &rc.Years, &rc.RetentionStart, &rc.DueAt,
+			&rc.Status, &rc.CreatedAt, &rc.DecidedBy, &rc.DecidedByName, &decidedAt, &rc.Reason); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if decidedAt.Valid {
+			rc.DecidedAt = &decidedAt.Time
+		}
+		candidates = append(candidates, rc)
+	}
+
+	json.NewEncoder(w).Encode(candidates)
+}
+
+// check prüft die Aufbewahrungsfristen sofort.
+func (h *retentionHandlers) check(w http.ResponseWriter, r *http.Request) {
+	proposed, err := checkRetention(h.repos.db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  fmt.Sprintf("Neue Löschvorschläge: %d", proposed),
+		"proposed": proposed,
+	})
+}
+
+// approve genehmigt einen Löschvorschlag und löscht den Vertrag bzw. das Dokument
+// sofort und unwiderruflich. Die Frist wird dabei erneut geprüft, ein inzwischen
+// gesetzter Legal Hold verhindert das Löschen.
+func (h *retentionHandlers) approve(w http.ResponseWriter, r *http.Request) {
+	retentionMu.Lock()
+	defer retentionMu.Unlock()
+
+	var contractID int
+	var documentID sql.NullInt64
+	var status string
+	err := h.repos.db.QueryRow("SELECT contract_id, document_id, status FROM retention_candidates WHERE id = ?", r.PathValue("id")).
+		Scan(&contractID, &documentID, &status)
+	if err != nil {
+		http.Error(w, "Löschvorschlag nicht gefunden", http.StatusNotFound)
+		return
+	}
+	if status != retentionPending {
+		http.Error(w, "Löschvorschlag wurde abgelehnt", http.StatusConflict)
+		return
+	}
+
+	var hold bool
+	h.repos.db.QueryRow("SELECT legal_hold FROM contracts WHERE id = ?", contractID).Scan(&hold)
+	if hold {
+		http.Error(w, errLegalHold, http.StatusConflict)
+		return
+	}
+	items, err := dueRetentionItems(h.repos.db, "c.id = ?", contractID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var item *retentionItem
+	for i := range items {
+		if items[i].DocumentID == int(documentID.Int64) {
+			item = &items[i]
+		}
+	}
+	if item == nil {
+		http.Error(w, "Löschvorschlag ist nicht mehr aktuell, bitte die Fristen neu prüfen", http.StatusConflict)
+		return
+	}
+
+	userID := mustAtoi(r.Header.Get("X-User-ID"))
+	if item.DocumentID != 0 {
+		err = purgeDocument(r.Context(), h.repos, *item, userID)
+	} else {
+		var c *Contract
+		if c, err = h.repos.Contracts.Get(r.Context(), item.ContractID); err == nil {
+			err = purgeContract(r.Context(), h.repos.db, c, userID, item.tombstone())
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reject lehnt einen Löschvorschlag mit Begründung ab.
+func (h *retentionHandlers) reject(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		http.Error(w, "Begründung darf nicht leer sein", http.StatusBadRequest)
+		return
+	}
+
+	var contractID int
+	var documentID sql.NullInt64
+	var dueAt time.Time
+	if err := h.repos.db.QueryRow("SELECT contract_id, document_id, due_at FROM retention_candidates WHERE id = ? AND status = ?", id, retentionPending).
+		Scan(&contractID, &documentID, &dueAt); err != nil {
+		http.Error(w, "Offener Löschvorschlag nicht gefunden", http.StatusNotFound)
+		return
+	}
+	userID := mustAtoi(r.Header.Get("X-User-ID"))
+
+	tx, err := h.repos.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE retention_candidates SET status = ?, decided_by = ?, decided_at = ?, reason = ? WHERE id = ?",
+		retentionRejected, userID, time.Now(), req.Reason, id)
+	if err == nil {
+		entity, entityID := "contract", contractID
+		if documentID.Valid {
+			entity, entityID = "document", int(documentID.Int64)
+		}
+		err = writeAudit(tx, auditRetentionRejected, entity, entityID, userID,
+			map[string]interface{}{"contract_id": contractID, "due_at": dueAt, "reason": req.Reason})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setLegalHold setzt oder entfernt den Legal Hold eines Vertrags. Solange er gesetzt
+// ist, werden weder der Vertrag noch seine Dokumente gelöscht.
+func (h *contractHandlers) setLegalHold(w http.ResponseWriter, r *http.Request) {
+	id := mustAtoi(r.PathValue("id"))
+	var req struct {
+		LegalHold bool   `json:"legal_hold"`
+		Reason    string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.LegalHold && req.Reason == "" {
+		http.Error(w, "Für einen Legal Hold ist eine Begründung erforderlich", http.StatusBadRequest)
+		return
+	}
+
+	retentionMu.Lock()
+	defer retentionMu.Unlock()
+
+	previous, err := h.contracts.Get(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Contract not found", http.StatusNotFound)
+		return
+	}
+	if !req.LegalHold && !previous.LegalHold {
+		json.NewEncoder(w).Encode(previous)
+		return
+	}
+
+	tx, err := h.repos.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	userID := mustAtoi(r.Header.Get("X-User-ID"))
+	if req.LegalHold {
+		_, err = tx.Exec("UPDATE contracts SET legal_hold = TRUE, legal_hold_reason = ? WHERE id = ?", req.Reason, id)
+		if err == nil {
+			_, err = tx.Exec("DELETE FROM retention_candidates WHERE contract_id = ? AND status = ?", id, retentionPending)
+		}
+		if err == nil {
+			err = writeAudit(tx, auditLegalHoldSet, "contract", previous.ID, userID, map[string]string{"reason": req.Reason})
+		}
+	} else {
+		_, err = tx.Exec("UPDATE contracts SET legal_hold = FALSE, legal_hold_reason = NULL WHERE id = ?", id)
+		if err == nil {
+			err = writeAudit(tx, auditLegalHoldReleased, "contract", previous.ID, userID, map[string]interface{}{"reason": previous.LegalHoldReason})
+		}
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !req.LegalHold {
+		wakeRetentionCheck()
+	}
+
+	updated, err := h.contracts.Get(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	emitContractEvent(h.repos.db, eventContractUpdated, *updated, previous)
+	publishChange(changeContractUpdated, map[string]interface{}{"contract": updated})
+
+	json.NewEncoder(w).Encode(updated)
+}
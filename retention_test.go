@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRetentionDue(t *testing.T) {
+	tests := []struct {
+		start string
+		years int
+		want  string
+	}{
+		{"2020-01-01", 10, "2031-01-01"},
+		{"2020-12-31", 10, "2031-01-01"},
+		{"2024-02-29", 6, "2031-01-01"},
+	}
+	for _, tt := range tests {
+		if got := retentionDue(date(tt.start), tt.years); got.Format("2006-01-02") != tt.want {
+			t.Errorf("retentionDue(%s, %d) = %s, erwartet %s", tt.start, tt.years, got.Format("2006-01-02"), tt.want)
+		}
+	}
+}
+
+func TestRetention(t *testing.T) {
+	s := newTestServer(t)
+
+	var categories []Category
+	s.expect("GET", "/categories", s.admin, nil, http.StatusOK, &categories)
+	var it Category
+	for _, c := range categories {
+		if c.Name == "IT" {
+			it = c
+		}
+	}
+
+	var rule RetentionRule
+	s.expect("POST", "/retention/rules", s.admin, map[string]interface{}{"category_id": it.ID, "years": 10}, http.StatusCreated, &rule)
+	if rule.Category != "IT" {
+		t.Errorf("Regel: %+v", rule)
+	}
+	s.expect("POST", "/retention/rules", s.admin, map[string]interface{}{"category_id": it.ID, "years": 6}, http.StatusConflict, nil)
+	for name, body := range map[string]map[string]interface{}{
+		"null Jahre":           {"category_id": it.ID, "years": 0},
+		"zu lang":              {"category_id": it.ID, "years": maxRetentionYears + 1},
+		"unbekannte Kategorie": {"category_id": 999, "years": 10},
+		"unbekannter Typ":      {"category_id": it.ID, "document_type": "brief", "years": 10},
+	} {
+		resp := s.do("POST", "/retention/rules", s.admin, body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: Status %d statt 400", name, resp.StatusCode)
+		}
+	}
+
+	// Fällig sind nur abgelaufene Verträge der Kategorie ohne Legal Hold
+	expired := s.createContract(map[string]interface{}{"title": "Alt", "valid_from": "1990-01-01T00:00:00Z", "valid_until": "2000-12-31T00:00:00Z"})
+	held := s.createContract(map[string]interface{}{"title": "Streitfall", "valid_from": "1990-01-01T00:00:00Z", "valid_until": "2000-12-31T00:00:00Z"})
+	rejected := s.createContract(map[string]interface{}{"title": "Aufheben", "valid_from": "1990-01-01T00:00:00Z", "valid_until": "2000-12-31T00:00:00Z"})
+	s.createContract(map[string]interface{}{"title": "Laufend", "valid_from": "1990-01-01T00:00:00Z"})
+	s.createContract(map[string]interface{}{"title": "Gebäude", "category": "Gebäude", "valid_from": "1990-01-01T00:00:00Z", "valid_until": "2000-12-31T00:00:00Z"})
+	s.expect("PUT", fmt.Sprintf("/contracts/%d/legal-hold", held.ID), s.admin, map[string]interface{}{"legal_hold": true}, http.StatusBadRequest, nil)
+	s.expect("PUT", fmt.Sprintf("/contracts/%d/legal-hold", held.ID), s.admin, map[string]interface{}{"legal_hold": true, "reason": "Klage"}, http.StatusOK, nil)
+
+	var run struct {
+		Proposed int `json:"proposed"`
+	}
+	s.expect("POST", "/retention/run", s.admin, nil, http.StatusOK, &run)
+	if run.Proposed != 2 {
+		t.Errorf("%d Löschvorschläge statt 2", run.Proposed)
+	}
+	var candidates []RetentionCandidate
+	s.expect("GET", "/retention/candidates", s.admin, nil, http.StatusOK, &candidates)
+	byContract := map[int]RetentionCandidate{}
+	for _, c := range candidates {
+		byContract[c.ContractID] = c
+	}
+	if len(candidates) != 2 || byContract[expired.ID].ID == 0 || byContract[rejected.ID].ID == 0 {
+		t.Fatalf("Löschvorschläge: %+v", candidates)
+	}
+	if due := byContract[expired.ID].DueAt; due.Year() != 2011 {
+		t.Errorf("Frist endet %s", due)
+	}
+	s.expect("GET", "/retention/candidates?status=deleted", s.admin, nil, http.StatusBadRequest, nil)
+
+	// Ablehnen nur mit Begründung; abgelehnte Vorschläge sind nicht genehmigbar
+	reject := fmt.Sprintf("/retention/candidates/%d/reject", byContract[rejected.ID].ID)
+	s.expect("POST", reject, s.admin, map[string]string{"reason": " "}, http.StatusBadRequest, nil)
+	s.expect("POST", reject, s.admin, map[string]string{"reason": "Steuerprüfung"}, http.StatusNoContent, nil)
+	s.expect("POST", reject, s.admin, map[string]string{"reason": "Steuerprüfung"}, http.StatusNotFound, nil)
+	s.expect("POST", fmt.Sprintf("/retention/candidates/%d/approve", byContract[rejected.ID].ID), s.admin, nil, http.StatusConflict, nil)
+	s.expect("GET", "/retention/candidates?status=rejected", s.admin, nil, http.StatusOK, &candidates)
+	if len(candidates) != 1 || candidates[0].Reason == nil || *candidates[0].Reason != "Steuerprüfung" {
+		t.Errorf("abgelehnt: %+v", candidates)
+	}
+	s.expect("POST", "/retention/run", s.admin, nil, http.StatusOK, &run)
+	if run.Proposed != 0 {
+		t.Errorf("abgelehnter Vorschlag erneut vorgeschlagen")
+	}
+
+	// Ein nachträglicher Legal Hold zieht den Vorschlag zurück
+	hold := fmt.Sprintf("/contracts/%d/legal-hold", expired.ID)
+	s.expect("PUT", hold, s.admin, map[string]interface{}{"legal_hold": true, "reason": "Prüfung"}, http.StatusOK, nil)
+	s.expect("POST", fmt.Sprintf("/retention/candidates/%d/approve", byContract[expired.ID].ID), s.admin, nil, http.StatusNotFound, nil)
+	s.expect("PUT", hold, s.admin, map[string]interface{}{"legal_hold": false}, http.StatusOK, nil)
+	s.expect("POST", "/retention/run", s.admin, nil, http.StatusOK, &run)
+	s.expect("GET", "/retention/candidates", s.admin, nil, http.StatusOK, &candidates)
+	if run.Proposed != 1 || len(candidates) != 1 || candidates[0].ContractID != expired.ID {
+		t.Fatalf("nach dem Legal Hold: %+v", candidates)
+	}
+	approve := fmt.Sprintf("/retention/candidates/%d/approve", candidates[0].ID)
+	s.expect("POST", approve, s.admin, nil, http.StatusNoContent, nil)
+	s.expect("GET", fmt.Sprintf("/contracts/%d", expired.ID), s.admin, nil, http.StatusNotFound, nil)
+	s.expect("POST", approve, s.admin, nil, http.StatusNotFound, nil)
+
+	// Der Grabstein enthält keine personenbezogenen Daten
+	var entries []AuditEntry
+	s.expect("GET", fmt.Sprintf("/audit-log?event=%s&entity_id=%d", auditContractPurged, expired.ID), s.admin, nil, http.StatusOK, &entries)
+	if len(entries) != 1 {
+		t.Fatalf("Prüfprotokoll: %+v", entries)
+	}
+	if body := string(entries[0].Details); !strings.Contains(body, `"reason":"retention"`) || strings.Contains(body, "Alt") || strings.Contains(body, "ACME") {
+		t.Errorf("Grabstein: %s", body)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Zugriffsstufen der Routen
+const (
+	accessPublic = "öffentlich"
+	accessAuth   = "angemeldet"
+	accessAdmin  = "admin"
+)
+
+// apiRoutes sind alle Routen der API mit der erwarteten Zugriffsstufe.
+// TestRouteTableComplete hält die Liste mit newRouter abgeglichen.
+var apiRoutes = []struct {
+	method, path, access string
+}{
+	{"POST", "/login", accessPublic},
+	{"GET", "/events", accessAuth},
+
+	{"GET", "/users", accessAuth},
+	{"POST", "/users", accessAdmin},
+	{"PUT", "/users/{id}", accessAdmin},
+	{"DELETE", "/users/{id}", accessAdmin},
+
+	{"GET", "/contracts", accessAuth},
+	{"POST", "/contracts", accessAdmin},
+	{"POST", "/contracts/calculate-dates", accessAdmin},
+	{"POST", "/contracts/import", accessAdmin},
+	{"GET", "/contracts/dossier", accessAuth},
+	{"GET", "/contracts/{id}", accessAuth},
+	{"GET", "/contracts/{id}/dossier", accessAuth},
+	{"PUT", "/contracts/{id}", accessAdmin},
+	{"POST", "/contracts/{id}/terminate", accessAdmin},
+	{"PUT", "/contracts/{id}/legal-hold", accessAdmin},
+	{"DELETE", "/contracts/{id}", accessAdmin},
+	{"POST", "/contracts/{id}/restore", accessAdmin},
+
+	{"GET", "/contracts/{id}/documents", accessAuth},
+	{"POST", "/contracts/{id}/documents", accessAdmin},
+	{"GET", "/documents/{docId}", accessAuth},
+	{"PUT", "/documents/{docId}", accessAdmin},
+	{"DELETE", "/documents/{docId}", accessAdmin},
+	{"POST", "/documents/{docId}/restore", accessAdmin},
+	{"GET", "/documents/{docId}/download", accessAuth},
+	{"GET", "/documents/{docId}/thumbnail", accessAuth},
+	{"GET", "/documents/{docId}/versions", accessAuth},
+	{"POST", "/documents/{docId}/versions", accessAdmin},
+	{"GET", "/documents/{docId}/versions/{version}/download", accessAuth},
+	{"GET", "/documents/{docId}/text", accessAuth},
+	{"POST", "/documents/{docId}/reindex", accessAdmin},
+	{"POST", "/documents/reindex", accessAdmin},
+	{"GET", "/quarantine", accessAdmin},
+	{"DELETE", "/quarantine/{id}", accessAdmin},
+
+	{"GET", "/search", accessAuth},
+	{"GET", "/saved-searches", accessAuth},
+	{"POST", "/saved-searches", accessAuth},
+	{"GET", "/saved-searches/{id}", accessAuth},
+	{"PUT", "/saved-searches/{id}", accessAuth},
+	{"DELETE", "/saved-searches/{id}", accessAuth},
+	{"GET", "/saved-searches/{id}/contracts", accessAuth},
+
+	{"GET", "/dashboard", accessAuth},
+	{"GET", "/dashboard/widgets", accessAuth},
+	{"POST", "/dashboard/widgets", accessAuth},
+	{"PUT", "/dashboard/widgets/{id}", accessAuth},
+	{"DELETE", "/dashboard/widgets/{id}", accessAuth},
+
+	{"GET", "/reports/expiring", accessAuth},
+	{"GET", "/reports/portfolio", accessAuth},
+	{"GET", "/report-subscriptions", accessAuth},
+	{"POST", "/report-subscriptions", accessAuth},
+	{"GET", "/report-subscriptions/{id}", accessAuth},
+	{"PUT", "/report-subscriptions/{id}", accessAuth},
+	{"DELETE", "/report-subscriptions/{id}", accessAuth},
+	{"POST", "/report-subscriptions/{id}/run", accessAuth},
+	{"GET", "/report-subscriptions/{id}/runs", accessAuth},
+
+	{"GET", "/webhooks", accessAdmin},
+	{"POST", "/webhooks", accessAdmin},
+	{"GET", "/webhooks/{id}", accessAdmin},
+	{"PUT", "/webhooks/{id}", accessAdmin},
+	{"DELETE", "/webhooks/{id}", accessAdmin},
+	{"POST", "/webhooks/{id}/test", accessAdmin},
+	{"GET", "/webhooks/{id}/deliveries", accessAdmin},
+	{"POST", "/webhooks/{id}/deliveries/{deliveryId}/redeliver", accessAdmin},
+
+	{"GET", "/retention/rules", accessAdmin},
+	{"POST", "/retention/rules", accessAdmin},
+	{"PUT", "/retention/rules/{id}", accessAdmin},
+	{"DELETE", "/retention/rules/{id}", accessAdmin},
+	{"GET", "/retention/candidates", accessAdmin},
+	{"POST", "/retention/candidates/{id}/approve", accessAdmin},
+	{"POST", "/retention/candidates/{id}/reject", accessAdmin},
+	{"POST", "/retention/run", accessAdmin},
+	{"GET", "/audit-log", accessAdmin},
+
+	{"GET", "/categories", accessAuth},
+	{"POST", "/categories", accessAdmin},
+	{"PUT", "/categories/{id}", accessAdmin},
+	{"DELETE", "/categories/{id}", accessAdmin},
+	{"POST", "/categories/{id}/restore", accessAdmin},
+
+	{"GET", "/trash", accessAdmin},
+	{"DELETE", "/trash/contracts/{id}", accessAdmin},
+	{"DELETE", "/trash/categories/{id}", accessAdmin},
+
+	{"GET", "/backups", accessAdmin},
+	{"POST", "/backups", accessAdmin},
+	{"GET", "/backups/{name}", accessAdmin},
+}
+
+// routePattern findet die Routen der API in main.go.
+var routePattern = regexp.MustCompile(`r\.HandleFunc\("([A-Z]+) "\+base\+"([^"]+)"`)
+
+func TestRouteTableComplete(t *testing.T) {
+	src, err := os.ReadFile("main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registered := map[string]bool{}
+	for _, m := range routePattern.FindAllStringSubmatch(string(src), -1) {
+		registered[m[1]+" "+m[2]] = true
+	}
+	if len(registered) == 0 {
+		t.Fatal("keine Routen in main.go gefunden")
+	}
+	listed := map[string]bool{}
+	for _, route := range apiRoutes {
+		key := route.method + " " + route.path
+		listed[key] = true
+		if !registered[key] {
+			t.Errorf("%s fehlt in newRouter", key)
+		}
+	}
+	for key := range registered {
+		if !listed[key] {
+			t.Errorf("%s fehlt in apiRoutes", key)
+		}
+	}
+}
+
+// routePath setzt in die Platzhalter einer Route Werte ein, zu denen es nichts gibt.
+func routePath(path string) string {
+	return strings.NewReplacer("{id}", "999", "{docId}", "999", "{deliveryId}", "999",
+		"{version}", "1", "{name}", "vertragsdb-20000101-000000.tar.gz").Replace(path)
+}
+
+func TestRouteAccess(t *testing.T) {
+	s := newTestServer(t)
+
+	expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{UserID: 1, Username: "admin", Role: "admin",
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Hour))}}).SignedString(jwtSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{UserID: 1, Username: "admin", Role: "admin",
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}}).SignedString([]byte("falsch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, route := range apiRoutes {
+		if route.access == accessPublic {
+			continue
+		}
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			path := routePath(route.path)
+			for name, token := range map[string]string{"ohne Token": "", "abgelaufen": expired, "falsch signiert": forged, "kein JWT": "abc"} {
+				resp := s.do(route.method, path, token, nil)
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusUnauthorized {
+					t.Errorf("%s: Status %d statt 401", name, resp.StatusCode)
+				}
+			}
+
+			status := s.viewerStatus(route.method, path)
+			switch route.access {
+			case accessAdmin:
+				if status != http.StatusForbidden {
+					t.Errorf("Viewer: Status %d statt 403", status)
+				}
+			case accessAuth:
+				if status == http.StatusUnauthorized || status == http.StatusForbidden {
+					t.Errorf("Viewer: Status %d", status)
+				}
+			}
+		})
+	}
+}
+
+// viewerStatus liefert den Status einer Anfrage des Viewers. Die Antwort wird nicht
+// gelesen, damit auch der Ereignisstrom sofort endet.
+func (s *testServer) viewerStatus(method, path string) int {
+	s.t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, s.URL+"/vertragsdb/api"+path, nil)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.viewer)
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestLogin(t *testing.T) {
+	s := newTestServer(t)
+
+	var resp struct {
+		Token string `json:"token"`
+		User  User   `json:"user"`
+	}
+	s.expect("POST", "/login", "", map[string]string{"username": "admin", "password": "admin"}, http.StatusOK, &resp)
+	if resp.User.Username != "admin" || resp.User.Role != "admin" {
+		t.Errorf("angemeldet als %+v", resp.User)
+	}
+	claims, err := verifyToken(resp.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != resp.User.ID || claims.Role != "admin" {
+		t.Errorf("Token für %+v", claims)
+	}
+
+	for name, body := range map[string]interface{}{
+		"falsches Passwort":  map[string]string{"username": "admin", "password": "falsch"},
+		"unbekannter Nutzer": map[string]string{"username": "niemand", "password": "admin"},
+		"leer":               map[string]string{},
+	} {
+		resp := s.do("POST", "/login", "", body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: Status %d statt 401", name, resp.StatusCode)
+		}
+	}
+	resp2 := s.do("POST", "/login", "", strings.NewReader("{"))
+	resp2.Body.Close()
+	if resp2.StatusCode != http.StatusBadRequest {
+		t.Errorf("ungültiges JSON: Status %d statt 400", resp2.StatusCode)
+	}
+}
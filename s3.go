@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3Config enthält den Zugang zu einem S3-kompatiblen Speicher (AWS S3, MinIO, Ceph …).
+// Er wird über die Umgebungsvariablen VERTRAGSDB_S3_ENDPOINT, VERTRAGSDB_S3_REGION,
+// VERTRAGSDB_S3_BUCKET, VERTRAGSDB_S3_PREFIX, VERTRAGSDB_S3_ACCESS_KEY,
+// VERTRAGSDB_S3_SECRET_KEY und VERTRAGSDB_S3_PATH_STYLE gesetzt.
+type s3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool // Bucket im Pfad statt im Hostnamen, nötig für MinIO
+}
+
+func loadS3Config() s3Config {
+	cfg := s3Config{
+		Endpoint:  os.Getenv("VERTRAGSDB_S3_ENDPOINT"),
+		Region:    os.Getenv("VERTRAGSDB_S3_REGION"),
+		Bucket:    os.Getenv("VERTRAGSDB_S3_BUCKET"),
+		Prefix:    os.Getenv("VERTRAGSDB_S3_PREFIX"),
+		AccessKey: os.Getenv("VERTRAGSDB_S3_ACCESS_KEY"),
+		SecretKey: os.Getenv("VERTRAGSDB_S3_SECRET_KEY"),
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	// Eigene Endpunkte sind meist MinIO o. Ä. und erwarten den Bucket im Pfad
+	cfg.PathStyle = cfg.Endpoint != ""
+	if v := os.Getenv("VERTRAGSDB_S3_PATH_STYLE"); v != "" {
+		cfg.PathStyle, _ = strconv.ParseBool(v)
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	return cfg
+}
+
+const (
+	s3PartSize        = 8 << 20 // Teilgröße für Uploads unbekannter Länge
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3EmptyHash       = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// s3Storage spricht die S3-REST-API direkt mit Signature Version 4 an.
+type s3Storage struct {
+	cfg      s3Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+func newS3Storage(cfg s3Config) (*s3Storage, error) {
+	if cfg.Bucket == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("VERTRAGSDB_S3_BUCKET, VERTRAGSDB_S3_ACCESS_KEY und VERTRAGSDB_S3_SECRET_KEY müssen gesetzt sein")
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("ungültiger S3-Endpunkt: %s", cfg.Endpoint)
+	}
+	// Kein Gesamt-Timeout: Downloads großer Dateien dürfen beliebig lange dauern
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: time.Minute,
+		IdleConnTimeout:       90 * time.Second,
+	}}
+	return &s3Storage{cfg: cfg, endpoint: endpoint, client: client, now: time.Now}, nil
+}
+
+func (s *s3Storage) String() string {
+	return "s3:" + s.cfg.Bucket + "/" + s.cfg.Prefix
+}
+
+// objectURL liefert die URL eines Objekts; query sind zusätzliche Parameter (z. B. uploadId).
+func (s *s3Storage) objectURL(key string, query url.Values) *url.URL {
+	u := *s.endpoint
+	objectPath := strings.TrimSuffix(u.Path, "/")
+	if s.cfg.PathStyle {
+		objectPath += "/" + s.cfg.Bucket
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+	}
+	objectPath += "/" + s.cfg.Prefix + key
+	u.Path = objectPath
+	u.RawPath = s3Escape(objectPath, false)
+	u.RawQuery = s3CanonicalQuery(query)
+	return &u
+}
+
+// s3Escape kodiert wie von SigV4 verlangt alles außer A-Z, a-z, 0-9, -, _, . und ~;
+// Schrägstriche bleiben in Pfaden erhalten.
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// sign setzt die Header x-amz-date, x-amz-content-sha256 und Authorization
+// (AWS Signature Version 4). Signiert werden Host, Content-Type, Range und alle x-amz-Header.
+func (s *s3Storage) sign(req *http.Request, payloadHash string) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" || lower == "content-md5" || lower == "range" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + s.cfg.Region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), day)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+// s3Error ist die XML-Fehlermeldung von S3.
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// do sendet eine signierte Anfrage. Antworten außerhalb von 2xx werden als Fehler
+// geliefert, 404 als errStorageNotFound.
+func (s *s3Storage) do(ctx context.Context, method string, u *url.URL, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	req, err := newS3Request(ctx, method, u, body, size)
+	if err != nil {
+		return nil, err
+	}
+	return s.send(req, payloadHash)
+}
+
+func newS3Request(ctx context.Context, method string, u *url.URL, body io.Reader, size int64) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	// NewRequest parst die URL neu; die eigene Kodierung des Pfads muss erhalten bleiben
+	req.URL = u
+	if size >= 0 {
+		req.ContentLength = size
+	}
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	return req, nil
+}
+
+// send signiert und sendet eine Anfrage, siehe do.
+func (s *s3Storage) send(req *http.Request, payloadHash string) (*http.Response, error) {
+	method, u := req.Method, req.URL
+	s.sign(req, payloadHash)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errStorageNotFound
+	}
+	var e s3Error
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if xml.Unmarshal(data, &e) == nil && e.Code != "" {
+		return nil, fmt.Errorf("S3 %s %s: %s (%s)", method, u.Path, e.Code, e.Message)
+	}
+	return nil, fmt.Errorf("S3 %s %s: %s", method, u.Path, resp.Status)
+}
+
+// Put lädt Dateien bekannter Länge mit einem einzelnen PUT hoch. Bei unbekannter
+// Länge wird ab s3PartSize ein Multipart-Upload verwendet, gepuffert wird nur ein Teil.
+func (s *s3Storage) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if err := validStorageKey(key); err != nil {
+		return err
+	}
+	if size >= 0 {
+		resp, err := s.do(ctx, http.MethodPut, s.objectURL(key, nil), r, size, s3UnsignedPayload)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	part := make([]byte, s3PartSize)
+	n, err := io.ReadFull(r, part)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return s.Put(ctx, key, bytes.NewReader(part[:n]), int64(n))
+	}
+	if err != nil {
+		return err
+	}
+	return s.putMultipart(ctx, key, r, part)
+}
+
+func (s *s3Storage) putMultipart(ctx context.Context, key string, r io.Reader, first []byte) error {
+	resp, err := s.do(ctx, http.MethodPost, s.objectURL(key, url.Values{"uploads": {""}}), nil, 0, s3EmptyHash)
+	if err != nil {
+		return err
+	}
+	var initiate struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&initiate)
+	resp.Body.Close()
+	if err != nil || initiate.UploadID == "" {
+		return fmt.Errorf("S3-Multipart-Upload nicht gestartet: %v", err)
+	}
+
+	type completedPart struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	var parts []completedPart
+	upload := func() error {
+		part := first
+		for number := 1; ; number++ {
+			query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {initiate.UploadID}}
+			resp, err := s.do(ctx, http.MethodPut, s.objectURL(key, query), bytes.NewReader(part), int64(len(part)), s3UnsignedPayload)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			parts = append(parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+
+			part = first[:s3PartSize]
+			n, err := io.ReadFull(r, part)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil && err != io.ErrUnexpectedEOF {
+				return err
+			}
+			part = part[:n]
+		}
+	}
+	if err := upload(); err != nil {
+		// Unvollständige Teile würden sonst Speicher belegen
+		if resp, abortErr := s.do(context.Background(), http.MethodDelete,
+			s.objectURL(key, url.Values{"uploadId": {initiate.UploadID}}), nil, 0, s3EmptyHash); abortErr == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(body)
+	resp, err = s.do(ctx, http.MethodPost, s.objectURL(key, url.Values{"uploadId": {initiate.UploadID}}),
+		bytes.NewReader(body), int64(len(body)), hex.EncodeToString(hash[:]))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// S3 kann trotz Status 200 einen Fehler im Body melden
+	var e s3Error
+	if data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10)); xml.Unmarshal(data, &e) == nil && e.Code != "" {
+		return fmt.Errorf("S3-Multipart-Upload nicht abgeschlossen: %s (%s)", e.Code, e.Message)
+	}
+	return nil
+}
+
+func (s *s3Storage) Get(ctx context.Context, key string) (io.ReadCloser, StorageInfo, error) {
+	if err := validStorageKey(key); err != nil {
+		return nil, StorageInfo{}, err
+	}
+	resp, err := s.do(ctx, http.MethodGet, s.objectURL(key, nil), nil, 0, s3EmptyHash)
+	if err != nil {
+		return nil, StorageInfo{}, err
+	}
+	info := s3Info(resp)
+	return &s3Object{s: s, ctx: ctx, key: key, body: resp.Body, size: info.Size}, info, nil
+}
+
+// s3Object ist ein geöffnetes Objekt. Nach einem Seek wird ab der neuen Position mit
+// einer Range-Anfrage weitergelesen; so unterstützen auch Downloads aus S3
+// Range-Anfragen, ohne dass das Objekt vorher vollständig gelesen wird.
+type s3Object struct {
+	s       *s3Storage
+	ctx     context.Context
+	key     string
+	body    io.ReadCloser
+	size    int64
+	pos     int64 // Leseposition
+	bodyPos int64 // Position, an der body steht
+}
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.size >= 0 && o.pos >= o.size {
+		return 0, io.EOF
+	}
+	if o.body != nil && o.bodyPos != o.pos {
+		o.body.Close()
+		o.body = nil
+	}
+	if o.body == nil {
+		req, err := newS3Request(o.ctx, http.MethodGet, o.s.objectURL(o.key, nil), nil, 0)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", o.pos))
+		resp, err := o.s.send(req, s3EmptyHash)
+		if err != nil {
+			return 0, err
+		}
+		if resp.StatusCode != http.StatusPartialContent {
+			resp.Body.Close()
+			return 0, fmt.Errorf("S3 GET %s: Range nicht unterstützt (%s)", o.key, resp.Status)
+		}
+		o.body, o.bodyPos = resp.Body, o.pos
+	}
+	n, err := o.body.Read(p)
+	o.pos += int64(n)
+	o.bodyPos += int64(n)
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += o.pos
+	case io.SeekEnd:
+		offset += o.size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative Position")
+	}
+	o.pos = offset
+	return offset, nil
+}
+
+func (o *s3Object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	return o.body.Close()
+}
+
+func (s *s3Storage) Stat(ctx context.Context, key string) (StorageInfo, error) {
+	if err := validStorageKey(key); err != nil {
+		return StorageInfo{}, err
+	}
+	resp, err := s.do(ctx, http.MethodHead, s.objectURL(key, nil), nil, 0, s3EmptyHash)
+	if err != nil {
+		return StorageInfo{}, err
+	}
+	resp.Body.Close()
+	return s3Info(resp), nil
+}
+
+func (s *s3Storage) Delete(ctx context.Context, key string) error {
+	if err := validStorageKey(key); err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, s.objectURL(key, nil), nil, 0, s3EmptyHash)
+	if errors.Is(err, errStorageNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func s3Info(resp *http.Response) StorageInfo {
+	info := StorageInfo{Size: resp.ContentLength}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = t
+	}
+	return info
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SavedSearch ist eine gespeicherte Kombination aus Filtern, Sortierung und Spalten.
+type SavedSearch struct {
+	ID              int               `json:"id"`
+	UserID          int               `json:"user_id"`
+	Name            string            `json:"name"`
+	Params          map[string]string `json:"params"`  // Filterparameter wie bei GET /contracts
+	Sort            string            `json:"sort"`    // wie der Parameter sort
+	Columns         []string          `json:"columns"` // wie der Parameter fields, leer = alle
+	SharedWithUsers []int             `json:"shared_with_users"`
+	SharedWithRoles []string          `json:"shared_with_roles"`
+	CreatedAt       time.Time         `json:"created_at"`
+	UpdatedAt       time.Time         `json:"updated_at"`
+}
+
+// savedSearchParams sind die Filterparameter, die in einer gespeicherten Suche erlaubt sind.
+var savedSearchParams = map[string]bool{
+	"search": true, "category": true, "partner": true, "contract_type": true,
+	"framework_contract_id": true, "owner": true, "terminated": true,
+	"has_documents": true, "only_valid": true, "match": true,
+}
+
+func init() {
+	for _, col := range contractDateFilters {
+		savedSearchParams[col+"_from"] = true
+		savedSearchParams[col+"_to"] = true
+	}
+}
+
+// query liefert die Parameter der gespeicherten Suche als URL-Query.
+func (s SavedSearch) query() url.Values {
+	q := url.Values{}
+	for k, v := range s.Params {
+		q.Set(k, v)
+	}
+	if s.Sort != "" {
+		q.Set("sort", s.Sort)
+	}
+	if len(s.Columns) > 0 {
+		q.Set("fields", strings.Join(s.Columns, ","))
+	}
+	return q
+}
+
+// validate prüft Name, Filter, Sortierung, Spalten und Freigaben.
+func (s *SavedSearch) validate(db *DB) error {
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		return fmt.Errorf("Name der Suche darf nicht leer sein")
+	}
+	for k := range s.Params {
+		if !savedSearchParams[k] {
+			return fmt.Errorf("unbekannter Filterparameter: %s", k)
+		}
+	}
+	q := s.query()
+	if _, _, err := contractFilter(db.Dialect, q, s.UserID); err != nil {
+		return err
+	}
+	if _, err := parseListOptions(q, ""); err != nil {
+		return err
+	}
+	for _, role := range s.SharedWithRoles {
+		if role != "admin" && role != "viewer" {
+			return fmt.Errorf("unbekannte Rolle: %s", role)
+		}
+	}
+	for _, id := range s.SharedWithUsers {
+		var exists int
+		db.QueryRow("SELECT COUNT(*) FROM users WHERE id = ?", id).Scan(&exists)
+		if exists == 0 {
+			return fmt.Errorf("Benutzer %d existiert nicht", id)
+		}
+	}
+	return nil
+}
+
+const savedSearchColumns = "id, user_id, name, params, sort, columns, created_at, updated_at"
+
+// accessibleSavedSearches liefert die WHERE-Bedingung für alle Suchen, die ein Benutzer
+// sehen darf: eigene sowie für ihn oder seine Rolle freigegebene.
+func accessibleSavedSearches(userID int, role string) (string, []interface{}) {
+	return `(user_id = ? OR id IN (SELECT saved_search_id FROM saved_search_shares WHERE user_id = ? OR role = ?))`,
+		[]interface{}{userID, userID, role}
+}
+
+func scanSavedSearch(row interface{ Scan(...interface{}) error }) (SavedSearch, error) {
+	var s SavedSearch
+	var params, columns string
+	if err := row.Scan(&s.ID, &s.UserID, &s.Name, &params, &s.Sort, &columns, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return s, err
+	}
+	s.Params = map[string]string{}
+	json.Unmarshal([]byte(params), &s.Params)
+	if columns != "" {
+		s.Columns = strings.Split(columns, ",")
+	}
+	return s, nil
+}
+
+// loadShares ergänzt die Freigaben einer gespeicherten Suche.
+func (s *SavedSearch) loadShares(db *DB) error {
+	rows, err := db.Query("SELECT user_id, role FROM saved_search_shares WHERE saved_search_id = ?", s.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	s.SharedWithUsers = []int{}
+	s.SharedWithRoles = []string{}
+	for rows.Next() {
+		var userID sql.NullInt64
+		var role sql.NullString
+		if err := rows.Scan(&userID, &role); err != nil {
+			continue
+		}
+		if userID.Valid {
+			s.SharedWithUsers = append(s.SharedWithUsers, int(userID.Int64))
+		}
+		if role.Valid {
+			s.SharedWithRoles = append(s.SharedWithRoles, role.String)
+		}
+	}
+	return rows.Err()
+}
+
+// saveShares ersetzt die Freigaben einer gespeicherten Suche.
+func (s *SavedSearch) saveShares(tx *Tx) error {
+	if _, err := tx.Exec("DELETE FROM saved_search_shares WHERE saved_search_id = ?", s.ID); err != nil {
+		return err
+	}
+	for _, id := range s.SharedWithUsers {
+		if _, err := tx.Exec("INSERT INTO saved_search_shares (saved_search_id, user_id) VALUES (?, ?)", s.ID, id); err != nil {
+			return err
+		}
+	}
+	for _, role := range s.SharedWithRoles {
+		if _, err := tx.Exec("INSERT INTO saved_search_shares (saved_search_id, role) VALUES (?, ?)", s.ID, role); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findSavedSearch lädt eine gespeicherte Suche, sofern der Benutzer sie sehen darf.
+func findSavedSearch(db *DB, id string, userID int, role string) (SavedSearch, error) {
+	access, args := accessibleSavedSearches(userID, role)
+	s, err := scanSavedSearch(db.QueryRow("SELECT "+savedSearchColumns+" FROM saved_searches WHERE id = ? AND "+access,
+		append([]interface{}{id}, args...)...))
+	if err != nil {
+		return s, err
+	}
+	return s, s.loadShares(db)
+}
+
+// savedSearchHandlers bedient die gespeicherten Suchen.
+type savedSearchHandlers struct {
+	repos *Repositories
+}
+
+func (h *savedSearchHandlers) list(w http.ResponseWriter, r *http.Request) {
+	userID := mustAtoi(r.Header.Get("X-User-ID"))
+	access, args := accessibleSavedSearches(userID, r.Header.Get("X-User-Role"))
+
+	rows, err := h.repos.db.Query("SELECT "+savedSearchColumns+" FROM saved_searches WHERE "+access+" ORDER BY name", args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var searches []SavedSearch
+	for rows.Next() {
+		s, err := scanSavedSearch(rows)
+		if err != nil {
+			continue
+		}
+		searches = append(searches, s)
+	}
+	rows.Close()
+
+	for i := range searches {
+		searches[i].loadShares(h.repos.db)
+	}
+
+	json.NewEncoder(w).Encode(searches)
+}
+
+func (h *savedSearchHandlers) get(w http.ResponseWriter, r *http.Request) {
+	s, err := findSavedSearch(h.repos.db, r.PathValue("id"), mustAtoi(r.Header.Get("X-User-ID")), r.Header.Get("X-User-Role"))
+	if err != nil {
+		http.Error(w, "Gespeicherte Suche nicht gefunden", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(s)
+}
+
+func (h *savedSearchHandlers) create(w http.ResponseWriter, r *http.Request) {
+	var s SavedSearch
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.UserID = mustAtoi(r.Header.Get("X-User-ID"))
+	if err := s.validate(h.repos.db); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := storeSavedSearch(h.repos.db, &s, true); err != nil {
+		http.Error(w, "Eine Suche mit diesem Namen existiert bereits", http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(s)
+}
+
+// update ändert eine gespeicherte Suche. Nur der Ersteller darf ändern.
+func (h *savedSearchHandlers) update(w http.ResponseWriter, r *http.Request) {
+	userID := mustAtoi(r.Header.Get("X-User-ID"))
+	existing, err := findSavedSearch(h.repos.db, r.PathValue("id"), userID, r.Header.Get("X-User-Role"))
+	if err != nil {
+		http.Error(w, "Gespeicherte Suche nicht gefunden", http.StatusNotFound)
+		return
+	}
+	if existing.UserID != userID {
+		http.Error(w, "Nur der Ersteller kann die Suche ändern", http.StatusForbidden)
+		return
+	}
+
+	var s SavedSearch
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.ID = existing.ID
+	s.UserID = existing.UserID
+	s.CreatedAt = existing.CreatedAt
+	if err := s.validate(h.repos.db); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := storeSavedSearch(h.repos.db, &s, false); err != nil {
+		http.Error(w, "Eine Suche mit diesem Namen existiert bereits", http.StatusConflict)
+		return
+	}
+
+	json.NewEncoder(w).Encode(s)
+}
+
+// storeSavedSearch legt eine Suche samt Freigaben an oder aktualisiert sie.
+func storeSavedSearch(db *DB, s *SavedSearch, create bool) error {
+	params, _ := json.Marshal(s.Params)
+	if s.Params == nil {
+		params = []byte("{}")
+	}
+	columns := strings.Join(s.Columns, ",")
+	s.UpdatedAt = time.Now()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if create {
+		s.CreatedAt = s.UpdatedAt
+		id, err := tx.Insert(`INSERT INTO saved_searches (user_id, name, params, sort, columns, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`, s.UserID, s.Name, string(params), s.Sort, columns, s.CreatedAt, s.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		s.ID = int(id)
+	} else {
+		_, err := tx.Exec("UPDATE saved_searches SET name = ?, params = ?, sort = ?, columns = ?, updated_at = ? WHERE id = ?",
+			s.Name, string(params), s.Sort, columns, s.UpdatedAt, s.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.SharedWithUsers == nil {
+		s.SharedWithUsers = []int{}
+	}
+	if s.SharedWithRoles == nil {
+		s.SharedWithRoles = []string{}
+	}
+	if err := s.saveShares(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// delete löscht eine gespeicherte Suche (Ersteller oder Admin).
+func (h *savedSearchHandlers) delete(w http.ResponseWriter, r *http.Request) {
+	userID := mustAtoi(r.Header.Get("X-User-ID"))
+	role := r.Header.Get("X-User-Role")
+	s, err := findSavedSearch(h.repos.db, r.PathValue("id"), userID, role)
+	if err != nil {
+		http.Error(w, "Gespeicherte Suche nicht gefunden", http.StatusNotFound)
+		return
+	}
+	if s.UserID != userID && role != "admin" {
+		http.Error(w, "Nur der Ersteller kann die Suche löschen", http.StatusForbidden)
+		return
+	}
+
+	tx, err := h.repos.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	tx.Exec("DELETE FROM saved_search_shares WHERE saved_search_id = ?", s.ID)
+	tx.Exec("DELETE FROM dashboard_widgets WHERE type = ? AND "+h.repos.db.Dialect.JSONInt("config", "saved_search_id")+" = ?", widgetSavedSearch, s.ID)
+	if _, err := tx.Exec("DELETE FROM saved_searches WHERE id = ?", s.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// run führt eine gespeicherte Suche aus. limit und offset können
+// zusätzlich übergeben werden.
+func (h *savedSearchHandlers) run(w http.ResponseWriter, r *http.Request) {
+	userID := mustAtoi(r.Header.Get("X-User-ID"))
+	s, err := findSavedSearch(h.repos.db, r.PathValue("id"), userID, r.Header.Get("X-User-Role"))
+	if err != nil {
+		http.Error(w, "Gespeicherte Suche nicht gefunden", http.StatusNotFound)
+		return
+	}
+
+	q := s.query()
+	for _, key := range []string{"limit", "offset", "format", "delimiter", "bom"} {
+		if v := r.URL.Query().Get(key); v != "" {
+			q.Set(key, v)
+		}
+	}
+
+	// owner=me bezieht sich auf den ausführenden Benutzer
+	where, args, err := contractFilter(h.repos.dialect, q, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	listContracts(w, r, h.repos, q, s.Name, where, args, "-created_at")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestSavedSearches(t *testing.T) {
+	s := newTestServer(t)
+	s.createContract(map[string]interface{}{"title": "Leasing Drucker", "category": "IT"})
+	s.createContract(map[string]interface{}{"title": "Reinigung", "category": "Gebäude"})
+
+	var search SavedSearch
+	s.expect("POST", "/saved-searches", s.admin, map[string]interface{}{"name": "IT-Verträge",
+		"params": map[string]string{"category": "IT"}, "sort": "title"}, http.StatusCreated, &search)
+	s.expect("POST", "/saved-searches", s.admin, map[string]interface{}{"name": "IT-Verträge"}, http.StatusConflict, nil)
+	s.expect("POST", "/saved-searches", s.admin, map[string]interface{}{"name": "x", "params": map[string]string{"unbekannt": "1"}}, http.StatusBadRequest, nil)
+	s.expect("POST", "/saved-searches", s.admin, map[string]interface{}{"name": "x", "shared_with_roles": []string{"root"}}, http.StatusBadRequest, nil)
+
+	path := fmt.Sprintf("/saved-searches/%d", search.ID)
+	var contracts []Contract
+	s.expect("GET", path+"/contracts", s.admin, nil, http.StatusOK, &contracts)
+	if len(contracts) != 1 || contracts[0].Title != "Leasing Drucker" {
+		t.Errorf("Ergebnis: %+v", contracts)
+	}
+
+	// Nicht freigegeben: für den Viewer unsichtbar
+	s.expect("GET", path, s.viewer, nil, http.StatusNotFound, nil)
+	s.expect("GET", path+"/contracts", s.viewer, nil, http.StatusNotFound, nil)
+	var searches []SavedSearch
+	s.expect("GET", "/saved-searches", s.viewer, nil, http.StatusOK, &searches)
+	if len(searches) != 0 {
+		t.Errorf("Viewer sieht %+v", searches)
+	}
+
+	// Für die Rolle freigegeben: lesbar, aber nur vom Ersteller änderbar
+	search.SharedWithRoles = []string{"viewer"}
+	s.expect("PUT", path, s.admin, search, http.StatusOK, nil)
+	s.expect("GET", path+"/contracts", s.viewer, nil, http.StatusOK, &contracts)
+	if len(contracts) != 1 {
+		t.Errorf("Ergebnis für den Viewer: %+v", contracts)
+	}
+	s.expect("PUT", path, s.viewer, search, http.StatusForbidden, nil)
+	s.expect("DELETE", path, s.viewer, nil, http.StatusForbidden, nil)
+
+	s.expect("DELETE", path, s.admin, nil, http.StatusNoContent, nil)
+	s.expect("GET", path, s.admin, nil, http.StatusNotFound, nil)
+}
+
+func TestDashboardWidgets(t *testing.T) {
+	s := newTestServer(t)
+	s.createContract(map[string]interface{}{"annual_cost": 1000})
+
+	var widget DashboardWidget
+	s.expect("POST", "/dashboard/widgets", s.viewer, map[string]interface{}{"type": "cost_by_category", "title": "Kosten"}, http.StatusCreated, &widget)
+	s.expect("POST", "/dashboard/widgets", s.viewer, map[string]interface{}{"type": "unbekannt"}, http.StatusBadRequest, nil)
+	s.expect("POST", "/dashboard/widgets", s.viewer, map[string]interface{}{"type": "saved_search", "config": map[string]int{"saved_search_id": 999}}, http.StatusBadRequest, nil)
+
+	var dashboard []struct {
+		DashboardWidget
+		Data  []CategoryCost `json:"data"`
+		Error string         `json:"error"`
+	}
+	s.expect("GET", "/dashboard", s.viewer, nil, http.StatusOK, &dashboard)
+	if len(dashboard) != 1 || dashboard[0].Error != "" || len(dashboard[0].Data) != 1 || dashboard[0].Data[0].AnnualCost != 1000 {
+		t.Errorf("Dashboard: %+v", dashboard)
+	}
+
+	// Widgets gehören ihrem Benutzer
+	var widgets []DashboardWidget
+	s.expect("GET", "/dashboard/widgets", s.admin, nil, http.StatusOK, &widgets)
+	if len(widgets) != 0 {
+		t.Errorf("Admin sieht %+v", widgets)
+	}
+	path := fmt.Sprintf("/dashboard/widgets/%d", widget.ID)
+	s.expect("DELETE", path, s.admin, nil, http.StatusNotFound, nil)
+
+	widget.Title = "Kosten je Kategorie"
+	s.expect("PUT", path, s.viewer, widget, http.StatusOK, &widget)
+	if widget.Title != "Kosten je Kategorie" {
+		t.Errorf("geändert: %+v", widget)
+	}
+	s.expect("DELETE", path, s.viewer, nil, http.StatusNoContent, nil)
+	s.expect("DELETE", path, s.viewer, nil, http.StatusNotFound, nil)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule ist ein Zeitplan in crontab-Schreibweise mit den fünf Feldern
+// Minute, Stunde, Tag, Monat und Wochentag. Jedes Feld ist eine Bitmaske der
+// erlaubten Werte.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool // Feld war "*", für die ODER-Verknüpfung von Tag und Wochentag
+}
+
+// cronAliases sind die üblichen Kurzformen.
+var cronAliases = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+
+var cronDayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+// parseCron liest einen Zeitplan wie "0 8 * * 1" (montags 08:00) oder "@daily".
+// Erlaubt sind Listen (1,15), Bereiche (1-5), Schritte (*/15, 8-18/2) sowie
+// englische Monats- und Wochentagsnamen. Sonntag ist 0 oder 7.
+func parseCron(spec string) (cronSchedule, error) {
+	var s cronSchedule
+	spec = strings.TrimSpace(spec)
+	if alias, ok := cronAliases[strings.ToLower(spec)]; ok {
+		spec = alias
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return s, fmt.Errorf("Zeitplan %q muss fünf Felder haben (Minute Stunde Tag Monat Wochentag)", spec)
+	}
+
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return s, fmt.Errorf("Zeitplan %q, Minute: %w", spec, err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return s, fmt.Errorf("Zeitplan %q, Stunde: %w", spec, err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return s, fmt.Errorf("Zeitplan %q, Tag: %w", spec, err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return s, fmt.Errorf("Zeitplan %q, Monat: %w", spec, err)
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7, cronDayNames); err != nil {
+		return s, fmt.Errorf("Zeitplan %q, Wochentag: %w", spec, err)
+	}
+	// 7 ist wie 0 der Sonntag
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = fields[2] == "*"
+	s.dowStar = fields[4] == "*"
+	return s, nil
+}
+
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	value := func(s string) (int, error) {
+		if n, ok := names[strings.ToLower(s)]; ok {
+			return n, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("ungültiger Wert %q (erlaubt %d-%d)", s, min, max)
+		}
+		return n, nil
+	}
+
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("ungültige Schrittweite %q", stepPart)
+			}
+			step = n
+		}
+
+		from, to := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			a, b, _ := strings.Cut(rangePart, "-")
+			var err error
+			if from, err = value(a); err != nil {
+				return 0, err
+			}
+			if to, err = value(b); err != nil {
+				return 0, err
+			}
+			if from > to {
+				return 0, fmt.Errorf("ungültiger Bereich %q", rangePart)
+			}
+		default:
+			n, err := value(rangePart)
+			if err != nil {
+				return 0, err
+			}
+			from = n
+			// "5/10" bedeutet wie in cron ab 5 alle 10
+			if !hasStep {
+				to = n
+			}
+		}
+		for i := from; i <= to; i += step {
+			bits |= 1 << i
+		}
+	}
+	return bits, nil
+}
+
+// dayMatches prüft Tag und Wochentag. Sind beide eingeschränkt, genügt wie in
+// cron eines von beiden.
+func (s cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<int(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next liefert den ersten Zeitpunkt des Zeitplans nach after in dessen Zeitzone.
+// Gibt es innerhalb von fünf Jahren keinen (z. B. "0 0 31 2 *"), ist das Ergebnis der Nullwert.
+func (s cronSchedule) next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<int(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<t.Hour()) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<t.Minute()) == 0 {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
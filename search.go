@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const defaultSearchLimit = 50
+
+// SearchResult ist ein Treffer der Volltextsuche.
+type SearchResult struct {
+	Contract Contract `json:"contract"`
+	Score    float64  `json:"score"`   // höher = relevanter
+	Snippet  string   `json:"snippet"` // HTML, Treffer in <mark>
+}
+
+// search durchsucht Vertragsfelder und Dokumenttexte und liefert Treffer nach Relevanz.
+// Alle Filter aus contractFilter sowie limit, offset und fields werden unterstützt.
+func (h *contractHandlers) search(w http.ResponseWriter, r *http.Request) {
+	input := strings.TrimSpace(r.URL.Query().Get("q"))
+	if input == "" {
+		http.Error(w, "Suchbegriff fehlt (Parameter q)", http.StatusBadRequest)
+		return
+	}
+	terms := parseSearchInput(input)
+	if len(terms) == 0 {
+		http.Error(w, "Suchbegriff enthält keine durchsuchbaren Wörter", http.StatusBadRequest)
+		return
+	}
+
+	where, args, err := contractFilter(h.repos.dialect, r.URL.Query(), mustAtoi(r.Header.Get("X-User-ID")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts, err := parseListOptions(r.URL.Query(), "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Limit < 0 {
+		opts.Limit = defaultSearchLimit
+	}
+
+	countQuery, query := h.repos.dialect.Search(where)
+	filterArgs := append([]interface{}{h.repos.dialect.SearchExpression(terms)}, args...)
+
+	var total int
+	if err := h.repos.db.QueryRow(countQuery, filterArgs...).Scan(&total); err != nil {
+		http.Error(w, "Ungültige Suchanfrage: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.repos.db.Query(query, append(filterArgs, opts.Limit, opts.Offset)...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var results []SearchResult
+	var ids []string
+	for rows.Next() {
+		var res SearchResult
+		var snippet string
+		if err := rows.Scan(&res.Contract.ID, &res.Score, &snippet); err != nil {
+			rows.Close()
+			writeError(w, err)
+			return
+		}
+		res.Snippet = highlightSnippet(snippet)
+		results = append(results, res)
+		ids = append(ids, strconv.Itoa(res.Contract.ID))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if len(ids) > 0 {
+		contractRows, err := h.repos.db.Query("SELECT " + opts.selectList() + " FROM contracts WHERE id IN (" + strings.Join(ids, ", ") + ")")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		contracts, err := scanContracts(contractRows)
+		contractRows.Close()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		byID := map[int]Contract{}
+		for _, c := range contracts {
+			byID[c.ID] = c
+		}
+		for i := range results {
+			results[i].Contract = byID[results[i].Contract.ID]
+		}
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if opts.Fields == nil {
+		json.NewEncoder(w).Encode(results)
+		return
+	}
+
+	// Feldauswahl wie bei Vertragslisten auf den eingebetteten Vertrag anwenden
+	contracts := make([]Contract, len(results))
+	for i, res := range results {
+		contracts[i] = res.Contract
+	}
+	projected := projectContracts(contracts, opts.Fields)
+	out := make([]map[string]interface{}, len(results))
+	for i, res := range results {
+		out[i] = map[string]interface{}{
+			"contract": projected[i],
+			"score":    res.Score,
+			"snippet":  res.Snippet,
+		}
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+// highlightSnippet maskiert den Snippet-Text für HTML und setzt die Treffermarkierungen.
+func highlightSnippet(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, "\x02", "<mark>")
+	return strings.ReplaceAll(s, "\x03", "</mark>")
+}
+
+// searchTerm ist ein Begriff der Suche oder, mit Or, die Verknüpfung zweier Begriffe.
+type searchTerm struct {
+	Text   string
+	Prefix bool // Text ist ein Wortanfang
+	Or     bool
+}
+
+// parseSearchInput zerlegt eine Benutzereingabe in Suchbegriffe.
+//
+//   - "mehrere Wörter" sucht die exakte Phrase
+//   - wort* sucht nach dem Präfix, ohne Grundformbildung
+//   - OR verknüpft zwei Begriffe alternativ, sonst müssen alle Begriffe vorkommen
+//   - alle übrigen Wörter werden auf ihre Grundform reduziert und als Präfix gesucht,
+//     so dass z. B. "Verträgen" auch "Vertrag" und "Vertragsende" findet
+func parseSearchInput(input string) []searchTerm {
+	var terms []searchTerm
+	lastWasOr := true // kein OR am Anfang
+
+	addTerm := func(term searchTerm) {
+		terms = append(terms, term)
+		lastWasOr = false
+	}
+
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"':
+			end := strings.IndexByte(input[i+1:], '"')
+			var phrase string
+			if end < 0 {
+				phrase = input[i+1:]
+				i = len(input)
+			} else {
+				phrase = input[i+1 : i+1+end]
+				i += end + 2
+			}
+			if strings.TrimSpace(phrase) != "" {
+				addTerm(searchTerm{Text: phrase})
+			}
+		default:
+			end := strings.IndexAny(input[i:], " \t\n\r\"")
+			var word string
+			if end < 0 {
+				word = input[i:]
+				i = len(input)
+			} else {
+				word = input[i : i+end]
+				i += end
+			}
+			if word == "OR" {
+				if !lastWasOr {
+					terms = append(terms, searchTerm{Or: true})
+					lastWasOr = true
+				}
+				continue
+			}
+			if strings.HasSuffix(word, "*") {
+				word = strings.TrimRight(word, "*")
+				if hasWordChars(word) {
+					addTerm(searchTerm{Text: word, Prefix: true})
+				}
+				continue
+			}
+			if !hasWordChars(word) {
+				continue
+			}
+			addTerm(searchTerm{Text: germanStem(word), Prefix: true})
+		}
+	}
+
+	if len(terms) > 0 && terms[len(terms)-1].Or {
+		terms = terms[:len(terms)-1]
+	}
+	return terms
+}
+
+func hasWordChars(s string) bool {
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
+
+var umlautReplacer = strings.NewReplacer("ä", "a", "ö", "o", "ü", "u", "à", "a", "á", "a", "â", "a",
+	"è", "e", "é", "e", "ê", "e", "ì", "i", "í", "i", "î", "i", "ò", "o", "ó", "o", "ô", "o", "ù", "u", "ú", "u", "û", "u")
+
+// germanStem reduziert ein deutsches Wort auf einen Wortstamm
+// (leichtgewichtiger Stemmer nach J. Savoy). Der Stamm wird als Präfix gesucht,
+// daher darf er eher zu kurz als zu lang sein.
+func germanStem(word string) string {
+	s := []rune(umlautReplacer.Replace(strings.ToLower(word)))
+	original := s
+
+	stEnding := func(r rune) bool {
+		return strings.ContainsRune("bdfghklmnt", r)
+	}
+	hasSuffix := func(suffix string) bool {
+		return strings.HasSuffix(string(s), suffix)
+	}
+
+	// Schritt 1: Flexionsendungen
+	switch {
+	case len(s) > 5 && hasSuffix("ern"):
+		s = s[:len(s)-3]
+	case len(s) > 4 && (hasSuffix("em") || hasSuffix("en") || hasSuffix("er") || hasSuffix("es")):
+		s = s[:len(s)-2]
+	case len(s) > 3 && hasSuffix("e"):
+		s = s[:len(s)-1]
+	case len(s) > 3 && hasSuffix("s") && stEnding(s[len(s)-2]):
+		s = s[:len(s)-1]
+	}
+
+	// Schritt 2: Steigerungs- und weitere Endungen
+	switch {
+	case len(s) > 5 && hasSuffix("est"):
+		s = s[:len(s)-3]
+	case len(s) > 4 && (hasSuffix("er") || hasSuffix("en")):
+		s = s[:len(s)-2]
+	case len(s) > 4 && hasSuffix("st") && stEnding(s[len(s)-3]):
+		s = s[:len(s)-2]
+	}
+
+	if len(s) < 3 {
+		return string(original)
+	}
+	return string(s)
+}
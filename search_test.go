@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestPostgresSearchExpression(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{`"wartung server"`, "(wartung <-> server)"},
+		{`"acme" OR "telekom"`, "(acme) | (telekom)"},
+		{`"acme" "Gebäude"`, "(acme) & (gebaude)"},
+		// Begriffe ohne Buchstaben und Ziffern entfallen mit ihrem OR
+		{`"--" OR "acme"`, "(acme)"},
+		{`"acme" OR "--"`, "(acme)"},
+		{`"acme" OR "--" OR "telekom"`, "(acme) | (telekom)"},
+		{`"--" OR "--"`, ""},
+	}
+	for _, tt := range tests {
+		if got := (postgresDialect{}).SearchExpression(parseSearchInput(tt.input)); got != tt.want {
+			t.Errorf("%s: %q, erwartet %q", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testDatabaseURLEnv wählt eine PostgreSQL-Datenbank für die Tests. Ohne die Variable
+// laufen sie gegen eine SQLite-Datenbank im Testverzeichnis. Die Tests leeren das
+// Schema public vor jedem Test: nur eine eigene Testdatenbank angeben.
+const testDatabaseURLEnv = "VERTRAGSDB_TEST_DATABASE_URL"
+
+// openTestDB richtet für einen Test ein leeres Arbeitsverzeichnis mit lokalem
+// Dokumentenspeicher ein und öffnet eine leere Datenbank, ohne sie zu migrieren.
+// Umgebungsvariablen des Aufrufers beeinflussen die Konfiguration nicht.
+func openTestDB(t testing.TB) *DB {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); strings.HasPrefix(name, "VERTRAGSDB_") && name != testDatabaseURLEnv {
+			t.Setenv(name, "")
+		}
+	}
+	if url := os.Getenv(testDatabaseURLEnv); url != "" {
+		t.Setenv("VERTRAGSDB_DATABASE", "postgres")
+		t.Setenv("VERTRAGSDB_DATABASE_URL", url)
+	}
+	if err := loadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	db, err := openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if db.Dialect.Name() == "postgres" {
+		if _, err := db.Exec("DROP SCHEMA public CASCADE"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec("CREATE SCHEMA public"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// setupTestDB öffnet eine leere Datenbank auf der aktuellen Schema-Version mit dem
+// Standard-Admin und liefert die Repositories dazu.
+func setupTestDB(t testing.TB) *Repositories {
+	t.Helper()
+	db := openTestDB(t)
+	if err := setupDB(db, schemaVersion); err != nil {
+		t.Fatal(err)
+	}
+	return newRepositories(db)
+}
+
+// skipUnlessSQLite überspringt Tests, die nur für SQLite gelten.
+func skipUnlessSQLite(t testing.TB, db *DB) {
+	t.Helper()
+	if db.Dialect.Name() != "sqlite" {
+		t.Skipf("nur für SQLite, nicht für %s", db.Dialect.Name())
+	}
+}
+
+// testServer ist die vollständige API auf einer leeren Datenbank, mit Tokens für den
+// Standard-Admin und einen Viewer.
+type testServer struct {
+	*httptest.Server
+	t      testing.TB
+	repos  *Repositories
+	admin  string
+	viewer string
+}
+
+func newTestServer(t testing.TB) *testServer {
+	t.Helper()
+	repos := setupTestDB(t)
+	s := &testServer{Server: httptest.NewServer(newRouter(repos)), t: t, repos: repos}
+	t.Cleanup(s.Close)
+
+	s.admin = s.login("admin", "admin")
+	s.createUser("viewer", "viewer")
+	s.viewer = s.login("viewer", "viewer")
+	return s
+}
+
+// login meldet einen Benutzer an und liefert sein Token.
+func (s *testServer) login(username, password string) string {
+	s.t.Helper()
+	var resp struct {
+		Token string `json:"token"`
+	}
+	s.expect("POST", "/login", "", map[string]string{"username": username, "password": password}, http.StatusOK, &resp)
+	return resp.Token
+}
+
+// createUser legt einen Benutzer an, dessen Passwort sein Name ist.
+func (s *testServer) createUser(username, role string) *User {
+	s.t.Helper()
+	user, err := s.repos.Users.Create(context.Background(), UserInput{Username: username, Password: username, Role: role})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return user
+}
+
+// createContract legt über die API einen Vertrag an.
+func (s *testServer) createContract(c map[string]interface{}) Contract {
+	s.t.Helper()
+	body := map[string]interface{}{"title": "Wartung", "contract_type": "individual", "category": "IT", "partner": "ACME"}
+	for k, v := range c {
+		body[k] = v
+	}
+	var created Contract
+	s.expect("POST", "/contracts", s.admin, body, http.StatusCreated, &created)
+	return created
+}
+
+// do sendet eine Anfrage an path unterhalb der API. body wird als JSON gesendet,
+// außer es ist bereits ein io.Reader.
+func (s *testServer) do(method, path, token string, body interface{}) *http.Response {
+	s.t.Helper()
+	var reader io.Reader
+	contentType := "application/json"
+	switch b := body.(type) {
+	case nil:
+	case multipartBody:
+		reader, contentType = b.reader, b.contentType
+	case io.Reader:
+		reader = b
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, s.URL+"/vertragsdb/api"+path, reader)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return resp
+}
+
+// expect sendet eine Anfrage, prüft den Status und dekodiert die Antwort nach out,
+// sofern out nicht nil ist. Geliefert wird der Rumpf der Antwort.
+func (s *testServer) expect(method, path, token string, body interface{}, status int, out interface{}) string {
+	s.t.Helper()
+	resp := s.do(method, path, token, body)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if resp.StatusCode != status {
+		s.t.Fatalf("%s %s: Status %d statt %d: %s", method, path, resp.StatusCode, status, strings.TrimSpace(string(data)))
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			s.t.Fatalf("%s %s: %v: %s", method, path, err, data)
+		}
+	}
+	return string(data)
+}
+
+// multipartBody ist ein Upload-Formular für do.
+type multipartBody struct {
+	reader      io.Reader
+	contentType string
+}
+
+// uploadForm baut ein Upload-Formular mit der Datei im Feld "document" und weiteren Feldern.
+func uploadForm(t testing.TB, filename string, content []byte, fields map[string]string) multipartBody {
+	t.Helper()
+	return uploadFormField(t, "document", filename, content, fields)
+}
+
+// uploadFormField baut ein Formular mit der Datei im Feld field.
+func uploadFormField(t testing.TB, field, filename string, content []byte, fields map[string]string) multipartBody {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		if err := mw.WriteField(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fw, err := mw.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(content)
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return multipartBody{&buf, mw.FormDataContentType()}
+}
+
+// testPDF ist eine minimale PDF-Datei; suffix macht den Inhalt unterscheidbar.
+func testPDF(suffix string) []byte {
+	return []byte("%PDF-1.4\n1 0 obj<<>>endobj\ntrailer<<>>\n%%EOF\n% " + suffix + "\n")
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Storage speichert Dokumentdateien unter einem undurchsichtigen Schlüssel. Der
+// Schlüssel steht in documents.storage_key; wo und wie die Datei liegt, entscheidet
+// allein das Backend.
+type Storage interface {
+	// Put speichert den Inhalt von r unter key. size ist die Länge in Byte oder -1,
+	// wenn sie unbekannt ist. Der Inhalt wird gestreamt, nicht vollständig gepuffert.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get öffnet die Datei zum Lesen. Der Aufrufer schließt den Reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, StorageInfo, error)
+	Stat(ctx context.Context, key string) (StorageInfo, error)
+	Delete(ctx context.Context, key string) error
+	String() string
+}
+
+// StorageInfo beschreibt eine gespeicherte Datei.
+type StorageInfo struct {
+	Size    int64
+	ModTime time.Time
+}
+
+var errStorageNotFound = errors.New("Datei nicht im Speicher gefunden")
+
+// store ist das Backend für Dokumente, gewählt über VERTRAGSDB_STORAGE.
+var store Storage
+
+// openStorage erzeugt ein Backend aus den Umgebungsvariablen: "local" (Standard,
+// Verzeichnis VERTRAGSDB_STORAGE_DIR bzw. ./uploads) oder "s3".
+func openStorage(backend string) (Storage, error) {
+	switch backend {
+	case "", "local":
+		dir := os.Getenv("VERTRAGSDB_STORAGE_DIR")
+		if dir == "" {
+			dir = "./uploads"
+		}
+		return newLocalStorage(dir)
+	case "s3":
+		return newS3Storage(loadS3Config())
+	default:
+		return nil, fmt.Errorf("unbekanntes Speicher-Backend: %s", backend)
+	}
+}
+
+// newStorageKey erzeugt den Schlüssel für ein neues Dokument. Er enthält bewusst
+// weder Vertrag noch Dateinamen.
+func newStorageKey() string {
+	return "documents/" + time.Now().Format("2006/01") + "/" + randomHex(16)
+}
+
+// readStoredFile liest eine gespeicherte Datei vollständig, z. B. für die Textextraktion.
+func readStoredFile(key string) ([]byte, error) {
+	r, _, err := store.Get(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// validStorageKey lehnt Schlüssel ab, die aus dem Speicherbereich herausführen.
+func validStorageKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") || path.Clean(key) != key ||
+		key == ".." || strings.HasPrefix(key, "../") {
+		return fmt.Errorf("ungültiger Speicherschlüssel: %q", key)
+	}
+	return nil
+}
+
+// localStorage legt Dateien unterhalb eines Verzeichnisses ab; der Schlüssel ist der relative Pfad.
+type localStorage struct {
+	root string
+}
+
+func newLocalStorage(root string) (*localStorage, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &localStorage{root: root}, nil
+}
+
+func (s *localStorage) String() string {
+	return "local:" + s.root
+}
+
+func (s *localStorage) path(key string) (string, error) {
+	if err := validStorageKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// Put schreibt zunächst in eine temporäre Datei und benennt sie dann um, damit nie
+// eine halb geschriebene Datei unter dem Schlüssel liegt.
+func (s *localStorage) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && size >= 0 && n != size {
+		err = fmt.Errorf("%d statt %d Byte geschrieben", n, size)
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s *localStorage) Get(ctx context.Context, key string) (io.ReadCloser, StorageInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, StorageInfo{}, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, StorageInfo{}, errStorageNotFound
+	}
+	if err != nil {
+		return nil, StorageInfo{}, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, StorageInfo{}, err
+	}
+	return f, StorageInfo{Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+func (s *localStorage) Stat(ctx context.Context, key string) (StorageInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return StorageInfo{}, err
+	}
+	fi, err := os.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return StorageInfo{}, errStorageNotFound
+	}
+	if err != nil {
+		return StorageInfo{}, err
+	}
+	return StorageInfo{Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+func (s *localStorage) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// migrateStorageCommand kopiert alle Dokumente von einem Backend in ein anderes:
+//
+//	vertragsdb migrate-storage -from local -to s3 [-delete] [-dry-run]
+//
+// Bereits vorhandene Dateien gleicher Größe werden übersprungen, ein Abbruch kann
+// also einfach wiederholt werden. Danach VERTRAGSDB_STORAGE umstellen und den
+// Server neu starten.
+func migrateStorageCommand(args []string) error {
+	fset := flag.NewFlagSet("migrate-storage", flag.ContinueOnError)
+	from := fset.String("from", "local", "Quell-Backend (local oder s3)")
+	to := fset.String("to", "s3", "Ziel-Backend (local oder s3)")
+	deleteSource := fset.Bool("delete", false, "Dateien nach erfolgreicher Kopie in der Quelle löschen")
+	dryRun := fset.Bool("dry-run", false, "nur anzeigen, was kopiert würde")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if *from == *to {
+		return fmt.Errorf("Quelle und Ziel sind identisch")
+	}
+	if err := loadConfig(); err != nil {
+		return err
+	}
+
+	src, err := openStorage(*from)
+	if err != nil {
+		return fmt.Errorf("Quelle: %w", err)
+	}
+	dst, err := openStorage(*to)
+	if err != nil {
+		return fmt.Errorf("Ziel: %w", err)
+	}
+	db, err := initDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Alle Versionen, auch von gelöschten Dokumenten, und ihre Miniaturansichten
+	rows, err := db.Query(`SELECT document_id, storage_key FROM document_versions
+		UNION ALL SELECT document_id, thumbnail_key FROM document_versions WHERE thumbnail_key != ''
+		ORDER BY 1, 2`)
+	if err != nil {
+		return err
+	}
+	type docKey struct {
+		id  int
+		key string
+	}
+	var docs []docKey
+	for rows.Next() {
+		var d docKey
+		if err := rows.Scan(&d.id, &d.key); err != nil {
+			rows.Close()
+			return err
+		}
+		docs = append(docs, d)
+	}
+	rows.Close()
+
+	ctx := context.Background()
+	var copied, skipped, failed int
+	for _, d := range docs {
+		info, err := src.Stat(ctx, d.key)
+		if err != nil {
+			log.Printf("Dokument %d (%s): %v", d.id, d.key, err)
+			failed++
+			continue
+		}
+		if existing, err := dst.Stat(ctx, d.key); err == nil && existing.Size == info.Size {
+			skipped++
+		} else if *dryRun {
+			log.Printf("Dokument %d: %s würde kopiert (%d Byte)", d.id, d.key, info.Size)
+			copied++
+			continue
+		} else {
+			if err := copyStorageObject(ctx, src, dst, d.key, d.key); err != nil {
+				log.Printf("Dokument %d (%s): %v", d.id, d.key, err)
+				failed++
+				continue
+			}
+			copied++
+		}
+		if *deleteSource && !*dryRun {
+			if err := src.Delete(ctx, d.key); err != nil {
+				log.Printf("Dokument %d (%s) nicht aus der Quelle gelöscht: %v", d.id, d.key, err)
+			}
+		}
+	}
+
+	log.Printf("Speichermigration %s → %s: %d kopiert, %d bereits vorhanden, %d fehlgeschlagen", src, dst, copied, skipped, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d Dokumente nicht migriert", failed)
+	}
+	return nil
+}
+
+func copyStorageObject(ctx context.Context, src, dst Storage, srcKey, dstKey string) error {
+	r, info, err := src.Get(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return dst.Put(ctx, dstKey, r, info.Size)
+}
@@ -0,0 +1,699 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Berichte, die abonniert werden können
+const (
+	reportExpiring    = "expiring"     // wie GET /reports/expiring
+	reportPortfolio   = "portfolio"    // wie GET /reports/portfolio
+	reportContracts   = "contracts"    // wie GET /contracts
+	reportSavedSearch = "saved_search" // wie GET /saved-searches/{id}/contracts
+)
+
+// Versandarten eines Abonnements
+const (
+	deliveryAttachment = "attachment" // Bericht als Anhang (format pdf, xlsx oder csv)
+	deliveryInline     = "inline"     // Bericht als HTML im Text der E-Mail
+)
+
+// Status eines Berichtslaufs
+const (
+	runPending  = "pending"
+	runRunning  = "running"
+	runRetrying = "retrying"
+	runSent     = "sent"
+	runFailed   = "failed"
+)
+
+// reportRetryDelays sind die Wartezeiten vor dem zweiten, dritten und vierten Versuch.
+var reportRetryDelays = []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute}
+
+// reportSchedulerInterval ist der Abstand, in dem fällige Abonnements geprüft werden.
+const reportSchedulerInterval = 30 * time.Second
+
+// maxRunHistory begrenzt die gespeicherten Läufe je Abonnement.
+const maxRunHistory = 100
+
+// reportWake weckt den Scheduler, z. B. nach einem manuell ausgelösten Lauf.
+var reportWake = make(chan struct{}, 1)
+
+// reportHandlers liefert die Handler, die die abonnierbaren Berichte erzeugen. Der
+// Scheduler ruft sie mit den Rechten des Abonnenten auf, sodass Inhalt und Format
+// genau der API entsprechen.
+func reportHandlers(repos *Repositories) map[string]http.HandlerFunc {
+	contracts := &contractHandlers{repos: repos, contracts: repos.Contracts}
+	searches := &savedSearchHandlers{repos: repos}
+	return map[string]http.HandlerFunc{
+		reportExpiring:    contracts.expiring,
+		reportPortfolio:   contracts.portfolio,
+		reportContracts:   contracts.list,
+		reportSavedSearch: searches.run,
+	}
+}
+
+// validReport meldet, ob report ein abonnierbarer Bericht ist.
+func validReport(report string) bool {
+	switch report {
+	case reportExpiring, reportPortfolio, reportContracts, reportSavedSearch:
+		return true
+	}
+	return false
+}
+
+// ReportSubscription ist ein Abonnement, das einen Bericht nach Zeitplan per E-Mail versendet.
+type ReportSubscription struct {
+	ID         int               `json:"id"`
+	UserID     int               `json:"user_id"`
+	Name       string            `json:"name"`
+	Report     string            `json:"report"`   // expiring, portfolio, contracts oder saved_search
+	Params     map[string]string `json:"params"`   // Filter, days, sort, fields bzw. saved_search_id
+	Format     string            `json:"format"`   // pdf, xlsx oder csv bei Versand als Anhang
+	Delivery   string            `json:"delivery"` // attachment oder inline
+	Recipients []string          `json:"recipients"`
+	Schedule   string            `json:"schedule"` // crontab, z. B. "0 8 * * 1"
+	Enabled    bool              `json:"enabled"`
+	NextRunAt  *time.Time        `json:"next_run_at"`
+	LastRun    *ReportRun        `json:"last_run"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+// ReportRun ist ein Versandlauf eines Abonnements einschließlich Wiederholungen.
+type ReportRun struct {
+	ID             int        `json:"id"`
+	SubscriptionID int        `json:"subscription_id"`
+	ScheduledFor   time.Time  `json:"scheduled_for"`
+	Manual         bool       `json:"manual"`
+	Status         string     `json:"status"` // pending, running, retrying, sent, failed
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at"`
+	StartedAt      *time.Time `json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at"`
+	Error          *string    `json:"error"`
+	Filename       *string    `json:"filename"`
+	Size           *int       `json:"size"`
+}
+
+// subscriptionParams liefert die erlaubten Parameter je Bericht.
+func subscriptionParams(report string) map[string]bool {
+	allowed := map[string]bool{}
+	switch report {
+	case reportSavedSearch:
+		allowed["saved_search_id"] = true
+		return allowed
+	case reportExpiring, reportPortfolio:
+		allowed["days"] = true
+	}
+	for k := range savedSearchParams {
+		allowed[k] = true
+	}
+	if report != reportPortfolio {
+		allowed["sort"] = true
+		allowed["fields"] = true
+	}
+	return allowed
+}
+
+// query liefert die Parameter des Berichts als URL-Query.
+func (s ReportSubscription) query() url.Values {
+	q := url.Values{}
+	for k, v := range s.Params {
+		if k != "saved_search_id" {
+			q.Set(k, v)
+		}
+	}
+	if s.Delivery == deliveryInline {
+		q.Set("format", exportHTML)
+	} else {
+		q.Set("format", s.Format)
+	}
+	return q
+}
+
+// validate prüft Bericht, Parameter, Format, Empfänger und Zeitplan.
+func (s *ReportSubscription) validate(repos *Repositories, role string) error {
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		return fmt.Errorf("Name des Abonnements darf nicht leer sein")
+	}
+	if !validReport(s.Report) {
+		return fmt.Errorf("unbekannter Bericht: %s", s.Report)
+	}
+
+	if s.Params == nil {
+		s.Params = map[string]string{}
+	}
+	allowed := subscriptionParams(s.Report)
+	for k := range s.Params {
+		if !allowed[k] {
+			return fmt.Errorf("unbekannter Parameter für Bericht %s: %s", s.Report, k)
+		}
+	}
+	if d, ok := s.Params["days"]; ok {
+		if n, err := strconv.Atoi(d); err != nil || n < 1 {
+			return fmt.Errorf("ungültiger Wert für days: %s", d)
+		}
+	}
+	if s.Report == reportSavedSearch {
+		if _, err := findSavedSearch(repos.db, s.Params["saved_search_id"], s.UserID, role); err != nil {
+			return fmt.Errorf("gespeicherte Suche %s nicht gefunden", s.Params["saved_search_id"])
+		}
+	} else {
+		q := s.query()
+		if _, _, err := contractFilter(repos.dialect, q, s.UserID); err != nil {
+			return err
+		}
+		if _, err := parseListOptions(url.Values{"sort": {q.Get("sort")}}, ""); err != nil {
+			return err
+		}
+	}
+
+	switch s.Delivery {
+	case deliveryInline:
+		s.Format = exportHTML
+	case deliveryAttachment:
+		switch {
+		case s.Report == reportPortfolio && s.Format != exportPDF:
+			return fmt.Errorf("der Portfolio-Bericht kann nur als pdf versendet werden")
+		case s.Format != exportPDF && s.Format != exportXLSX && s.Format != exportCSV:
+			return fmt.Errorf("unbekanntes Format: %s", s.Format)
+		}
+	default:
+		return fmt.Errorf("unbekannte Versandart: %s", s.Delivery)
+	}
+	if s.Report != reportPortfolio && s.Report != reportSavedSearch {
+		if _, err := parseExportOptions(s.query()); err != nil {
+			return err
+		}
+	}
+
+	if len(s.Recipients) == 0 {
+		return fmt.Errorf("mindestens ein Empfänger ist erforderlich")
+	}
+	for i, addr := range s.Recipients {
+		s.Recipients[i] = strings.TrimSpace(addr)
+		if err := validateMailAddress(s.Recipients[i]); err != nil {
+			return err
+		}
+	}
+
+	schedule, err := parseCron(s.Schedule)
+	if err != nil {
+		return err
+	}
+	if schedule.next(time.Now()).IsZero() {
+		return fmt.Errorf("Zeitplan %q ergibt keinen Termin", s.Schedule)
+	}
+	return nil
+}
+
+// scheduleNext berechnet den nächsten Versandzeitpunkt ab now.
+func (s *ReportSubscription) scheduleNext(now time.Time) {
+	s.NextRunAt = nil
+	if !s.Enabled {
+		return
+	}
+	schedule, err := parseCron(s.Schedule)
+	if err != nil {
+		return
+	}
+	if next := schedule.next(now); !next.IsZero() {
+		s.NextRunAt = &next
+	}
+}
+
+const subscriptionColumns = "id, user_id, name, report, params, format, delivery, recipients, schedule, enabled, next_run_at, created_at, updated_at"
+
+func scanSubscription(row interface{ Scan(...interface{}) error }) (ReportSubscription, error) {
+	var s ReportSubscription
+	var params, recipients string
+	err := row.Scan(&s.ID, &s.UserID, &s.Name, &s.Report, &params, &s.Format, &s.Delivery, &recipients,
+		&s.Schedule, &s.Enabled, &s.NextRunAt, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return s, err
+	}
+	s.Params = map[string]string{}
+	json.Unmarshal([]byte(params), &s.Params)
+	s.Recipients = strings.Split(recipients, ",")
+	return s, nil
+}
+
+// findSubscription lädt ein Abonnement des Benutzers; Administratoren sehen alle.
+func findSubscription(db *DB, id string, userID int, role string) (ReportSubscription, error) {
+	s, err := scanSubscription(db.QueryRow("SELECT "+subscriptionColumns+" FROM report_subscriptions WHERE id = ? AND (user_id = ? OR ? = 'admin')",
+		id, userID, role))
+	if err != nil {
+		return s, err
+	}
+	s.LastRun, err = lastReportRun(db, s.ID)
+	return s, err
+}
+
+const runColumns = "id, subscription_id, scheduled_for, manual, status, attempts, next_attempt_at, started_at, finished_at, error, filename, size"
+
+func scanRun(row interface{ Scan(...interface{}) error }) (ReportRun, error) {
+	var run ReportRun
+	err := row.Scan(&run.ID, &run.SubscriptionID, &run.ScheduledFor, &run.Manual, &run.Status, &run.Attempts,
+		&run.NextAttemptAt, &run.StartedAt, &run.FinishedAt, &run.Error, &run.Filename, &run.Size)
+	return run, err
+}
+
+func lastReportRun(db *DB, subscriptionID int) (*ReportRun, error) {
+	run, err := scanRun(db.QueryRow("SELECT "+runColumns+" FROM report_runs WHERE subscription_id = ? ORDER BY id DESC LIMIT 1", subscriptionID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// storeSubscription legt ein Abonnement an oder aktualisiert es.
+func storeSubscription(db *DB, s *ReportSubscription, create bool) error {
+	params, _ := json.Marshal(s.Params)
+	if s.Params == nil {
+		params = []byte("{}")
+	}
+	recipients := strings.Join(s.Recipients, ",")
+	s.UpdatedAt = time.Now()
+	s.scheduleNext(s.UpdatedAt)
+
+	if create {
+		s.CreatedAt = s.UpdatedAt
+		id, err := db.Insert(`INSERT INTO report_subscriptions
+			(user_id, name, report, params, format, delivery, recipients, schedule, enabled, next_run_at, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			s.UserID, s.Name, s.Report, string(params), s.Format, s.Delivery, recipients, s.Schedule, s.Enabled,
+			s.NextRunAt, s.CreatedAt, s.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		s.ID = int(id)
+		return nil
+	}
+	_, err := db.Exec(`UPDATE report_subscriptions SET name = ?, report = ?, params = ?, format = ?, delivery = ?,
+		recipients = ?, schedule = ?, enabled = ?, next_run_at = ?, updated_at = ? WHERE id = ?`,
+		s.Name, s.Report, string(params), s.Format, s.Delivery, recipients, s.Schedule, s.Enabled,
+		s.NextRunAt, s.UpdatedAt, s.ID)
+	return err
+}
+
+// newSubscription liefert ein Abonnement mit den Standardwerten für fehlende Angaben.
+func newSubscription() ReportSubscription {
+	return ReportSubscription{Format: exportPDF, Delivery: deliveryAttachment, Enabled: true}
+}
+
+// subscriptionHandlers bedient die Berichtsabonnements und ihre Versandläufe.
+type subscriptionHandlers struct {
+	repos *Repositories
+}
+
+// list liefert die eigenen Abonnements, Administratoren sehen alle.
+func (h *subscriptionHandlers) list(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.repos.db.Query("SELECT "+subscriptionColumns+" FROM report_subscriptions WHERE user_id = ? OR ? = 'admin' ORDER BY name, id",
+		mustAtoi(r.Header.Get("X-User-ID")), r.Header.Get("X-User-Role"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	subscriptions := []ReportSubscription{}
+	for rows.Next() {
+		s, err := scanSubscription(rows)
+		if err != nil {
+			continue
+		}
+		subscriptions = append(subscriptions, s)
+	}
+	rows.Close()
+
+	for i := range subscriptions {
+		subscriptions[i].LastRun, _ = lastReportRun(h.repos.db, subscriptions[i].ID)
+	}
+
+	json.NewEncoder(w).Encode(subscriptions)
+}
+
+func (h *subscriptionHandlers) get(w http.ResponseWriter, r *http.Request) {
+	s, err := findSubscription(h.repos.db, r.PathValue("id"), mustAtoi(r.Header.Get("X-User-ID")), r.Header.Get("X-User-Role"))
+	if err != nil {
+		http.Error(w, "Abonnement nicht gefunden", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(s)
+}
+
+func (h *subscriptionHandlers) create(w http.ResponseWriter, r *http.Request) {
+	s := newSubscription()
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.UserID = mustAtoi(r.Header.Get("X-User-ID"))
+	if err := s.validate(h.repos, r.Header.Get("X-User-Role")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := storeSubscription(h.repos.db, &s, true); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(s)
+}
+
+// update ersetzt ein Abonnement; der nächste Versand wird neu berechnet.
+func (h *subscriptionHandlers) update(w http.ResponseWriter, r *http.Request) {
+	existing, err := findSubscription(h.repos.db, r.PathValue("id"), mustAtoi(r.Header.Get("X-User-ID")), r.Header.Get("X-User-Role"))
+	if err != nil {
+		http.Error(w, "Abonnement nicht gefunden", http.StatusNotFound)
+		return
+	}
+
+	s := newSubscription()
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.ID = existing.ID
+	s.UserID = existing.UserID
+	s.CreatedAt = existing.CreatedAt
+	s.LastRun = existing.LastRun
+
+	// Gespeicherte Suchen werden mit den Rechten des Abonnenten geprüft
+	var ownerRole string
+	h.repos.db.QueryRow("SELECT role FROM users WHERE id = ?", s.UserID).Scan(&ownerRole)
+	if err := s.validate(h.repos, ownerRole); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := storeSubscription(h.repos.db, &s, false); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(s)
+}
+
+func (h *subscriptionHandlers) delete(w http.ResponseWriter, r *http.Request) {
+	s, err := findSubscription(h.repos.db, r.PathValue("id"), mustAtoi(r.Header.Get("X-User-ID")), r.Header.Get("X-User-Role"))
+	if err != nil {
+		http.Error(w, "Abonnement nicht gefunden", http.StatusNotFound)
+		return
+	}
+
+	tx, err := h.repos.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	tx.Exec("DELETE FROM report_runs WHERE subscription_id = ?", s.ID)
+	if _, err := tx.Exec("DELETE FROM report_subscriptions WHERE id = ?", s.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// run stößt einen sofortigen Versand an, unabhängig vom Zeitplan.
+func (h *subscriptionHandlers) run(w http.ResponseWriter, r *http.Request) {
+	s, err := findSubscription(h.repos.db, r.PathValue("id"), mustAtoi(r.Header.Get("X-User-ID")), r.Header.Get("X-User-Role"))
+	if err != nil {
+		http.Error(w, "Abonnement nicht gefunden", http.StatusNotFound)
+		return
+	}
+
+	now := time.Now()
+	id, err := h.repos.db.Insert(`INSERT INTO report_runs (subscription_id, scheduled_for, manual, status, next_attempt_at)
+		VALUES (?, ?, TRUE, ?, ?)`, s.ID, now, runPending, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	wakeReportScheduler()
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(ReportRun{ID: int(id), SubscriptionID: s.ID, ScheduledFor: now, Manual: true,
+		Status: runPending, NextAttemptAt: &now})
+}
+
+// runs liefert die Versandläufe eines Abonnements, neueste zuerst.
+func (h *subscriptionHandlers) runs(w http.ResponseWriter, r *http.Request) {
+	s, err := findSubscription(h.repos.db, r.PathValue("id"), mustAtoi(r.Header.Get("X-User-ID")), r.Header.Get("X-User-Role"))
+	if err != nil {
+		http.Error(w, "Abonnement nicht gefunden", http.StatusNotFound)
+		return
+	}
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if n, err := strconv.Atoi(l); err == nil && n > 0 && n <= maxRunHistory {
+			limit = n
+		}
+	}
+
+	rows, err := h.repos.db.Query("SELECT "+runColumns+" FROM report_runs WHERE subscription_id = ? ORDER BY id DESC LIMIT ?", s.ID, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	runs := []ReportRun{}
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	json.NewEncoder(w).Encode(runs)
+}
+
+func wakeReportScheduler() {
+	select {
+	case reportWake <- struct{}{}:
+	default:
+	}
+}
+
+// runReportScheduler legt für fällige Abonnements Läufe an und versendet sie.
+// Zeitpunkte und Läufe stehen in der Datenbank: Nach einem Neustart werden
+// unterbrochene Läufe wiederholt und ein verpasster Termin einmal nachgeholt.
+func runReportScheduler(repos *Repositories) {
+	repos.db.Exec("UPDATE report_runs SET status = ? WHERE status = ?", runPending, runRunning)
+
+	ticker := time.NewTicker(reportSchedulerInterval)
+	defer ticker.Stop()
+	for {
+		scheduleDueReports(repos.db, time.Now())
+		processDueRuns(repos)
+		select {
+		case <-ticker.C:
+		case <-reportWake:
+		}
+	}
+}
+
+// scheduleDueReports legt für jedes fällige Abonnement einen Lauf an und setzt
+// den nächsten Termin.
+func scheduleDueReports(db *DB, now time.Time) {
+	rows, err := db.Query("SELECT " + subscriptionColumns + " FROM report_subscriptions WHERE enabled = TRUE")
+	if err != nil {
+		log.Printf("Berichtsabonnements nicht lesbar: %v", err)
+		return
+	}
+	var due []ReportSubscription
+	for rows.Next() {
+		s, err := scanSubscription(rows)
+		if err != nil {
+			continue
+		}
+		if s.NextRunAt != nil && !s.NextRunAt.After(now) {
+			due = append(due, s)
+		}
+	}
+	rows.Close()
+
+	for _, s := range due {
+		scheduledFor := *s.NextRunAt
+		s.scheduleNext(now)
+
+		tx, err := db.Begin()
+		if err != nil {
+			log.Printf("Abonnement %d nicht eingeplant: %v", s.ID, err)
+			return
+		}
+		_, err = tx.Exec(`INSERT INTO report_runs (subscription_id, scheduled_for, status, next_attempt_at)
+			VALUES (?, ?, ?, ?)`, s.ID, scheduledFor, runPending, now)
+		if err == nil {
+			_, err = tx.Exec("UPDATE report_subscriptions SET next_run_at = ? WHERE id = ?", s.NextRunAt, s.ID)
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			tx.Rollback()
+			log.Printf("Abonnement %d nicht eingeplant: %v", s.ID, err)
+		}
+	}
+}
+
+// processDueRuns führt alle offenen Läufe aus, deren Zeitpunkt erreicht ist.
+func processDueRuns(repos *Repositories) {
+	rows, err := repos.db.Query("SELECT "+runColumns+" FROM report_runs WHERE status IN (?, ?) ORDER BY id", runPending, runRetrying)
+	if err != nil {
+		log.Printf("Berichtsläufe nicht lesbar: %v", err)
+		return
+	}
+	var due []ReportRun
+	now := time.Now()
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			continue
+		}
+		if run.NextAttemptAt == nil || !run.NextAttemptAt.After(now) {
+			due = append(due, run)
+		}
+	}
+	rows.Close()
+
+	for _, run := range due {
+		executeRun(repos, run)
+	}
+}
+
+// executeRun versendet einen Lauf. Schlägt der Versand fehl, wird er nach
+// reportRetryDelays wiederholt und danach als failed markiert.
+func executeRun(repos *Repositories, run ReportRun) {
+	run.Attempts++
+	repos.db.Exec("UPDATE report_runs SET status = ?, attempts = ?, started_at = ? WHERE id = ?",
+		runRunning, run.Attempts, time.Now(), run.ID)
+
+	var filename string
+	var size int
+	s, err := scanSubscription(repos.db.QueryRow("SELECT "+subscriptionColumns+" FROM report_subscriptions WHERE id = ?", run.SubscriptionID))
+	if err == nil {
+		filename, size, err = deliverSubscription(repos, s)
+	}
+	now := time.Now()
+
+	switch {
+	case err == nil:
+		_, err = repos.db.Exec(`UPDATE report_runs SET status = ?, finished_at = ?, next_attempt_at = NULL, error = NULL,
+			filename = ?, size = ? WHERE id = ?`, runSent, now, filename, size, run.ID)
+		if err != nil {
+			log.Printf("Berichtslauf %d nicht gespeichert: %v", run.ID, err)
+		}
+	case run.Attempts <= len(reportRetryDelays):
+		next := now.Add(reportRetryDelays[run.Attempts-1])
+		log.Printf("Berichtslauf %d (Abonnement %d) fehlgeschlagen, neuer Versuch um %s: %v",
+			run.ID, run.SubscriptionID, next.Format("15:04"), err)
+		repos.db.Exec("UPDATE report_runs SET status = ?, next_attempt_at = ?, error = ? WHERE id = ?",
+			runRetrying, next, err.Error(), run.ID)
+	default:
+		log.Printf("Berichtslauf %d (Abonnement %d) endgültig fehlgeschlagen: %v", run.ID, run.SubscriptionID, err)
+		repos.db.Exec("UPDATE report_runs SET status = ?, finished_at = ?, next_attempt_at = NULL, error = ? WHERE id = ?",
+			runFailed, now, err.Error(), run.ID)
+	}
+
+	repos.db.Exec(`DELETE FROM report_runs WHERE subscription_id = ? AND status IN (?, ?)
+		AND id NOT IN (SELECT id FROM report_runs WHERE subscription_id = ? ORDER BY id DESC LIMIT ?)`,
+		run.SubscriptionID, runSent, runFailed, run.SubscriptionID, maxRunHistory)
+}
+
+// reportResponse nimmt die Ausgabe eines Berichts-Handlers im Speicher auf.
+type reportResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *reportResponse) Header() http.Header { return r.header }
+
+func (r *reportResponse) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *reportResponse) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(b)
+}
+
+// renderSubscription erzeugt den Bericht eines Abonnements mit den Rechten des Abonnenten.
+func renderSubscription(repos *Repositories, s ReportSubscription) (*reportResponse, error) {
+	var role string
+	if err := repos.db.QueryRow("SELECT role FROM users WHERE id = ?", s.UserID).Scan(&role); err != nil {
+		return nil, fmt.Errorf("Abonnent %d nicht gefunden", s.UserID)
+	}
+	handler, ok := reportHandlers(repos)[s.Report]
+	if !ok {
+		return nil, fmt.Errorf("unbekannter Bericht: %s", s.Report)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "/?"+s.query().Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-User-ID", strconv.Itoa(s.UserID))
+	req.Header.Set("X-User-Role", role)
+	req.SetPathValue("id", s.Params["saved_search_id"])
+
+	resp := &reportResponse{header: http.Header{}}
+	handler(resp, req)
+	if resp.status >= 400 {
+		return nil, fmt.Errorf("Bericht konnte nicht erzeugt werden: %s", strings.TrimSpace(resp.body.String()))
+	}
+	return resp, nil
+}
+
+// deliverSubscription erzeugt den Bericht und versendet ihn an alle Empfänger.
+func deliverSubscription(repos *Repositories, s ReportSubscription) (string, int, error) {
+	resp, err := renderSubscription(repos, s)
+	if err != nil {
+		return "", 0, err
+	}
+	filename := exportFilename(s.Name, time.Now(), s.Format)
+	if _, params, err := mime.ParseMediaType(resp.header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		filename = params["filename"]
+	}
+
+	now := time.Now()
+	msg := mailMessage{
+		To:      s.Recipients,
+		Subject: fmt.Sprintf("%s (%s)", s.Name, now.Format("02.01.2006")),
+	}
+	if s.Delivery == deliveryInline {
+		msg.HTML = resp.body.String()
+	} else {
+		msg.Text = fmt.Sprintf("Guten Tag,\n\nim Anhang finden Sie den Bericht „%s“ mit Stand %s.\n\n"+
+			"Diese Nachricht wurde automatisch von der Vertragsdatenbank versendet (Abonnement %d).\n",
+			s.Name, now.Format("02.01.2006 15:04"), s.ID)
+		msg.Attachments = []mailAttachment{{Filename: filename, ContentType: resp.header.Get("Content-Type"), Data: resp.body.Bytes()}}
+	}
+
+	if err := sendMail(loadMailConfig(), msg); err != nil {
+		return "", 0, err
+	}
+	return filename, resp.body.Len(), nil
+}
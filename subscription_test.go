@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestReportSubscriptions(t *testing.T) {
+	s := newTestServer(t)
+
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{"name": "Fristen", "report": "expiring", "params": map[string]string{"days": "90"},
+			"format": "pdf", "delivery": "attachment", "recipients": []string{"einkauf@example.com"},
+			"schedule": "0 8 * * 1", "enabled": true}
+	}
+
+	var sub ReportSubscription
+	s.expect("POST", "/report-subscriptions", s.viewer, valid(), http.StatusCreated, &sub)
+	if sub.NextRunAt == nil {
+		t.Errorf("kein nächster Versand: %+v", sub)
+	}
+
+	for name, change := range map[string]map[string]interface{}{
+		"ohne Namen":            {"name": " "},
+		"unbekannter Bericht":   {"report": "umsatz"},
+		"unbekannter Filter":    {"params": map[string]string{"farbe": "rot"}},
+		"ungültige Tage":        {"params": map[string]string{"days": "0"}},
+		"Portfolio als xlsx":    {"report": "portfolio", "params": map[string]string{}, "format": "xlsx"},
+		"unbekannte Versandart": {"delivery": "fax"},
+		"ohne Empfänger":        {"recipients": []string{}},
+		"ungültiger Empfänger":  {"recipients": []string{"keine-adresse"}},
+		"ungültiger Zeitplan":   {"schedule": "montags"},
+		"Zeitplan ohne Termin":  {"schedule": "0 8 31 2 *"},
+	} {
+		body := valid()
+		for k, v := range change {
+			body[k] = v
+		}
+		resp := s.do("POST", "/report-subscriptions", s.viewer, body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: Status %d statt 400", name, resp.StatusCode)
+		}
+	}
+
+	// Abonnements sind privat
+	path := fmt.Sprintf("/report-subscriptions/%d", sub.ID)
+	var subs []ReportSubscription
+	s.expect("GET", "/report-subscriptions", s.viewer, nil, http.StatusOK, &subs)
+	if len(subs) != 1 {
+		t.Errorf("Abonnements des Viewers: %+v", subs)
+	}
+	other := s.login(s.createUser("zweiter", "viewer").Username, "zweiter")
+	s.expect("GET", path, other, nil, http.StatusNotFound, nil)
+	s.expect("POST", path+"/run", other, nil, http.StatusNotFound, nil)
+
+	var run ReportRun
+	s.expect("POST", path+"/run", s.viewer, nil, http.StatusAccepted, &run)
+	if !run.Manual || run.Status != runPending {
+		t.Errorf("Versand: %+v", run)
+	}
+	var runs []ReportRun
+	s.expect("GET", path+"/runs", s.viewer, nil, http.StatusOK, &runs)
+	if len(runs) != 1 || runs[0].ID != run.ID {
+		t.Errorf("Protokoll: %+v", runs)
+	}
+
+	body := valid()
+	body["enabled"] = false
+	s.expect("PUT", path, s.viewer, body, http.StatusOK, &sub)
+	if sub.Enabled || sub.NextRunAt != nil {
+		t.Errorf("deaktiviert: %+v", sub)
+	}
+	s.expect("DELETE", path, s.viewer, nil, http.StatusNoContent, nil)
+	s.expect("GET", path, s.viewer, nil, http.StatusNotFound, nil)
+}
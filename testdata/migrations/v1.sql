@@ -0,0 +1,50 @@
+-- Datenbank mit Schema-Version 1, wie sie vor der Versionierung angelegt wurde:
+-- ohne PRAGMA user_version, Kündigungsfrist und Mindestlaufzeit als Freitext.
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT UNIQUE NOT NULL,
+	password TEXT NOT NULL,
+	role TEXT NOT NULL CHECK(role IN ('admin', 'viewer'))
+);
+
+CREATE TABLE contracts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	contract_number TEXT UNIQUE NOT NULL,
+	title TEXT NOT NULL,
+	content TEXT,
+	conditions TEXT,
+	notice_period TEXT,
+	minimum_term TEXT,
+	valid_from DATETIME NOT NULL,
+	valid_until DATETIME,
+	partner TEXT NOT NULL,
+	category TEXT NOT NULL,
+	contract_type TEXT NOT NULL CHECK(contract_type IN ('framework', 'individual')),
+	framework_contract_id INTEGER,
+	is_terminated BOOLEAN DEFAULT 0,
+	terminated_at DATETIME,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (framework_contract_id) REFERENCES contracts(id)
+);
+
+CREATE TABLE documents (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	contract_id INTEGER NOT NULL,
+	filename TEXT NOT NULL,
+	file_path TEXT NOT NULL,
+	uploaded_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (contract_id) REFERENCES contracts(id)
+);
+
+INSERT INTO users (id, username, password, role) VALUES
+	(1, 'chef', '$2a$04$eJEcvN5aau2kjqYucYi.4.OitHDikS5njuO4PeZ.YDfzHdcS/kNF6', 'admin'),
+	(2, 'leser', '$2a$04$eJEcvN5aau2kjqYucYi.4.OitHDikS5njuO4PeZ.YDfzHdcS/kNF6', 'viewer');
+
+INSERT INTO contracts (id, contract_number, title, content, conditions, notice_period, minimum_term, valid_from, partner, category, contract_type, framework_contract_id) VALUES
+	(1, 'V001', 'Rahmenvertrag Telefonie', '', '', '3 Monate', '31.12.2024', '2023-01-01 00:00:00+00:00', 'Telekom', 'Telefonie', 'framework', NULL),
+	(2, 'V002', 'Mobilfunk', '', 'Zahlung jährlich', '1', 'bis Projektende', '2023-02-01 00:00:00+00:00', 'Telekom', 'Telefonie', 'individual', 1),
+	(3, 'V003', 'Wartung Server', '', '', '', '2025-06-30', '2023-03-31 00:00:00+00:00', 'ACME', 'IT', 'individual', NULL);
+
+INSERT INTO documents (id, contract_id, filename, file_path, uploaded_at) VALUES
+	(1, 1, 'rahmenvertrag.pdf', 'uploads/1672531200_rahmenvertrag.pdf', '2023-01-02 10:00:00+00:00'),
+	(2, 3, 'wartung.pdf', './uploads/1680220800_wartung.pdf', '2023-03-31 12:00:00+00:00');
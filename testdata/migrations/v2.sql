@@ -0,0 +1,48 @@
+-- Datenbank mit Schema-Version 2: Kündigungsfrist in Monaten, Mindestlaufzeit als Datum.
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT UNIQUE NOT NULL,
+	password TEXT NOT NULL,
+	role TEXT NOT NULL CHECK(role IN ('admin', 'viewer'))
+);
+
+CREATE TABLE "contracts" (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	contract_number TEXT UNIQUE NOT NULL,
+	title TEXT NOT NULL,
+	content TEXT,
+	conditions TEXT,
+	notice_period INTEGER,
+	minimum_term DATE,
+	valid_from DATETIME NOT NULL,
+	valid_until DATETIME,
+	partner TEXT NOT NULL,
+	category TEXT NOT NULL,
+	contract_type TEXT NOT NULL CHECK(contract_type IN ('framework', 'individual')),
+	framework_contract_id INTEGER,
+	is_terminated BOOLEAN DEFAULT 0,
+	terminated_at DATETIME,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (framework_contract_id) REFERENCES "contracts"(id)
+);
+
+CREATE TABLE documents (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	contract_id INTEGER NOT NULL,
+	filename TEXT NOT NULL,
+	file_path TEXT NOT NULL,
+	uploaded_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (contract_id) REFERENCES contracts(id)
+);
+
+INSERT INTO users (id, username, password, role) VALUES
+	(1, 'chef', '$2a$04$eJEcvN5aau2kjqYucYi.4.OitHDikS5njuO4PeZ.YDfzHdcS/kNF6', 'admin');
+
+INSERT INTO contracts (id, contract_number, title, content, conditions, notice_period, minimum_term, valid_from, partner, category, contract_type, is_terminated, terminated_at) VALUES
+	(1, 'V001', 'Reinigung', '', '', 3, '2024-12-31', '2023-01-01 00:00:00+00:00', 'Sauber GmbH', 'Gebäude', 'individual', 0, NULL),
+	(2, 'V002', 'Kfz-Versicherung', '', '', 1, NULL, '2022-01-01 00:00:00+00:00', 'Versicherer AG', 'Versicherungen', 'individual', 1, '2023-06-30 00:00:00+00:00');
+
+INSERT INTO documents (id, contract_id, filename, file_path, uploaded_at) VALUES
+	(1, 1, 'reinigung.pdf', 'uploads/1672531200_reinigung.pdf', '2023-01-02 10:00:00+00:00');
+
+PRAGMA user_version = 2;
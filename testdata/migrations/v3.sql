@@ -0,0 +1,45 @@
+-- Datenbank mit Schema-Version 3: Laufzeit und berechnete Kündigungstermine.
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT UNIQUE NOT NULL,
+	password TEXT NOT NULL,
+	role TEXT NOT NULL CHECK(role IN ('admin', 'viewer'))
+);
+
+CREATE TABLE "contracts" (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	contract_number TEXT UNIQUE NOT NULL,
+	title TEXT NOT NULL,
+	content TEXT,
+	conditions TEXT,
+	notice_period INTEGER,
+	minimum_term DATE,
+	valid_from DATETIME NOT NULL,
+	valid_until DATETIME,
+	partner TEXT NOT NULL,
+	category TEXT NOT NULL,
+	contract_type TEXT NOT NULL CHECK(contract_type IN ('framework', 'individual')),
+	framework_contract_id INTEGER,
+	is_terminated BOOLEAN DEFAULT 0,
+	terminated_at DATETIME,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP, term_months INTEGER, cancellation_date DATE, cancellation_action_date DATE,
+	FOREIGN KEY (framework_contract_id) REFERENCES "contracts"(id)
+);
+
+CREATE TABLE documents (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	contract_id INTEGER NOT NULL,
+	filename TEXT NOT NULL,
+	file_path TEXT NOT NULL,
+	uploaded_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (contract_id) REFERENCES contracts(id)
+);
+
+INSERT INTO users (id, username, password, role) VALUES
+	(1, 'chef', '$2a$04$eJEcvN5aau2kjqYucYi.4.OitHDikS5njuO4PeZ.YDfzHdcS/kNF6', 'admin');
+
+INSERT INTO contracts (id, contract_number, title, content, conditions, notice_period, minimum_term, valid_from, partner, category, contract_type, term_months, cancellation_date, cancellation_action_date) VALUES
+	(1, 'V001', 'Wartung Server', '', '', 3, '2024-03-31', '2023-01-31 00:00:00+00:00', 'ACME', 'IT', 'individual', 12, '2025-01-31', '2024-10-31'),
+	(2, 'V002', 'Fahrzeugleasing', '', '', 6, NULL, '2023-01-01 00:00:00+00:00', 'Leasing AG', 'Leasing', 'individual', NULL, NULL, NULL);
+
+PRAGMA user_version = 3;
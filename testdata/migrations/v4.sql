@@ -0,0 +1,54 @@
+-- Datenbank mit Schema-Version 4: Kategorien als eigene Tabelle.
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT UNIQUE NOT NULL,
+	password TEXT NOT NULL,
+	role TEXT NOT NULL CHECK(role IN ('admin', 'viewer'))
+);
+
+CREATE TABLE "contracts" (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	contract_number TEXT UNIQUE NOT NULL,
+	title TEXT NOT NULL,
+	content TEXT,
+	conditions TEXT,
+	notice_period INTEGER,
+	minimum_term DATE,
+	valid_from DATETIME NOT NULL,
+	valid_until DATETIME,
+	partner TEXT NOT NULL,
+	category TEXT NOT NULL,
+	contract_type TEXT NOT NULL CHECK(contract_type IN ('framework', 'individual')),
+	framework_contract_id INTEGER,
+	is_terminated BOOLEAN DEFAULT 0,
+	terminated_at DATETIME,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP, term_months INTEGER, cancellation_date DATE, cancellation_action_date DATE,
+	FOREIGN KEY (framework_contract_id) REFERENCES "contracts"(id)
+);
+
+CREATE TABLE documents (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	contract_id INTEGER NOT NULL,
+	filename TEXT NOT NULL,
+	file_path TEXT NOT NULL,
+	uploaded_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (contract_id) REFERENCES contracts(id)
+);
+
+CREATE TABLE categories (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT UNIQUE NOT NULL
+);
+
+INSERT INTO users (id, username, password, role) VALUES
+	(1, 'chef', '$2a$04$eJEcvN5aau2kjqYucYi.4.OitHDikS5njuO4PeZ.YDfzHdcS/kNF6', 'admin');
+
+INSERT INTO categories (id, name) VALUES (1, 'IT'), (2, 'Gebäude'), (3, 'Versicherungen'), (4, 'Leasing'), (5, 'Marketing');
+
+INSERT INTO contracts (id, contract_number, title, content, conditions, notice_period, valid_from, partner, category, contract_type, term_months, cancellation_date, cancellation_action_date) VALUES
+	(1, 'V001', 'Fahrzeugleasing', '', '', 6, '2023-01-01 00:00:00+00:00', 'Leasing AG', 'Leasing', 'individual', 12, '2024-01-01', '2023-07-01');
+
+INSERT INTO documents (id, contract_id, filename, file_path, uploaded_at) VALUES
+	(1, 1, 'leasing.pdf', 'uploads/1672531200_leasing.pdf', '2023-01-02 10:00:00+00:00');
+
+PRAGMA user_version = 4;
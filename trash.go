@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultTrashDays   = 30
+	trashPurgeInterval = time.Hour
+)
+
+// trashRetention ist die Verweildauer im Papierkorb (VERTRAGSDB_TRASH_DAYS), 0 = kein
+// automatisches Löschen.
+var trashRetention time.Duration
+
+func loadTrashConfig() error {
+	days := defaultTrashDays
+	if v := os.Getenv("VERTRAGSDB_TRASH_DAYS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("VERTRAGSDB_TRASH_DAYS: ungültiger Wert %q", v)
+		}
+		days = n
+	}
+	trashRetention = time.Duration(days) * 24 * time.Hour
+	return nil
+}
+
+// TrashEntry ist ein Vertrag oder eine Kategorie im Papierkorb.
+type TrashEntry struct {
+	Type          string     `json:"type"` // contract, category
+	ID            int        `json:"id"`
+	Name          string     `json:"name"` // Vertragsnummer und Titel bzw. Kategoriename
+	DeletedAt     time.Time  `json:"deleted_at"`
+	DeletedBy     *int       `json:"deleted_by"`
+	DeletedByName *string    `json:"deleted_by_name"`
+	PurgeAt       *time.Time `json:"purge_at"` // null = kein automatisches Löschen
+}
+
+// purgeAt liefert den Zeitpunkt, ab dem ein Eintrag automatisch gelöscht wird.
+func purgeAt(deletedAt time.Time) *time.Time {
+	if trashRetention == 0 {
+		return nil
+	}
+	t := deletedAt.Add(trashRetention)
+	return &t
+}
+
+// trashHandlers bedient die Übersicht des Papierkorbs.
+type trashHandlers struct {
+	db *DB
+}
+
+// list liefert Verträge und Kategorien im Papierkorb, zuletzt gelöschte zuerst.
+func (h *trashHandlers) list(w http.ResponseWriter, r *http.Request) {
+	entries := []TrashEntry{}
+	for _, q := range []struct{ entity, query string }{
+		{"contract", `SELECT c.id, c.contract_number || ' - ' || c.title, c.deleted_at, c.deleted_by, u.username
+			FROM contracts c LEFT JOIN users u ON u.id = c.deleted_by WHERE c.deleted_at IS NOT NULL`},
+		{"category", `SELECT c.id, c.name, c.deleted_at, c.deleted_by, u.username
+			FROM categories c LEFT JOIN users u ON u.id = c.deleted_by WHERE c.deleted_at IS NOT NULL`},
+	} {
+		rows, err := h.db.Query(q.query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for rows.Next() {
+			e := TrashEntry{Type: q.entity}
+			if err := rows.Scan(&e.ID, &e.Name, &e.DeletedAt, &e.DeletedBy, &e.DeletedByName); err != nil {
+				rows.Close()
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			e.PurgeAt = purgeAt(e.DeletedAt)
+			entries = append(entries, e)
+		}
+		rows.Close()
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].DeletedAt.After(entries[j].DeletedAt) })
+
+	json.NewEncoder(w).Encode(entries)
+}
+
+// trash verschiebt einen Vertrag in den Papierkorb, siehe ContractRepository.Trash.
+func (h *contractHandlers) trash(w http.ResponseWriter, r *http.Request) {
+	retentionMu.Lock()
+	defer retentionMu.Unlock()
+
+	c, err := h.contracts.Trash(r.Context(), mustAtoi(r.PathValue("id")), mustAtoi(r.Header.Get("X-User-ID")))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	publishChange(changeContractDeleted, map[string]interface{}{"contract_id": c.ID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// restore holt einen Vertrag aus dem Papierkorb zurück.
+func (h *contractHandlers) restore(w http.ResponseWriter, r *http.Request) {
+	restored, err := h.contracts.Restore(r.Context(), mustAtoi(r.PathValue("id")), mustAtoi(r.Header.Get("X-User-ID")))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	wakeRetentionCheck()
+	publishChange(changeContractRestored, map[string]interface{}{"contract": restored})
+
+	json.NewEncoder(w).Encode(restored)
+}
+
+func (h *categoryHandlers) restore(w http.ResponseWriter, r *http.Request) {
+	cat, err := h.categories.Restore(r.Context(), mustAtoi(r.PathValue("id")), mustAtoi(r.Header.Get("X-User-ID")))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	publishChange(changeCategoryRestored, map[string]interface{}{"category": cat})
+
+	json.NewEncoder(w).Encode(cat)
+}
+
+// purgeTrashedContract löscht einen Vertrag aus dem Papierkorb endgültig.
+func purgeTrashedContract(ctx context.Context, db *DB, c *Contract, userID int) error {
+	tomb := purgeTombstone{Reason: purgeReasonTrash}
+	var deletedAt time.Time
+	if err := db.QueryRow("SELECT deleted_at, deleted_by FROM contracts WHERE id = ?", c.ID).Scan(&deletedAt, &tomb.DeletedBy); err != nil {
+		return err
+	}
+	tomb.DeletedAt = &deletedAt
+	return purgeContract(ctx, db, c, userID, tomb)
+}
+
+// purge löscht einen Vertrag aus dem Papierkorb sofort endgültig.
+func (h *contractHandlers) purge(w http.ResponseWriter, r *http.Request) {
+	retentionMu.Lock()
+	defer retentionMu.Unlock()
+
+	c, err := h.contracts.GetTrashed(r.Context(), mustAtoi(r.PathValue("id")))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := purgeTrashedContract(r.Context(), h.repos.db, c, mustAtoi(r.Header.Get("X-User-ID"))); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// purge löscht eine Kategorie endgültig, sobald kein Vertrag im Papierkorb sie mehr
+// verwendet.
+func (h *categoryHandlers) purge(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.categories.Purge(r.Context(), mustAtoi(r.PathValue("id")), mustAtoi(r.Header.Get("X-User-ID"))); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func runTrashPurger(repos *Repositories) {
+	if trashRetention == 0 {
+		return
+	}
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+	for {
+		if err := purgeExpiredTrash(repos); err != nil {
+			log.Printf("Leeren des Papierkorbs fehlgeschlagen: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// purgeExpiredTrash löscht Verträge und danach Kategorien, die länger als
+// trashRetention im Papierkorb liegen. Kategorien, die noch ein Vertrag im Papierkorb
+// verwendet, warten auf dessen Löschung.
+func purgeExpiredTrash(repos *Repositories) error {
+	ctx := context.Background()
+	cutoff := time.Now().Add(-trashRetention)
+
+	expired := func(query string) ([]int, error) {
+		rows, err := repos.db.Query(query)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var ids []int
+		for rows.Next() {
+			var id int
+			var deletedAt time.Time
+			if err := rows.Scan(&id, &deletedAt); err != nil {
+				return nil, err
+			}
+			if deletedAt.Before(cutoff) {
+				ids = append(ids, id)
+			}
+		}
+		return ids, rows.Err()
+	}
+
+	ids, err := expired("SELECT id, deleted_at FROM contracts WHERE deleted_at IS NOT NULL")
+	if err != nil {
+		return err
+	}
+	purged := 0
+	for _, id := range ids {
+		retentionMu.Lock()
+		c, err := repos.Contracts.GetTrashed(ctx, id)
+		if err == nil {
+			err = purgeTrashedContract(ctx, repos.db, c, 0)
+		}
+		retentionMu.Unlock()
+		if err != nil {
+			return fmt.Errorf("Vertrag %d: %w", id, err)
+		}
+		purged++
+	}
+
+	ids, err = expired(`SELECT id, deleted_at FROM categories c WHERE deleted_at IS NOT NULL
+		AND NOT EXISTS (SELECT 1 FROM contracts WHERE category = c.name)`)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, err := repos.Categories.Purge(ctx, id, 0); err != nil {
+			return fmt.Errorf("Kategorie %d: %w", id, err)
+		}
+		purged++
+	}
+
+	if purged > 0 {
+		log.Printf("Papierkorb: %d Einträge endgültig gelöscht", purged)
+	}
+	return nil
+}
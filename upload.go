@@ -0,0 +1,517 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	mimePDF  = "application/pdf"
+	mimeDOCX = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	mimeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	mimePNG  = "image/png"
+	mimeJPEG = "image/jpeg"
+	mimeTIFF = "image/tiff"
+	mimeText = "text/plain"
+)
+
+// uploadTypes ordnet jedem erkennbaren Dateityp die passenden Dateiendungen zu.
+// Welche davon angenommen werden, legt VERTRAGSDB_UPLOAD_TYPES fest.
+var uploadTypes = map[string][]string{
+	mimePDF:  {".pdf"},
+	mimeDOCX: {".docx"},
+	mimeXLSX: {".xlsx"},
+	mimePNG:  {".png"},
+	mimeJPEG: {".jpg", ".jpeg"},
+	mimeTIFF: {".tif", ".tiff"},
+	mimeText: {".txt", ".csv", ".md"},
+}
+
+const (
+	defaultUploadTypes    = mimePDF + "," + mimeDOCX + "," + mimePNG + "," + mimeJPEG
+	defaultMaxUploadMB    = 10
+	maxFilenameLength     = 200 // Byte, einschließlich Endung
+	uploadFormOverhead    = 1 << 20
+	clamdChunkSize        = 64 << 10
+	clamdTimeout          = 2 * time.Minute
+	defaultClamdAddress   = "/var/run/clamav/clamd.ctl"
+	quarantineKeyPrefix   = "quarantine/"
+	scannerUnavailableMsg = "Virenprüfung nicht möglich, bitte später erneut versuchen"
+)
+
+// Upload-Einstellungen, gesetzt von loadUploadConfig
+var (
+	allowedUploadTypes = map[string]bool{}
+	maxUploadSize      int64
+	scanner            Scanner
+)
+
+// loadUploadConfig liest VERTRAGSDB_UPLOAD_TYPES, VERTRAGSDB_MAX_UPLOAD_MB und
+// VERTRAGSDB_SCANNER.
+func loadUploadConfig() error {
+	types := os.Getenv("VERTRAGSDB_UPLOAD_TYPES")
+	if types == "" {
+		types = defaultUploadTypes
+	}
+	allowedUploadTypes = map[string]bool{}
+	for _, t := range strings.Split(types, ",") {
+		t = strings.TrimSpace(t)
+		if _, ok := uploadTypes[t]; !ok {
+			return fmt.Errorf("VERTRAGSDB_UPLOAD_TYPES: unbekannter Dateityp %q", t)
+		}
+		allowedUploadTypes[t] = true
+	}
+
+	maxUploadSize = defaultMaxUploadMB << 20
+	if v := os.Getenv("VERTRAGSDB_MAX_UPLOAD_MB"); v != "" {
+		mb, err := strconv.Atoi(v)
+		if err != nil || mb <= 0 {
+			return fmt.Errorf("VERTRAGSDB_MAX_UPLOAD_MB: ungültiger Wert %q", v)
+		}
+		maxUploadSize = int64(mb) << 20
+	}
+
+	var err error
+	scanner, err = openScanner(os.Getenv("VERTRAGSDB_SCANNER"))
+	return err
+}
+
+// uploadError ist ein Fehler beim Upload mit passendem HTTP-Status.
+type uploadError struct {
+	status int
+	msg    string
+}
+
+func (e *uploadError) Error() string { return e.msg }
+
+var errUploadTooLarge = errors.New("Upload zu groß")
+
+var errScanIncomplete = errors.New("Scanner hat die Datei nicht vollständig gelesen")
+
+// sniffUploadType bestimmt den Dateityp aus den ersten Bytes. Office-Dateien sind
+// ZIP-Archive; ob Word oder Excel, entscheidet dort die Dateiendung.
+func sniffUploadType(head []byte, ext string) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("%PDF-")):
+		return mimePDF
+	case bytes.HasPrefix(head, []byte("II*\x00")) || bytes.HasPrefix(head, []byte("MM\x00*")):
+		return mimeTIFF
+	case isOOXML(head):
+		if ext == ".xlsx" {
+			return mimeXLSX
+		}
+		return mimeDOCX
+	}
+	t, _, _ := strings.Cut(http.DetectContentType(head), ";")
+	return t
+}
+
+// isOOXML erkennt ein Office-Open-XML-Paket am Namen des ersten Eintrags im ZIP-Archiv.
+func isOOXML(head []byte) bool {
+	if len(head) < 30 || !bytes.HasPrefix(head, []byte("PK\x03\x04")) {
+		return false
+	}
+	n := int(binary.LittleEndian.Uint16(head[26:28]))
+	if len(head) < 30+n {
+		return false
+	}
+	name := string(head[30 : 30+n])
+	if name == "[Content_Types].xml" {
+		return true
+	}
+	for _, prefix := range []string{"_rels/", "docProps/", "word/", "xl/", "customXml/"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUploadType prüft den erkannten Typ gegen die Liste erlaubter Typen und die
+// Dateiendung gegen den Inhalt.
+func checkUploadType(head []byte, filename string) (string, error) {
+	ext := strings.ToLower(path.Ext(filename))
+	t := sniffUploadType(head, ext)
+	if !allowedUploadTypes[t] {
+		return "", &uploadError{http.StatusUnsupportedMediaType, fmt.Sprintf("Dateityp %s ist nicht erlaubt", t)}
+	}
+	for _, e := range uploadTypes[t] {
+		if e == ext {
+			return t, nil
+		}
+	}
+	return "", &uploadError{http.StatusUnsupportedMediaType,
+		fmt.Sprintf("Dateiendung %q passt nicht zum Inhalt (%s)", ext, t)}
+}
+
+// sanitizeFilename macht einen vom Browser gesendeten Dateinamen unschädlich: ohne
+// Pfad, ohne Steuer- und Formatzeichen, ohne unter Windows reservierte Zeichen und
+// höchstens maxFilenameLength Byte lang.
+func sanitizeFilename(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.ToValidUTF8(name, "")
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsControl(r) || unicode.Is(unicode.Cf, r): // auch Bidi-Steuerzeichen
+			return -1
+		case strings.ContainsRune(`<>:"|?*`, r):
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+
+	ext := path.Ext(name)
+	if len(ext) > 16 {
+		ext = ""
+	}
+	base := strings.TrimSuffix(name, ext)
+	if len(base)+len(ext) > maxFilenameLength {
+		base = base[:maxFilenameLength-len(ext)]
+		for !utf8.ValidString(base) {
+			base = base[:len(base)-1]
+		}
+		base = strings.TrimRight(base, " .")
+	}
+	if base == "" || isReservedFilename(base) {
+		base = "dokument"
+	}
+	return base + ext
+}
+
+// isReservedFilename erkennt Gerätenamen, die unter Windows nicht als Dateiname taugen.
+func isReservedFilename(base string) bool {
+	upper := strings.ToUpper(base)
+	switch upper {
+	case "CON", "PRN", "AUX", "NUL":
+		return true
+	}
+	return len(upper) == 4 && (strings.HasPrefix(upper, "COM") || strings.HasPrefix(upper, "LPT")) &&
+		upper[3] >= '1' && upper[3] <= '9'
+}
+
+// contentDisposition erzeugt den Header nach RFC 6266: filename mit ASCII-Ersatz
+// für ältere Clients und filename* mit dem UTF-8-Namen.
+func contentDisposition(disposition, filename string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' || r == '%' {
+			return '_'
+		}
+		return r
+	}, filename)
+	v := fmt.Sprintf(`%s; filename="%s"`, disposition, fallback)
+	if fallback != filename {
+		var sb strings.Builder
+		for _, b := range []byte(filename) {
+			if b < 0x80 && (b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' ||
+				strings.IndexByte("!#$&+-.^_`|~", b) >= 0) {
+				sb.WriteByte(b)
+			} else {
+				fmt.Fprintf(&sb, "%%%02X", b)
+			}
+		}
+		v += "; filename*=UTF-8''" + sb.String()
+	}
+	return v
+}
+
+// maxSizeReader bricht ab, sobald mehr als remaining Byte gelesen wurden, damit zu
+// große Dateien gar nicht erst vollständig im Speicher landen.
+type maxSizeReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (m *maxSizeReader) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	m.remaining -= int64(n)
+	if m.remaining < 0 {
+		return n, errUploadTooLarge
+	}
+	return n, err
+}
+
+// storeUpload prüft einen Multipart-Teil und streamt ihn in den Speicher. Dabei
+// werden Größe und SHA-256-Hash ermittelt und, falls ein Scanner eingerichtet ist,
+// der Inhalt parallel geprüft. Befallene Dateien werden in die Quarantäne
+// verschoben; das Ergebnis ist dann ein *infectedError.
+func storeUpload(ctx context.Context, part *multipart.Part) (storedFile, error) {
+	br := bufio.NewReaderSize(part, 512)
+	head, _ := br.Peek(512)
+	f := storedFile{Key: newStorageKey(), Filename: sanitizeFilename(part.FileName())}
+	mimeType, err := checkUploadType(head, f.Filename)
+	if err != nil {
+		return storedFile{}, err
+	}
+	f.MimeType = mimeType
+
+	h := &countingHash{Hash: sha256.New()}
+	var out io.Writer = h
+	var pw *io.PipeWriter
+	scanDone := make(chan scanResult, 1)
+	if scanner != nil {
+		var pr *io.PipeReader
+		pr, pw = io.Pipe()
+		out = io.MultiWriter(h, pw)
+		go func() {
+			signature, err := scanner.Scan(ctx, pr)
+			if err == nil {
+				// Hört der Scanner vorzeitig auf zu lesen, wird der Rest verworfen, damit der
+				// Upload nicht am geschlossenen Pipe scheitert. Ohne Fund gilt die Datei dann
+				// als nicht geprüft.
+				if n, _ := io.Copy(io.Discard, pr); n > 0 && signature == "" {
+					err = errScanIncomplete
+				}
+			}
+			pr.CloseWithError(err)
+			scanDone <- scanResult{signature, err}
+		}()
+	}
+
+	err = store.Put(ctx, f.Key, io.TeeReader(&maxSizeReader{r: br, remaining: maxUploadSize}, out), -1)
+	var scan scanResult
+	if pw != nil {
+		pw.CloseWithError(err)
+		scan = <-scanDone
+	}
+	switch {
+	case errors.Is(err, errUploadTooLarge):
+		return storedFile{}, &uploadError{http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("Datei ist größer als %d MB", maxUploadSize>>20)}
+	case scan.err != nil && (err == nil || errors.Is(err, scan.err)):
+		if err == nil {
+			store.Delete(context.Background(), f.Key)
+		}
+		log.Printf("Virenprüfung für %q fehlgeschlagen: %v", f.Filename, scan.err)
+		return storedFile{}, &uploadError{http.StatusServiceUnavailable, scannerUnavailableMsg}
+	case err != nil:
+		return storedFile{}, err
+	}
+	f.Size = h.n
+	f.SHA256 = hex.EncodeToString(h.Sum(nil))
+
+	if scan.signature != "" {
+		return storedFile{}, quarantineFile(f, scan.signature)
+	}
+	return f, nil
+}
+
+// Scanner prüft hochgeladene Dateien auf Schadsoftware.
+type Scanner interface {
+	// Scan liest r bis EOF und liefert den Namen der gefundenen Schadsoftware,
+	// bei sauberen Dateien "".
+	Scan(ctx context.Context, r io.Reader) (string, error)
+	String() string
+}
+
+type scanResult struct {
+	signature string
+	err       error
+}
+
+// openScanner erzeugt den Scanner aus VERTRAGSDB_SCANNER: "" (keine Prüfung) oder
+// "clamd" (ClamAV über VERTRAGSDB_CLAMD_ADDRESS, Unix-Socket oder host:port).
+func openScanner(kind string) (Scanner, error) {
+	switch kind {
+	case "", "none":
+		return nil, nil
+	case "clamd":
+		addr := os.Getenv("VERTRAGSDB_CLAMD_ADDRESS")
+		if addr == "" {
+			addr = defaultClamdAddress
+		}
+		return &clamdScanner{address: addr}, nil
+	default:
+		return nil, fmt.Errorf("unbekannter Virenscanner: %s", kind)
+	}
+}
+
+// clamdScanner nutzt das INSTREAM-Kommando von clamd.
+type clamdScanner struct {
+	address string
+}
+
+func (c *clamdScanner) String() string {
+	return "clamd:" + c.address
+}
+
+func (c *clamdScanner) Scan(ctx context.Context, r io.Reader) (string, error) {
+	network := "tcp"
+	if strings.Contains(c.address, "/") {
+		network = "unix"
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, c.address)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(clamdTimeout))
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", err
+	}
+	buf := make([]byte, clamdChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, werr := conn.Write(append(size, buf[:n]...)); werr != nil {
+				return "", werr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return "", err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	// Antwort: "stream: OK", "stream: <Name> FOUND" oder "<Meldung> ERROR"
+	switch {
+	case strings.HasSuffix(reply, " OK"):
+		return "", nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return strings.TrimSuffix(strings.TrimPrefix(reply, "stream: "), " FOUND"), nil
+	default:
+		return "", fmt.Errorf("clamd: %s", reply)
+	}
+}
+
+// QuarantinedUpload ist eine abgewiesene Datei, in der der Scanner Schadsoftware gefunden hat.
+type QuarantinedUpload struct {
+	ID             int       `json:"id"`
+	ContractID     *int      `json:"contract_id"`
+	DocumentID     *int      `json:"document_id"`
+	Filename       string    `json:"filename"`
+	StorageKey     string    `json:"-"`
+	FileSize       int64     `json:"file_size"`
+	MimeType       string    `json:"mime_type"`
+	SHA256         string    `json:"sha256"`
+	Signature      string    `json:"signature"`
+	UploadedBy     *int      `json:"uploaded_by"`
+	UploadedByName *string   `json:"uploaded_by_name"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// infectedError meldet eine Datei, die in die Quarantäne verschoben wurde.
+type infectedError struct {
+	file      storedFile
+	signature string
+}
+
+func (e *infectedError) Error() string {
+	return fmt.Sprintf("Schadsoftware gefunden (%s), die Datei wurde in Quarantäne verschoben", e.signature)
+}
+
+// quarantineFile verschiebt eine befallene Datei unter quarantine/, wo sie weder
+// heruntergeladen noch extrahiert wird.
+func quarantineFile(f storedFile, signature string) error {
+	ctx := context.Background()
+	key := quarantineKeyPrefix + strings.TrimPrefix(f.Key, "documents/")
+	if err := copyStorageObject(ctx, store, store, f.Key, key); err != nil {
+		store.Delete(ctx, f.Key)
+		log.Printf("Befallene Datei %q (%s) nicht in Quarantäne verschoben, gelöscht: %v", f.Filename, signature, err)
+	} else {
+		store.Delete(ctx, f.Key)
+		f.Key = key
+	}
+	return &infectedError{file: f, signature: signature}
+}
+
+// recordQuarantine vermerkt eine befallene Datei für die Admin-Übersicht.
+func recordQuarantine(db *DB, e *infectedError, contractID, documentID, userID int) {
+	_, err := db.Exec(`INSERT INTO quarantined_uploads
+		(contract_id, document_id, filename, storage_key, file_size, mime_type, sha256, signature, uploaded_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		nullableID(contractID), nullableID(documentID), e.file.Filename, e.file.Key, e.file.Size,
+		e.file.MimeType, e.file.SHA256, e.signature, userID)
+	if err != nil {
+		log.Printf("Quarantäne für %q nicht gespeichert: %v", e.file.Filename, err)
+	}
+	log.Printf("Upload %q von Benutzer %d abgewiesen: %s", e.file.Filename, userID, e.signature)
+}
+
+func nullableID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// quarantine listet die abgewiesenen Uploads in Quarantäne, neueste zuerst.
+func (h *documentHandlers) quarantine(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.db.Query(`SELECT q.id, q.contract_id, q.document_id, q.filename, q.storage_key, q.file_size,
+		q.mime_type, q.sha256, q.signature, q.uploaded_by, u.username, q.created_at
+		FROM quarantined_uploads q LEFT JOIN users u ON u.id = q.uploaded_by ORDER BY q.id DESC`)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	uploads := []QuarantinedUpload{}
+	for rows.Next() {
+		var q QuarantinedUpload
+		if err := rows.Scan(&q.ID, &q.ContractID, &q.DocumentID, &q.Filename, &q.StorageKey, &q.FileSize,
+			&q.MimeType, &q.SHA256, &q.Signature, &q.UploadedBy, &q.UploadedByName, &q.CreatedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		uploads = append(uploads, q)
+	}
+
+	json.NewEncoder(w).Encode(uploads)
+}
+
+// deleteQuarantine löscht eine Datei aus der Quarantäne endgültig.
+func (h *documentHandlers) deleteQuarantine(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var key string
+	if err := h.db.QueryRow("SELECT storage_key FROM quarantined_uploads WHERE id = ?", id).Scan(&key); err != nil {
+		http.Error(w, "Eintrag nicht gefunden", http.StatusNotFound)
+		return
+	}
+	if err := store.Delete(r.Context(), key); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.db.Exec("DELETE FROM quarantined_uploads WHERE id = ?", id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
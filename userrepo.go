@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// errInvalidCredentials meldet einen unbekannten Benutzer oder ein falsches Passwort;
+// beide Fälle sind bewusst nicht unterscheidbar.
+var errInvalidCredentials = errors.New("Invalid credentials")
+
+// UserRepository verwaltet Benutzer. Passwörter werden nur als bcrypt-Hash gespeichert.
+type UserRepository struct {
+	s *Repositories
+}
+
+// UserInput sind die änderbaren Felder eines Benutzers. Ein leeres Passwort lässt das
+// bisherige bei Update unverändert.
+type UserInput struct {
+	Username string
+	Password string
+	Role     string
+}
+
+func (in *UserInput) validate(create bool) error {
+	in.Username = strings.TrimSpace(in.Username)
+	if in.Username == "" {
+		return validationError("Benutzername darf nicht leer sein")
+	}
+	if in.Role != "admin" && in.Role != "viewer" {
+		return validationError("unbekannte Rolle: %s", in.Role)
+	}
+	if create && in.Password == "" {
+		return validationError("das Passwort darf nicht leer sein")
+	}
+	return nil
+}
+
+// List liefert alle Benutzer ohne Passwort.
+func (r *UserRepository) List(ctx context.Context) ([]User, error) {
+	rows, err := r.s.q.QueryContext(ctx, "SELECT id, username, role FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Username, &user.Role); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// Get liest einen Benutzer ohne Passwort.
+func (r *UserRepository) Get(ctx context.Context, id int) (*User, error) {
+	var user User
+	err := r.s.q.QueryRowContext(ctx, "SELECT id, username, role FROM users WHERE id = ?", id).
+		Scan(&user.ID, &user.Username, &user.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFoundError("Benutzer nicht gefunden")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetByUsername liest einen Benutzer anhand des Namens ohne Passwort.
+func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*User, error) {
+	var user User
+	err := r.s.q.QueryRowContext(ctx, "SELECT id, username, role FROM users WHERE username = ?", username).
+		Scan(&user.ID, &user.Username, &user.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFoundError("Benutzer %s existiert nicht", username)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// FirstAdmin liefert den Admin mit der kleinsten ID.
+func (r *UserRepository) FirstAdmin(ctx context.Context) (*User, error) {
+	var user User
+	err := r.s.q.QueryRowContext(ctx, "SELECT id, username, role FROM users WHERE role = 'admin' ORDER BY id LIMIT 1").
+		Scan(&user.ID, &user.Username, &user.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFoundError("kein Admin vorhanden")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Authenticate prüft Benutzername und Passwort und liefert den Benutzer.
+func (r *UserRepository) Authenticate(ctx context.Context, username, password string) (*User, error) {
+	var user User
+	var hash string
+	err := r.s.q.QueryRowContext(ctx, "SELECT id, username, password, role FROM users WHERE username = ?", username).
+		Scan(&user.ID, &user.Username, &hash, &user.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return nil, errInvalidCredentials
+	}
+	return &user, nil
+}
+
+// Create legt einen Benutzer an.
+func (r *UserRepository) Create(ctx context.Context, in UserInput) (*User, error) {
+	if err := in.validate(true); err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(in.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	var user *User
+	err = r.s.Transaction(ctx, func(tx *Repositories) error {
+		if err := tx.Users.checkUsername(ctx, in.Username, 0); err != nil {
+			return err
+		}
+		id, err := tx.q.InsertContext(ctx, "INSERT INTO users (username, password, role) VALUES (?, ?, ?)",
+			in.Username, string(hashedPassword), in.Role)
+		if err != nil {
+			return err
+		}
+		user = &User{ID: int(id), Username: in.Username, Role: in.Role}
+		return nil
+	})
+	return user, err
+}
+
+// checkUsername meldet einen Konflikt, wenn ein anderer Benutzer als exceptID den
+// Namen bereits verwendet.
+func (r *UserRepository) checkUsername(ctx context.Context, username string, exceptID int) error {
+	n, err := r.s.count(ctx, "SELECT COUNT(*) FROM users WHERE username = ? AND id != ?", username, exceptID)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return conflictError("Benutzer %s existiert bereits", username)
+	}
+	return nil
+}
+
+// Update ändert Name, Rolle und, falls angegeben, das Passwort eines Benutzers. Der
+// letzte Admin kann nicht herabgestuft werden.
+func (r *UserRepository) Update(ctx context.Context, id int, in UserInput) (*User, error) {
+	if err := in.validate(false); err != nil {
+		return nil, err
+	}
+	var hashedPassword []byte
+	if in.Password != "" {
+		var err error
+		if hashedPassword, err = bcrypt.GenerateFromPassword([]byte(in.Password), bcrypt.DefaultCost); err != nil {
+			return nil, err
+		}
+	}
+
+	var user *User
+	err := r.s.Transaction(ctx, func(tx *Repositories) error {
+		if _, err := tx.Users.Get(ctx, id); err != nil {
+			return err
+		}
+		if in.Role != "admin" {
+			admins, err := tx.count(ctx, "SELECT COUNT(*) FROM users WHERE role = 'admin' AND id != ?", id)
+			if err != nil {
+				return err
+			}
+			if admins == 0 {
+				return validationError("Der letzte Admin kann nicht herabgestuft werden")
+			}
+		}
+		if err := tx.Users.checkUsername(ctx, in.Username, id); err != nil {
+			return err
+		}
+
+		var err error
+		if hashedPassword != nil {
+			_, err = tx.q.ExecContext(ctx, "UPDATE users SET username = ?, password = ?, role = ? WHERE id = ?",
+				in.Username, string(hashedPassword), in.Role, id)
+		} else {
+			_, err = tx.q.ExecContext(ctx, "UPDATE users SET username = ?, role = ? WHERE id = ?",
+				in.Username, in.Role, id)
+		}
+		if err != nil {
+			return err
+		}
+		user, err = tx.Users.Get(ctx, id)
+		return err
+	})
+	return user, err
+}
+
+// SetPassword setzt das Passwort eines Benutzers neu.
+func (r *UserRepository) SetPassword(ctx context.Context, username, password string) error {
+	if password == "" {
+		return validationError("das Passwort darf nicht leer sein")
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	result, err := r.s.q.ExecContext(ctx, "UPDATE users SET password = ? WHERE username = ?", string(hashedPassword), username)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return notFoundError("Benutzer %s existiert nicht", username)
+	}
+	return nil
+}
+
+// Delete löscht einen Benutzer mit seinen persönlichen Suchen, Freigaben, Dashboards
+// und Abonnements. Verträge, Dokumente und Protokolle bleiben erhalten, ihre Verweise
+// auf den Benutzer werden NULL. actingUserID ist der löschende Benutzer; weder er
+// selbst noch der letzte Admin können gelöscht werden.
+func (r *UserRepository) Delete(ctx context.Context, id, actingUserID int) error {
+	if id == actingUserID {
+		return validationError("Sie können Ihren eigenen Account nicht löschen")
+	}
+	return r.s.Transaction(ctx, func(tx *Repositories) error {
+		user, err := tx.Users.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if user.Role == "admin" {
+			admins, err := tx.count(ctx, "SELECT COUNT(*) FROM users WHERE role = 'admin'")
+			if err != nil {
+				return err
+			}
+			if admins <= 1 {
+				return validationError("Der letzte Admin kann nicht gelöscht werden")
+			}
+		}
+
+		for _, stmt := range []struct {
+			query string
+			args  []interface{}
+		}{
+			{"DELETE FROM saved_search_shares WHERE user_id = ? OR saved_search_id IN (SELECT id FROM saved_searches WHERE user_id = ?)", []interface{}{id, id}},
+			{"DELETE FROM saved_searches WHERE user_id = ?", []interface{}{id}},
+			{"DELETE FROM dashboard_widgets WHERE user_id = ?", []interface{}{id}},
+			{"DELETE FROM report_runs WHERE subscription_id IN (SELECT id FROM report_subscriptions WHERE user_id = ?)", []interface{}{id}},
+			{"DELETE FROM report_subscriptions WHERE user_id = ?", []interface{}{id}},
+			// Unter PostgreSQL erledigt das ON DELETE SET NULL, SQLite kann die
+			// Fremdschlüssel bestehender Spalten nicht mehr ändern
+			{"UPDATE contracts SET owner_id = NULL WHERE owner_id = ?", []interface{}{id}},
+			{"UPDATE contracts SET deleted_by = NULL WHERE deleted_by = ?", []interface{}{id}},
+			{"UPDATE categories SET deleted_by = NULL WHERE deleted_by = ?", []interface{}{id}},
+			{"UPDATE documents SET uploaded_by = NULL WHERE uploaded_by = ?", []interface{}{id}},
+			{"UPDATE documents SET deleted_by = NULL WHERE deleted_by = ?", []interface{}{id}},
+			{"UPDATE document_versions SET uploaded_by = NULL WHERE uploaded_by = ?", []interface{}{id}},
+			{"UPDATE quarantined_uploads SET uploaded_by = NULL WHERE uploaded_by = ?", []interface{}{id}},
+			{"UPDATE retention_candidates SET decided_by = NULL WHERE decided_by = ?", []interface{}{id}},
+			{"UPDATE audit_log SET user_id = NULL WHERE user_id = ?", []interface{}{id}},
+			{"DELETE FROM users WHERE id = ?", []interface{}{id}},
+		} {
+			if _, err := tx.q.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,684 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ereignisse, die an Webhooks gesendet werden
+const (
+	eventContractCreated     = "contract.created"
+	eventContractUpdated     = "contract.updated"
+	eventContractTerminated  = "contract.terminated"
+	eventDeadlineApproaching = "contract.deadline_approaching" // Kündigungsvornahme liegt im Vorlauf des Webhooks
+	eventPing                = "ping"                          // Testereignis, nur über POST /webhooks/{id}/test
+)
+
+var webhookEvents = map[string]bool{
+	eventContractCreated: true, eventContractUpdated: true,
+	eventContractTerminated: true, eventDeadlineApproaching: true,
+}
+
+// Status einer Webhook-Zustellung
+const (
+	webhookPending   = "pending"
+	webhookRetrying  = "retrying"
+	webhookDelivered = "delivered"
+	webhookFailed    = "failed"
+)
+
+// webhookRetryDelays sind die Wartezeiten vor den Wiederholungen einer Zustellung.
+var webhookRetryDelays = []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour, 6 * time.Hour}
+
+const (
+	webhookTimeout        = 10 * time.Second
+	webhookWorkerInterval = 30 * time.Second
+	deadlineCheckInterval = time.Hour
+	defaultDeadlineDays   = 90
+	maxDeliveryHistory    = 500
+	maxStoredResponseBody = 1024
+)
+
+// webhookWake weckt den Zustell-Worker, wenn neue Ereignisse anstehen.
+var webhookWake = make(chan struct{}, 1)
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// Webhook ist ein Empfänger für Vertragsereignisse.
+type Webhook struct {
+	ID           int       `json:"id"`
+	Name         string    `json:"name"`
+	URL          string    `json:"url"`
+	Secret       string    `json:"secret"`        // Schlüssel für die HMAC-Signatur, wird ohne Angabe erzeugt
+	Events       []string  `json:"events"`        // leer = alle Ereignisse
+	Categories   []string  `json:"categories"`    // leer = alle Kategorien
+	DeadlineDays int       `json:"deadline_days"` // Vorlauf für contract.deadline_approaching, Standard 90
+	Enabled      bool      `json:"enabled"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery ist die Zustellung eines Ereignisses an einen Webhook.
+type WebhookDelivery struct {
+	ID            int             `json:"id"`
+	WebhookID     int             `json:"webhook_id"`
+	EventID       string          `json:"event_id"`
+	Event         string          `json:"event"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"` // pending, retrying, delivered, failed
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt *time.Time      `json:"next_attempt_at"`
+	ResponseCode  *int            `json:"response_code"`
+	ResponseBody  *string         `json:"response_body"`
+	Error         *string         `json:"error"`
+	DurationMs    *int            `json:"duration_ms"`
+	CreatedAt     time.Time       `json:"created_at"`
+	DeliveredAt   *time.Time      `json:"delivered_at"`
+}
+
+// webhookEvent ist der JSON-Body einer Zustellung.
+type webhookEvent struct {
+	ID         string      `json:"id"`
+	Event      string      `json:"event"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+// contractEventData ist der Inhalt der Vertragsereignisse.
+type contractEventData struct {
+	Contract        Contract  `json:"contract"`
+	Previous        *Contract `json:"previous,omitempty"`          // contract.updated: Stand vor der Änderung
+	ChangedFields   []string  `json:"changed_fields,omitempty"`    // contract.updated
+	DaysUntilAction *int      `json:"days_until_action,omitempty"` // contract.deadline_approaching
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// subscribes prüft, ob der Webhook das Ereignis für einen Vertrag der Kategorie erhält.
+func (wh Webhook) subscribes(event, category string) bool {
+	if !wh.Enabled {
+		return false
+	}
+	if len(wh.Events) > 0 && !containsString(wh.Events, event) {
+		return false
+	}
+	return len(wh.Categories) == 0 || containsString(wh.Categories, category)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// validate prüft URL, Ereignisse und Vorlauf und ergänzt fehlende Standardwerte.
+func (wh *Webhook) validate() error {
+	wh.Name = strings.TrimSpace(wh.Name)
+	if wh.Name == "" {
+		return fmt.Errorf("Name des Webhooks darf nicht leer sein")
+	}
+	u, err := url.Parse(wh.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("ungültige URL: %s", wh.URL)
+	}
+	for _, event := range wh.Events {
+		if !webhookEvents[event] {
+			return fmt.Errorf("unbekanntes Ereignis: %s", event)
+		}
+	}
+	if wh.DeadlineDays < 0 {
+		return fmt.Errorf("ungültiger Wert für deadline_days: %d", wh.DeadlineDays)
+	}
+	if wh.DeadlineDays == 0 {
+		wh.DeadlineDays = defaultDeadlineDays
+	}
+	if wh.Secret == "" {
+		wh.Secret = "whsec_" + randomHex(24)
+	}
+	if wh.Events == nil {
+		wh.Events = []string{}
+	}
+	if wh.Categories == nil {
+		wh.Categories = []string{}
+	}
+	return nil
+}
+
+const webhookColumns = "id, name, url, secret, events, categories, deadline_days, enabled, created_at, updated_at"
+
+func scanWebhook(row interface{ Scan(...interface{}) error }) (Webhook, error) {
+	var wh Webhook
+	var events, categories string
+	err := row.Scan(&wh.ID, &wh.Name, &wh.URL, &wh.Secret, &events, &categories, &wh.DeadlineDays, &wh.Enabled,
+		&wh.CreatedAt, &wh.UpdatedAt)
+	if err != nil {
+		return wh, err
+	}
+	wh.Events, wh.Categories = []string{}, []string{}
+	json.Unmarshal([]byte(events), &wh.Events)
+	json.Unmarshal([]byte(categories), &wh.Categories)
+	return wh, nil
+}
+
+func loadWebhooks(db *DB, where string, args ...interface{}) ([]Webhook, error) {
+	rows, err := db.Query("SELECT "+webhookColumns+" FROM webhooks WHERE "+where+" ORDER BY name, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	webhooks := []Webhook{}
+	for rows.Next() {
+		wh, err := scanWebhook(rows)
+		if err != nil {
+			continue
+		}
+		webhooks = append(webhooks, wh)
+	}
+	return webhooks, rows.Err()
+}
+
+// changedFields liefert die JSON-Felder, in denen sich zwei Vertragsstände unterscheiden.
+func changedFields(previous, current Contract) []string {
+	var before, after map[string]interface{}
+	b, _ := json.Marshal(previous)
+	json.Unmarshal(b, &before)
+	a, _ := json.Marshal(current)
+	json.Unmarshal(a, &after)
+
+	fields := []string{}
+	for k, v := range after {
+		if !reflect.DeepEqual(before[k], v) {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// emitContractEvent legt für alle passenden Webhooks eine Zustellung an. Fehler
+// werden nur protokolliert, damit die auslösende Änderung nicht scheitert.
+func emitContractEvent(db *DB, event string, contract Contract, previous *Contract) {
+	data := contractEventData{Contract: contract, Previous: previous}
+	if previous != nil {
+		data.ChangedFields = changedFields(*previous, contract)
+		if len(data.ChangedFields) == 0 {
+			return
+		}
+	}
+
+	webhooks, err := loadWebhooks(db, "enabled = TRUE")
+	if err != nil {
+		log.Printf("Ereignis %s für Vertrag %d nicht verteilt: %v", event, contract.ID, err)
+		return
+	}
+	queued := false
+	for _, wh := range webhooks {
+		if !wh.subscribes(event, contract.Category) {
+			continue
+		}
+		if _, err := queueWebhookDelivery(db, wh.ID, event, data); err != nil {
+			log.Printf("Ereignis %s für Webhook %d nicht gespeichert: %v", event, wh.ID, err)
+			continue
+		}
+		queued = true
+	}
+	if queued {
+		wakeWebhookWorker()
+	}
+}
+
+// queueWebhookDelivery speichert ein Ereignis als ausstehende Zustellung.
+func queueWebhookDelivery(q querier, webhookID int, event string, data interface{}) (int64, error) {
+	now := time.Now()
+	payload, err := json.Marshal(webhookEvent{ID: "evt_" + randomHex(12), Event: event, OccurredAt: now, Data: data})
+	if err != nil {
+		return 0, err
+	}
+	var evt webhookEvent
+	json.Unmarshal(payload, &evt)
+	return q.Insert(`INSERT INTO webhook_deliveries (webhook_id, event_id, event, payload, status, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, webhookID, evt.ID, event, string(payload), webhookPending, now, now)
+}
+
+func wakeWebhookWorker() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// runWebhookWorker stellt ausstehende Ereignisse zu. Zustellungen stehen in der
+// Datenbank und werden nach einem Neustart fortgesetzt.
+func runWebhookWorker(db *DB) {
+	wakeWebhookWorker()
+	ticker := time.NewTicker(webhookWorkerInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-webhookWake:
+		}
+		processDueDeliveries(db)
+	}
+}
+
+const deliveryColumns = "id, webhook_id, event_id, event, payload, status, attempts, next_attempt_at, response_code, response_body, error, duration_ms, created_at, delivered_at"
+
+func scanDelivery(row interface{ Scan(...interface{}) error }) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	var payload string
+	err := row.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.Event, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&d.ResponseCode, &d.ResponseBody, &d.Error, &d.DurationMs, &d.CreatedAt, &d.DeliveredAt)
+	d.Payload = json.RawMessage(payload)
+	return d, err
+}
+
+func processDueDeliveries(db *DB) {
+	rows, err := db.Query(`SELECT `+deliveryColumns+` FROM webhook_deliveries
+		WHERE status IN (?, ?) AND webhook_id IN (SELECT id FROM webhooks WHERE enabled = TRUE) ORDER BY id`,
+		webhookPending, webhookRetrying)
+	if err != nil {
+		log.Printf("Webhook-Zustellungen nicht lesbar: %v", err)
+		return
+	}
+	var due []WebhookDelivery
+	now := time.Now()
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			continue
+		}
+		if d.NextAttemptAt == nil || !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	rows.Close()
+
+	webhooks := map[int]Webhook{}
+	for _, d := range due {
+		wh, ok := webhooks[d.WebhookID]
+		if !ok {
+			wh, err = scanWebhook(db.QueryRow("SELECT "+webhookColumns+" FROM webhooks WHERE id = ?", d.WebhookID))
+			if err != nil {
+				continue
+			}
+			webhooks[d.WebhookID] = wh
+		}
+		attemptDelivery(db, wh, &d, true)
+	}
+}
+
+// signWebhook berechnet die Signatur über Zeitstempel und Body.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// attemptDelivery sendet eine Zustellung einmal und speichert das Ergebnis. Mit retry
+// wird eine fehlgeschlagene Zustellung nach webhookRetryDelays erneut versucht.
+func attemptDelivery(db *DB, wh Webhook, d *WebhookDelivery, retry bool) {
+	d.Attempts++
+	start := time.Now()
+	code, body, err := postWebhook(wh, d)
+	duration := int(time.Since(start).Milliseconds())
+	d.DurationMs = &duration
+	d.ResponseCode, d.ResponseBody, d.Error = nil, nil, nil
+	if code != 0 {
+		d.ResponseCode = &code
+		d.ResponseBody = &body
+	}
+	if err == nil && (code < 200 || code > 299) {
+		err = fmt.Errorf("Antwort %d", code)
+	}
+
+	now := time.Now()
+	switch {
+	case err == nil:
+		d.Status = webhookDelivered
+		d.NextAttemptAt = nil
+		d.DeliveredAt = &now
+	case retry && d.Attempts <= len(webhookRetryDelays):
+		msg := err.Error()
+		next := now.Add(webhookRetryDelays[d.Attempts-1])
+		d.Status, d.Error, d.NextAttemptAt = webhookRetrying, &msg, &next
+	default:
+		msg := err.Error()
+		d.Status, d.Error, d.NextAttemptAt = webhookFailed, &msg, nil
+		log.Printf("Webhook %d: Zustellung %d (%s) fehlgeschlagen: %v", wh.ID, d.ID, d.Event, err)
+	}
+
+	_, err = db.Exec(`UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt_at = ?, response_code = ?,
+		response_body = ?, error = ?, duration_ms = ?, delivered_at = ? WHERE id = ?`,
+		d.Status, d.Attempts, d.NextAttemptAt, d.ResponseCode, d.ResponseBody, d.Error, d.DurationMs, d.DeliveredAt, d.ID)
+	if err != nil {
+		log.Printf("Webhook-Zustellung %d nicht gespeichert: %v", d.ID, err)
+	}
+
+	db.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id = ? AND status IN (?, ?)
+		AND id NOT IN (SELECT id FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT ?)`,
+		wh.ID, webhookDelivered, webhookFailed, wh.ID, maxDeliveryHistory)
+}
+
+// postWebhook sendet den Payload signiert an die URL des Webhooks.
+func postWebhook(wh Webhook, d *WebhookDelivery) (int, string, error) {
+	req, err := http.NewRequest(http.MethodPost, wh.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "vertragsdb-webhook/1")
+	req.Header.Set("X-Vertragsdb-Event", d.Event)
+	req.Header.Set("X-Vertragsdb-Delivery", strconv.Itoa(d.ID))
+	req.Header.Set("X-Vertragsdb-Timestamp", timestamp)
+	req.Header.Set("X-Vertragsdb-Signature", signWebhook(wh.Secret, timestamp, d.Payload))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxStoredResponseBody))
+	return resp.StatusCode, strings.ToValidUTF8(string(body), ""), nil
+}
+
+// runDeadlineScheduler prüft stündlich, ob Kündigungsvornahmen in den Vorlauf
+// eines Webhooks rücken, und sendet dafür contract.deadline_approaching.
+func runDeadlineScheduler(repos *Repositories) {
+	ticker := time.NewTicker(deadlineCheckInterval)
+	defer ticker.Stop()
+	for {
+		checkDeadlines(repos)
+		<-ticker.C
+	}
+}
+
+// checkDeadlines legt je Webhook, Vertrag und Kündigungsvornahme genau ein Ereignis an.
+// Verschiebt sich die Kündigungsvornahme, wird erneut benachrichtigt.
+func checkDeadlines(repos *Repositories) {
+	webhooks, err := loadWebhooks(repos.db, "enabled = TRUE")
+	if err != nil {
+		log.Printf("Fristenprüfung für Webhooks fehlgeschlagen: %v", err)
+		return
+	}
+	now := time.Now()
+	queued := false
+	for _, wh := range webhooks {
+		if len(wh.Events) > 0 && !containsString(wh.Events, eventDeadlineApproaching) {
+			continue
+		}
+		where := `is_terminated = FALSE
+			AND cancellation_action_date IS NOT NULL
+			AND cancellation_action_date BETWEEN CURRENT_DATE AND ` + repos.dialect.DateInDays() + `
+			AND NOT EXISTS (SELECT 1 FROM webhook_deadline_notices n WHERE n.webhook_id = ?
+				AND n.contract_id = contracts.id AND n.action_date = ` + repos.dialect.DateString("contracts.cancellation_action_date") + `)`
+		contracts, _, err := repos.Contracts.List(context.Background(), where, []interface{}{wh.DeadlineDays, wh.ID},
+			listOptions{Limit: -1, Sort: []string{"cancellation_action_date ASC", "id ASC"}})
+		if err != nil {
+			log.Printf("Fristenprüfung für Webhook %d fehlgeschlagen: %v", wh.ID, err)
+			continue
+		}
+
+		for _, c := range contracts {
+			if !wh.subscribes(eventDeadlineApproaching, c.Category) {
+				continue
+			}
+			days := daysBetween(now, *c.CancellationActionDate)
+			tx, err := repos.db.Begin()
+			if err != nil {
+				log.Printf("Fristenprüfung für Webhook %d fehlgeschlagen: %v", wh.ID, err)
+				break
+			}
+			_, err = tx.Exec("INSERT INTO webhook_deadline_notices (webhook_id, contract_id, action_date) VALUES (?, ?, ?)",
+				wh.ID, c.ID, c.CancellationActionDate.Format("2006-01-02"))
+			if err == nil {
+				_, err = queueWebhookDelivery(tx, wh.ID, eventDeadlineApproaching, contractEventData{Contract: c, DaysUntilAction: &days})
+			}
+			if err == nil {
+				err = tx.Commit()
+			}
+			if err != nil {
+				tx.Rollback()
+				log.Printf("Fristereignis für Vertrag %d an Webhook %d nicht gespeichert: %v", c.ID, wh.ID, err)
+				continue
+			}
+			queued = true
+		}
+	}
+	if queued {
+		wakeWebhookWorker()
+	}
+}
+
+// webhookHandlers bedient die Webhook-Verwaltung und das Zustellprotokoll.
+type webhookHandlers struct {
+	db *DB
+}
+
+func (h *webhookHandlers) list(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := loadWebhooks(h.db, "1=1")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(webhooks)
+}
+
+func findWebhook(db *DB, id string) (Webhook, error) {
+	return scanWebhook(db.QueryRow("SELECT "+webhookColumns+" FROM webhooks WHERE id = ?", id))
+}
+
+func (h *webhookHandlers) get(w http.ResponseWriter, r *http.Request) {
+	wh, err := findWebhook(h.db, r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Webhook nicht gefunden", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(wh)
+}
+
+func (h *webhookHandlers) create(w http.ResponseWriter, r *http.Request) {
+	wh := Webhook{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&wh); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := wh.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	events, _ := json.Marshal(wh.Events)
+	categories, _ := json.Marshal(wh.Categories)
+	wh.CreatedAt = time.Now()
+	wh.UpdatedAt = wh.CreatedAt
+
+	id, err := h.db.Insert(`INSERT INTO webhooks (name, url, secret, events, categories, deadline_days, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		wh.Name, wh.URL, wh.Secret, string(events), string(categories), wh.DeadlineDays, wh.Enabled, wh.CreatedAt, wh.UpdatedAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	wh.ID = int(id)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(wh)
+}
+
+// update ersetzt einen Webhook. Ohne secret bleibt der bisherige Schlüssel erhalten.
+func (h *webhookHandlers) update(w http.ResponseWriter, r *http.Request) {
+	existing, err := findWebhook(h.db, r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Webhook nicht gefunden", http.StatusNotFound)
+		return
+	}
+
+	wh := Webhook{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&wh); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	wh.ID = existing.ID
+	wh.CreatedAt = existing.CreatedAt
+	if wh.Secret == "" {
+		wh.Secret = existing.Secret
+	}
+	if err := wh.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	events, _ := json.Marshal(wh.Events)
+	categories, _ := json.Marshal(wh.Categories)
+	wh.UpdatedAt = time.Now()
+
+	_, err = h.db.Exec(`UPDATE webhooks SET name = ?, url = ?, secret = ?, events = ?, categories = ?, deadline_days = ?,
+		enabled = ?, updated_at = ? WHERE id = ?`,
+		wh.Name, wh.URL, wh.Secret, string(events), string(categories), wh.DeadlineDays, wh.Enabled, wh.UpdatedAt, wh.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	wakeWebhookWorker()
+
+	json.NewEncoder(w).Encode(wh)
+}
+
+func (h *webhookHandlers) delete(w http.ResponseWriter, r *http.Request) {
+	wh, err := findWebhook(h.db, r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Webhook nicht gefunden", http.StatusNotFound)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id = ?", wh.ID)
+	tx.Exec("DELETE FROM webhook_deadline_notices WHERE webhook_id = ?", wh.ID)
+	if _, err := tx.Exec("DELETE FROM webhooks WHERE id = ?", wh.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// test sendet sofort ein ping-Ereignis und liefert das Ergebnis der Zustellung.
+// Testereignisse werden nicht wiederholt, auch wenn der Webhook deaktiviert ist.
+func (h *webhookHandlers) test(w http.ResponseWriter, r *http.Request) {
+	wh, err := findWebhook(h.db, r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Webhook nicht gefunden", http.StatusNotFound)
+		return
+	}
+
+	id, err := queueWebhookDelivery(h.db, wh.ID, eventPing, map[string]interface{}{
+		"webhook_id": wh.ID,
+		"message":    "Testereignis der Vertragsdatenbank",
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	d, err := scanDelivery(h.db.QueryRow("SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE id = ?", id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	attemptDelivery(h.db, wh, &d, false)
+
+	json.NewEncoder(w).Encode(d)
+}
+
+// deliveries liefert das Zustellprotokoll, neueste zuerst. Optional gefiltert
+// nach status und event.
+func (h *webhookHandlers) deliveries(w http.ResponseWriter, r *http.Request) {
+	wh, err := findWebhook(h.db, r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Webhook nicht gefunden", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	where := "webhook_id = ?"
+	args := []interface{}{wh.ID}
+	if status := q.Get("status"); status != "" {
+		where += " AND status = ?"
+		args = append(args, status)
+	}
+	if event := q.Get("event"); event != "" {
+		where += " AND event = ?"
+		args = append(args, event)
+	}
+	limit := 50
+	if l := q.Get("limit"); l != "" {
+		if n, err := strconv.Atoi(l); err == nil && n > 0 && n <= maxDeliveryHistory {
+			limit = n
+		}
+	}
+
+	rows, err := h.db.Query("SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE "+where+" ORDER BY id DESC LIMIT ?",
+		append(args, limit)...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// redeliver stellt eine Zustellung erneut zu, z. B. nach Behebung eines Fehlers beim Empfänger.
+func (h *webhookHandlers) redeliver(w http.ResponseWriter, r *http.Request) {
+	result, err := h.db.Exec(`UPDATE webhook_deliveries SET status = ?, attempts = 0, next_attempt_at = ?
+		WHERE id = ? AND webhook_id = ?`, webhookPending, time.Now(), r.PathValue("deliveryId"), r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Zustellung nicht gefunden", http.StatusNotFound)
+		return
+	}
+	wakeWebhookWorker()
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Zustellung wird wiederholt"})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// webhookRequest ist eine beim Empfänger eingegangene Zustellung.
+type webhookRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func TestWebhooks(t *testing.T) {
+	s := newTestServer(t)
+
+	received := make(chan webhookRequest, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- webhookRequest{r.Header, body}
+	}))
+	defer receiver.Close()
+
+	var wh Webhook
+	s.expect("POST", "/webhooks", s.admin, map[string]interface{}{"name": "Empfänger", "url": receiver.URL,
+		"events": []string{"contract.created"}, "enabled": true}, http.StatusCreated, &wh)
+	if wh.Secret == "" || wh.DeadlineDays != defaultDeadlineDays {
+		t.Errorf("angelegt: %+v", wh)
+	}
+	for name, body := range map[string]map[string]interface{}{
+		"ohne Namen":           {"url": receiver.URL},
+		"ungültige URL":        {"name": "x", "url": "ftp://example.com"},
+		"unbekanntes Ereignis": {"name": "x", "url": receiver.URL, "events": []string{"contract.exploded"}},
+	} {
+		resp := s.do("POST", "/webhooks", s.admin, body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: Status %d statt 400", name, resp.StatusCode)
+		}
+	}
+
+	// Testereignis: wird sofort zugestellt und ist signiert
+	path := fmt.Sprintf("/webhooks/%d", wh.ID)
+	var d WebhookDelivery
+	s.expect("POST", path+"/test", s.admin, nil, http.StatusOK, &d)
+	if d.Status != webhookDelivered || d.Event != eventPing {
+		t.Errorf("Zustellung: %+v", d)
+	}
+	req := <-received
+	if got := req.header.Get("X-Vertragsdb-Event"); got != eventPing {
+		t.Errorf("Ereignis %s", got)
+	}
+	if sig := signWebhook(wh.Secret, req.header.Get("X-Vertragsdb-Timestamp"), req.body); req.header.Get("X-Vertragsdb-Signature") != sig {
+		t.Errorf("Signatur %s, erwartet %s", req.header.Get("X-Vertragsdb-Signature"), sig)
+	}
+
+	// Neue Verträge stehen für den Worker bereit
+	c := s.createContract(nil)
+	var deliveries []WebhookDelivery
+	s.expect("GET", path+"/deliveries?event=contract.created", s.admin, nil, http.StatusOK, &deliveries)
+	if len(deliveries) != 1 {
+		t.Fatalf("Zustellungen: %+v", deliveries)
+	}
+	var event struct {
+		Event string            `json:"event"`
+		Data  contractEventData `json:"data"`
+	}
+	if err := json.Unmarshal(deliveries[0].Payload, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Event != eventContractCreated || event.Data.Contract.ID != c.ID {
+		t.Errorf("Ereignis %s für Vertrag %d, erwartet Vertrag %d", event.Event, event.Data.Contract.ID, c.ID)
+	}
+	s.expect("POST", fmt.Sprintf("%s/deliveries/%d/redeliver", path, deliveries[0].ID), s.admin, nil, http.StatusAccepted, nil)
+	s.expect("POST", path+"/deliveries/999/redeliver", s.admin, nil, http.StatusNotFound, nil)
+
+	wh.Enabled = false
+	s.expect("PUT", path, s.admin, wh, http.StatusOK, &wh)
+	if wh.Enabled {
+		t.Error("Webhook noch aktiv")
+	}
+	s.createContract(nil)
+	s.expect("GET", path+"/deliveries?event=contract.created", s.admin, nil, http.StatusOK, &deliveries)
+	if len(deliveries) != 1 {
+		t.Errorf("Zustellungen an einen deaktivierten Webhook: %d", len(deliveries))
+	}
+
+	s.expect("DELETE", path, s.admin, nil, http.StatusNoContent, nil)
+	s.expect("GET", path, s.admin, nil, http.StatusNotFound, nil)
+}
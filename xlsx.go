@@ -0,0 +1,396 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Zellformate aus xlsxStyles (Index in cellXfs)
+const (
+	xlsxStyleDefault = iota
+	xlsxStyleHeader
+	xlsxStyleDate
+	xlsxStyleDateTime
+	xlsxStyleAmount
+)
+
+// xlsxCell ist eine Zelle für xlsxWriter. Value darf string, int, int64,
+// float64, bool, time.Time oder nil sein.
+type xlsxCell struct {
+	Value interface{}
+	Style int
+}
+
+// xlsxWriter schreibt eine Arbeitsmappe mit einem Tabellenblatt direkt in einen
+// io.Writer. Zeilen werden sofort geschrieben, Texte als Inline-Strings, damit
+// keine gemeinsame String-Tabelle im Speicher gehalten werden muss.
+type xlsxWriter struct {
+	zw    *zip.Writer
+	sheet io.Writer
+	rows  int
+	cols  int
+}
+
+// newXLSXWriter legt die Arbeitsmappe an. widths enthält die Spaltenbreiten in Zeichen.
+func newXLSXWriter(w io.Writer, sheetName string, widths []float64) (*xlsxWriter, error) {
+	x := &xlsxWriter{zw: zip.NewWriter(w), cols: len(widths)}
+	now := time.Now()
+	create := func(name string) (io.Writer, error) {
+		return x.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+	}
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, xlsxEscape(xlsxSheetName(sheetName)))},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, p := range parts {
+		f, err := create(p.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, p.content); err != nil {
+			return nil, err
+		}
+	}
+
+	sheet, err := create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	x.sheet = sheet
+
+	var sb strings.Builder
+	sb.WriteString(xml.Header)
+	sb.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	// Kopfzeile fixieren
+	sb.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	if len(widths) > 0 {
+		sb.WriteString("<cols>")
+		for i, width := range widths {
+			fmt.Fprintf(&sb, `<col min="%d" max="%d" width="%.1f" customWidth="1"/>`, i+1, i+1, width)
+		}
+		sb.WriteString("</cols>")
+	}
+	sb.WriteString("<sheetData>")
+	if _, err := io.WriteString(x.sheet, sb.String()); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// WriteRow schreibt die nächste Zeile.
+func (x *xlsxWriter) WriteRow(cells []xlsxCell) error {
+	x.rows++
+	if len(cells) > x.cols {
+		x.cols = len(cells)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<row r="%d">`, x.rows)
+	for i, cell := range cells {
+		ref := xlsxColumnName(i) + strconv.Itoa(x.rows)
+		style := ""
+		if cell.Style != xlsxStyleDefault {
+			style = fmt.Sprintf(` s="%d"`, cell.Style)
+		}
+
+		switch v := cell.Value.(type) {
+		case nil:
+			if style != "" {
+				fmt.Fprintf(&sb, `<c r="%s"%s/>`, ref, style)
+			}
+		case string:
+			fmt.Fprintf(&sb, `<c r="%s"%s t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, style, xlsxEscape(v))
+		case int:
+			fmt.Fprintf(&sb, `<c r="%s"%s><v>%d</v></c>`, ref, style, v)
+		case int64:
+			fmt.Fprintf(&sb, `<c r="%s"%s><v>%d</v></c>`, ref, style, v)
+		case float64:
+			fmt.Fprintf(&sb, `<c r="%s"%s><v>%s</v></c>`, ref, style, strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			b := 0
+			if v {
+				b = 1
+			}
+			fmt.Fprintf(&sb, `<c r="%s"%s t="b"><v>%d</v></c>`, ref, style, b)
+		case time.Time:
+			fmt.Fprintf(&sb, `<c r="%s"%s><v>%s</v></c>`, ref, style, strconv.FormatFloat(xlsxSerial(v), 'f', -1, 64))
+		default:
+			return fmt.Errorf("xlsx: nicht unterstützter Zellwert %T", v)
+		}
+	}
+	sb.WriteString("</row>")
+
+	_, err := io.WriteString(x.sheet, sb.String())
+	return err
+}
+
+// Close schließt das Tabellenblatt (inklusive Autofilter) und das ZIP-Archiv ab.
+func (x *xlsxWriter) Close() error {
+	end := "</sheetData>"
+	if x.rows > 0 && x.cols > 0 {
+		end += fmt.Sprintf(`<autoFilter ref="A1:%s%d"/>`, xlsxColumnName(x.cols-1), x.rows)
+	}
+	end += "</worksheet>"
+	if _, err := io.WriteString(x.sheet, end); err != nil {
+		return err
+	}
+	return x.zw.Close()
+}
+
+// xlsxColumnName wandelt einen nullbasierten Spaltenindex in A, B, …, Z, AA, … um.
+func xlsxColumnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// xlsxSerial liefert die Excel-Seriennummer (Tage seit 30.12.1899) eines Zeitpunkts.
+// Die Wanduhrzeit wird übernommen, Excel kennt keine Zeitzonen.
+func xlsxSerial(t time.Time) float64 {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	days := wall.Sub(epoch).Hours() / 24
+	return math.Round(days*86400) / 86400
+}
+
+// xlsxSheetName entfernt in Blattnamen unzulässige Zeichen und kürzt auf 31 Zeichen.
+func xlsxSheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if utf8.RuneCountInString(name) > 31 {
+		name = string([]rune(name)[:31])
+	}
+	if name == "" {
+		name = "Tabelle1"
+	}
+	return name
+}
+
+// xlsxEscape maskiert XML-Sonderzeichen und entfernt in XML unzulässige Steuerzeichen.
+func xlsxEscape(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		return r
+	}, s)
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
+
+const xlsxContentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+	`</Types>`
+
+const xlsxRootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const xlsxWorkbook = xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>` +
+	`</workbook>`
+
+const xlsxWorkbookRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+	`</Relationships>`
+
+// xlsxStyles definiert die Formate in der Reihenfolge der xlsxStyle-Konstanten.
+const xlsxStyles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="3">` +
+	`<numFmt numFmtId="164" formatCode="dd\.mm\.yyyy"/>` +
+	`<numFmt numFmtId="165" formatCode="dd\.mm\.yyyy\ hh:mm"/>` +
+	`<numFmt numFmtId="166" formatCode="#,##0.00\ &quot;€&quot;"/>` +
+	`</numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="5">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="166" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Standard" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
+
+// readXLSX liest das erste Tabellenblatt einer Arbeitsmappe als Textzeilen.
+// Zahlen (auch Datumswerte) werden unformatiert als Dezimalzahl geliefert.
+func readXLSX(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	decode := func(name string, v interface{}) error {
+		f, ok := files[name]
+		if !ok {
+			return fmt.Errorf("xlsx: %s fehlt", name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		return xml.NewDecoder(io.LimitReader(rc, 256<<20)).Decode(v)
+	}
+
+	// Pfad des ersten Tabellenblatts über workbook.xml und dessen Beziehungen ermitteln
+	var workbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decode("xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, fmt.Errorf("xlsx: keine Tabellenblätter vorhanden")
+	}
+	var rels struct {
+		Rels []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decode("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	sheetPath := ""
+	for _, rel := range rels.Rels {
+		if rel.ID == workbook.Sheets[0].ID {
+			sheetPath = strings.TrimPrefix(rel.Target, "/")
+			if !strings.HasPrefix(sheetPath, "xl/") {
+				sheetPath = "xl/" + sheetPath
+			}
+		}
+	}
+
+	type richText struct {
+		T    string `xml:"t"`
+		Runs []struct {
+			T string `xml:"t"`
+		} `xml:"r"`
+	}
+	text := func(rt richText) string {
+		if len(rt.Runs) == 0 {
+			return rt.T
+		}
+		var sb strings.Builder
+		for _, r := range rt.Runs {
+			sb.WriteString(r.T)
+		}
+		return sb.String()
+	}
+
+	var shared []string
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		var sst struct {
+			Items []richText `xml:"si"`
+		}
+		if err := decode("xl/sharedStrings.xml", &sst); err != nil {
+			return nil, err
+		}
+		for _, si := range sst.Items {
+			shared = append(shared, text(si))
+		}
+	}
+
+	var sheet struct {
+		Rows []struct {
+			Num   int `xml:"r,attr"`
+			Cells []struct {
+				Ref    string   `xml:"r,attr"`
+				Type   string   `xml:"t,attr"`
+				Value  string   `xml:"v"`
+				Inline richText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := decode(sheetPath, &sheet); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for _, row := range sheet.Rows {
+		// Leere Zeilen fehlen im Blatt, damit Zeilennummern stimmen, werden sie aufgefüllt
+		for row.Num > 0 && len(rows) < row.Num-1 {
+			rows = append(rows, nil)
+		}
+		var values []string
+		for i, c := range row.Cells {
+			col := i
+			if c.Ref != "" {
+				col = xlsxColumnIndex(c.Ref)
+			}
+			var v string
+			switch c.Type {
+			case "s":
+				n, err := strconv.Atoi(c.Value)
+				if err != nil || n < 0 || n >= len(shared) {
+					return nil, fmt.Errorf("xlsx: ungültiger String-Index in Zelle %s", c.Ref)
+				}
+				v = shared[n]
+			case "inlineStr":
+				v = text(c.Inline)
+			case "b":
+				v = map[string]string{"1": "true", "0": "false"}[c.Value]
+			default:
+				v = c.Value
+			}
+			for len(values) <= col {
+				values = append(values, "")
+			}
+			values[col] = v
+		}
+		rows = append(rows, values)
+	}
+	return rows, nil
+}
+
+// xlsxColumnIndex liefert den nullbasierten Spaltenindex eines Zellbezugs wie "AB12".
+func xlsxColumnIndex(ref string) int {
+	n := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		n = n*26 + int(r-'A'+1)
+	}
+	return n - 1
+}
+
+// xlsxDate wandelt eine Excel-Seriennummer in ein Datum (UTC) um.
+func xlsxDate(serial float64) time.Time {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	return epoch.Add(time.Duration(math.Round(serial*86400)) * time.Second)
+}